@@ -0,0 +1,807 @@
+// Code generated by protoc-gen-go. DO NOT EDIT.
+// versions:
+// 	protoc-gen-go v1.36.11
+// 	protoc        (unknown)
+// source: encz.proto
+
+package api
+
+import (
+	protoreflect "google.golang.org/protobuf/reflect/protoreflect"
+	protoimpl "google.golang.org/protobuf/runtime/protoimpl"
+	timestamppb "google.golang.org/protobuf/types/known/timestamppb"
+	reflect "reflect"
+	sync "sync"
+	unsafe "unsafe"
+)
+
+const (
+	// Verify that this generated code is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(20 - protoimpl.MinVersion)
+	// Verify that runtime/protoimpl is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(protoimpl.MaxVersion - 20)
+)
+
+// Priority orders the queue: high jobs run before normal ones, and normal ones
+// before low ones. Jobs of the same priority run in the order they were queued.
+type Priority int32
+
+const (
+	// PRIORITY_UNSPECIFIED is taken as normal
+	Priority_PRIORITY_UNSPECIFIED Priority = 0
+	Priority_PRIORITY_LOW         Priority = 1
+	Priority_PRIORITY_NORMAL      Priority = 2
+	Priority_PRIORITY_HIGH        Priority = 3
+)
+
+// Enum value maps for Priority.
+var (
+	Priority_name = map[int32]string{
+		0: "PRIORITY_UNSPECIFIED",
+		1: "PRIORITY_LOW",
+		2: "PRIORITY_NORMAL",
+		3: "PRIORITY_HIGH",
+	}
+	Priority_value = map[string]int32{
+		"PRIORITY_UNSPECIFIED": 0,
+		"PRIORITY_LOW":         1,
+		"PRIORITY_NORMAL":      2,
+		"PRIORITY_HIGH":        3,
+	}
+)
+
+func (x Priority) Enum() *Priority {
+	p := new(Priority)
+	*p = x
+	return p
+}
+
+func (x Priority) String() string {
+	return protoimpl.X.EnumStringOf(x.Descriptor(), protoreflect.EnumNumber(x))
+}
+
+func (Priority) Descriptor() protoreflect.EnumDescriptor {
+	return file_encz_proto_enumTypes[0].Descriptor()
+}
+
+func (Priority) Type() protoreflect.EnumType {
+	return &file_encz_proto_enumTypes[0]
+}
+
+func (x Priority) Number() protoreflect.EnumNumber {
+	return protoreflect.EnumNumber(x)
+}
+
+// Deprecated: Use Priority.Descriptor instead.
+func (Priority) EnumDescriptor() ([]byte, []int) {
+	return file_encz_proto_rawDescGZIP(), []int{0}
+}
+
+type Job_State int32
+
+const (
+	Job_STATE_UNSPECIFIED Job_State = 0
+	Job_STATE_QUEUED      Job_State = 1
+	Job_STATE_RUNNING     Job_State = 2
+	Job_STATE_ENCODED     Job_State = 3
+	Job_STATE_SKIPPED     Job_State = 4
+	Job_STATE_FAILED      Job_State = 5
+	Job_STATE_CANCELLED   Job_State = 6
+)
+
+// Enum value maps for Job_State.
+var (
+	Job_State_name = map[int32]string{
+		0: "STATE_UNSPECIFIED",
+		1: "STATE_QUEUED",
+		2: "STATE_RUNNING",
+		3: "STATE_ENCODED",
+		4: "STATE_SKIPPED",
+		5: "STATE_FAILED",
+		6: "STATE_CANCELLED",
+	}
+	Job_State_value = map[string]int32{
+		"STATE_UNSPECIFIED": 0,
+		"STATE_QUEUED":      1,
+		"STATE_RUNNING":     2,
+		"STATE_ENCODED":     3,
+		"STATE_SKIPPED":     4,
+		"STATE_FAILED":      5,
+		"STATE_CANCELLED":   6,
+	}
+)
+
+func (x Job_State) Enum() *Job_State {
+	p := new(Job_State)
+	*p = x
+	return p
+}
+
+func (x Job_State) String() string {
+	return protoimpl.X.EnumStringOf(x.Descriptor(), protoreflect.EnumNumber(x))
+}
+
+func (Job_State) Descriptor() protoreflect.EnumDescriptor {
+	return file_encz_proto_enumTypes[1].Descriptor()
+}
+
+func (Job_State) Type() protoreflect.EnumType {
+	return &file_encz_proto_enumTypes[1]
+}
+
+func (x Job_State) Number() protoreflect.EnumNumber {
+	return protoreflect.EnumNumber(x)
+}
+
+// Deprecated: Use Job_State.Descriptor instead.
+func (Job_State) EnumDescriptor() ([]byte, []int) {
+	return file_encz_proto_rawDescGZIP(), []int{6, 0}
+}
+
+type SubmitRequest struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	// Path is the source on the server, an absolute path or one relative to
+	// its --media-dir
+	Path string `protobuf:"bytes,1,opt,name=path,proto3" json:"path,omitempty"`
+	// OutputDir is where the output is saved, the server's --output-dir or the
+	// folder of the source when empty
+	OutputDir string `protobuf:"bytes,2,opt,name=output_dir,json=outputDir,proto3" json:"output_dir,omitempty"`
+	// Preset names presets of the server's config file to encode with, like
+	// "anime,small"
+	Preset string `protobuf:"bytes,3,opt,name=preset,proto3" json:"preset,omitempty"`
+	// Quality overrides the quality of the video encoder when set
+	Quality *float64 `protobuf:"fixed64,4,opt,name=quality,proto3,oneof" json:"quality,omitempty"`
+	// Force encodes the file even when the history has it already
+	Force         bool     `protobuf:"varint,5,opt,name=force,proto3" json:"force,omitempty"`
+	Priority      Priority `protobuf:"varint,6,opt,name=priority,proto3,enum=encz.v1.Priority" json:"priority,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *SubmitRequest) Reset() {
+	*x = SubmitRequest{}
+	mi := &file_encz_proto_msgTypes[0]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *SubmitRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*SubmitRequest) ProtoMessage() {}
+
+func (x *SubmitRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_encz_proto_msgTypes[0]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use SubmitRequest.ProtoReflect.Descriptor instead.
+func (*SubmitRequest) Descriptor() ([]byte, []int) {
+	return file_encz_proto_rawDescGZIP(), []int{0}
+}
+
+func (x *SubmitRequest) GetPath() string {
+	if x != nil {
+		return x.Path
+	}
+	return ""
+}
+
+func (x *SubmitRequest) GetOutputDir() string {
+	if x != nil {
+		return x.OutputDir
+	}
+	return ""
+}
+
+func (x *SubmitRequest) GetPreset() string {
+	if x != nil {
+		return x.Preset
+	}
+	return ""
+}
+
+func (x *SubmitRequest) GetQuality() float64 {
+	if x != nil && x.Quality != nil {
+		return *x.Quality
+	}
+	return 0
+}
+
+func (x *SubmitRequest) GetForce() bool {
+	if x != nil {
+		return x.Force
+	}
+	return false
+}
+
+func (x *SubmitRequest) GetPriority() Priority {
+	if x != nil {
+		return x.Priority
+	}
+	return Priority_PRIORITY_UNSPECIFIED
+}
+
+type JobRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Id            string                 `protobuf:"bytes,1,opt,name=id,proto3" json:"id,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *JobRequest) Reset() {
+	*x = JobRequest{}
+	mi := &file_encz_proto_msgTypes[1]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *JobRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*JobRequest) ProtoMessage() {}
+
+func (x *JobRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_encz_proto_msgTypes[1]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use JobRequest.ProtoReflect.Descriptor instead.
+func (*JobRequest) Descriptor() ([]byte, []int) {
+	return file_encz_proto_rawDescGZIP(), []int{1}
+}
+
+func (x *JobRequest) GetId() string {
+	if x != nil {
+		return x.Id
+	}
+	return ""
+}
+
+type SetPriorityRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Id            string                 `protobuf:"bytes,1,opt,name=id,proto3" json:"id,omitempty"`
+	Priority      Priority               `protobuf:"varint,2,opt,name=priority,proto3,enum=encz.v1.Priority" json:"priority,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *SetPriorityRequest) Reset() {
+	*x = SetPriorityRequest{}
+	mi := &file_encz_proto_msgTypes[2]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *SetPriorityRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*SetPriorityRequest) ProtoMessage() {}
+
+func (x *SetPriorityRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_encz_proto_msgTypes[2]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use SetPriorityRequest.ProtoReflect.Descriptor instead.
+func (*SetPriorityRequest) Descriptor() ([]byte, []int) {
+	return file_encz_proto_rawDescGZIP(), []int{2}
+}
+
+func (x *SetPriorityRequest) GetId() string {
+	if x != nil {
+		return x.Id
+	}
+	return ""
+}
+
+func (x *SetPriorityRequest) GetPriority() Priority {
+	if x != nil {
+		return x.Priority
+	}
+	return Priority_PRIORITY_UNSPECIFIED
+}
+
+type MoveRequest struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	Id    string                 `protobuf:"bytes,1,opt,name=id,proto3" json:"id,omitempty"`
+	// Before is the queued job to move the job in front of, taking its
+	// priority. The job goes to the back of its priority when empty.
+	Before        string `protobuf:"bytes,2,opt,name=before,proto3" json:"before,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *MoveRequest) Reset() {
+	*x = MoveRequest{}
+	mi := &file_encz_proto_msgTypes[3]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *MoveRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*MoveRequest) ProtoMessage() {}
+
+func (x *MoveRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_encz_proto_msgTypes[3]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use MoveRequest.ProtoReflect.Descriptor instead.
+func (*MoveRequest) Descriptor() ([]byte, []int) {
+	return file_encz_proto_rawDescGZIP(), []int{3}
+}
+
+func (x *MoveRequest) GetId() string {
+	if x != nil {
+		return x.Id
+	}
+	return ""
+}
+
+func (x *MoveRequest) GetBefore() string {
+	if x != nil {
+		return x.Before
+	}
+	return ""
+}
+
+type ListJobsRequest struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	// All lists the jobs of every submitter, for admins
+	All           bool `protobuf:"varint,1,opt,name=all,proto3" json:"all,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *ListJobsRequest) Reset() {
+	*x = ListJobsRequest{}
+	mi := &file_encz_proto_msgTypes[4]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ListJobsRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ListJobsRequest) ProtoMessage() {}
+
+func (x *ListJobsRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_encz_proto_msgTypes[4]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ListJobsRequest.ProtoReflect.Descriptor instead.
+func (*ListJobsRequest) Descriptor() ([]byte, []int) {
+	return file_encz_proto_rawDescGZIP(), []int{4}
+}
+
+func (x *ListJobsRequest) GetAll() bool {
+	if x != nil {
+		return x.All
+	}
+	return false
+}
+
+type ListJobsResponse struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Jobs          []*Job                 `protobuf:"bytes,1,rep,name=jobs,proto3" json:"jobs,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *ListJobsResponse) Reset() {
+	*x = ListJobsResponse{}
+	mi := &file_encz_proto_msgTypes[5]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ListJobsResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ListJobsResponse) ProtoMessage() {}
+
+func (x *ListJobsResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_encz_proto_msgTypes[5]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ListJobsResponse.ProtoReflect.Descriptor instead.
+func (*ListJobsResponse) Descriptor() ([]byte, []int) {
+	return file_encz_proto_rawDescGZIP(), []int{5}
+}
+
+func (x *ListJobsResponse) GetJobs() []*Job {
+	if x != nil {
+		return x.Jobs
+	}
+	return nil
+}
+
+type Job struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	Id    string                 `protobuf:"bytes,1,opt,name=id,proto3" json:"id,omitempty"`
+	Path  string                 `protobuf:"bytes,2,opt,name=path,proto3" json:"path,omitempty"`
+	State Job_State              `protobuf:"varint,3,opt,name=state,proto3,enum=encz.v1.Job_State" json:"state,omitempty"`
+	// Phase is what a running job is doing besides encoding, like "analysing"
+	Phase string `protobuf:"bytes,4,opt,name=phase,proto3" json:"phase,omitempty"`
+	// Percent, Fps and EtaSeconds are the progress of a running job
+	Percent    float64 `protobuf:"fixed64,5,opt,name=percent,proto3" json:"percent,omitempty"`
+	Fps        float64 `protobuf:"fixed64,6,opt,name=fps,proto3" json:"fps,omitempty"`
+	EtaSeconds int64   `protobuf:"varint,7,opt,name=eta_seconds,json=etaSeconds,proto3" json:"eta_seconds,omitempty"`
+	// OutputPath is the encoded file, or the previous output of a skipped job
+	OutputPath string `protobuf:"bytes,8,opt,name=output_path,json=outputPath,proto3" json:"output_path,omitempty"`
+	InputSize  int64  `protobuf:"varint,9,opt,name=input_size,json=inputSize,proto3" json:"input_size,omitempty"`
+	OutputSize int64  `protobuf:"varint,10,opt,name=output_size,json=outputSize,proto3" json:"output_size,omitempty"`
+	// Error is why the job failed
+	Error       string                 `protobuf:"bytes,11,opt,name=error,proto3" json:"error,omitempty"`
+	SubmittedAt *timestamppb.Timestamp `protobuf:"bytes,12,opt,name=submitted_at,json=submittedAt,proto3" json:"submitted_at,omitempty"`
+	StartedAt   *timestamppb.Timestamp `protobuf:"bytes,13,opt,name=started_at,json=startedAt,proto3" json:"started_at,omitempty"`
+	FinishedAt  *timestamppb.Timestamp `protobuf:"bytes,14,opt,name=finished_at,json=finishedAt,proto3" json:"finished_at,omitempty"`
+	// Submitter is the name of the API key, or the user, that submitted the job
+	Submitter string   `protobuf:"bytes,15,opt,name=submitter,proto3" json:"submitter,omitempty"`
+	Priority  Priority `protobuf:"varint,16,opt,name=priority,proto3,enum=encz.v1.Priority" json:"priority,omitempty"`
+	// Position is the place of a queued job in the queue, 1 being next
+	Position      int32 `protobuf:"varint,17,opt,name=position,proto3" json:"position,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *Job) Reset() {
+	*x = Job{}
+	mi := &file_encz_proto_msgTypes[6]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Job) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Job) ProtoMessage() {}
+
+func (x *Job) ProtoReflect() protoreflect.Message {
+	mi := &file_encz_proto_msgTypes[6]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Job.ProtoReflect.Descriptor instead.
+func (*Job) Descriptor() ([]byte, []int) {
+	return file_encz_proto_rawDescGZIP(), []int{6}
+}
+
+func (x *Job) GetId() string {
+	if x != nil {
+		return x.Id
+	}
+	return ""
+}
+
+func (x *Job) GetPath() string {
+	if x != nil {
+		return x.Path
+	}
+	return ""
+}
+
+func (x *Job) GetState() Job_State {
+	if x != nil {
+		return x.State
+	}
+	return Job_STATE_UNSPECIFIED
+}
+
+func (x *Job) GetPhase() string {
+	if x != nil {
+		return x.Phase
+	}
+	return ""
+}
+
+func (x *Job) GetPercent() float64 {
+	if x != nil {
+		return x.Percent
+	}
+	return 0
+}
+
+func (x *Job) GetFps() float64 {
+	if x != nil {
+		return x.Fps
+	}
+	return 0
+}
+
+func (x *Job) GetEtaSeconds() int64 {
+	if x != nil {
+		return x.EtaSeconds
+	}
+	return 0
+}
+
+func (x *Job) GetOutputPath() string {
+	if x != nil {
+		return x.OutputPath
+	}
+	return ""
+}
+
+func (x *Job) GetInputSize() int64 {
+	if x != nil {
+		return x.InputSize
+	}
+	return 0
+}
+
+func (x *Job) GetOutputSize() int64 {
+	if x != nil {
+		return x.OutputSize
+	}
+	return 0
+}
+
+func (x *Job) GetError() string {
+	if x != nil {
+		return x.Error
+	}
+	return ""
+}
+
+func (x *Job) GetSubmittedAt() *timestamppb.Timestamp {
+	if x != nil {
+		return x.SubmittedAt
+	}
+	return nil
+}
+
+func (x *Job) GetStartedAt() *timestamppb.Timestamp {
+	if x != nil {
+		return x.StartedAt
+	}
+	return nil
+}
+
+func (x *Job) GetFinishedAt() *timestamppb.Timestamp {
+	if x != nil {
+		return x.FinishedAt
+	}
+	return nil
+}
+
+func (x *Job) GetSubmitter() string {
+	if x != nil {
+		return x.Submitter
+	}
+	return ""
+}
+
+func (x *Job) GetPriority() Priority {
+	if x != nil {
+		return x.Priority
+	}
+	return Priority_PRIORITY_UNSPECIFIED
+}
+
+func (x *Job) GetPosition() int32 {
+	if x != nil {
+		return x.Position
+	}
+	return 0
+}
+
+var File_encz_proto protoreflect.FileDescriptor
+
+const file_encz_proto_rawDesc = "" +
+	"\n" +
+	"\n" +
+	"encz.proto\x12\aencz.v1\x1a\x1fgoogle/protobuf/timestamp.proto\"\xca\x01\n" +
+	"\rSubmitRequest\x12\x12\n" +
+	"\x04path\x18\x01 \x01(\tR\x04path\x12\x1d\n" +
+	"\n" +
+	"output_dir\x18\x02 \x01(\tR\toutputDir\x12\x16\n" +
+	"\x06preset\x18\x03 \x01(\tR\x06preset\x12\x1d\n" +
+	"\aquality\x18\x04 \x01(\x01H\x00R\aquality\x88\x01\x01\x12\x14\n" +
+	"\x05force\x18\x05 \x01(\bR\x05force\x12-\n" +
+	"\bpriority\x18\x06 \x01(\x0e2\x11.encz.v1.PriorityR\bpriorityB\n" +
+	"\n" +
+	"\b_quality\"\x1c\n" +
+	"\n" +
+	"JobRequest\x12\x0e\n" +
+	"\x02id\x18\x01 \x01(\tR\x02id\"S\n" +
+	"\x12SetPriorityRequest\x12\x0e\n" +
+	"\x02id\x18\x01 \x01(\tR\x02id\x12-\n" +
+	"\bpriority\x18\x02 \x01(\x0e2\x11.encz.v1.PriorityR\bpriority\"5\n" +
+	"\vMoveRequest\x12\x0e\n" +
+	"\x02id\x18\x01 \x01(\tR\x02id\x12\x16\n" +
+	"\x06before\x18\x02 \x01(\tR\x06before\"#\n" +
+	"\x0fListJobsRequest\x12\x10\n" +
+	"\x03all\x18\x01 \x01(\bR\x03all\"4\n" +
+	"\x10ListJobsResponse\x12 \n" +
+	"\x04jobs\x18\x01 \x03(\v2\f.encz.v1.JobR\x04jobs\"\xe0\x05\n" +
+	"\x03Job\x12\x0e\n" +
+	"\x02id\x18\x01 \x01(\tR\x02id\x12\x12\n" +
+	"\x04path\x18\x02 \x01(\tR\x04path\x12(\n" +
+	"\x05state\x18\x03 \x01(\x0e2\x12.encz.v1.Job.StateR\x05state\x12\x14\n" +
+	"\x05phase\x18\x04 \x01(\tR\x05phase\x12\x18\n" +
+	"\apercent\x18\x05 \x01(\x01R\apercent\x12\x10\n" +
+	"\x03fps\x18\x06 \x01(\x01R\x03fps\x12\x1f\n" +
+	"\veta_seconds\x18\a \x01(\x03R\n" +
+	"etaSeconds\x12\x1f\n" +
+	"\voutput_path\x18\b \x01(\tR\n" +
+	"outputPath\x12\x1d\n" +
+	"\n" +
+	"input_size\x18\t \x01(\x03R\tinputSize\x12\x1f\n" +
+	"\voutput_size\x18\n" +
+	" \x01(\x03R\n" +
+	"outputSize\x12\x14\n" +
+	"\x05error\x18\v \x01(\tR\x05error\x12=\n" +
+	"\fsubmitted_at\x18\f \x01(\v2\x1a.google.protobuf.TimestampR\vsubmittedAt\x129\n" +
+	"\n" +
+	"started_at\x18\r \x01(\v2\x1a.google.protobuf.TimestampR\tstartedAt\x12;\n" +
+	"\vfinished_at\x18\x0e \x01(\v2\x1a.google.protobuf.TimestampR\n" +
+	"finishedAt\x12\x1c\n" +
+	"\tsubmitter\x18\x0f \x01(\tR\tsubmitter\x12-\n" +
+	"\bpriority\x18\x10 \x01(\x0e2\x11.encz.v1.PriorityR\bpriority\x12\x1a\n" +
+	"\bposition\x18\x11 \x01(\x05R\bposition\"\x90\x01\n" +
+	"\x05State\x12\x15\n" +
+	"\x11STATE_UNSPECIFIED\x10\x00\x12\x10\n" +
+	"\fSTATE_QUEUED\x10\x01\x12\x11\n" +
+	"\rSTATE_RUNNING\x10\x02\x12\x11\n" +
+	"\rSTATE_ENCODED\x10\x03\x12\x11\n" +
+	"\rSTATE_SKIPPED\x10\x04\x12\x10\n" +
+	"\fSTATE_FAILED\x10\x05\x12\x13\n" +
+	"\x0fSTATE_CANCELLED\x10\x06*^\n" +
+	"\bPriority\x12\x18\n" +
+	"\x14PRIORITY_UNSPECIFIED\x10\x00\x12\x10\n" +
+	"\fPRIORITY_LOW\x10\x01\x12\x13\n" +
+	"\x0fPRIORITY_NORMAL\x10\x02\x12\x11\n" +
+	"\rPRIORITY_HIGH\x10\x032\xe8\x02\n" +
+	"\aEncoder\x12.\n" +
+	"\x06Submit\x12\x16.encz.v1.SubmitRequest\x1a\f.encz.v1.Job\x12+\n" +
+	"\x06GetJob\x12\x13.encz.v1.JobRequest\x1a\f.encz.v1.Job\x12?\n" +
+	"\bListJobs\x12\x18.encz.v1.ListJobsRequest\x1a\x19.encz.v1.ListJobsResponse\x12,\n" +
+	"\x05Watch\x12\x13.encz.v1.JobRequest\x1a\f.encz.v1.Job0\x01\x12+\n" +
+	"\x06Cancel\x12\x13.encz.v1.JobRequest\x1a\f.encz.v1.Job\x128\n" +
+	"\vSetPriority\x12\x1b.encz.v1.SetPriorityRequest\x1a\f.encz.v1.Job\x12*\n" +
+	"\x04Move\x12\x14.encz.v1.MoveRequest\x1a\f.encz.v1.JobB\n" +
+	"Z\bencz/apib\x06proto3"
+
+var (
+	file_encz_proto_rawDescOnce sync.Once
+	file_encz_proto_rawDescData []byte
+)
+
+func file_encz_proto_rawDescGZIP() []byte {
+	file_encz_proto_rawDescOnce.Do(func() {
+		file_encz_proto_rawDescData = protoimpl.X.CompressGZIP(unsafe.Slice(unsafe.StringData(file_encz_proto_rawDesc), len(file_encz_proto_rawDesc)))
+	})
+	return file_encz_proto_rawDescData
+}
+
+var file_encz_proto_enumTypes = make([]protoimpl.EnumInfo, 2)
+var file_encz_proto_msgTypes = make([]protoimpl.MessageInfo, 7)
+var file_encz_proto_goTypes = []any{
+	(Priority)(0),                 // 0: encz.v1.Priority
+	(Job_State)(0),                // 1: encz.v1.Job.State
+	(*SubmitRequest)(nil),         // 2: encz.v1.SubmitRequest
+	(*JobRequest)(nil),            // 3: encz.v1.JobRequest
+	(*SetPriorityRequest)(nil),    // 4: encz.v1.SetPriorityRequest
+	(*MoveRequest)(nil),           // 5: encz.v1.MoveRequest
+	(*ListJobsRequest)(nil),       // 6: encz.v1.ListJobsRequest
+	(*ListJobsResponse)(nil),      // 7: encz.v1.ListJobsResponse
+	(*Job)(nil),                   // 8: encz.v1.Job
+	(*timestamppb.Timestamp)(nil), // 9: google.protobuf.Timestamp
+}
+var file_encz_proto_depIdxs = []int32{
+	0,  // 0: encz.v1.SubmitRequest.priority:type_name -> encz.v1.Priority
+	0,  // 1: encz.v1.SetPriorityRequest.priority:type_name -> encz.v1.Priority
+	8,  // 2: encz.v1.ListJobsResponse.jobs:type_name -> encz.v1.Job
+	1,  // 3: encz.v1.Job.state:type_name -> encz.v1.Job.State
+	9,  // 4: encz.v1.Job.submitted_at:type_name -> google.protobuf.Timestamp
+	9,  // 5: encz.v1.Job.started_at:type_name -> google.protobuf.Timestamp
+	9,  // 6: encz.v1.Job.finished_at:type_name -> google.protobuf.Timestamp
+	0,  // 7: encz.v1.Job.priority:type_name -> encz.v1.Priority
+	2,  // 8: encz.v1.Encoder.Submit:input_type -> encz.v1.SubmitRequest
+	3,  // 9: encz.v1.Encoder.GetJob:input_type -> encz.v1.JobRequest
+	6,  // 10: encz.v1.Encoder.ListJobs:input_type -> encz.v1.ListJobsRequest
+	3,  // 11: encz.v1.Encoder.Watch:input_type -> encz.v1.JobRequest
+	3,  // 12: encz.v1.Encoder.Cancel:input_type -> encz.v1.JobRequest
+	4,  // 13: encz.v1.Encoder.SetPriority:input_type -> encz.v1.SetPriorityRequest
+	5,  // 14: encz.v1.Encoder.Move:input_type -> encz.v1.MoveRequest
+	8,  // 15: encz.v1.Encoder.Submit:output_type -> encz.v1.Job
+	8,  // 16: encz.v1.Encoder.GetJob:output_type -> encz.v1.Job
+	7,  // 17: encz.v1.Encoder.ListJobs:output_type -> encz.v1.ListJobsResponse
+	8,  // 18: encz.v1.Encoder.Watch:output_type -> encz.v1.Job
+	8,  // 19: encz.v1.Encoder.Cancel:output_type -> encz.v1.Job
+	8,  // 20: encz.v1.Encoder.SetPriority:output_type -> encz.v1.Job
+	8,  // 21: encz.v1.Encoder.Move:output_type -> encz.v1.Job
+	15, // [15:22] is the sub-list for method output_type
+	8,  // [8:15] is the sub-list for method input_type
+	8,  // [8:8] is the sub-list for extension type_name
+	8,  // [8:8] is the sub-list for extension extendee
+	0,  // [0:8] is the sub-list for field type_name
+}
+
+func init() { file_encz_proto_init() }
+func file_encz_proto_init() {
+	if File_encz_proto != nil {
+		return
+	}
+	file_encz_proto_msgTypes[0].OneofWrappers = []any{}
+	type x struct{}
+	out := protoimpl.TypeBuilder{
+		File: protoimpl.DescBuilder{
+			GoPackagePath: reflect.TypeOf(x{}).PkgPath(),
+			RawDescriptor: unsafe.Slice(unsafe.StringData(file_encz_proto_rawDesc), len(file_encz_proto_rawDesc)),
+			NumEnums:      2,
+			NumMessages:   7,
+			NumExtensions: 0,
+			NumServices:   1,
+		},
+		GoTypes:           file_encz_proto_goTypes,
+		DependencyIndexes: file_encz_proto_depIdxs,
+		EnumInfos:         file_encz_proto_enumTypes,
+		MessageInfos:      file_encz_proto_msgTypes,
+	}.Build()
+	File_encz_proto = out.File
+	file_encz_proto_goTypes = nil
+	file_encz_proto_depIdxs = nil
+}
@@ -0,0 +1,381 @@
+// Code generated by protoc-gen-go-grpc. DO NOT EDIT.
+// versions:
+// - protoc-gen-go-grpc v1.6.2
+// - protoc             (unknown)
+// source: encz.proto
+
+package api
+
+import (
+	context "context"
+	grpc "google.golang.org/grpc"
+	codes "google.golang.org/grpc/codes"
+	status "google.golang.org/grpc/status"
+)
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the grpc package it is being compiled against.
+// Requires gRPC-Go v1.64.0 or later.
+const _ = grpc.SupportPackageIsVersion9
+
+const (
+	Encoder_Submit_FullMethodName      = "/encz.v1.Encoder/Submit"
+	Encoder_GetJob_FullMethodName      = "/encz.v1.Encoder/GetJob"
+	Encoder_ListJobs_FullMethodName    = "/encz.v1.Encoder/ListJobs"
+	Encoder_Watch_FullMethodName       = "/encz.v1.Encoder/Watch"
+	Encoder_Cancel_FullMethodName      = "/encz.v1.Encoder/Cancel"
+	Encoder_SetPriority_FullMethodName = "/encz.v1.Encoder/SetPriority"
+	Encoder_Move_FullMethodName        = "/encz.v1.Encoder/Move"
+)
+
+// EncoderClient is the client API for Encoder service.
+//
+// For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
+//
+// Encoder queues encodes on the server, which runs them one at a time. With
+// API keys on the server, calls send one as "authorization: Bearer <key>"
+// metadata, and without them the submitter can be named in "x-encz-user".
+// Jobs are only seen and cancelled by their submitter and the admins.
+type EncoderClient interface {
+	// Submit queues the encode of a file on the server
+	Submit(ctx context.Context, in *SubmitRequest, opts ...grpc.CallOption) (*Job, error)
+	// GetJob returns a job by its ID
+	GetJob(ctx context.Context, in *JobRequest, opts ...grpc.CallOption) (*Job, error)
+	// ListJobs returns the jobs of the caller, in the order they were submitted
+	ListJobs(ctx context.Context, in *ListJobsRequest, opts ...grpc.CallOption) (*ListJobsResponse, error)
+	// Watch sends the job, then again each time it changes, and ends once the
+	// job is finished
+	Watch(ctx context.Context, in *JobRequest, opts ...grpc.CallOption) (grpc.ServerStreamingClient[Job], error)
+	// Cancel drops a queued job, or stops a running one
+	Cancel(ctx context.Context, in *JobRequest, opts ...grpc.CallOption) (*Job, error)
+	// SetPriority changes the priority of a queued job, moving it behind the
+	// queued jobs of its new priority
+	SetPriority(ctx context.Context, in *SetPriorityRequest, opts ...grpc.CallOption) (*Job, error)
+	// Move reorders a queued job
+	Move(ctx context.Context, in *MoveRequest, opts ...grpc.CallOption) (*Job, error)
+}
+
+type encoderClient struct {
+	cc grpc.ClientConnInterface
+}
+
+func NewEncoderClient(cc grpc.ClientConnInterface) EncoderClient {
+	return &encoderClient{cc}
+}
+
+func (c *encoderClient) Submit(ctx context.Context, in *SubmitRequest, opts ...grpc.CallOption) (*Job, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(Job)
+	err := c.cc.Invoke(ctx, Encoder_Submit_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *encoderClient) GetJob(ctx context.Context, in *JobRequest, opts ...grpc.CallOption) (*Job, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(Job)
+	err := c.cc.Invoke(ctx, Encoder_GetJob_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *encoderClient) ListJobs(ctx context.Context, in *ListJobsRequest, opts ...grpc.CallOption) (*ListJobsResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(ListJobsResponse)
+	err := c.cc.Invoke(ctx, Encoder_ListJobs_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *encoderClient) Watch(ctx context.Context, in *JobRequest, opts ...grpc.CallOption) (grpc.ServerStreamingClient[Job], error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	stream, err := c.cc.NewStream(ctx, &Encoder_ServiceDesc.Streams[0], Encoder_Watch_FullMethodName, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &grpc.GenericClientStream[JobRequest, Job]{ClientStream: stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type Encoder_WatchClient = grpc.ServerStreamingClient[Job]
+
+func (c *encoderClient) Cancel(ctx context.Context, in *JobRequest, opts ...grpc.CallOption) (*Job, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(Job)
+	err := c.cc.Invoke(ctx, Encoder_Cancel_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *encoderClient) SetPriority(ctx context.Context, in *SetPriorityRequest, opts ...grpc.CallOption) (*Job, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(Job)
+	err := c.cc.Invoke(ctx, Encoder_SetPriority_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *encoderClient) Move(ctx context.Context, in *MoveRequest, opts ...grpc.CallOption) (*Job, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(Job)
+	err := c.cc.Invoke(ctx, Encoder_Move_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// EncoderServer is the server API for Encoder service.
+// All implementations must embed UnimplementedEncoderServer
+// for forward compatibility.
+//
+// Encoder queues encodes on the server, which runs them one at a time. With
+// API keys on the server, calls send one as "authorization: Bearer <key>"
+// metadata, and without them the submitter can be named in "x-encz-user".
+// Jobs are only seen and cancelled by their submitter and the admins.
+type EncoderServer interface {
+	// Submit queues the encode of a file on the server
+	Submit(context.Context, *SubmitRequest) (*Job, error)
+	// GetJob returns a job by its ID
+	GetJob(context.Context, *JobRequest) (*Job, error)
+	// ListJobs returns the jobs of the caller, in the order they were submitted
+	ListJobs(context.Context, *ListJobsRequest) (*ListJobsResponse, error)
+	// Watch sends the job, then again each time it changes, and ends once the
+	// job is finished
+	Watch(*JobRequest, grpc.ServerStreamingServer[Job]) error
+	// Cancel drops a queued job, or stops a running one
+	Cancel(context.Context, *JobRequest) (*Job, error)
+	// SetPriority changes the priority of a queued job, moving it behind the
+	// queued jobs of its new priority
+	SetPriority(context.Context, *SetPriorityRequest) (*Job, error)
+	// Move reorders a queued job
+	Move(context.Context, *MoveRequest) (*Job, error)
+	mustEmbedUnimplementedEncoderServer()
+}
+
+// UnimplementedEncoderServer must be embedded to have
+// forward compatible implementations.
+//
+// NOTE: this should be embedded by value instead of pointer to avoid a nil
+// pointer dereference when methods are called.
+type UnimplementedEncoderServer struct{}
+
+func (UnimplementedEncoderServer) Submit(context.Context, *SubmitRequest) (*Job, error) {
+	return nil, status.Error(codes.Unimplemented, "method Submit not implemented")
+}
+func (UnimplementedEncoderServer) GetJob(context.Context, *JobRequest) (*Job, error) {
+	return nil, status.Error(codes.Unimplemented, "method GetJob not implemented")
+}
+func (UnimplementedEncoderServer) ListJobs(context.Context, *ListJobsRequest) (*ListJobsResponse, error) {
+	return nil, status.Error(codes.Unimplemented, "method ListJobs not implemented")
+}
+func (UnimplementedEncoderServer) Watch(*JobRequest, grpc.ServerStreamingServer[Job]) error {
+	return status.Error(codes.Unimplemented, "method Watch not implemented")
+}
+func (UnimplementedEncoderServer) Cancel(context.Context, *JobRequest) (*Job, error) {
+	return nil, status.Error(codes.Unimplemented, "method Cancel not implemented")
+}
+func (UnimplementedEncoderServer) SetPriority(context.Context, *SetPriorityRequest) (*Job, error) {
+	return nil, status.Error(codes.Unimplemented, "method SetPriority not implemented")
+}
+func (UnimplementedEncoderServer) Move(context.Context, *MoveRequest) (*Job, error) {
+	return nil, status.Error(codes.Unimplemented, "method Move not implemented")
+}
+func (UnimplementedEncoderServer) mustEmbedUnimplementedEncoderServer() {}
+func (UnimplementedEncoderServer) testEmbeddedByValue()                 {}
+
+// UnsafeEncoderServer may be embedded to opt out of forward compatibility for this service.
+// Use of this interface is not recommended, as added methods to EncoderServer will
+// result in compilation errors.
+type UnsafeEncoderServer interface {
+	mustEmbedUnimplementedEncoderServer()
+}
+
+func RegisterEncoderServer(s grpc.ServiceRegistrar, srv EncoderServer) {
+	// If the following call panics, it indicates UnimplementedEncoderServer was
+	// embedded by pointer and is nil.  This will cause panics if an
+	// unimplemented method is ever invoked, so we test this at initialization
+	// time to prevent it from happening at runtime later due to I/O.
+	if t, ok := srv.(interface{ testEmbeddedByValue() }); ok {
+		t.testEmbeddedByValue()
+	}
+	s.RegisterService(&Encoder_ServiceDesc, srv)
+}
+
+func _Encoder_Submit_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(SubmitRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(EncoderServer).Submit(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Encoder_Submit_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(EncoderServer).Submit(ctx, req.(*SubmitRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Encoder_GetJob_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(JobRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(EncoderServer).GetJob(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Encoder_GetJob_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(EncoderServer).GetJob(ctx, req.(*JobRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Encoder_ListJobs_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ListJobsRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(EncoderServer).ListJobs(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Encoder_ListJobs_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(EncoderServer).ListJobs(ctx, req.(*ListJobsRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Encoder_Watch_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(JobRequest)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(EncoderServer).Watch(m, &grpc.GenericServerStream[JobRequest, Job]{ServerStream: stream})
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type Encoder_WatchServer = grpc.ServerStreamingServer[Job]
+
+func _Encoder_Cancel_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(JobRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(EncoderServer).Cancel(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Encoder_Cancel_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(EncoderServer).Cancel(ctx, req.(*JobRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Encoder_SetPriority_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(SetPriorityRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(EncoderServer).SetPriority(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Encoder_SetPriority_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(EncoderServer).SetPriority(ctx, req.(*SetPriorityRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Encoder_Move_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(MoveRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(EncoderServer).Move(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Encoder_Move_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(EncoderServer).Move(ctx, req.(*MoveRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+// Encoder_ServiceDesc is the grpc.ServiceDesc for Encoder service.
+// It's only intended for direct use with grpc.RegisterService,
+// and not to be introspected or modified (even as a copy)
+var Encoder_ServiceDesc = grpc.ServiceDesc{
+	ServiceName: "encz.v1.Encoder",
+	HandlerType: (*EncoderServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "Submit",
+			Handler:    _Encoder_Submit_Handler,
+		},
+		{
+			MethodName: "GetJob",
+			Handler:    _Encoder_GetJob_Handler,
+		},
+		{
+			MethodName: "ListJobs",
+			Handler:    _Encoder_ListJobs_Handler,
+		},
+		{
+			MethodName: "Cancel",
+			Handler:    _Encoder_Cancel_Handler,
+		},
+		{
+			MethodName: "SetPriority",
+			Handler:    _Encoder_SetPriority_Handler,
+		},
+		{
+			MethodName: "Move",
+			Handler:    _Encoder_Move_Handler,
+		},
+	},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "Watch",
+			Handler:       _Encoder_Watch_Handler,
+			ServerStreams: true,
+		},
+	},
+	Metadata: "encz.proto",
+}
@@ -0,0 +1,4 @@
+// Package api is the gRPC API of encz serve, generated from encz.proto
+package api
+
+//go:generate protoc --go_out=. --go_opt=paths=source_relative --go-grpc_out=. --go-grpc_opt=paths=source_relative encz.proto
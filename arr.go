@@ -0,0 +1,208 @@
+package main
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/rs/zerolog/log"
+
+	"encz/arr"
+)
+
+// arrArgs represents the arguments of the arr command
+type arrArgs struct {
+	cliArgs
+	URL        string
+	APIKey     string
+	MinBitrate int64
+	PathMaps   []string
+	Limit      int
+	DryRun     bool
+	// ReportPath is the CSV or JSON file the batch report is written to
+	ReportPath string
+	// FailFast stops the run at the first file that fails
+	FailFast bool
+}
+
+// arrMain implements `encz arr [flags]`, encoding the files of a Radarr or
+// Sonarr library that aren't HEVC yet
+func arrMain(arguments []string) {
+	var args arrArgs
+
+	fs := flag.NewFlagSet("arr", flag.ExitOnError)
+	fs.StringVar(&args.URL, "url", "", "Radarr or Sonarr URL, e.g. http://localhost:7878")
+	fs.StringVar(&args.APIKey, "api-key", os.Getenv("ENCZ_ARR_API_KEY"), "API key (default: $ENCZ_ARR_API_KEY)")
+	fs.Int64Var(&args.MinBitrate, "min-bitrate", 0, "only encode files with a video bitrate above this many kb/s")
+	listVar(fs, "path-map", "translate paths reported by the *arr to local paths, as from=to (repeatable)", func() { args.PathMaps = nil }, func(s string) error {
+		if !strings.Contains(s, "=") {
+			return fmt.Errorf("expected from=to, got %q", s)
+		}
+		args.PathMaps = append(args.PathMaps, s)
+		return nil
+	})
+	fs.IntVar(&args.Limit, "limit", 0, "encode at most this many files per run")
+	fs.BoolVar(&args.DryRun, "dry-run", false, "only list the files that would be encoded")
+	fs.StringVar(&args.ReportPath, "report", "", "also write the table of the files of the run to this .csv or .json file")
+	failFastFlags(fs, &args.FailFast)
+
+	args.cliArgs = parseArgs(fs, arguments)
+
+	if err := setupLogging(args.cliArgs); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+
+	ctx, cancel := interruptContext()
+	defer cancel()
+	watchPauseSignals(ctx)
+	watchStatusSignal(ctx)
+
+	if args.URL == "" || args.APIKey == "" {
+		exitInvalid(ctx, errors.New("--url and --api-key are required"))
+	}
+
+	// Files come from the *arr rather than the command line
+	if err := cmp.Or(args.validateOutput(), args.validateEncoding(), args.validateBatch(), validateReportPath(args.ReportPath)); err != nil {
+		exitInvalid(ctx, err)
+	}
+
+	checkPreflight(ctx, args.cliArgs)
+	defer acquireLock(ctx, args.cliArgs)()
+
+	if args.unattended() {
+		ctx = withProgressView(ctx, discardView{})
+	}
+
+	summary, err := runArr(ctx, args)
+	reportBatch(ctx, summary.Files, args.ReportPath)
+	if args.unattended() || useColor(os.Stdout) {
+		printLibrarySummary(os.Stdout, summary, useColor(os.Stdout))
+	}
+	exitOnError(ctx, err)
+}
+
+// runArr encodes the matching files of the *arr and asks it to rescan what changed
+func runArr(ctx context.Context, args arrArgs) (summary librarySummary, err error) {
+	start := time.Now()
+	summary.Root = args.URL
+	defer func() { summary.Elapsed = time.Since(start) }()
+
+	client, err := arr.Connect(ctx, args.URL, args.APIKey)
+	if err != nil {
+		return summary, err
+	}
+
+	files, err := client.Files(ctx)
+	if err != nil {
+		return summary, err
+	}
+
+	var candidates []arr.File
+	for _, file := range files {
+		if file.IsHEVCOrBetter() || file.VideoBitrate < args.MinBitrate*1000 {
+			continue
+		}
+		candidates = append(candidates, file)
+	}
+	if args.Limit > 0 && len(candidates) > args.Limit {
+		candidates = candidates[:args.Limit]
+	}
+
+	log.Ctx(ctx).Info().
+		Str("app", string(client.Kind)).
+		Int("files", len(files)).
+		Int("candidates", len(candidates)).
+		Msg("queried library")
+
+	rescanned := map[int]bool{}
+
+	for _, file := range candidates {
+		if stopping() {
+			log.Ctx(ctx).Warn().Msg("stopping before the next file, as asked")
+			break
+		}
+		path := mapPath(file.Path, args.PathMaps)
+
+		if args.DryRun {
+			fmt.Printf("%s (%s, %d kb/s)\n", path, file.VideoCodec, file.VideoBitrate/1000)
+			continue
+		}
+
+		if _, err := os.Stat(path); err != nil {
+			log.Ctx(ctx).Warn().Err(err).Str("file", path).Msg("file not found, check --path-map")
+			summary.Failed++
+			if args.FailFast {
+				log.Ctx(ctx).Warn().Msg("stopping at the failed file, as asked with --fail-fast")
+				break
+			}
+			continue
+		}
+
+		if reason, err := unsettledReason(path, args.QuietPeriod); err == nil && reason != "" {
+			log.Ctx(ctx).Info().Str("file", path).Str("reason", reason).Msg("file is still being written, skipping until the next run")
+			continue
+		}
+
+		log.Ctx(ctx).Info().Str("title", file.Title).Str("file", path).Msg("encoding")
+
+		fileArgs := args.cliArgs
+		fileArgs.VideoPath = path
+
+		result, err := runJob(ctx, fileArgs)
+		if errors.Is(err, context.Canceled) {
+			return summary, err
+		}
+		summary.Files = append(summary.Files, newFileStats(path, result))
+		if err != nil {
+			log.Ctx(ctx).Error().Err(err).Str("file", path).Msg("failed to encode")
+			summary.Failed++
+			if args.FailFast {
+				log.Ctx(ctx).Warn().Msg("stopping at the failed file, as asked with --fail-fast")
+				break
+			}
+			continue
+		}
+		if result.Skipped {
+			summary.Skipped++
+			continue
+		}
+		summary.Encoded++
+		summary.SavedBytes += result.Event.SavedBytes
+
+		if !rescanned[file.ItemID] {
+			if err := client.Rescan(ctx, file.ItemID); err != nil {
+				log.Ctx(ctx).Warn().Err(err).Str("title", file.Title).Msg("failed to request rescan")
+			}
+			rescanned[file.ItemID] = true
+		}
+	}
+
+	log.Ctx(ctx).Info().
+		Int("encoded", summary.Encoded).
+		Int("skipped", summary.Skipped).
+		Int("failed", summary.Failed).
+		Str("saved", formatBytes(summary.SavedBytes)).
+		Msg("arr run finished")
+
+	if summary.Failed > 0 {
+		return summary, batchError{failed: summary.Failed, total: len(candidates)}
+	}
+	return summary, nil
+}
+
+// mapPath translates a path reported by the *arr using the first matching from=to prefix mapping
+func mapPath(path string, maps []string) string {
+	for _, m := range maps {
+		from, to, _ := strings.Cut(m, "=")
+		if rest, ok := strings.CutPrefix(path, from); ok {
+			return to + rest
+		}
+	}
+	return path
+}
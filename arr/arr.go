@@ -0,0 +1,203 @@
+// Package arr talks to Radarr and Sonarr to find media files worth encoding
+package arr
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// requestTimeout bounds a single API request
+const requestTimeout = time.Minute
+
+// Kind identifies the *arr application
+type Kind string
+
+const (
+	Radarr Kind = "Radarr"
+	Sonarr Kind = "Sonarr"
+)
+
+// File is a media file managed by Radarr or Sonarr
+type File struct {
+	// ItemID is the movie or series the file belongs to, used for rescans
+	ItemID int
+	Title  string
+	Path   string
+	Size   int64
+	// VideoCodec as reported by the *arr, e.g. x264, HEVC or AV1
+	VideoCodec string
+	// VideoBitrate in bits per second, 0 when unknown
+	VideoBitrate int64
+}
+
+// IsHEVCOrBetter reports whether the file's video codec doesn't need re-encoding
+func (f File) IsHEVCOrBetter() bool {
+	switch strings.ToLower(f.VideoCodec) {
+	case "hevc", "h265", "x265", "av1":
+		return true
+	}
+	return false
+}
+
+// Client is a Radarr or Sonarr API client
+type Client struct {
+	url    string
+	apiKey string
+	Kind   Kind
+}
+
+// Connect returns a client for the *arr at url, detecting whether it is Radarr or Sonarr
+func Connect(ctx context.Context, url, apiKey string) (*Client, error) {
+	c := &Client{url: strings.TrimSuffix(url, "/"), apiKey: apiKey}
+
+	var status struct {
+		AppName string `json:"appName"`
+	}
+	if err := c.get(ctx, "/api/v3/system/status", &status); err != nil {
+		return nil, err
+	}
+
+	switch Kind(status.AppName) {
+	case Radarr, Sonarr:
+		c.Kind = Kind(status.AppName)
+	default:
+		return nil, fmt.Errorf("unsupported application %q at %s, expected Radarr or Sonarr", status.AppName, url)
+	}
+	return c, nil
+}
+
+type mediaInfo struct {
+	VideoCodec   string `json:"videoCodec"`
+	VideoBitrate int64  `json:"videoBitrate"`
+}
+
+// Files returns all media files known to the *arr
+func (c *Client) Files(ctx context.Context) ([]File, error) {
+	if c.Kind == Radarr {
+		return c.movieFiles(ctx)
+	}
+	return c.episodeFiles(ctx)
+}
+
+func (c *Client) movieFiles(ctx context.Context) ([]File, error) {
+	var movies []struct {
+		ID        int    `json:"id"`
+		Title     string `json:"title"`
+		HasFile   bool   `json:"hasFile"`
+		MovieFile struct {
+			Path      string    `json:"path"`
+			Size      int64     `json:"size"`
+			MediaInfo mediaInfo `json:"mediaInfo"`
+		} `json:"movieFile"`
+	}
+	if err := c.get(ctx, "/api/v3/movie", &movies); err != nil {
+		return nil, err
+	}
+
+	var files []File
+	for _, m := range movies {
+		if !m.HasFile {
+			continue
+		}
+		files = append(files, File{
+			ItemID:       m.ID,
+			Title:        m.Title,
+			Path:         m.MovieFile.Path,
+			Size:         m.MovieFile.Size,
+			VideoCodec:   m.MovieFile.MediaInfo.VideoCodec,
+			VideoBitrate: m.MovieFile.MediaInfo.VideoBitrate,
+		})
+	}
+	return files, nil
+}
+
+func (c *Client) episodeFiles(ctx context.Context) ([]File, error) {
+	var series []struct {
+		ID    int    `json:"id"`
+		Title string `json:"title"`
+	}
+	if err := c.get(ctx, "/api/v3/series", &series); err != nil {
+		return nil, err
+	}
+
+	var files []File
+	for _, s := range series {
+		var episodes []struct {
+			Path      string    `json:"path"`
+			Size      int64     `json:"size"`
+			MediaInfo mediaInfo `json:"mediaInfo"`
+		}
+		if err := c.get(ctx, fmt.Sprintf("/api/v3/episodefile?seriesId=%d", s.ID), &episodes); err != nil {
+			return nil, err
+		}
+		for _, e := range episodes {
+			files = append(files, File{
+				ItemID:       s.ID,
+				Title:        s.Title,
+				Path:         e.Path,
+				Size:         e.Size,
+				VideoCodec:   e.MediaInfo.VideoCodec,
+				VideoBitrate: e.MediaInfo.VideoBitrate,
+			})
+		}
+	}
+	return files, nil
+}
+
+// Rescan asks the *arr to rescan the movie or series with the given id
+func (c *Client) Rescan(ctx context.Context, itemID int) error {
+	command := map[string]any{"name": "RescanMovie", "movieId": itemID}
+	if c.Kind == Sonarr {
+		command = map[string]any{"name": "RescanSeries", "seriesId": itemID}
+	}
+	return c.post(ctx, "/api/v3/command", command)
+}
+
+func (c *Client) get(ctx context.Context, path string, v any) error {
+	return c.do(ctx, http.MethodGet, path, nil, v)
+}
+
+func (c *Client) post(ctx context.Context, path string, body any) error {
+	return c.do(ctx, http.MethodPost, path, body, nil)
+}
+
+func (c *Client) do(ctx context.Context, method, path string, body, v any) error {
+	ctx, cancel := context.WithTimeout(ctx, requestTimeout)
+	defer cancel()
+
+	var payload bytes.Buffer
+	if body != nil {
+		if err := json.NewEncoder(&payload).Encode(body); err != nil {
+			return fmt.Errorf("failed to encode request: %w", err)
+		}
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, c.url+path, &payload)
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("X-Api-Key", c.apiKey)
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to call %s: %w", path, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("%s %s returned %s", method, path, resp.Status)
+	}
+	if v == nil {
+		return nil
+	}
+	if err := json.NewDecoder(resp.Body).Decode(v); err != nil {
+		return fmt.Errorf("failed to decode response of %s: %w", path, err)
+	}
+	return nil
+}
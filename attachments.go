@@ -0,0 +1,75 @@
+package main
+
+import (
+	"context"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/rs/zerolog/log"
+
+	"encz/ffmpeg"
+)
+
+// keptSubtitles returns the subtitle tracks of a source with count of them
+// that outputs keep
+func (c *cliArgs) keptSubtitles(count int) []int {
+	sel := c.Streams.Subtitles
+	switch {
+	case sel.None:
+		return nil
+	case sel.All:
+		kept := make([]int, count)
+		for i := range kept {
+			kept[i] = i
+		}
+		return kept
+	case len(sel.Indices) > 0:
+		return sel.Indices
+	}
+	// HandBrake keeps no subtitles unless told to
+	if c.Encoder == "ffmpeg" && count > 0 {
+		return []int{0}
+	}
+	return nil
+}
+
+// keepsStyledSubtitles reports whether outputs keep an ASS subtitle track of the source
+func (c *cliArgs) keepsStyledSubtitles(probe ffmpeg.ProbeResult) bool {
+	for _, track := range c.keptSubtitles(len(probe.SubtitleCodecs)) {
+		if track < len(probe.SubtitleCodecs) && slices.Contains([]string{"ass", "ssa"}, probe.SubtitleCodecs[track]) {
+			return true
+		}
+	}
+	return false
+}
+
+// resolveAttachments keeps the fonts of the source when outputs keep its
+// styled subtitles, which render with the wrong fonts without them. Only
+// Matroska outputs encoded by ffmpeg can carry fonts, anything else is warned
+// about.
+func resolveAttachments(ctx context.Context, args *cliArgs, probe ffmpeg.ProbeResult, savePath string) {
+	if probe.Fonts == 0 || args.Streams.Attachments || args.Streams.DropAttachments || !args.keepsStyledSubtitles(probe) {
+		return
+	}
+
+	var reason string
+	switch {
+	case !strings.EqualFold(filepath.Ext(savePath), ".mkv"):
+		reason = "only MKV outputs can carry fonts"
+	case usesHandbrake(*args):
+		reason = "HandBrake drops attachments, use --encoder ffmpeg to keep them"
+	case args.Chunked:
+		reason = "chunked encodes don't keep attachments"
+	}
+	if reason != "" {
+		log.Ctx(ctx).Warn().
+			Int("fonts", probe.Fonts).
+			Str("reason", reason).
+			Msg("styled subtitles will render with the wrong fonts, drop them with --map t:none to hide this warning")
+		return
+	}
+
+	log.Ctx(ctx).Info().Int("fonts", probe.Fonts).Msg("keeping the fonts of styled subtitles")
+	args.Streams.Attachments = true
+}
@@ -0,0 +1,223 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/rs/zerolog/log"
+
+	"encz/ffmpeg"
+	"encz/handbrake"
+)
+
+// audioBitrates are the default bitrates in kbps of the audio codecs for mono,
+// stereo, up to 5.1 and 7.1 tracks
+var audioBitrates = map[string][4]int{
+	ffmpeg.AudioAAC:  {96, 160, 384, 512},
+	ffmpeg.AudioOpus: {64, 128, 256, 384},
+	ffmpeg.AudioAC3:  {96, 192, 448, 640},
+	ffmpeg.AudioEAC3: {96, 224, 640, 640},
+}
+
+// validateAudio checks --audio-codec and --audio-bitrate
+func (c *cliArgs) validateAudio() error {
+	switch c.AudioCodec {
+	case "auto", ffmpeg.AudioAAC, ffmpeg.AudioOpus, ffmpeg.AudioAC3, ffmpeg.AudioEAC3:
+	default:
+		return fmt.Errorf("invalid --audio-codec %q: expected auto, aac, opus, ac3 or eac3", c.AudioCodec)
+	}
+	if c.AudioCopy && c.AudioDelay.isSet() {
+		return fmt.Errorf("--audio-delay cannot be combined with --audio-copy, shifted audio isn't bit-identical")
+	}
+	if c.AudioGain < -20 || c.AudioGain > 20 {
+		return fmt.Errorf("--gain must be between -20dB and 20dB")
+	}
+	if c.AudioCopy && c.AudioGain != 0 {
+		return fmt.Errorf("--gain cannot be combined with --audio-copy, copied audio isn't filtered")
+	}
+	if c.AudioBitrate < 0 {
+		return fmt.Errorf("--audio-bitrate must not be negative")
+	}
+	if c.AudioCopy && (c.AudioCodec != "auto" || c.AudioBitrate > 0 || len(c.AudioPassthrough) > 0) {
+		return fmt.Errorf("--audio-copy cannot be combined with --audio-codec, --audio-bitrate or --audio-passthrough")
+	}
+	return nil
+}
+
+// audioCodec returns the codec of the audio of an output at savePath. Auto
+// picks Opus for MKV outputs, AAC plays everywhere MP4 does. HandBrake only
+// writes MP4.
+func audioCodec(args cliArgs, savePath string, handbrake bool) string {
+	if args.AudioCodec != "auto" {
+		return args.AudioCodec
+	}
+	if outputContainer(savePath, handbrake) == "mkv" {
+		return ffmpeg.AudioOpus
+	}
+	return ffmpeg.AudioAAC
+}
+
+// audioTrack is how an output audio track is encoded
+type audioTrack struct {
+	// Source is the track of the source, counted from 0 like --map
+	Source int
+	// Codec is the codec encoded to, or copy to pass the track through
+	Codec    string
+	Bitrate  int
+	Channels int
+	Delay    time.Duration
+	Gain     float64
+}
+
+// audioTracks returns how the output audio tracks are encoded in codec, or
+// passed through by the --audio-passthrough rules for container
+func audioTracks(args cliArgs, probe ffmpeg.ProbeResult, codec, container string, renditions bool) []audioTrack {
+	sources := keptAudioTracks(args, probe, renditions)
+
+	tracks := make([]audioTrack, len(sources))
+	for i, source := range sources {
+		channels := probe.AudioChannels[source]
+		track := audioTrack{Codec: codec, Bitrate: args.AudioBitrate}
+		if rule, ok := args.passthroughRule(probe.AudioCodecs[source], container); ok {
+			if rule.Copy {
+				tracks[i] = audioTrack{Source: source, Codec: "copy", Bitrate: defaultAudioBitrate(codec, channels), Delay: args.AudioDelay.of(source)}
+				continue
+			}
+			track = audioTrack{Codec: rule.Target, Bitrate: rule.Bitrate}
+		}
+		track.Source, track.Delay, track.Gain = source, args.AudioDelay.of(source), args.AudioGain
+		// AC3 and E-AC3 carry up to 5.1
+		if (track.Codec == ffmpeg.AudioAC3 || track.Codec == ffmpeg.AudioEAC3) && channels > 6 {
+			track.Channels, channels = 6, 6
+		}
+		if track.Bitrate == 0 {
+			track.Bitrate = defaultAudioBitrate(track.Codec, channels)
+		}
+		tracks[i] = track
+	}
+	return tracks
+}
+
+// defaultAudioBitrate returns the bitrate in kbps of a track of codec with channels
+func defaultAudioBitrate(codec string, channels int) int {
+	bitrates := audioBitrates[codec]
+	switch {
+	case channels == 1:
+		return bitrates[0]
+	case channels <= 2:
+		// Tracks of unknown channels are most likely stereo
+		return bitrates[1]
+	case channels <= 6:
+		return bitrates[2]
+	}
+	return bitrates[3]
+}
+
+// outputContainer returns mkv or mp4, the container of an output at savePath
+func outputContainer(savePath string, handbrake bool) string {
+	// Matroska and NUT, the formats of piped outputs, carry the same codecs
+	if !handbrake && (strings.EqualFold(filepath.Ext(savePath), ".mkv") || savePath == pipePath) {
+		return "mkv"
+	}
+	return "mp4"
+}
+
+// ffmpegAudio returns the encoder and tracks of the audio FFmpeg encodes for
+// an output at savePath
+func ffmpegAudio(ctx context.Context, args cliArgs, probe ffmpeg.ProbeResult, savePath string, renditions bool) (string, []ffmpeg.AudioTrack, error) {
+	codec := audioCodec(args, savePath, false)
+	encoders := map[string]string{"copy": "copy"}
+	encoder := func(codec string) (string, error) {
+		if encoders[codec] == "" {
+			name, err := ffmpeg.AudioEncoder(ctx, codec)
+			if err != nil {
+				return "", fmt.Errorf("failed to find audio encoder: %w", err)
+			}
+			encoders[codec] = name
+		}
+		return encoders[codec], nil
+	}
+
+	defaultEncoder, err := encoder(codec)
+	if err != nil {
+		return "", nil, err
+	}
+	var tracks []ffmpeg.AudioTrack
+	for _, track := range audioTracks(args, probe, codec, outputContainer(savePath, false), renditions) {
+		// Filters can't shift a track FFmpeg copies
+		if track.Codec == "copy" && track.Delay != 0 {
+			return "", nil, fmt.Errorf("--audio-delay can't shift audio track %d, it is passed through", track.Source)
+		}
+		if track.Codec == "copy" && args.AudioGain != 0 {
+			log.Ctx(ctx).Warn().Int("track", track.Source).Msg("audio track is passed through, --gain doesn't apply to it")
+		}
+		name, err := encoder(track.Codec)
+		if err != nil {
+			return "", nil, err
+		}
+		tracks = append(tracks, ffmpeg.AudioTrack{Encoder: name, Bitrate: track.Bitrate, Channels: track.Channels, Delay: track.Delay, Gain: track.Gain})
+	}
+
+	log.Ctx(ctx).Debug().
+		Str("encoder", defaultEncoder).
+		Interface("tracks", tracks).
+		Msg("audio encoding")
+	return defaultEncoder, tracks, nil
+}
+
+// handbrakeAudio returns the tracks of the audio HandBrake encodes in codec,
+// which keeps the first track by default, and their delays applied afterwards
+func handbrakeAudio(args cliArgs, probe ffmpeg.ProbeResult, codec string) ([]handbrake.AudioTrack, []time.Duration) {
+	tracks := audioTracks(args, probe, codec, outputContainer("", true), false)
+	var hbTracks []handbrake.AudioTrack
+	var delays []time.Duration
+	for _, track := range tracks {
+		hbTracks = append(hbTracks, handbrake.AudioTrack{Codec: track.Codec, Bitrate: track.Bitrate})
+		delays = append(delays, track.Delay)
+	}
+	return hbTracks, delays
+}
+
+// keptAudioTracks returns the audio tracks of the source kept in the output,
+// counted from 0 like --map. Without a selection, HandBrake keeps the first
+// track and FFmpeg the one with the most channels, or every track for
+// renditions, which streaming players choose from.
+func keptAudioTracks(args cliArgs, probe ffmpeg.ProbeResult, renditions bool) []int {
+	sources := make([]int, len(probe.AudioChannels))
+	for i := range sources {
+		sources[i] = i
+	}
+	switch {
+	case args.Encoder != "ffmpeg" || args.Streams.isSet():
+		return keptAudio(args.Streams, sources)
+	case renditions || len(sources) == 0:
+		return sources
+	}
+	return []int{bestAudio(probe)}
+}
+
+// bestAudio returns the audio track FFmpeg keeps when no stream is selected,
+// the one with the most channels
+func bestAudio(probe ffmpeg.ProbeResult) int {
+	best := 0
+	for i, c := range probe.AudioChannels {
+		if c > probe.AudioChannels[best] {
+			best = i
+		}
+	}
+	return best
+}
+
+// parseGain parses a --gain value in dB, e.g. 3dB or -2.5
+func parseGain(value string) (float64, error) {
+	number := strings.TrimSuffix(strings.TrimSuffix(value, "dB"), "db")
+	gain, err := strconv.ParseFloat(strings.TrimSpace(number), 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid --gain %q: expected decibels like 3dB or -2.5dB", value)
+	}
+	return gain, nil
+}
@@ -0,0 +1,56 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// audioDelay shifts the audio tracks of outputs, later for positive delays and
+// earlier for negative ones
+type audioDelay struct {
+	// All shifts every track, Tracks the source tracks counted from 0 like --map
+	All    time.Duration
+	Tracks map[int]time.Duration
+}
+
+// isSet reports whether any track is shifted
+func (d audioDelay) isSet() bool {
+	return d.All != 0 || len(d.Tracks) > 0
+}
+
+// of returns the delay of the source track
+func (d audioDelay) of(source int) time.Duration {
+	if delay, ok := d.Tracks[source]; ok {
+		return delay
+	}
+	return d.All
+}
+
+// parseAudioDelay adds an --audio-delay value to d: a duration shifting every
+// track, or N=duration for the source audio track N, e.g. 250ms or 1=-120ms
+func parseAudioDelay(value string, d *audioDelay) error {
+	track, spec, perTrack := strings.Cut(value, "=")
+	if !perTrack {
+		spec = value
+	}
+	delay, err := time.ParseDuration(spec)
+	if err != nil {
+		return fmt.Errorf("invalid --audio-delay %q: expected a duration like 250ms or -1.2s, or TRACK=DURATION", value)
+	}
+	if !perTrack {
+		d.All = delay
+		return nil
+	}
+
+	index, err := strconv.Atoi(track)
+	if err != nil || index < 0 {
+		return fmt.Errorf("invalid --audio-delay %q: expected an audio track number before =", value)
+	}
+	if d.Tracks == nil {
+		d.Tracks = map[int]time.Duration{}
+	}
+	d.Tracks[index] = delay
+	return nil
+}
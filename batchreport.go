@@ -0,0 +1,160 @@
+package main
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/rs/zerolog/log"
+)
+
+// fileStats is a row of the batch report, describing the job of a file
+type fileStats struct {
+	Path         string  `json:"path"`
+	Status       string  `json:"status"`
+	InputSize    int64   `json:"input_size"`
+	OutputSize   int64   `json:"output_size,omitempty"`
+	SavedPercent float64 `json:"saved_percent,omitempty"`
+	// FPS is the average frame rate of the encode, 0 when nothing was encoded
+	FPS            float64 `json:"fps,omitempty"`
+	ElapsedSeconds float64 `json:"elapsed_seconds"`
+}
+
+// newFileStats returns the report row of a finished job for the file at rel
+func newFileStats(rel string, result encodeResult) fileStats {
+	event := result.Event
+	return fileStats{
+		Path:           rel,
+		Status:         event.Status(),
+		InputSize:      event.InputSize,
+		OutputSize:     event.OutputSize,
+		SavedPercent:   event.SavedPercent,
+		FPS:            math.Round(result.FPS*10) / 10,
+		ElapsedSeconds: math.Round(event.ElapsedSeconds*10) / 10,
+	}
+}
+
+// batchTotals sums the rows of encoded files, the elapsed time of every file.
+// The frame rate is the average of the encodes weighted by their time.
+func batchTotals(files []fileStats) fileStats {
+	total := fileStats{Path: "total", Status: fmt.Sprintf("%d files", len(files))}
+	var encodeSeconds, weightedFPS float64
+	for _, f := range files {
+		total.ElapsedSeconds += f.ElapsedSeconds
+		if f.OutputSize == 0 {
+			continue
+		}
+		total.InputSize += f.InputSize
+		total.OutputSize += f.OutputSize
+		if f.FPS > 0 {
+			encodeSeconds += f.ElapsedSeconds
+			weightedFPS += f.FPS * f.ElapsedSeconds
+		}
+	}
+	if total.InputSize > 0 {
+		saved := float64(total.InputSize-total.OutputSize) / float64(total.InputSize)
+		total.SavedPercent = math.Round(saved*1000) / 10
+	}
+	if encodeSeconds > 0 {
+		total.FPS = math.Round(weightedFPS/encodeSeconds*10) / 10
+	}
+	total.ElapsedSeconds = math.Round(total.ElapsedSeconds*10) / 10
+	return total
+}
+
+// reportBatch prints the report of a batch that encoded files, and writes it
+// to reportPath when given
+func reportBatch(ctx context.Context, files []fileStats, reportPath string) {
+	if len(files) > 0 {
+		fmt.Println()
+		_ = printBatchReport(os.Stdout, files)
+		fmt.Println()
+	}
+	if reportPath == "" {
+		return
+	}
+	if err := writeBatchReport(reportPath, files); err != nil {
+		log.Ctx(ctx).Error().Err(err).Send()
+	}
+}
+
+// printBatchReport writes the table of the files of a batch with their totals
+func printBatchReport(w io.Writer, files []fileStats) error {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "FILE\tSTATUS\tORIGINAL\tNEW\tSAVED\tFPS\tELAPSED\t")
+	for _, f := range append(files, batchTotals(files)) {
+		output, saved := "-", "-"
+		if f.OutputSize > 0 {
+			output, saved = formatBytes(f.OutputSize), fmt.Sprintf("%.1f%%", f.SavedPercent)
+		}
+		fps := "-"
+		if f.FPS > 0 {
+			fps = fmt.Sprintf("%.1f", f.FPS)
+		}
+		elapsed := time.Duration(f.ElapsedSeconds * float64(time.Second)).Round(time.Second)
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\t%s\t%s\t\n",
+			f.Path, f.Status, formatBytes(f.InputSize), output, saved, fps, elapsed)
+	}
+	return tw.Flush()
+}
+
+// validateReportPath checks that the --report format is known from its extension
+func validateReportPath(path string) error {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case "", ".csv", ".json":
+		return nil
+	}
+	return fmt.Errorf("invalid --report %q: expected a .csv or .json file", path)
+}
+
+// writeBatchReport writes the report of a batch to path as CSV or JSON, by its extension
+func writeBatchReport(path string, files []fileStats) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return fmt.Errorf("failed to create report: %w", err)
+	}
+	defer f.Close()
+
+	if strings.EqualFold(filepath.Ext(path), ".json") {
+		enc := json.NewEncoder(f)
+		enc.SetIndent("", "  ")
+		err = enc.Encode(struct {
+			Files []fileStats `json:"files"`
+			Total fileStats   `json:"total"`
+		}{files, batchTotals(files)})
+	} else {
+		err = writeReportCSV(f, files)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to write report: %w", err)
+	}
+	return f.Close()
+}
+
+// writeReportCSV writes the rows and totals of a batch as CSV
+func writeReportCSV(w io.Writer, files []fileStats) error {
+	cw := csv.NewWriter(w)
+	_ = cw.Write([]string{"path", "status", "input_size", "output_size", "saved_percent", "fps", "elapsed_seconds"})
+	for _, f := range append(files, batchTotals(files)) {
+		_ = cw.Write([]string{
+			f.Path,
+			f.Status,
+			strconv.FormatInt(f.InputSize, 10),
+			strconv.FormatInt(f.OutputSize, 10),
+			strconv.FormatFloat(f.SavedPercent, 'f', -1, 64),
+			strconv.FormatFloat(f.FPS, 'f', -1, 64),
+			strconv.FormatFloat(f.ElapsedSeconds, 'f', -1, 64),
+		})
+	}
+	cw.Flush()
+	return cw.Error()
+}
@@ -0,0 +1,42 @@
+package main
+
+import (
+	"context"
+	"time"
+
+	"github.com/rs/zerolog/log"
+
+	"encz/power"
+)
+
+// onBattery reports whether the machine runs on battery, assuming AC power if it can't be detected
+func onBattery(ctx context.Context) bool {
+	battery, err := power.OnBattery()
+	if err != nil {
+		log.Ctx(ctx).Debug().Err(err).Msg("failed to detect the power source")
+		return false
+	}
+	return battery
+}
+
+// waitForAC blocks until the machine is on AC power
+func waitForAC(ctx context.Context) error {
+	if !onBattery(ctx) {
+		return nil
+	}
+	log.Ctx(ctx).Info().Msg("running on battery, waiting for AC power")
+
+	ticker := time.NewTicker(pauseCheckInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+			if !onBattery(ctx) {
+				return nil
+			}
+		}
+	}
+}
@@ -0,0 +1,180 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"text/tabwriter"
+	"time"
+
+	"github.com/rs/zerolog/log"
+
+	"encz/ffmpeg"
+	"encz/power"
+)
+
+// benchResult is the outcome of one encoder and preset combination
+type benchResult struct {
+	Encoder string
+	Preset  string
+	FPS     float64
+	Speed   float64
+	// Watts is the average CPU package power, 0 when it can't be measured
+	Watts float64
+	Size  int64
+	Err   error
+}
+
+// benchMain implements `encz bench [flags] [clip]`
+func benchMain(arguments []string) {
+	fs := flag.NewFlagSet("bench", flag.ExitOnError)
+	encoders := fs.String("encoders", "", "comma-separated ffmpeg encoders to compare (default: every HEVC encoder usable on this machine)")
+	presets := fs.String("presets", "", "comma-separated -preset values to try with each encoder, e.g. fast,medium,slow")
+	length := fs.Duration("length", 20*time.Second, "length of the generated clip when no clip is given")
+
+	args := parseArgs(fs, arguments)
+	if err := setupLogging(args); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+
+	ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer cancel()
+
+	if err := checkTool("ffmpeg", ffmpeg.Binary, "--ffmpeg-path", ffmpegInstallHint()); err != nil {
+		log.Ctx(ctx).Fatal().Msg(err.Error())
+	}
+
+	results, err := runBench(ctx, args, splitList(*encoders), splitList(*presets), *length)
+	exitOnError(ctx, err)
+	printBenchResults(os.Stdout, results)
+}
+
+// splitList splits a comma-separated flag value, dropping empty items
+func splitList(s string) []string {
+	var items []string
+	for _, item := range strings.Split(s, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+// runBench encodes the clip, or a generated one, with each encoder and preset
+func runBench(ctx context.Context, args cliArgs, encoders, presets []string, length time.Duration) ([]benchResult, error) {
+	dir, err := os.MkdirTemp("", "encz-bench-*")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create temp dir: %w", err)
+	}
+	defer os.RemoveAll(dir)
+
+	clip := args.VideoPath
+	if clip == "" {
+		clip = filepath.Join(dir, "clip.mp4")
+		log.Ctx(ctx).Info().Str("length", length.String()).Msg("generating 1080p test clip")
+		if err := ffmpeg.WriteBenchClip(ctx, clip, length); err != nil {
+			return nil, err
+		}
+	}
+	probe, err := ffmpeg.Probe(ctx, clip)
+	if err != nil {
+		return nil, fmt.Errorf("failed to probe clip: %w", err)
+	}
+
+	if len(encoders) == 0 {
+		all, err := ffmpeg.VideoEncoders(ctx)
+		if err != nil {
+			return nil, err
+		}
+		for _, encoder := range hevcEncoders(all) {
+			if ffmpeg.EncoderWorks(ctx, encoder) {
+				encoders = append(encoders, encoder)
+			}
+		}
+		if len(encoders) == 0 {
+			return nil, errors.New("no usable HEVC encoders found, run encz doctor for details")
+		}
+	}
+	if len(presets) == 0 {
+		presets = []string{""}
+	}
+
+	var results []benchResult
+	for _, encoder := range encoders {
+		for _, preset := range presets {
+			if ctx.Err() != nil {
+				return results, ctx.Err()
+			}
+			results = append(results, benchEncode(ctx, args, probe, clip, filepath.Join(dir, "out.mp4"), encoder, preset))
+		}
+	}
+	return results, nil
+}
+
+// benchEncode times one encode of clip, measuring the power drawn where possible
+func benchEncode(ctx context.Context, args cliArgs, probe ffmpeg.ProbeResult, clip, output, encoder, preset string) benchResult {
+	result := benchResult{Encoder: encoder, Preset: preset}
+	log.Ctx(ctx).Info().Str("encoder", encoder).Str("preset", preset).Msg("benchmarking")
+
+	params := ffmpeg.EncodeParams{
+		InputPath:    clip,
+		OutputPath:   output,
+		Quality:      args.Quality,
+		Is10Bit:      args.Is10Bit,
+		VideoEncoder: encoder,
+		Threads:      args.Threads,
+	}
+	if preset != "" {
+		params.OutputArgs = []string{"-preset", preset}
+	}
+
+	startEnergy, metered := power.Energy()
+	start := time.Now()
+	err := ffmpeg.Encode(ctx, params, func(ffmpeg.EncodeProgress) {})
+	elapsed := time.Since(start)
+	if err != nil {
+		result.Err = err
+		return result
+	}
+
+	result.FPS = probe.Duration.Seconds() * probe.FPS / elapsed.Seconds()
+	result.Speed = probe.Duration.Seconds() / elapsed.Seconds()
+	if endEnergy, ok := power.Energy(); metered && ok && endEnergy > startEnergy {
+		result.Watts = (endEnergy - startEnergy) / elapsed.Seconds()
+	}
+	if info, err := os.Stat(output); err == nil {
+		result.Size = info.Size()
+	}
+	os.Remove(output)
+	return result
+}
+
+// printBenchResults writes the table of benchmark results
+func printBenchResults(w io.Writer, results []benchResult) {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "encoder\tpreset\tfps\tspeed\twatts\tsize\t")
+	for _, r := range results {
+		preset := r.Preset
+		if preset == "" {
+			preset = "-"
+		}
+		if r.Err != nil {
+			fmt.Fprintf(tw, "%s\t%s\tfailed: %s\n", r.Encoder, preset, r.Err)
+			continue
+		}
+		watts := "n/a"
+		if r.Watts > 0 {
+			watts = fmt.Sprintf("%.1f", r.Watts)
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%.1f\t%.2fx\t%s\t%s\t\n", r.Encoder, preset, r.FPS, r.Speed, watts, formatBytes(r.Size))
+	}
+	tw.Flush()
+}
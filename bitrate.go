@@ -0,0 +1,95 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/rs/zerolog/log"
+)
+
+// errBitrateCollapsed is the cancellation cause when the bitrate guard aborts an encode
+var errBitrateCollapsed = errors.New("realized bitrate collapsed")
+
+// bitrateGuardWarmup is the amount of encoded media required before the
+// realized bitrate is judged, since openings are often static or black
+const bitrateGuardWarmup = 60 * time.Second
+
+// bitrateGuard watches the realized bitrate of hardware encodes. VideoToolbox
+// is known to produce unwatchable, starved output for certain quality values.
+type bitrateGuard struct {
+	abort          bool
+	floor          int64
+	quality        float64
+	higherIsBetter bool
+	cancel         context.CancelCauseFunc
+	tripped        bool
+}
+
+// newBitrateGuard returns a guard for an encode at the given output
+// resolution, or nil when mode is "off"
+func newBitrateGuard(mode string, width, height int, quality float64, higherIsBetter bool, cancel context.CancelCauseFunc) *bitrateGuard {
+	if mode == "off" {
+		return nil
+	}
+	return &bitrateGuard{
+		abort:          mode == "abort",
+		floor:          minBitrate(width, height),
+		quality:        quality,
+		higherIsBetter: higherIsBetter,
+		cancel:         cancel,
+	}
+}
+
+// minBitrate returns the lowest plausible bitrate in bits per second for a
+// watchable HEVC encode at the given resolution
+func minBitrate(width, height int) int64 {
+	switch maxLength := max(width, height); {
+	case maxLength >= 3000:
+		return 4_000_000
+	case maxLength >= 1900:
+		return 1_500_000
+	case maxLength >= 1200:
+		return 800_000
+	default:
+		return 400_000
+	}
+}
+
+// check judges the realized bitrate after encoded worth of media produced size bytes
+func (g *bitrateGuard) check(ctx context.Context, encoded time.Duration, size int64) {
+	if g == nil || g.tripped || encoded < bitrateGuardWarmup {
+		return
+	}
+
+	bitrate := int64(float64(size*8) / encoded.Seconds())
+	if bitrate >= g.floor {
+		return
+	}
+	g.tripped = true
+
+	suggested := g.suggestQuality()
+
+	event := log.Ctx(ctx).Warn()
+	if g.abort {
+		event = log.Ctx(ctx).Error()
+	}
+	event.
+		Int64("bitrate_kbps", bitrate/1000).
+		Int64("expected_min_kbps", g.floor/1000).
+		Float64("suggested_quality", suggested).
+		Msg("realized bitrate is far below expectations for the resolution, output will likely look bad")
+
+	if g.abort {
+		g.cancel(fmt.Errorf("%w to %d kb/s, try --quality %.0f", errBitrateCollapsed, bitrate/1000, suggested))
+	}
+}
+
+// suggestQuality returns a quality value likely to avoid the collapse
+func (g *bitrateGuard) suggestQuality() float64 {
+	if g.higherIsBetter {
+		return min(100, g.quality+10)
+	}
+	return max(0, g.quality-4)
+}
@@ -0,0 +1,64 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"slices"
+	"time"
+
+	"github.com/mattn/go-isatty"
+	"github.com/rs/zerolog"
+)
+
+// ANSI styles of the console output
+const (
+	ansiReset  = "\x1b[0m"
+	ansiBold   = "\x1b[1m"
+	ansiRed    = "\x1b[31m"
+	ansiGreen  = "\x1b[32m"
+	ansiYellow = "\x1b[33m"
+	ansiCyan   = "\x1b[36m"
+)
+
+// colorAllowed is turned off by --no-color, $NO_COLOR and --cron, see setupLogging
+var colorAllowed = true
+
+// highlightedFields are the log fields holding file names, shown in bold
+var highlightedFields = []string{"file", "input", "output", "output_path", "previous_output", "job", "root"}
+
+// useColor reports whether output to f is styled: colors are allowed and f is a terminal
+func useColor(f *os.File) bool {
+	return colorAllowed && (isatty.IsTerminal(f.Fd()) || isatty.IsCygwinTerminal(f.Fd()))
+}
+
+// paint wraps s in the ANSI style code
+func paint(code, s string) string {
+	if code == "" {
+		return s
+	}
+	return code + s + ansiReset
+}
+
+// consoleWriter returns the human readable log writer to out, with colored
+// levels and highlighted file names when out is a terminal
+func consoleWriter(out *os.File) zerolog.ConsoleWriter {
+	w := zerolog.ConsoleWriter{Out: out, NoColor: !useColor(out), TimeFormat: time.DateTime}
+	if w.NoColor {
+		return w
+	}
+
+	// The name is written right before its value, so it opens the value's style,
+	// which every value closes
+	w.FormatFieldName = func(i any) string {
+		name := fmt.Sprint(i)
+		if slices.Contains(highlightedFields, name) {
+			return ansiCyan + name + "=" + ansiReset + ansiBold
+		}
+		return ansiCyan + name + "=" + ansiReset
+	}
+	w.FormatFieldValue = func(i any) string {
+		// Objects are passed as their JSON bytes
+		return fmt.Sprintf("%s", i) + ansiReset
+	}
+	return w
+}
@@ -0,0 +1,150 @@
+package main
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/rs/zerolog/log"
+
+	"encz/ffmpeg"
+)
+
+// Comparison layouts
+const (
+	layoutSideBySide  = "side-by-side"
+	layoutInterleaved = "interleaved"
+)
+
+// comparePoint is a position in a video, either absolute or relative to its duration
+type comparePoint struct {
+	At      time.Duration
+	Percent float64
+}
+
+// resolve returns the position in a video of the given duration
+func (p comparePoint) resolve(duration time.Duration) time.Duration {
+	if p.Percent > 0 {
+		return time.Duration(float64(duration) * p.Percent / 100)
+	}
+	return p.At
+}
+
+// parseComparePoints parses a list like 10%,50%,00:42:00
+func parseComparePoints(s string) ([]comparePoint, error) {
+	var points []comparePoint
+	for _, part := range strings.Split(s, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		if pct, ok := strings.CutSuffix(part, "%"); ok {
+			n, err := strconv.ParseFloat(pct, 64)
+			if err != nil || n < 0 || n >= 100 {
+				return nil, fmt.Errorf("invalid position %q: percentages must be between 0 and 100", part)
+			}
+			points = append(points, comparePoint{Percent: n})
+			continue
+		}
+		at, err := parseTimestamp(part)
+		if err != nil {
+			return nil, err
+		}
+		points = append(points, comparePoint{At: at})
+	}
+	if len(points) == 0 {
+		return nil, fmt.Errorf("no positions given")
+	}
+	return points, nil
+}
+
+// compareMain implements `encz compare [flags] <source> <encode>`
+func compareMain(arguments []string) {
+	fs := flag.NewFlagSet("compare", flag.ExitOnError)
+	at := fs.String("at", "10%,50%,90%", "comma-separated positions to compare, as percentages or timestamps")
+	layout := fs.String("layout", layoutSideBySide, "side-by-side writes one image per position, interleaved writes the source and encode frames as consecutive images to flip between")
+
+	args := parseArgs(fs, arguments)
+	if err := setupLogging(args); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+
+	ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer cancel()
+
+	encodePath := fs.Arg(1)
+	if args.VideoPath == "" || encodePath == "" {
+		exitInvalid(ctx, errors.New("usage: encz compare [flags] <source> <encode>"))
+	}
+	if *layout != layoutSideBySide && *layout != layoutInterleaved {
+		exitInvalid(ctx, fmt.Errorf("--layout must be %s or %s", layoutSideBySide, layoutInterleaved))
+	}
+	points, err := parseComparePoints(*at)
+	if err != nil {
+		exitInvalid(ctx, fmt.Errorf("invalid --at: %w", err))
+	}
+
+	paths, err := runCompare(ctx, args.VideoPath, encodePath, cmp.Or(args.OutputDir, filepath.Dir(encodePath)), points, *layout)
+	exitOnError(ctx, err)
+	for _, path := range paths {
+		fmt.Println(path)
+	}
+}
+
+// runCompare writes comparison images of the source and encode at points into dir
+// and returns their paths
+func runCompare(ctx context.Context, sourcePath, encodePath, dir string, points []comparePoint, layout string) ([]string, error) {
+	source, err := ffmpeg.Probe(ctx, sourcePath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to probe source: %w", err)
+	}
+	encode, err := ffmpeg.Probe(ctx, encodePath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to probe encode: %w", err)
+	}
+
+	// Compare at the source resolution, that's what a downscaled encode is played back at
+	width, height := source.Width, source.Height
+	duration := min(source.Duration, encode.Duration)
+	stem := strings.TrimSuffix(filepath.Base(encodePath), filepath.Ext(encodePath))
+
+	// PNG, so the comparison doesn't add compression artifacts of its own
+	var paths []string
+	for i, point := range points {
+		at := point.resolve(duration)
+		if at >= duration {
+			return paths, fmt.Errorf("position %s is past the end of the video (%s)", at, duration)
+		}
+		log.Ctx(ctx).Info().Str("at", at.String()).Msg("comparing frames")
+
+		base := filepath.Join(dir, fmt.Sprintf("%s-compare-%02d", stem, i+1))
+		if layout == layoutSideBySide {
+			path := base + ".png"
+			if err := ffmpeg.SideBySide(ctx, sourcePath, encodePath, at, width, height, path); err != nil {
+				return paths, err
+			}
+			paths = append(paths, path)
+			continue
+		}
+
+		sourceFrame, encodeFrame := base+"-a-source.png", base+"-b-encode.png"
+		if err := ffmpeg.ScaledFrame(ctx, sourcePath, at, width, height, sourceFrame); err != nil {
+			return paths, err
+		}
+		if err := ffmpeg.ScaledFrame(ctx, encodePath, at, width, height, encodeFrame); err != nil {
+			return paths, err
+		}
+		paths = append(paths, sourceFrame, encodeFrame)
+	}
+	return paths, nil
+}
@@ -0,0 +1,225 @@
+// Package config loads the YAML config file providing defaults for the command line flags
+package config
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// File is a loaded config file. Top-level scalar and list values are flag
+// defaults keyed by the flag name, with underscores allowed in place of
+// dashes. Mapping values are sections read by the features that need them,
+// including the flags of subcommands under the subcommand name.
+type File struct {
+	Path   string
+	values map[string]yaml.Node
+}
+
+// DefaultPath returns the config file location in the user config dir
+func DefaultPath() (string, error) {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return "", fmt.Errorf("failed to find user config dir: %w", err)
+	}
+	return filepath.Join(dir, "encz", "config.yaml"), nil
+}
+
+// Load reads the config file at path. A missing file yields an empty config.
+func Load(path string) (File, error) {
+	file := File{Path: path, values: map[string]yaml.Node{}}
+
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return file, nil
+	}
+	if err != nil {
+		return file, fmt.Errorf("failed to read config: %w", err)
+	}
+
+	if err := yaml.Unmarshal(data, &file.values); err != nil {
+		return file, fmt.Errorf("failed to parse config %s: %w", path, err)
+	}
+	return file, nil
+}
+
+// Apply sets the flags of fs from the config, so flags given on the command
+// line still take precedence when parsed afterwards
+func (f File) Apply(fs *flag.FlagSet) error {
+	keys := make([]string, 0, len(f.values))
+	for key := range f.values {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		node := f.values[key]
+		if node.Kind == yaml.MappingNode || isSectionList(node) {
+			continue
+		}
+
+		name := strings.ReplaceAll(key, "_", "-")
+		if fs.Lookup(name) == nil {
+			return fmt.Errorf("unknown option %q in %s", key, f.Path)
+		}
+
+		values, err := scalars(node)
+		if err != nil {
+			return fmt.Errorf("invalid value for %q in %s: %w", key, f.Path, err)
+		}
+		for _, value := range values {
+			if err := fs.Set(name, value); err != nil {
+				return fmt.Errorf("invalid value for %q in %s: %w", key, f.Path, err)
+			}
+		}
+	}
+	return nil
+}
+
+// Section decodes the section with the given key into v, reporting whether it exists
+func (f File) Section(key string, v any) (bool, error) {
+	node, ok := f.values[key]
+	if !ok {
+		return false, nil
+	}
+	if err := node.Decode(v); err != nil {
+		return true, fmt.Errorf("invalid %q section in %s: %w", key, f.Path, err)
+	}
+	return true, nil
+}
+
+// Sub returns the section with the given key as a config of its own, used
+// for the flags of subcommands. The result is empty when the section doesn't exist.
+func (f File) Sub(key string) (File, error) {
+	sub := File{Path: f.Path, values: map[string]yaml.Node{}}
+	if _, err := f.Section(key, &sub.values); err != nil {
+		return sub, err
+	}
+	return sub, nil
+}
+
+// Presets returns the presets with the given names from the `presets:` section
+// merged into a config of their own, applied after the config's flag values.
+// A preset's `extends` names the presets it builds on, and the values of a
+// preset replace those of the presets before it, whether extended or listed.
+func (f File) Presets(names []string) (File, error) {
+	merged := File{Path: f.Path, values: map[string]yaml.Node{}}
+	if len(names) == 0 {
+		return merged, nil
+	}
+
+	var presets map[string]map[string]yaml.Node
+	if _, err := f.Section("presets", &presets); err != nil {
+		return merged, err
+	}
+	for _, name := range names {
+		if err := mergePreset(merged.values, presets, name, nil); err != nil {
+			return merged, fmt.Errorf("invalid preset %q in %s: %w", name, f.Path, err)
+		}
+	}
+	return merged, nil
+}
+
+// mergePreset merges the values of the named preset into values, after those
+// of the presets it extends. chain holds the presets being merged, to catch cycles.
+func mergePreset(values map[string]yaml.Node, presets map[string]map[string]yaml.Node, name string, chain []string) error {
+	preset, ok := presets[name]
+	if !ok {
+		known := make([]string, 0, len(presets))
+		for key := range presets {
+			known = append(known, key)
+		}
+		sort.Strings(known)
+		return fmt.Errorf("unknown preset %q, expected one of: %s", name, strings.Join(known, ", "))
+	}
+	for _, seen := range chain {
+		if seen == name {
+			return fmt.Errorf("presets extend each other: %s", strings.Join(append(chain, name), " -> "))
+		}
+	}
+	chain = append(chain, name)
+
+	if node, ok := preset["extends"]; ok {
+		bases, err := scalars(node)
+		if err != nil {
+			return fmt.Errorf("invalid extends of %q: %w", name, err)
+		}
+		for _, base := range bases {
+			if err := mergePreset(values, presets, base, chain); err != nil {
+				return err
+			}
+		}
+	}
+	for key, node := range preset {
+		switch key {
+		case "extends":
+		case "preset":
+			return fmt.Errorf("preset %q sets preset, use extends to build on other presets", name)
+		default:
+			values[key] = node
+		}
+	}
+	return nil
+}
+
+// isSectionList reports whether node is a list of mappings rather than a list of flag values
+func isSectionList(node yaml.Node) bool {
+	return node.Kind == yaml.SequenceNode && len(node.Content) > 0 && node.Content[0].Kind == yaml.MappingNode
+}
+
+// scalars returns the flag values held by node, one per list item
+func scalars(node yaml.Node) ([]string, error) {
+	switch node.Kind {
+	case yaml.ScalarNode:
+		return []string{node.Value}, nil
+	case yaml.SequenceNode:
+		var values []string
+		for _, item := range node.Content {
+			if item.Kind != yaml.ScalarNode {
+				return nil, errors.New("expected a list of values")
+			}
+			values = append(values, item.Value)
+		}
+		return values, nil
+	default:
+		return nil, errors.New("expected a value or a list of values")
+	}
+}
+
+// Setting is a single value written by Write
+type Setting struct {
+	Key     string
+	Value   any
+	Comment string
+}
+
+// Write creates a config file at path with the given settings
+func Write(path string, settings []Setting) error {
+	var b strings.Builder
+	b.WriteString("# encz config, values are defaults for the flags of the same name\n")
+	for _, s := range settings {
+		value, err := yaml.Marshal(s.Value)
+		if err != nil {
+			return fmt.Errorf("failed to encode %q: %w", s.Key, err)
+		}
+		b.WriteString("\n")
+		if s.Comment != "" {
+			fmt.Fprintf(&b, "# %s\n", s.Comment)
+		}
+		fmt.Fprintf(&b, "%s: %s", s.Key, value)
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return fmt.Errorf("failed to create config dir: %w", err)
+	}
+	if err := os.WriteFile(path, []byte(b.String()), 0644); err != nil {
+		return fmt.Errorf("failed to write config: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,176 @@
+package main
+
+import (
+	"cmp"
+	"flag"
+	"fmt"
+	"iter"
+	"os"
+	"strings"
+
+	"encz/config"
+)
+
+// loadConfig loads the config file given with -config in arguments, or the
+// default one, and applies it to the flags of fs. Subcommands also get the
+// section named after them, e.g. `library:`, then come the --preset presets,
+// and for encz serve the environment.
+func loadConfig(fs *flag.FlagSet, arguments []string) (config.File, error) {
+	path := cmp.Or(earlyFlag(fs, arguments, "config"), envFlag(fs, "config"))
+	if path == "" {
+		var err error
+		if path, err = config.DefaultPath(); err != nil {
+			return config.File{}, err
+		}
+	}
+
+	file, err := config.Load(path)
+	if err != nil {
+		return file, err
+	}
+	return file, applyConfig(fs, arguments, file)
+}
+
+// applyConfig applies a loaded config file to the flags of fs like loadConfig
+func applyConfig(fs *flag.FlagSet, arguments []string, file config.File) error {
+	if err := file.Apply(fs); err != nil {
+		return err
+	}
+
+	if fs != flag.CommandLine {
+		sub, err := file.Sub(fs.Name())
+		if err != nil {
+			return err
+		}
+		if err := sub.Apply(fs); err != nil {
+			return err
+		}
+	}
+
+	// Presets named in the config apply unless others are given on the command line
+	names := cmp.Or(earlyFlag(fs, arguments, "preset"), envFlag(fs, "preset"))
+	if names == "" {
+		names = fs.Lookup("preset").Value.String()
+	}
+	presets, err := file.Presets(splitList(names))
+	if err != nil {
+		return err
+	}
+	if err := presets.Apply(fs); err != nil {
+		return err
+	}
+	return applyEnv(fs)
+}
+
+// readsEnv reports whether the flags of fs can be set in the environment.
+// Containers configure encz serve that way rather than with a config file.
+func readsEnv(fs *flag.FlagSet) bool {
+	return fs.Name() == "serve"
+}
+
+// envName returns the environment variable of a flag, e.g. ENCZ_OUTPUT_DIR for -output-dir
+func envName(flagName string) string {
+	return "ENCZ_" + strings.ToUpper(strings.ReplaceAll(flagName, "-", "_"))
+}
+
+// envFlag returns the value of the named flag in the environment, for the
+// flags that must be known before the others are set
+func envFlag(fs *flag.FlagSet, flagName string) string {
+	if !readsEnv(fs) {
+		return ""
+	}
+	return os.Getenv(envName(flagName))
+}
+
+// applyEnv sets the flags of fs given in the environment
+func applyEnv(fs *flag.FlagSet) error {
+	if !readsEnv(fs) {
+		return nil
+	}
+	var err error
+	fs.VisitAll(func(f *flag.Flag) {
+		value, ok := os.LookupEnv(envName(f.Name))
+		if !ok || err != nil {
+			return
+		}
+		if setErr := fs.Set(f.Name, value); setErr != nil {
+			err = fmt.Errorf("invalid value for $%s: %w", envName(f.Name), setErr)
+		}
+	})
+	return err
+}
+
+// earlyFlag returns the value of the named flag in arguments, for the flags
+// that must be known before the others are parsed, like -config
+func earlyFlag(fs *flag.FlagSet, arguments []string, flagName string) string {
+	for name, value := range scanFlags(fs, arguments) {
+		if name == flagName {
+			return value
+		}
+	}
+	return ""
+}
+
+// givenFlags returns the names of the flags given in arguments, rather than
+// set by the config file
+func givenFlags(fs *flag.FlagSet, arguments []string) map[string]bool {
+	given := make(map[string]bool)
+	for name := range scanFlags(fs, arguments) {
+		given[name] = true
+	}
+	return given
+}
+
+// scanFlags yields the names and values of the flags in arguments, as far as
+// fs.Parse reads them
+func scanFlags(fs *flag.FlagSet, arguments []string) iter.Seq2[string, string] {
+	return func(yield func(string, string) bool) {
+		for i := 0; i < len(arguments); i++ {
+			arg := arguments[i]
+			if arg == "--" || arg == "-" || !strings.HasPrefix(arg, "-") {
+				return
+			}
+
+			name, value, hasValue := strings.Cut(strings.TrimLeft(arg, "-"), "=")
+			// Flags given as -name value take the next argument, unless they're boolean
+			if f := fs.Lookup(name); !hasValue && (f == nil || !isBoolFlag(f)) && i+1 < len(arguments) {
+				i++
+				value = arguments[i]
+			}
+			if !yield(name, value) {
+				return
+			}
+		}
+	}
+}
+
+// listFlag is a repeatable flag. The values given on the command line replace
+// those of the config file rather than adding to them.
+type listFlag struct {
+	set   func(string) error
+	reset func()
+}
+
+func (f listFlag) String() string     { return "" }
+func (f listFlag) Set(s string) error { return f.set(s) }
+
+// listVar defines a listFlag, with reset emptying its values
+func listVar(fs *flag.FlagSet, name, usage string, reset func(), set func(string) error) {
+	fs.Var(listFlag{set: set, reset: reset}, name, usage)
+}
+
+// resetLists empties the list flags given in arguments, before parsing them
+func resetLists(fs *flag.FlagSet, arguments []string) {
+	given := givenFlags(fs, arguments)
+	fs.VisitAll(func(f *flag.Flag) {
+		if list, ok := f.Value.(listFlag); ok && given[f.Name] {
+			list.reset()
+		}
+	})
+}
+
+// isBoolFlag reports whether f is a boolean flag, which takes no value after it
+func isBoolFlag(f *flag.Flag) bool {
+	b, ok := f.Value.(interface{ IsBoolFlag() bool })
+	return ok && b.IsBoolFlag()
+}
@@ -0,0 +1,302 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"math"
+	"net"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog/log"
+
+	"encz/library"
+	"encz/proc"
+)
+
+// controlTimeout bounds how long encz control waits for a run to answer
+const controlTimeout = 10 * time.Second
+
+// controlRequest is a command sent to the control socket, one JSON object per line
+type controlRequest struct {
+	// Command is status, skip, cancel, add or pause
+	Command string `json:"command"`
+	// Arg is the file of add, and on, off or toggle for pause
+	Arg string `json:"arg,omitempty"`
+}
+
+// controlReply answers a controlRequest, one JSON object per line
+type controlReply struct {
+	OK     bool           `json:"ok"`
+	Error  string         `json:"error,omitempty"`
+	Status *controlStatus `json:"status,omitempty"`
+}
+
+// controlStatus is the state of a library run reported by the status command
+type controlStatus struct {
+	Root     string            `json:"root"`
+	Current  string            `json:"current,omitempty"`
+	Paused   bool              `json:"paused"`
+	Progress []controlProgress `json:"progress"`
+	Queued   []string          `json:"queued"`
+	Encoded  int               `json:"encoded"`
+	Skipped  int               `json:"skipped"`
+	Failed   int               `json:"failed"`
+}
+
+// controlProgress is the progress of a running encode
+type controlProgress struct {
+	Job        string  `json:"job"`
+	Phase      string  `json:"phase,omitempty"`
+	Percent    float64 `json:"percent"`
+	FPS        float64 `json:"fps"`
+	ETASeconds float64 `json:"eta_seconds,omitempty"`
+}
+
+// controlServer serves the control socket of a library run, letting other
+// programs do what the keys of the TUI do
+type controlServer struct {
+	listener net.Listener
+	path     string
+	root     string
+	queue    *jobQueue
+	control  *batchControl
+	// cancel stops the run after the current file is cancelled
+	cancel context.CancelFunc
+
+	mu      sync.Mutex
+	current string
+	summary librarySummary
+}
+
+// startControlServer listens on the Unix socket at path. A socket left behind
+// by a run that didn't exit cleanly is replaced.
+func startControlServer(ctx context.Context, path, root string, queue *jobQueue, control *batchControl, cancel context.CancelFunc) (*controlServer, error) {
+	if info, err := os.Lstat(path); err == nil && info.Mode()&os.ModeSocket != 0 {
+		if conn, err := net.Dial("unix", path); err == nil {
+			conn.Close()
+			return nil, fmt.Errorf("control socket %s is in use by another run", path)
+		}
+		_ = os.Remove(path)
+	}
+
+	listener, err := net.Listen("unix", path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to listen on control socket: %w", err)
+	}
+	// Anyone who can connect can cancel the run
+	if err := os.Chmod(path, 0600); err != nil {
+		listener.Close()
+		return nil, fmt.Errorf("failed to restrict control socket: %w", err)
+	}
+
+	s := &controlServer{
+		listener: listener,
+		path:     path,
+		root:     root,
+		queue:    queue,
+		control:  control,
+		cancel:   cancel,
+	}
+	go s.serve(ctx)
+	log.Ctx(ctx).Info().Str("socket", path).Msg("listening for control commands")
+	return s, nil
+}
+
+// Close stops listening and removes the socket
+func (s *controlServer) Close() {
+	s.listener.Close()
+	_ = os.Remove(s.path)
+}
+
+// setCurrent records the file being processed
+func (s *controlServer) setCurrent(rel string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.current = rel
+}
+
+// setSummary records the outcomes of the run so far
+func (s *controlServer) setSummary(summary librarySummary) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.summary = summary
+}
+
+func (s *controlServer) serve(ctx context.Context) {
+	for {
+		conn, err := s.listener.Accept()
+		if err != nil {
+			if !errors.Is(err, net.ErrClosed) {
+				log.Ctx(ctx).Warn().Err(err).Msg("control socket stopped accepting connections")
+			}
+			return
+		}
+		go s.handle(ctx, conn)
+	}
+}
+
+// handle answers the commands of a connection until it is closed
+func (s *controlServer) handle(ctx context.Context, conn net.Conn) {
+	defer conn.Close()
+
+	scanner := bufio.NewScanner(conn)
+	enc := json.NewEncoder(conn)
+	for scanner.Scan() {
+
+		var req controlRequest
+		if err := json.Unmarshal(scanner.Bytes(), &req); err != nil {
+			_ = enc.Encode(controlReply{Error: fmt.Sprintf("invalid command: %v", err)})
+			continue
+		}
+		reply := s.run(ctx, req)
+		if reply.Error == "" {
+			reply.OK = true
+		}
+		if err := enc.Encode(reply); err != nil {
+			return
+		}
+	}
+}
+
+// run carries out a command
+func (s *controlServer) run(ctx context.Context, req controlRequest) controlReply {
+	switch req.Command {
+	case "status":
+		return controlReply{Status: s.status()}
+	case "skip":
+		log.Ctx(ctx).Info().Msg("skipping the current file, asked over the control socket")
+		s.control.skip()
+	case "cancel":
+		log.Ctx(ctx).Info().Msg("stopping the run, asked over the control socket")
+		s.cancel()
+	case "add":
+		rel, err := s.add(req.Arg)
+		if err != nil {
+			return controlReply{Error: err.Error()}
+		}
+		log.Ctx(ctx).Info().Str("file", rel).Msg("queued over the control socket")
+	case "pause":
+		switch req.Arg {
+		case "", "toggle":
+			togglePause(ctx)
+		case "on", "off":
+			setPaused(ctx, req.Arg == "on")
+		default:
+			return controlReply{Error: fmt.Sprintf("invalid pause %q, expected on, off or toggle", req.Arg)}
+		}
+	default:
+		return controlReply{Error: fmt.Sprintf("unknown command %q, expected status, skip, cancel, add or pause", req.Command)}
+	}
+	return controlReply{}
+}
+
+// add queues a video file of the library, given relative to its root or absolute
+func (s *controlServer) add(path string) (string, error) {
+	if path == "" {
+		return "", fmt.Errorf("add requires a file")
+	}
+	if !filepath.IsAbs(path) {
+		path = filepath.Join(s.root, path)
+	}
+	rel, ok := relativeTo(s.root, path)
+	if !ok {
+		return "", fmt.Errorf("%s is not in the library %s", path, s.root)
+	}
+	if !library.IsVideo(path) {
+		return "", fmt.Errorf("%s is not a video file", path)
+	}
+	if info, err := os.Stat(path); err != nil || info.IsDir() {
+		return "", fmt.Errorf("no such file: %s", path)
+	}
+	s.queue.Push(rel)
+	return rel, nil
+}
+
+// status returns the state of the run
+func (s *controlServer) status() *controlStatus {
+	s.mu.Lock()
+	status := &controlStatus{
+		Root:    s.root,
+		Current: s.current,
+		Encoded: s.summary.Encoded,
+		Skipped: s.summary.Skipped,
+		Failed:  s.summary.Failed,
+	}
+	s.mu.Unlock()
+
+	status.Paused = proc.Paused()
+	status.Queued = s.queue.Items()
+	if status.Queued == nil {
+		status.Queued = []string{}
+	}
+	status.Progress = []controlProgress{}
+	for _, p := range jobStatuses.snapshot() {
+		status.Progress = append(status.Progress, controlProgress{
+			Job:        p.Label,
+			Phase:      p.Phase,
+			Percent:    math.Round(p.Percent*10) / 10,
+			FPS:        math.Round(p.FPS*10) / 10,
+			ETASeconds: p.ETA.Round(time.Second).Seconds(),
+		})
+	}
+	return status
+}
+
+// controlMain implements `encz control -socket <path> <command> [arg]`, sending
+// a command to the control socket of a running library run and printing the reply
+func controlMain(arguments []string) {
+	fs := flag.NewFlagSet("control", flag.ExitOnError)
+	socket := fs.String("socket", "", "control socket of the run, as given to encz library --control-socket")
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "usage: encz control -socket <path> status | skip | cancel | add <file> | pause [on|off|toggle]")
+		fs.PrintDefaults()
+	}
+	_ = fs.Parse(arguments)
+
+	if *socket == "" || fs.NArg() == 0 || fs.NArg() > 2 {
+		fs.Usage()
+		os.Exit(2)
+	}
+	req := controlRequest{Command: fs.Arg(0), Arg: fs.Arg(1)}
+
+	reply, err := sendControl(*socket, req)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	if reply.Error != "" {
+		fmt.Fprintln(os.Stderr, reply.Error)
+		os.Exit(1)
+	}
+	if reply.Status != nil {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		_ = enc.Encode(reply.Status)
+	}
+}
+
+// sendControl sends a command to the control socket at path and returns the reply
+func sendControl(path string, req controlRequest) (controlReply, error) {
+	conn, err := net.DialTimeout("unix", path, controlTimeout)
+	if err != nil {
+		return controlReply{}, fmt.Errorf("failed to connect to control socket: %w", err)
+	}
+	defer conn.Close()
+	_ = conn.SetDeadline(time.Now().Add(controlTimeout))
+
+	if err := json.NewEncoder(conn).Encode(req); err != nil {
+		return controlReply{}, fmt.Errorf("failed to send command: %w", err)
+	}
+	var reply controlReply
+	if err := json.NewDecoder(conn).Decode(&reply); err != nil {
+		return controlReply{}, fmt.Errorf("failed to read reply: %w", err)
+	}
+	return reply, nil
+}
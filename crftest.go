@@ -0,0 +1,202 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+	"text/tabwriter"
+	"time"
+
+	"github.com/rs/zerolog/log"
+
+	"encz/ffmpeg"
+)
+
+// defaultTargetVMAF is the score generally considered visually transparent for HD content
+const defaultTargetVMAF = 93
+
+// qualityTrial is the outcome of encoding the sample at one quality
+type qualityTrial struct {
+	Quality float64
+	Size    int64
+	// EstimatedSize extrapolates Size to the full video
+	EstimatedSize int64
+	VMAF          float64
+}
+
+// crfTestMain implements `encz crf-test [flags] <file>`
+func crfTestMain(arguments []string) {
+	fs := flag.NewFlagSet("crf-test", flag.ExitOnError)
+	qualities := fs.String("qualities", "", "comma-separated qualities to try (default: four steps around --quality)")
+	sampleLength := fs.Duration("sample", 60*time.Second, "length of the sample to encode")
+	var at time.Duration
+	fs.Func("at", "start of the sample (default: the middle of the video)", func(s string) error {
+		var err error
+		at, err = parseTimestamp(s)
+		return err
+	})
+	target := fs.Float64("target-vmaf", defaultTargetVMAF, "lowest acceptable VMAF score for the recommendation")
+
+	args := parseArgs(fs, arguments)
+	if err := setupLogging(args); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+
+	ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer cancel()
+
+	if args.VideoPath == "" {
+		exitInvalid(ctx, errors.New("usage: encz crf-test [flags] <file>"))
+	}
+	if err := args.Validate(); err != nil {
+		exitInvalid(ctx, err)
+	}
+	if *sampleLength <= 0 {
+		exitInvalid(ctx, errors.New("--sample must be positive"))
+	}
+
+	values, err := parseQualities(*qualities, args.Quality)
+	if err != nil {
+		exitInvalid(ctx, fmt.Errorf("invalid --qualities: %w", err))
+	}
+
+	// Samples are cut and scored with ffmpeg whichever engine encodes
+	checkPreflight(ctx, args)
+	if err := checkTool("ffmpeg", ffmpeg.Binary, "--ffmpeg-path", ffmpegInstallHint()); err != nil {
+		log.Ctx(ctx).Fatal().Msg(err.Error())
+	}
+
+	trials, err := runCRFTest(ctx, args, values, at, *sampleLength)
+	if err != nil {
+		exitOnError(ctx, err)
+	}
+	printQualityTrials(os.Stdout, trials, *target)
+}
+
+// parseQualities parses the --qualities list, defaulting to steps around quality
+func parseQualities(s string, quality float64) ([]float64, error) {
+	if s == "" {
+		var values []float64
+		for _, step := range []float64{-4, 0, 4, 8} {
+			if q := quality + step; q > 0 {
+				values = append(values, q)
+			}
+		}
+		return values, nil
+	}
+
+	var values []float64
+	for _, part := range strings.Split(s, ",") {
+		q, err := strconv.ParseFloat(strings.TrimSpace(part), 64)
+		if err != nil || q <= 0 {
+			return nil, fmt.Errorf("invalid quality %q", part)
+		}
+		values = append(values, q)
+	}
+	return values, nil
+}
+
+// runCRFTest encodes a sample of the video at each quality and scores it against the source
+func runCRFTest(ctx context.Context, args cliArgs, qualities []float64, at, length time.Duration) ([]qualityTrial, error) {
+	probe, err := ffmpeg.Probe(ctx, args.VideoPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to probe video: %w", err)
+	}
+	args.Detelecine = resolveDetelecine(ctx, args, probe.FPS, args.VideoPath, probe.Duration/2)
+	if at == 0 {
+		at = max(0, (probe.Duration-length)/2)
+	}
+	if at >= probe.Duration {
+		return nil, fmt.Errorf("--at %s is past the end of the video (%s)", at, probe.Duration)
+	}
+
+	dir, err := os.MkdirTemp("", "encz-crf-test-*")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create temp dir: %w", err)
+	}
+	defer os.RemoveAll(dir)
+
+	// The reference is a stream copy, so scores compare against the source itself
+	reference := filepath.Join(dir, "reference"+filepath.Ext(args.VideoPath))
+	log.Ctx(ctx).Info().Str("at", at.String()).Str("length", length.String()).Msg("cutting sample")
+	if err := ffmpeg.CutSample(ctx, args.VideoPath, at, length, reference); err != nil {
+		return nil, err
+	}
+	sample, err := ffmpeg.Probe(ctx, reference)
+	if err != nil {
+		return nil, fmt.Errorf("failed to probe sample: %w", err)
+	}
+
+	var trials []qualityTrial
+	for _, q := range qualities {
+		trialArgs := args
+		trialArgs.VideoPath = reference
+		trialArgs.Quality = q
+		trialArgs.FromTime = 0
+		trialArgs.Duration = 0
+
+		output := filepath.Join(dir, fmt.Sprintf("q%g.mp4", q))
+		log.Ctx(ctx).Info().Float64("quality", q).Msg("encoding sample")
+		if err := encode(ctx, trialArgs, sample, output, 0); err != nil {
+			return trials, fmt.Errorf("failed to encode sample at quality %g: %w", q, err)
+		}
+
+		info, err := os.Stat(output)
+		if err != nil {
+			return trials, fmt.Errorf("failed to stat sample encode: %w", err)
+		}
+		score, err := ffmpeg.VMAF(ctx, output, reference, sample.Width, sample.Height)
+		if err != nil {
+			return trials, err
+		}
+
+		trial := qualityTrial{Quality: q, Size: info.Size(), VMAF: score}
+		if sample.Duration > 0 {
+			trial.EstimatedSize = int64(float64(info.Size()) * probe.Duration.Seconds() / sample.Duration.Seconds())
+		}
+		trials = append(trials, trial)
+	}
+	return trials, nil
+}
+
+// recommendQuality returns the index of the smallest trial scoring at least target, or -1
+func recommendQuality(trials []qualityTrial, target float64) int {
+	best := -1
+	for i, trial := range trials {
+		if trial.VMAF >= target && (best < 0 || trial.Size < trials[best].Size) {
+			best = i
+		}
+	}
+	return best
+}
+
+// printQualityTrials writes the table of trials and the recommended quality
+func printQualityTrials(w io.Writer, trials []qualityTrial, target float64) {
+	best := recommendQuality(trials, target)
+
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "quality\tsample\testimated\tvmaf\t")
+	for i, trial := range trials {
+		mark := ""
+		if i == best {
+			mark = "<- recommended"
+		}
+		fmt.Fprintf(tw, "%g\t%s\t%s\t%.2f\t%s\n", trial.Quality, formatBytes(trial.Size), formatBytes(trial.EstimatedSize), trial.VMAF, mark)
+	}
+	tw.Flush()
+
+	if best < 0 {
+		fmt.Fprintf(w, "\nno quality reached VMAF %g, try better qualities\n", target)
+		return
+	}
+	fmt.Fprintf(w, "\nsmallest encode with VMAF >= %g: -quality %g\n", target, trials[best].Quality)
+}
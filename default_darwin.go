@@ -0,0 +1,4 @@
+package main
+
+// defaultQuality suits the default VideoToolbox encoders, where higher is better
+const defaultQuality = 35
@@ -0,0 +1,6 @@
+//go:build !darwin
+
+package main
+
+// defaultQuality suits the default x265 encoders, where lower is better
+const defaultQuality = 24
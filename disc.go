@@ -0,0 +1,216 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/rs/zerolog/log"
+
+	"encz/ffmpeg"
+	"encz/handbrake"
+	"encz/history"
+)
+
+// discInput is a DVD or Blu-ray folder, encoded by HandBrake one title at a time
+type discInput struct {
+	Root  string
+	Title handbrake.Title
+	// Picked reports whether the title was chosen with --title rather than
+	// being the main feature
+	Picked bool
+}
+
+// openDisc scans the DVD or Blu-ray at args.VideoPath and selects the title to
+// encode. It reports false when the input is not a disc folder.
+func openDisc(ctx context.Context, args cliArgs) (discInput, bool, error) {
+	root, ok := handbrake.DiscRoot(args.VideoPath)
+	if !ok {
+		return discInput{}, false, nil
+	}
+
+	if err := validateDiscArgs(args); err != nil {
+		return discInput{}, true, err
+	}
+
+	titles, mainFeature, err := handbrake.Scan(ctx, root)
+	if err != nil {
+		return discInput{}, true, err
+	}
+	if len(titles) == 0 {
+		return discInput{}, true, fmt.Errorf("no titles found on %s", root)
+	}
+
+	disc := discInput{Root: root, Picked: args.Title > 0}
+	if disc.Picked {
+		title, ok := findTitle(titles, args.Title)
+		if !ok {
+			return discInput{}, true, fmt.Errorf("no title %d on %s, run with --list-titles to see the titles", args.Title, root)
+		}
+		disc.Title = title
+	} else {
+		disc.Title = mainTitle(titles, mainFeature)
+		if !args.MainFeature {
+			log.Ctx(ctx).Info().Int("title", disc.Title.Index).Msg("no --title given, encoding the main feature")
+		}
+	}
+
+	log.Ctx(ctx).Debug().
+		Str("disc", root).
+		Interface("title", disc.Title).
+		Msg("scanned disc")
+	return disc, true, nil
+}
+
+// validateDiscArgs checks that args can encode a disc: only HandBrake reads them
+func validateDiscArgs(args cliArgs) error {
+	if args.Encoder != "handbrake" {
+		return fmt.Errorf("DVD and Blu-ray folders require --encoder handbrake")
+	}
+	for _, f := range args.FallbackEncoders {
+		if f.Engine() != "handbrake" {
+			return fmt.Errorf("DVD and Blu-ray folders require HandBrake fallback encoders, %s is an ffmpeg encoder", f)
+		}
+	}
+	if len(args.Renditions) > 0 || args.Estimate || args.AudioDelay.isSet() {
+		return fmt.Errorf("--renditions, --estimate and --audio-delay are not available for DVD and Blu-ray folders")
+	}
+	return nil
+}
+
+// findTitle returns the title with the given index
+func findTitle(titles []handbrake.Title, index int) (handbrake.Title, bool) {
+	for _, title := range titles {
+		if title.Index == index {
+			return title, true
+		}
+	}
+	return handbrake.Title{}, false
+}
+
+// mainTitle returns the main feature, or the longest title when HandBrake found none
+func mainTitle(titles []handbrake.Title, mainFeature int) handbrake.Title {
+	if title, ok := findTitle(titles, mainFeature); ok {
+		return title
+	}
+	longest := titles[0]
+	for _, title := range titles[1:] {
+		if title.Duration > longest.Duration {
+			longest = title
+		}
+	}
+	return longest
+}
+
+// probe describes the title the way ffprobe describes a file
+func (d discInput) probe() ffmpeg.ProbeResult {
+	probe := ffmpeg.ProbeResult{
+		Duration: d.Title.Duration,
+		FPS:      d.Title.FPS,
+		Width:    d.Title.Width,
+		Height:   d.Title.Height,
+		SampleAR: d.Title.SampleAR,
+	}
+	if probe.Height > 0 {
+		probe.AspectRatio = float64(probe.Width) * max(probe.SampleAR, 1) / float64(probe.Height)
+	}
+	return probe
+}
+
+// namingPath returns the path outputs are named after, e.g. "/media/Movie.mp4", or
+// "/media/Movie - Title 3.mp4" for a title picked with --title
+func (d discInput) namingPath() string {
+	name := filepath.Base(d.Root)
+	if d.Picked {
+		name += fmt.Sprintf(" - Title %d", d.Title.Index)
+	}
+	return filepath.Join(filepath.Dir(d.Root), name+".mp4")
+}
+
+// hash identifies the title in the history. The disc's index files are small
+// and differ between discs, the title tells the titles of a disc apart.
+func (d discInput) hash() (string, error) {
+	h := sha256.New()
+	for _, index := range []string{"VIDEO_TS/VIDEO_TS.IFO", "BDMV/index.bdmv"} {
+		path := filepath.Join(d.Root, filepath.FromSlash(index))
+		if _, err := os.Stat(path); err != nil {
+			continue
+		}
+		fileHash, err := history.HashFile(path)
+		if err != nil {
+			return "", err
+		}
+		h.Write([]byte(fileHash))
+	}
+	fmt.Fprintf(h, ":title=%d", d.Title.Index)
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// files returns the sum of the sizes of the disc's files, and its largest video
+// file, a VOB or M2TS ffmpeg can read on its own
+func (d discInput) files() (size int64, largest string) {
+	var largestSize int64
+	_ = filepath.WalkDir(d.Root, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil || entry.IsDir() {
+			return nil
+		}
+		info, err := entry.Info()
+		if err != nil {
+			return nil
+		}
+		size += info.Size()
+
+		switch strings.ToLower(filepath.Ext(path)) {
+		case ".vob", ".m2ts":
+			if info.Size() > largestSize {
+				largest, largestSize = path, info.Size()
+			}
+		}
+		return nil
+	})
+	return size, largest
+}
+
+// discInfo is the file info of a disc folder reporting the size of its files
+type discInfo struct {
+	os.FileInfo
+	size int64
+}
+
+func (i discInfo) Size() int64 {
+	return i.size
+}
+
+// listTitles prints the titles of the DVD or Blu-ray at path
+func listTitles(ctx context.Context, w io.Writer, path string) error {
+	root, ok := handbrake.DiscRoot(path)
+	if !ok {
+		return fmt.Errorf("%s is not a DVD or Blu-ray folder, expected a folder with VIDEO_TS or BDMV", path)
+	}
+
+	titles, mainFeature, err := handbrake.Scan(ctx, root)
+	if err != nil {
+		return err
+	}
+
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "TITLE\tDURATION\tRESOLUTION\tFPS\tCHAPTERS\tAUDIO\tSUBTITLES\t")
+	for _, title := range titles {
+		index := fmt.Sprint(title.Index)
+		if title.Index == mainFeature {
+			index += " (main)"
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%dx%d\t%.3f\t%d\t%d\t%d\t\n",
+			index, title.Duration.Truncate(time.Second), title.Width, title.Height, title.FPS,
+			title.Chapters, title.Audio, title.Subtitles)
+	}
+	return tw.Flush()
+}
@@ -0,0 +1,134 @@
+package main
+
+import (
+	"fmt"
+	"slices"
+	"strconv"
+
+	"encz/ffmpeg"
+)
+
+// trackFlags are the tracks of the source flagged default or forced in
+// outputs, counted from 0 within their kind like --map, -1 when not set
+type trackFlags struct {
+	DefaultAudio    int
+	DefaultSubtitle int
+	// NoDefaultSubtitle clears the default flag of every subtitle track
+	NoDefaultSubtitle bool
+	ForcedSubtitle    int
+}
+
+// unsetTrackFlags leaves the flags of the tracks to the engine
+var unsetTrackFlags = trackFlags{DefaultAudio: -1, DefaultSubtitle: -1, ForcedSubtitle: -1}
+
+// parseDefaultSubtitle parses a --default-subtitle value, a track number or none
+func parseDefaultSubtitle(value string, flags *trackFlags) error {
+	if value == "none" {
+		flags.NoDefaultSubtitle, flags.DefaultSubtitle = true, -1
+		return nil
+	}
+	track, err := strconv.Atoi(value)
+	if err != nil || track < 0 {
+		return fmt.Errorf("invalid --default-subtitle %q: expected a track number or none", value)
+	}
+	flags.DefaultSubtitle, flags.NoDefaultSubtitle = track, false
+	return nil
+}
+
+// outputTrack returns the position in outputs of a source track kept by sel.
+// The default selection keeps the first track when keepsFirst is set, none otherwise.
+func outputTrack(sel trackSelection, source int, keepsFirst bool) (int, bool) {
+	switch {
+	case sel.None:
+		return 0, false
+	case sel.All:
+		return source, true
+	case len(sel.Indices) > 0:
+		for i, index := range sel.Indices {
+			if index == source {
+				return i, true
+			}
+		}
+		return 0, false
+	}
+	return 0, keepsFirst && source == 0
+}
+
+// validateTrackFlags checks that the tracks flagged default or forced are
+// kept. Without a probe, the audio track kept by FFmpeg's default selection
+// isn't known yet, and is checked once the source is probed.
+func (c *cliArgs) validateTrackFlags(probe *ffmpeg.ProbeResult) error {
+	if c.TrackFlags.DefaultAudio >= 0 {
+		var ok bool
+		if probe != nil {
+			_, ok = outputAudio(*c, *probe, c.TrackFlags.DefaultAudio)
+		} else {
+			_, ok = outputTrack(c.Streams.Audio, c.TrackFlags.DefaultAudio, true)
+			ok = ok || c.Encoder == "ffmpeg" && c.Streams.Audio.isDefault()
+		}
+		if !ok {
+			return fmt.Errorf("--default-audio %d is not kept in outputs, select it with --map a:", c.TrackFlags.DefaultAudio)
+		}
+	}
+	// HandBrake keeps no subtitles unless told to
+	keepsFirst := c.Encoder == "ffmpeg"
+	for _, flag := range []struct {
+		name  string
+		track int
+	}{
+		{"--default-subtitle", c.TrackFlags.DefaultSubtitle},
+		{"--forced-subtitle", c.TrackFlags.ForcedSubtitle},
+	} {
+		if flag.track < 0 {
+			continue
+		}
+		if _, ok := outputTrack(c.Streams.Subtitles, flag.track, keepsFirst); !ok {
+			return fmt.Errorf("%s %d is not kept in outputs, select it with --map s:", flag.name, flag.track)
+		}
+	}
+	return nil
+}
+
+// outputAudio returns the position in outputs of a source audio track, among
+// those keptAudioTracks keeps. Sources read from stdin aren't probed, their
+// tracks are counted as the selection has them.
+func outputAudio(args cliArgs, probe ffmpeg.ProbeResult, source int) (int, bool) {
+	if len(probe.AudioChannels) == 0 {
+		return outputTrack(args.Streams.Audio, source, true)
+	}
+	i := slices.Index(keptAudioTracks(args, probe, len(args.Renditions) > 0), source)
+	return i, i >= 0
+}
+
+// dispositions returns the flags written to the tracks of outputs. Tracks of a
+// kind with a flag set have the flags of the others cleared, muxers would keep
+// several default tracks otherwise.
+func dispositions(args cliArgs, probe ffmpeg.ProbeResult) []ffmpeg.Disposition {
+	var ds []ffmpeg.Disposition
+	flags := args.TrackFlags
+
+	if flags.DefaultAudio >= 0 {
+		track, _ := outputAudio(args, probe, flags.DefaultAudio)
+		ds = append(ds, ffmpeg.Disposition{Kind: "a", Track: -1, Flags: "0"}, ffmpeg.Disposition{Kind: "a", Track: track, Flags: "default"})
+	}
+
+	if flags.DefaultSubtitle < 0 && flags.ForcedSubtitle < 0 && !flags.NoDefaultSubtitle {
+		return ds
+	}
+	ds = append(ds, ffmpeg.Disposition{Kind: "s", Track: -1, Flags: "0"})
+	keepsFirst := args.Encoder == "ffmpeg"
+	defaultTrack, _ := outputTrack(args.Streams.Subtitles, flags.DefaultSubtitle, keepsFirst)
+	forcedTrack, _ := outputTrack(args.Streams.Subtitles, flags.ForcedSubtitle, keepsFirst)
+	switch {
+	case flags.DefaultSubtitle >= 0 && flags.ForcedSubtitle >= 0 && defaultTrack == forcedTrack:
+		ds = append(ds, ffmpeg.Disposition{Kind: "s", Track: defaultTrack, Flags: "default+forced"})
+	default:
+		if flags.DefaultSubtitle >= 0 {
+			ds = append(ds, ffmpeg.Disposition{Kind: "s", Track: defaultTrack, Flags: "default"})
+		}
+		if flags.ForcedSubtitle >= 0 {
+			ds = append(ds, ffmpeg.Disposition{Kind: "s", Track: forcedTrack, Flags: "forced"})
+		}
+	}
+	return ds
+}
@@ -0,0 +1,190 @@
+package main
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"encz/ffmpeg"
+	"encz/handbrake"
+	"encz/ytdlp"
+)
+
+// doctorMain implements `encz doctor`, checking that the external tools work
+func doctorMain(arguments []string) {
+	fs := flag.NewFlagSet("doctor", flag.ExitOnError)
+	args := parseArgs(fs, arguments)
+
+	if err := runDoctor(context.Background(), args, os.Stdout); err != nil {
+		fmt.Fprintln(os.Stderr, "error:", err)
+		os.Exit(1)
+	}
+}
+
+// runDoctor reports the installed tools and encoders, and test encodes with
+// the configured encoder
+func runDoctor(ctx context.Context, args cliArgs, out io.Writer) error {
+	var problems []string
+
+	fmt.Fprintln(out, "Tools:")
+	versions := []struct {
+		name     string
+		binary   string
+		required bool
+		version  func(context.Context) (string, error)
+	}{
+		{"ffmpeg", ffmpeg.Binary, true, ffmpeg.Version},
+		{"ffprobe", ffmpeg.ProbeBinary, true, ffmpeg.ProbeVersion},
+		{"HandBrakeCLI", handbrake.Binary, args.Encoder == "handbrake", handbrake.Version},
+		{"yt-dlp", ytdlp.Binary, args.YTDLP, ytdlp.Version},
+	}
+	found := map[string]bool{}
+	for _, tool := range versions {
+		path, err := exec.LookPath(tool.binary)
+		if err != nil {
+			fmt.Fprintf(out, "  ✗ %-13s %s not found\n", tool.name, tool.binary)
+			if tool.required {
+				problems = append(problems, tool.name+" is not installed")
+			}
+			continue
+		}
+		found[tool.name] = true
+
+		version, err := tool.version(ctx)
+		if err != nil {
+			version = err.Error()
+		}
+		fmt.Fprintf(out, "  ✓ %-13s %s (%s)\n", tool.name, version, path)
+	}
+
+	if found["ffmpeg"] {
+		fmt.Fprintln(out, "\nFFmpeg HEVC encoders:")
+		encoders, err := ffmpeg.VideoEncoders(ctx)
+		if err != nil {
+			return err
+		}
+		for _, encoder := range hevcEncoders(encoders) {
+			if ffmpeg.EncoderWorks(ctx, encoder) {
+				fmt.Fprintf(out, "  ✓ %s\n", encoder)
+			} else {
+				fmt.Fprintf(out, "  ✗ %s (built in, but not usable on this machine)\n", encoder)
+			}
+		}
+	}
+
+	if found["ffmpeg"] {
+		if err := doctorGPUs(ctx, out); err != nil {
+			problems = append(problems, err.Error())
+		}
+	}
+
+	fmt.Fprintln(out, "\nConfigured encoder:")
+	switch args.Encoder {
+	case "ffmpeg":
+		encoder := cmp.Or(args.VideoEncoder, ffmpeg.DefaultVideoEncoder)
+		if !found["ffmpeg"] {
+			fmt.Fprintf(out, "  ✗ ffmpeg/%s: ffmpeg is not installed\n", encoder)
+		} else if ffmpeg.EncoderWorks(ctx, encoder) {
+			fmt.Fprintf(out, "  ✓ ffmpeg/%s test encode succeeded\n", encoder)
+		} else {
+			fmt.Fprintf(out, "  ✗ ffmpeg/%s test encode failed\n", encoder)
+			problems = append(problems, "the configured encoder doesn't work")
+		}
+	case "handbrake":
+		encoder := cmp.Or(args.VideoEncoder, handbrake.DefaultVideoEncoder)
+		if err := doctorHandbrake(ctx, encoder, args.Is10Bit, found); err != nil {
+			fmt.Fprintf(out, "  ✗ handbrake/%s: %s\n", encoder, err)
+			problems = append(problems, "the configured encoder doesn't work")
+		} else {
+			fmt.Fprintf(out, "  ✓ handbrake/%s test encode succeeded\n", encoder)
+		}
+	default:
+		problems = append(problems, fmt.Sprintf("unknown encoder %q", args.Encoder))
+	}
+
+	if len(problems) > 0 {
+		return errors.New(strings.Join(problems, ", "))
+	}
+	fmt.Fprintln(out, "\nEverything looks good.")
+	return nil
+}
+
+// doctorHandbrake test encodes a synthetic clip with HandBrake, which can't
+// generate its own input
+func doctorHandbrake(ctx context.Context, encoder string, is10Bit bool, found map[string]bool) error {
+	if !found["HandBrakeCLI"] {
+		return errors.New("HandBrakeCLI is not installed")
+	}
+	if !found["ffmpeg"] {
+		return errors.New("ffmpeg is needed to create the test clip")
+	}
+
+	dir, err := os.MkdirTemp("", "encz-doctor-*")
+	if err != nil {
+		return fmt.Errorf("failed to create temp dir: %w", err)
+	}
+	defer os.RemoveAll(dir)
+
+	sample := filepath.Join(dir, "sample.mp4")
+	if err := ffmpeg.WriteTestClip(ctx, sample); err != nil {
+		return err
+	}
+	return handbrake.EncoderWorks(ctx, encoder, is10Bit, sample)
+}
+
+// hevcEncoders filters the HEVC encoders from a list of FFmpeg encoders
+func hevcEncoders(encoders []string) []string {
+	var hevc []string
+	for _, encoder := range encoders {
+		if strings.HasPrefix(encoder, "hevc_") || encoder == "libx265" {
+			hevc = append(hevc, encoder)
+		}
+	}
+	return hevc
+}
+
+// maxProbedSessions is the most concurrent sessions doctorGPUs opens per GPU,
+// above what consumer NVIDIA drivers allow
+const maxProbedSessions = 16
+
+// doctorGPUs lists the GPUs usable with --gpu, and the encoder sessions each
+// NVIDIA GPU allows, found by opening as many as it accepts
+func doctorGPUs(ctx context.Context, out io.Writer) error {
+	gpus, err := ffmpeg.NvidiaGPUs(ctx)
+	if err != nil {
+		return err
+	}
+	nodes := ffmpeg.RenderNodes()
+	if len(gpus) == 0 && len(nodes) == 0 {
+		return nil
+	}
+
+	fmt.Fprintln(out, "\nGPUs (--gpu):")
+	for _, gpu := range gpus {
+		started := ffmpeg.SessionLimit(ctx, "hevc_nvenc", gpu.Device, maxProbedSessions)
+		if started == 0 {
+			fmt.Fprintf(out, "  ✗ %s %s: hevc_nvenc can't open a session\n", gpu.Device, gpu.Name)
+			continue
+		}
+		if gpu.Sessions < 0 {
+			fmt.Fprintf(out, "  ✓ %s %s: %d free NVENC sessions\n", gpu.Device, gpu.Name, started)
+			continue
+		}
+		limit := fmt.Sprint(started + gpu.Sessions)
+		if started == maxProbedSessions {
+			limit = fmt.Sprintf("%d or more", started+gpu.Sessions)
+		}
+		fmt.Fprintf(out, "  ✓ %s %s: %s NVENC sessions, %d in use\n", gpu.Device, gpu.Name, limit, gpu.Sessions)
+	}
+	for _, node := range nodes {
+		fmt.Fprintf(out, "  ✓ %s (VAAPI and QSV)\n", node.Device)
+	}
+	return nil
+}
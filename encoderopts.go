@@ -0,0 +1,52 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"slices"
+	"strings"
+)
+
+// encoderOptionKey matches the option names of x265 and other encoders, e.g. aq-mode or psy-rd
+var encoderOptionKey = regexp.MustCompile(`^[a-z][a-z0-9-]*$`)
+
+// parseEncoderOptions parses colon-separated key=value options of flag, e.g.
+// aq-mode=3:psy-rd=2.0, where switches like no-sao may have no value
+func parseEncoderOptions(flag, value string) ([]string, error) {
+	var options []string
+	for _, option := range strings.Split(value, ":") {
+		key, _, _ := strings.Cut(option, "=")
+		if !encoderOptionKey.MatchString(key) {
+			return nil, fmt.Errorf("invalid --%s option %q: expected key=value pairs separated by colons", flag, option)
+		}
+		options = append(options, option)
+	}
+	return options, nil
+}
+
+// usesX265 reports whether the video encoder of c is x265
+func (c *cliArgs) usesX265() bool {
+	encoder := videoEncoderName(*c)
+	return encoder == "libx265" || strings.HasPrefix(encoder, "x265")
+}
+
+// validateEncoderOptions checks that the encoder options reach an encoder taking them
+func (c *cliArgs) validateEncoderOptions() error {
+	if len(c.X265Params) > 0 && !c.usesX265() {
+		return fmt.Errorf("--x265-params requires the x265 video encoder, libx265 with ffmpeg or x265 with HandBrake")
+	}
+	if len(c.EncoderOptions) > 0 && c.Encoder == "ffmpeg" {
+		return fmt.Errorf("--encopts is for HandBrake, use --x265-params or --ff-out with ffmpeg")
+	}
+	return nil
+}
+
+// handbrakeOptions returns the --encopts of HandBrake encodes, the x265 params
+// only reaching x265
+func (c *cliArgs) handbrakeOptions() []string {
+	options := c.EncoderOptions
+	if c.usesX265() {
+		options = append(slices.Clone(c.X265Params), options...)
+	}
+	return options
+}
@@ -0,0 +1,100 @@
+package main
+
+import (
+	"bufio"
+	"cmp"
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/rs/zerolog/log"
+
+	"encz/ffmpeg"
+)
+
+// Samples encoded by --estimate, spread evenly across the encoded range
+const (
+	estimateSamples      = 5
+	estimateSampleLength = 10 * time.Second
+)
+
+// confirmEstimate prints the estimated output size and asks whether to encode
+func confirmEstimate(ctx context.Context, args cliArgs, probe ffmpeg.ProbeResult, sourceSize int64, encodeDuration time.Duration) (bool, error) {
+	estimate, err := estimateSize(ctx, args, probe, encodeDuration)
+	if err != nil {
+		return false, err
+	}
+
+	log.Ctx(ctx).Info().
+		Str("estimated_size", formatBytes(estimate)).
+		Str("source_size", formatBytes(sourceSize)).
+		Msg("estimated output size")
+	if estimate >= sourceSize {
+		log.Ctx(ctx).Warn().Msg("the encode is estimated to be larger than the source")
+	}
+
+	if args.Yes {
+		return true, nil
+	}
+	p := &prompter{in: bufio.NewReader(os.Stdin), out: os.Stderr}
+	return p.confirm("Encode?", false), nil
+}
+
+// estimateSize encodes short samples spread across the encoded range and
+// extrapolates their size to the whole range
+func estimateSize(ctx context.Context, args cliArgs, probe ffmpeg.ProbeResult, encodeDuration time.Duration) (int64, error) {
+	mediaDuration := cmp.Or(encodeDuration, probe.Duration-args.FromTime)
+	samples := max(1, min(estimateSamples, int(mediaDuration/(2*estimateSampleLength))))
+
+	dir, err := os.MkdirTemp("", "encz-estimate-*")
+	if err != nil {
+		return 0, fmt.Errorf("failed to create temp dir: %w", err)
+	}
+	defer os.RemoveAll(dir)
+
+	// Sample progress would only be noise before the real encode
+	ctx = withProgressView(ctx, discardView{})
+	log.Ctx(ctx).Info().Int("samples", samples).Msg("encoding samples to estimate the output size")
+
+	var sampledBytes int64
+	var sampledDuration time.Duration
+	for i := range samples {
+		at := args.FromTime + mediaDuration*time.Duration(2*i+1)/time.Duration(2*samples) - estimateSampleLength/2
+		at = max(args.FromTime, at)
+
+		input := filepath.Join(dir, fmt.Sprintf("sample-%d%s", i, filepath.Ext(args.VideoPath)))
+		if err := ffmpeg.CutSample(ctx, args.VideoPath, at, min(estimateSampleLength, mediaDuration), input); err != nil {
+			return 0, err
+		}
+		sample, err := ffmpeg.Probe(ctx, input)
+		if err != nil {
+			return 0, fmt.Errorf("failed to probe sample: %w", err)
+		}
+
+		sampleArgs := args
+		sampleArgs.VideoPath = input
+		sampleArgs.FromTime, sampleArgs.ToTime, sampleArgs.Duration = 0, 0, 0
+		sampleArgs.Chunked = false
+		sampleArgs.Timeout = 0
+
+		output := filepath.Join(dir, fmt.Sprintf("sample-%d.encoded.mp4", i))
+		if err := encode(ctx, sampleArgs, sample, output, 0); err != nil {
+			return 0, fmt.Errorf("failed to encode sample: %w", err)
+		}
+		info, err := os.Stat(output)
+		if err != nil {
+			return 0, fmt.Errorf("failed to stat sample encode: %w", err)
+		}
+
+		// Samples start at keyframes, so their length differs from what was asked for
+		sampledBytes += info.Size()
+		sampledDuration += sample.Duration
+	}
+
+	if sampledDuration <= 0 {
+		return 0, fmt.Errorf("samples have no duration")
+	}
+	return int64(float64(sampledBytes) * mediaDuration.Seconds() / sampledDuration.Seconds()), nil
+}
@@ -0,0 +1,79 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"strconv"
+
+	"github.com/rs/zerolog"
+	"github.com/rs/zerolog/log"
+)
+
+// Exit codes of encz, for scripts to tell failures apart
+const (
+	// exitFailed is for errors without a code of their own, like missing tools
+	exitFailed        = 1
+	exitInvalidArgs   = 2
+	exitEncoderFailed = 3
+	// exitBatchFailed is for library and *arr runs where files failed
+	exitBatchFailed = 4
+	// exitCancelled is the code of shells for commands stopped by Ctrl-C
+	exitCancelled = 130
+)
+
+// encoderError is a failure of the encoder itself, rather than of the steps around it
+type encoderError struct {
+	err error
+}
+
+func (e encoderError) Error() string { return e.err.Error() }
+func (e encoderError) Unwrap() error { return e.err }
+
+// batchError reports the files of a library or *arr run that failed
+type batchError struct {
+	failed int
+	total  int
+}
+
+func (e batchError) Error() string {
+	return fmt.Sprintf("%d of %d files failed", e.failed, e.total)
+}
+
+// exitInvalid logs an invalid argument error and exits with exitInvalidArgs
+func exitInvalid(ctx context.Context, err error) {
+	log.Ctx(ctx).WithLevel(zerolog.FatalLevel).Err(err).Send()
+	os.Exit(exitInvalidArgs)
+}
+
+// exitCode returns the exit code for the error of a run in ctx. Encoders
+// stopped by the user fail on being killed, their runs count as cancelled.
+func exitCode(ctx context.Context, err error) int {
+	var encoderErr encoderError
+	var batchErr batchError
+	switch {
+	case err == nil:
+		return 0
+	case errors.Is(err, context.Canceled) || ctx.Err() != nil:
+		return exitCancelled
+	case errors.As(err, &batchErr):
+		return exitBatchFailed
+	case errors.As(err, &encoderErr):
+		return exitEncoderFailed
+	default:
+		return exitFailed
+	}
+}
+
+// failFastFlags registers --fail-fast and --keep-going on the flags of a batch
+// command, the last one given wins
+func failFastFlags(fs *flag.FlagSet, failFast *bool) {
+	fs.BoolVar(failFast, "fail-fast", false, "stop the run at the first file that fails to encode")
+	fs.BoolFunc("keep-going", "go on with the next file when one fails to encode (default)", func(s string) error {
+		keepGoing, err := strconv.ParseBool(s)
+		*failFast = !keepGoing
+		return err
+	})
+}
@@ -0,0 +1,161 @@
+package main
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/rs/zerolog/log"
+
+	"encz/ffmpeg"
+	"encz/handbrake"
+)
+
+// fallbackEncoder is an encoder tried when the previous one fails to start
+type fallbackEncoder struct {
+	VideoEncoder string
+	// Quality is the quality of the encoder, 0 for --quality
+	Quality float64
+}
+
+func (f fallbackEncoder) String() string {
+	if f.Quality == 0 {
+		return f.VideoEncoder
+	}
+	return fmt.Sprintf("%s:q%g", f.VideoEncoder, f.Quality)
+}
+
+// Engine returns the engine of the encoder: FFmpeg names such as libx265 and
+// hevc_nvenc are told apart from HandBrake names such as x265 and nvenc_h265
+func (f fallbackEncoder) Engine() string {
+	for _, prefix := range []string{"lib", "hevc_", "h264_", "av1_"} {
+		if strings.HasPrefix(f.VideoEncoder, prefix) {
+			return "ffmpeg"
+		}
+	}
+	return "handbrake"
+}
+
+var fallbackEncoderRe = regexp.MustCompile(`^([\w-]+)(?::q(\d+(?:\.\d+)?))?$`)
+
+// parseFallbackEncoders parses a list of encoders such as vt_h265,libx265:q24
+func parseFallbackEncoders(s string) ([]fallbackEncoder, error) {
+	var encoders []fallbackEncoder
+	for _, spec := range strings.Split(s, ",") {
+		m := fallbackEncoderRe.FindStringSubmatch(strings.TrimSpace(spec))
+		if m == nil {
+			return nil, fmt.Errorf("invalid fallback encoder %q: expected <encoder>[:q<quality>], e.g. libx265:q24", spec)
+		}
+		quality, _ := strconv.ParseFloat(cmp.Or(m[2], "0"), 64)
+		encoders = append(encoders, fallbackEncoder{VideoEncoder: m[1], Quality: quality})
+	}
+	return encoders, nil
+}
+
+// withFallback returns the arguments encoding with f instead of the selected encoder
+func (c cliArgs) withFallback(f fallbackEncoder) cliArgs {
+	c.Encoder = f.Engine()
+	c.VideoEncoder = f.VideoEncoder
+	c.Quality = cmp.Or(f.Quality, c.Quality)
+	c.FallbackEncoders = nil
+	if c.validateGPU() != nil {
+		c.GPU = ""
+	}
+	return c
+}
+
+// validateFallbacks checks that each fallback encoder works with the other arguments
+func (c *cliArgs) validateFallbacks() error {
+	if len(c.FallbackEncoders) == 0 {
+		return nil
+	}
+	if c.Chunked || len(c.Renditions) > 0 {
+		return fmt.Errorf("--fallback-encoders cannot be combined with --chunked or --renditions")
+	}
+
+	higherIsBetter := qualityHigherIsBetter(c.Encoder, c.VideoEncoder)
+	for _, f := range c.FallbackEncoders {
+		// A quality of 35 is good on VideoToolbox's scale and poor on x265's
+		if f.Quality == 0 && qualityHigherIsBetter(f.Engine(), f.VideoEncoder) != higherIsBetter {
+			return fmt.Errorf("fallback encoder %s uses a different quality scale, add one, e.g. %s:q24", f, f.VideoEncoder)
+		}
+		fallback := c.withFallback(f)
+		if err := fallback.validateEncoding(); err != nil {
+			return fmt.Errorf("invalid fallback encoder %s: %w", f, err)
+		}
+	}
+	return nil
+}
+
+// qualityHigherIsBetter reports whether higher quality values mean better quality for the encoder of engine
+func qualityHigherIsBetter(engine, encoder string) bool {
+	if engine == "ffmpeg" {
+		return ffmpeg.QualityHigherIsBetter(encoder)
+	}
+	return handbrake.QualityHigherIsBetter(encoder)
+}
+
+// encoderStartErrors are messages of encoders that are unavailable on this
+// machine or out of sessions, as opposed to failing halfway through a file
+var encoderStartErrors = []string{
+	"Unknown encoder",
+	"Error while opening encoder",
+	"OpenEncodeSessionEx failed",
+	"No capable devices found",
+	"cannot create compression session",
+	"Error initializing an internal MFX session",
+	"Failed to initialise VAAPI connection",
+	"Invalid video encoder",
+	"failure to initialize encoder",
+}
+
+// isEncoderStartFailure reports whether err is an encoder failing to start
+func isEncoderStartFailure(err error) bool {
+	if errors.Is(err, context.Canceled) || errors.Is(err, errBitrateCollapsed) || errors.Is(err, errTimedOut) {
+		return false
+	}
+
+	msg := strings.ToLower(err.Error())
+	for _, s := range encoderStartErrors {
+		if strings.Contains(msg, strings.ToLower(s)) {
+			return true
+		}
+	}
+	return false
+}
+
+// encodeWithFallback encodes with the selected encoder, moving on to the
+// fallback encoders while they fail to start. It returns the arguments of
+// the encoder that produced the output.
+func encodeWithFallback(ctx context.Context, args cliArgs, probe ffmpeg.ProbeResult, savePath string, encodeDuration time.Duration) (cliArgs, error) {
+	current := args
+	err := encode(ctx, current, probe, savePath, encodeDuration)
+	for _, f := range args.FallbackEncoders {
+		if err == nil || ctx.Err() != nil || !isEncoderStartFailure(err) {
+			break
+		}
+
+		log.Ctx(ctx).Warn().
+			Err(err).
+			Str("encoder", videoEncoderName(current)).
+			Stringer("fallback", f).
+			Msg("encoder failed to start, trying the next one")
+
+		current = args.withFallback(f)
+		err = encode(ctx, current, probe, savePath, encodeDuration)
+	}
+	return current, err
+}
+
+// videoEncoderName returns the selected video encoder, or the default of the engine
+func videoEncoderName(args cliArgs) string {
+	if args.Encoder == "ffmpeg" {
+		return cmp.Or(args.VideoEncoder, ffmpeg.DefaultVideoEncoder)
+	}
+	return cmp.Or(args.VideoEncoder, handbrake.DefaultVideoEncoder)
+}
@@ -0,0 +1,114 @@
+package ffmpeg
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Audio codecs of EncodeParams.AudioEncoder, resolved to an encoder by AudioEncoder
+const (
+	AudioAAC  = "aac"
+	AudioOpus = "opus"
+	AudioAC3  = "ac3"
+	AudioEAC3 = "eac3"
+)
+
+// aacEncoders are the AAC encoders in order of preference: Fraunhofer's and
+// Apple's sound better than FFmpeg's own at the same bitrate
+var aacEncoders = []string{"libfdk_aac", "aac_at", "aac"}
+
+// AudioTrack is how an output audio track is encoded
+type AudioTrack struct {
+	// Encoder overrides AudioEncoder for the track, "copy" passes it through
+	Encoder string
+	// Bitrate is in kbps
+	Bitrate int
+	// Channels downmixes the track, 0 keeps the channels of the input
+	Channels int
+	// Delay shifts the track, later for positive delays and earlier for negative ones
+	Delay time.Duration
+	// Gain changes the volume of the track in dB
+	Gain float64
+}
+
+// AudioEncoder returns the best encoder of codec FFmpeg was built with
+func AudioEncoder(ctx context.Context, codec string) (string, error) {
+	switch codec {
+	case AudioOpus:
+		return "libopus", nil
+	case AudioAC3, AudioEAC3:
+		return codec, nil
+	case AudioAAC:
+		encoders, err := listEncoders(ctx, 'A')
+		if err != nil {
+			return "", err
+		}
+		for _, encoder := range aacEncoders {
+			if slices.Contains(encoders, encoder) {
+				return encoder, nil
+			}
+		}
+		return "aac", nil
+	}
+	return "", fmt.Errorf("unknown audio codec %q", codec)
+}
+
+// audioArgs returns the options encoding the kept audio tracks, FFmpeg's
+// default encoder for the container is used without an AudioEncoder
+func audioArgs(params EncodeParams) []string {
+	if params.AudioCopy {
+		return []string{"-c:a", "copy"}
+	}
+	if params.AudioEncoder == "" {
+		return nil
+	}
+
+	args := []string{"-c:a", params.AudioEncoder}
+	// Variable bitrate Opus is transparent at lower bitrates than constant
+	if params.AudioEncoder == "libopus" {
+		args = append(args, "-vbr", "on")
+	}
+	for i, track := range params.AudioTracks {
+		if track.Encoder != "" && track.Encoder != params.AudioEncoder {
+			args = append(args, fmt.Sprintf("-c:a:%d", i), track.Encoder)
+			if track.Encoder == "copy" {
+				continue
+			}
+			if track.Encoder == "libopus" {
+				args = append(args, fmt.Sprintf("-vbr:a:%d", i), "on")
+			}
+		}
+		args = append(args, fmt.Sprintf("-b:a:%d", i), fmt.Sprintf("%dk", track.Bitrate))
+		if track.Channels > 0 {
+			args = append(args, fmt.Sprintf("-ac:a:%d", i), strconv.Itoa(track.Channels))
+		}
+		if filter := audioFilter(track); filter != "" {
+			args = append(args, fmt.Sprintf("-filter:a:%d", i), filter)
+		}
+	}
+	return args
+}
+
+// audioFilter returns the filter chain shifting and amplifying track. Delays
+// pad the start with silence or cut it, gains above 0dB are limited to keep
+// peaks from clipping.
+func audioFilter(track AudioTrack) string {
+	var filters []string
+	switch {
+	case track.Delay > 0:
+		filters = append(filters, fmt.Sprintf("adelay=delays=%d:all=1", track.Delay.Milliseconds()))
+	case track.Delay < 0:
+		filters = append(filters, fmt.Sprintf("atrim=start=%s,asetpts=PTS-STARTPTS", seconds(-track.Delay)))
+	}
+	if track.Gain != 0 {
+		filters = append(filters, fmt.Sprintf("volume=%sdB", strconv.FormatFloat(track.Gain, 'f', -1, 64)))
+	}
+	if track.Gain > 0 {
+		filters = append(filters, "alimiter=limit=0.98:level=false")
+	}
+	return strings.Join(filters, ",")
+}
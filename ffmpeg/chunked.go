@@ -0,0 +1,609 @@
+package ffmpeg
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog/log"
+
+	"encz/proc"
+)
+
+// ChunkParams configures chunked parallel encoding
+type ChunkParams struct {
+	// ChunkDuration is the target length of a chunk. Chunks are cut at the
+	// first keyframe after it, so they always start on a clean boundary.
+	ChunkDuration time.Duration
+	// Workers are the machines encoding chunks. When empty, chunks are encoded
+	// on the local machine using DefaultChunkWorkers slots.
+	Workers []Worker
+	// OnChunkProgress optionally receives the progress of individual chunks
+	OnChunkProgress func(ChunkProgress)
+}
+
+// ChunkProgress represents the encoding progress of a single chunk
+type ChunkProgress struct {
+	Index  int
+	Count  int
+	Worker string
+	// OutTime is the duration of the chunk encoded so far
+	OutTime time.Duration
+	FPS     float64
+	Done    bool
+}
+
+// Worker represents a machine that encodes chunks
+type Worker struct {
+	// Host is an ssh destination like user@host, empty for the local machine
+	Host string
+	// Port is the ssh port, the ssh default when zero
+	Port int
+	// Slots is the number of chunks the worker encodes concurrently. For
+	// devices it is the weight of the device, its concurrent encode sessions.
+	Slots int
+	// VideoEncoder overrides the video encoder of the encode, selecting a
+	// hardware device like hevc_nvenc or hevc_qsv
+	VideoEncoder string
+}
+
+// IsRemote reports whether the worker encodes over ssh
+func (w Worker) IsRemote() bool {
+	return w.Host != ""
+}
+
+func (w Worker) String() string {
+	name := w.Host
+	if !w.IsRemote() {
+		name = "local"
+	}
+	if w.VideoEncoder != "" {
+		name += "/" + w.VideoEncoder
+	}
+	return name
+}
+
+// ParseDevice parses a local device worker like hevc_nvenc=2, where the
+// number is the weight of the device, i.e. its concurrent encode sessions
+func ParseDevice(spec string) (Worker, error) {
+	encoder, weight, found := strings.Cut(spec, "=")
+	if encoder == "" {
+		return Worker{}, fmt.Errorf("invalid device %q: expected encoder[=weight]", spec)
+	}
+
+	worker := Worker{VideoEncoder: encoder, Slots: 1}
+	if found {
+		slots, err := strconv.Atoi(weight)
+		if err != nil || slots < 1 {
+			return Worker{}, fmt.Errorf("invalid device weight %q", weight)
+		}
+		worker.Slots = slots
+	}
+
+	return worker, nil
+}
+
+// ParseWorker parses a worker address like ssh://user@host:22?slots=2
+func ParseWorker(addr string) (Worker, error) {
+	u, err := url.Parse(addr)
+	if err != nil {
+		return Worker{}, fmt.Errorf("invalid worker address %q: %w", addr, err)
+	}
+	if u.Scheme != "ssh" || u.Hostname() == "" {
+		return Worker{}, fmt.Errorf("invalid worker address %q: expected ssh://[user@]host[:port]", addr)
+	}
+
+	worker := Worker{Host: u.Hostname(), Slots: 1}
+	if u.User != nil {
+		worker.Host = u.User.Username() + "@" + worker.Host
+	}
+	if port := u.Port(); port != "" {
+		if worker.Port, err = strconv.Atoi(port); err != nil {
+			return Worker{}, fmt.Errorf("invalid worker port %q: %w", port, err)
+		}
+	}
+	if slots := u.Query().Get("slots"); slots != "" {
+		if worker.Slots, err = strconv.Atoi(slots); err != nil || worker.Slots < 1 {
+			return Worker{}, fmt.Errorf("invalid worker slots %q", slots)
+		}
+	}
+
+	return worker, nil
+}
+
+// DefaultChunkWorkers returns the default number of concurrent chunk encodes.
+// Software encoders already use several threads each, so one worker per core
+// would oversubscribe the CPU.
+func DefaultChunkWorkers() int {
+	return max(2, runtime.NumCPU()/4)
+}
+
+// EncodeChunked splits the input into chunks at keyframes, encodes the chunks
+// in parallel and concatenates them losslessly together with the source audio
+func EncodeChunked(ctx context.Context, params EncodeParams, chunks ChunkParams, onProgress ProgressCallback) error {
+	report := func(phase string, percent float64) {
+		if onProgress != nil {
+			onProgress(EncodeProgress{Phase: phase, Percent: percent})
+		}
+	}
+
+	totalDuration := params.Duration
+	if totalDuration == 0 {
+		report(PhaseProbing, 0)
+		probe, err := Probe(ctx, params.InputPath)
+		if err != nil {
+			return fmt.Errorf("failed to probe video: %w", err)
+		}
+		totalDuration = probe.Duration - params.FromTime
+	}
+
+	tmpDir, err := os.MkdirTemp(filepath.Dir(params.OutputPath), ".encz-chunks-")
+	if err != nil {
+		return fmt.Errorf("failed to create chunk directory: %w", err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	report(PhaseSplitting, 0)
+	sources, err := splitChunks(ctx, params, chunks.ChunkDuration, tmpDir)
+	if err != nil {
+		return err
+	}
+
+	log.Ctx(ctx).Debug().
+		Int("chunks", len(sources)).
+		Msg("split source into chunks")
+
+	workers := chunks.Workers
+	if len(workers) == 0 {
+		workers = []Worker{{Slots: DefaultChunkWorkers()}}
+	}
+
+	encoded, err := encodeChunks(ctx, params, sources, workers, totalDuration, onProgress, chunks.OnChunkProgress)
+	if err != nil {
+		return err
+	}
+
+	report(PhaseMuxing, 100)
+	return concatChunks(ctx, params, encoded, tmpDir)
+}
+
+// splitChunks cuts the video stream of the input into chunk files without re-encoding
+func splitChunks(ctx context.Context, params EncodeParams, chunkDuration time.Duration, dir string) ([]string, error) {
+	args := []string{Binary, "-v", "error"}
+	args = append(args, trimArgs(params)...)
+	args = append(args,
+		"-i", params.InputPath,
+		"-map", "0:v:0",
+		"-c", "copy",
+		"-f", "segment",
+		"-segment_time", fmt.Sprintf("%.0f", chunkDuration.Seconds()),
+		"-reset_timestamps", "1",
+		filepath.Join(dir, "source_%05d.mkv"),
+	)
+
+	log.Ctx(ctx).Debug().Strs("args", args).Msg("splitting source into chunks")
+
+	if err := runCopy(ctx, args); err != nil {
+		return nil, fmt.Errorf("failed to split source: %w", err)
+	}
+
+	sources, err := filepath.Glob(filepath.Join(dir, "source_*.mkv"))
+	if err != nil {
+		return nil, err
+	}
+	if len(sources) == 0 {
+		return nil, fmt.Errorf("splitting produced no chunks")
+	}
+	slices.Sort(sources)
+
+	return sources, nil
+}
+
+// encodeChunks encodes the chunk files using a pool of workers and reports
+// the combined progress of all chunks
+func encodeChunks(ctx context.Context, params EncodeParams, sources []string, workers []Worker, totalDuration time.Duration, onProgress ProgressCallback, onChunkProgress func(ChunkProgress)) ([]string, error) {
+	ctx, cancel := context.WithCancelCause(ctx)
+	defer cancel(nil)
+
+	outputs := make([]string, len(sources))
+	for i, src := range sources {
+		outputs[i] = strings.Replace(src, "source_", "encoded_", 1)
+	}
+
+	tracker := newChunkTracker(len(sources), onProgress, onChunkProgress)
+	jobs := make(chan int)
+
+	var wg sync.WaitGroup
+	for _, worker := range workers {
+		for range max(1, worker.Slots) {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				for i := range jobs {
+					log.Ctx(ctx).Debug().
+						Int("chunk", i).
+						Stringer("worker", worker).
+						Msg("encoding chunk")
+
+					if err := encodeChunk(ctx, worker, params, sources[i], outputs[i], totalDuration, func(p EncodeProgress) {
+						tracker.update(i, worker, p)
+					}); err != nil {
+						cancel(fmt.Errorf("failed to encode chunk %d on %s: %w", i, worker, err))
+						return
+					}
+					tracker.finish(i, worker)
+				}
+			}()
+		}
+	}
+
+	for i := range sources {
+		select {
+		case jobs <- i:
+		case <-ctx.Done():
+		}
+	}
+	close(jobs)
+	wg.Wait()
+
+	if err := context.Cause(ctx); err != nil {
+		return nil, err
+	}
+
+	return outputs, nil
+}
+
+// encodeChunk encodes a single video-only chunk on a worker. Remote workers
+// receive the chunk on stdin and stream the result back on stdout, so the
+// remote host only needs ffmpeg and no shared storage.
+func encodeChunk(ctx context.Context, worker Worker, params EncodeParams, src, dst string, totalDuration time.Duration, onProgress ProgressCallback) error {
+	if worker.VideoEncoder != "" {
+		params.VideoEncoder = worker.VideoEncoder
+	}
+
+	input, output, progress := src, dst, "pipe:1"
+	if worker.IsRemote() {
+		input, output, progress = "pipe:0", "pipe:1", "pipe:2"
+	}
+
+	args := []string{
+		"ffmpeg",
+		"-y",
+		"-v", "error",
+		"-progress", progress,
+		"-stats_period", "3",
+	}
+	// GPUs of remote workers are their own
+	if worker.IsRemote() {
+		params.GPU = ""
+	}
+	args = append(args, gpuInputArgs(params)...)
+	args = append(args, params.InputArgs...)
+	args = append(args,
+		"-i", input,
+		"-an", "-sn",
+	)
+	args = append(args, videoCodecArgs(params)...)
+	if filter := videoFilter(params); filter != "" {
+		args = append(args, "-vf", filter)
+	}
+	args = append(args, "-f", "matroska", output)
+
+	var cmd *exec.Cmd
+	var progressPipe io.ReadCloser
+	var err error
+
+	if worker.IsRemote() {
+		// Remote workers use the ffmpeg on their PATH
+		cmd = exec.CommandContext(ctx, "ssh", sshArgs(worker, args)...)
+		proc.Detach(cmd)
+
+		in, openErr := os.Open(src)
+		if openErr != nil {
+			return openErr
+		}
+		defer in.Close()
+
+		out, createErr := os.Create(dst)
+		if createErr != nil {
+			return createErr
+		}
+		defer out.Close()
+
+		cmd.Stdin = in
+		cmd.Stdout = out
+		progressPipe, err = cmd.StderrPipe()
+	} else {
+		cmd = proc.Command(ctx, Binary, args[1:]...)
+		cmd.Stderr = params.LogOutput
+		progressPipe, err = cmd.StdoutPipe()
+	}
+	if err != nil {
+		return fmt.Errorf("failed to create progress pipe: %w", err)
+	}
+
+	if err := cmd.Start(); err != nil {
+		return fmt.Errorf("failed to start FFmpeg: %w", err)
+	}
+	defer proc.Track(cmd)()
+
+	// Errors of remote workers share stderr with the progress
+	var progressOutput io.Reader = progressPipe
+	if worker.IsRemote() && params.LogOutput != nil {
+		progressOutput = io.TeeReader(progressPipe, params.LogOutput)
+	}
+	for progress := range iterProgress(progressOutput, progressTotal{duration: totalDuration}) {
+		onProgress(progress)
+	}
+
+	return cmd.Wait()
+}
+
+// sshArgs returns the ssh arguments running command on a remote worker
+func sshArgs(worker Worker, command []string) []string {
+	args := []string{"-o", "BatchMode=yes"}
+	if worker.Port > 0 {
+		args = append(args, "-p", strconv.Itoa(worker.Port))
+	}
+	args = append(args, worker.Host, "--")
+
+	// ssh joins its arguments into a single remote shell command
+	quoted := make([]string, len(command))
+	for i, arg := range command {
+		quoted[i] = proc.ShellQuote(arg)
+	}
+
+	return append(args, strings.Join(quoted, " "))
+}
+
+// concatChunks joins the encoded chunks and muxes them with the source audio and subtitles
+func concatChunks(ctx context.Context, params EncodeParams, encoded []string, dir string) error {
+	var list strings.Builder
+	for _, path := range encoded {
+		// Paths are relative to the list file, and chunk names never need quoting
+		fmt.Fprintf(&list, "file '%s'\n", filepath.Base(path))
+	}
+
+	listPath := filepath.Join(dir, "chunks.txt")
+	if err := os.WriteFile(listPath, []byte(list.String()), 0644); err != nil {
+		return fmt.Errorf("failed to write chunk list: %w", err)
+	}
+
+	args := []string{
+		Binary,
+		"-y",
+		"-v", "error",
+		"-f", "concat",
+		"-safe", "0",
+		"-i", listPath,
+	}
+	audioTrim, err := audioTrimArgs(ctx, params)
+	if err != nil {
+		return err
+	}
+	args = append(args, audioTrim...)
+	args = append(args, "-i", params.InputPath, "-map", "0:v")
+	args = append(args, params.Audio.maps(1, "a", "-map", "1:a:0?")...)
+	args = append(args, sideStreamArgs(params, params.Subtitles.maps(1, "s", "-map", "1:s:0?"))...)
+	args = append(args, "-c:v", "copy")
+
+	args = append(args, audioArgs(params)...)
+	args = append(args, metadataArgs(params, 1, 1)...)
+	// Chunks are video-only matroska files, so output options only apply to the final file
+	args = append(args, params.OutputArgs...)
+	args = append(args, params.ExtraArgs...)
+	args = append(args, params.OutputPath)
+
+	log.Ctx(ctx).Debug().Strs("args", args).Msg("concatenating chunks")
+
+	if err := runCopy(ctx, args); err != nil {
+		return fmt.Errorf("failed to concatenate chunks: %w", err)
+	}
+
+	return nil
+}
+
+// runCopy runs the ffmpeg splitting or joining chunks like the encodes, so
+// it's paused, stopped and lowered in priority with them
+func runCopy(ctx context.Context, args []string) error {
+	cmd := proc.Command(ctx, args[0], args[1:]...)
+	var output bytes.Buffer
+	cmd.Stdout = &output
+	cmd.Stderr = &output
+	if err := cmd.Start(); err != nil {
+		return err
+	}
+	defer proc.Track(cmd)()
+
+	if err := cmd.Wait(); err != nil {
+		return fmt.Errorf("%w: %s", err, strings.TrimSpace(output.String()))
+	}
+	return nil
+}
+
+// accurateSeekPreroll is how far before --from a fast input seek lands with
+// accurate seeking, the rest is decoded and dropped to cut on the exact frame
+const accurateSeekPreroll = 30 * time.Second
+
+// trimArgs returns the input options selecting the requested time range
+func trimArgs(params EncodeParams) []string {
+	if params.AccurateSeek {
+		if params.FromTime > accurateSeekPreroll {
+			return []string{"-ss", seconds(params.FromTime - accurateSeekPreroll)}
+		}
+		return nil
+	}
+
+	var args []string
+	if params.FromTime > 0 {
+		args = append(args, "-ss", fmt.Sprintf("%d", int(params.FromTime.Seconds())))
+	}
+	if params.Duration > 0 {
+		args = append(args, "-t", fmt.Sprintf("%d", int(params.Duration.Seconds())))
+	}
+	return args
+}
+
+// audioTrimArgs returns the input options cutting the audio like the video of
+// the chunks, which is copied from the keyframe before the seek of trimArgs
+func audioTrimArgs(ctx context.Context, params EncodeParams) ([]string, error) {
+	from := params.FromTime.Truncate(time.Second)
+	if from == 0 {
+		return trimArgs(params), nil
+	}
+
+	start, err := keyframeBefore(ctx, params.InputPath, from)
+	if err != nil {
+		return nil, err
+	}
+	args := []string{"-ss", seconds(start)}
+	if params.Duration > 0 {
+		args = append(args, "-t", seconds(params.Duration.Truncate(time.Second)+from-start))
+	}
+	return args, nil
+}
+
+// keyframeBefore returns the time of the video keyframe a seek of ffmpeg to t
+// lands on
+func keyframeBefore(ctx context.Context, path string, t time.Duration) (time.Duration, error) {
+	output, err := exec.CommandContext(ctx, ProbeBinary,
+		"-v", "error",
+		"-select_streams", "v:0",
+		// Like -ss, the offset is from the start time of the file
+		"-read_intervals", fmt.Sprintf("+%s%%+#1", seconds(t)),
+		"-show_entries", "packet=pts_time:format=start_time",
+		"-of", "default=noprint_wrappers=1",
+		path).Output()
+	if err != nil {
+		return 0, fmt.Errorf("failed to find the keyframe before %s: %w", t, err)
+	}
+
+	values := make(map[string]float64)
+	for line := range strings.Lines(string(output)) {
+		key, value, _ := strings.Cut(strings.TrimSpace(line), "=")
+		if v, err := strconv.ParseFloat(value, 64); err == nil {
+			values[key] = v
+		}
+	}
+	pts, ok := values["pts_time"]
+	if !ok {
+		return 0, fmt.Errorf("no keyframe found before %s", t)
+	}
+	return max(0, time.Duration((pts-values["start_time"])*float64(time.Second))), nil
+}
+
+// accurateTrimArgs returns the output options completing trimArgs with accurate seeking
+func accurateTrimArgs(params EncodeParams) []string {
+	if !params.AccurateSeek {
+		return nil
+	}
+
+	var args []string
+	if params.FromTime > 0 {
+		var preSeek time.Duration
+		if params.FromTime > accurateSeekPreroll {
+			preSeek = params.FromTime - accurateSeekPreroll
+		}
+		args = append(args, "-ss", seconds(params.FromTime-preSeek))
+	}
+	if params.Duration > 0 {
+		args = append(args, "-t", seconds(params.Duration))
+	}
+	return args
+}
+
+// seconds formats d as fractional seconds for ffmpeg
+func seconds(d time.Duration) string {
+	return strconv.FormatFloat(d.Seconds(), 'f', 3, 64)
+}
+
+// chunkTracker combines the progress of concurrently encoded chunks
+type chunkTracker struct {
+	mu              sync.Mutex
+	chunks          []EncodeProgress
+	done            []bool
+	startTime       time.Time
+	onProgress      ProgressCallback
+	onChunkProgress func(ChunkProgress)
+}
+
+func newChunkTracker(n int, onProgress ProgressCallback, onChunkProgress func(ChunkProgress)) *chunkTracker {
+	return &chunkTracker{
+		chunks:          make([]EncodeProgress, n),
+		done:            make([]bool, n),
+		startTime:       time.Now(),
+		onProgress:      onProgress,
+		onChunkProgress: onChunkProgress,
+	}
+}
+
+// update records the progress of chunk i and reports the combined progress
+func (t *chunkTracker) update(i int, worker Worker, p EncodeProgress) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.chunks[i] = p
+	t.reportChunk(i, worker)
+	t.report()
+}
+
+// finish marks chunk i as fully encoded
+func (t *chunkTracker) finish(i int, worker Worker) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.done[i] = true
+	t.reportChunk(i, worker)
+	t.report()
+}
+
+func (t *chunkTracker) reportChunk(i int, worker Worker) {
+	if t.onChunkProgress == nil {
+		return
+	}
+	t.onChunkProgress(ChunkProgress{
+		Index:   i,
+		Count:   len(t.chunks),
+		Worker:  worker.String(),
+		OutTime: t.chunks[i].OutTime,
+		FPS:     t.chunks[i].FPSAvg,
+		Done:    t.done[i],
+	})
+}
+
+func (t *chunkTracker) report() {
+	if t.onProgress == nil {
+		return
+	}
+
+	// Chunk percentages are relative to the total duration, so they add up
+	combined := EncodeProgress{Phase: PhaseEncoding}
+	for i, p := range t.chunks {
+		combined.Percent += p.Percent
+		combined.CurrentSize += p.CurrentSize
+		combined.OutTime += p.OutTime
+		if !t.done[i] {
+			combined.FPSAvg += p.FPSAvg
+		}
+	}
+	combined.Percent = round(min(100, combined.Percent), 2)
+
+	if combined.Percent > 0 && combined.Percent < 100 {
+		elapsed := time.Since(t.startTime)
+		estimated := time.Duration(float64(elapsed) * 100 / combined.Percent)
+		combined.ETA = (estimated - elapsed).Truncate(time.Second)
+	}
+
+	t.onProgress(combined)
+}
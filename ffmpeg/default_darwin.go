@@ -0,0 +1,5 @@
+package ffmpeg
+
+// DefaultVideoEncoder is the video encoder used when none is specified.
+// Every Mac since 2017 encodes HEVC with VideoToolbox.
+const DefaultVideoEncoder = "hevc_videotoolbox"
@@ -0,0 +1,7 @@
+//go:build !darwin
+
+package ffmpeg
+
+// DefaultVideoEncoder is the video encoder used when none is specified.
+// Hardware encoders depend on the GPU elsewhere, x265 runs anywhere.
+const DefaultVideoEncoder = "libx265"
@@ -2,6 +2,8 @@ package ffmpeg
 
 import (
 	"bufio"
+	"bytes"
+	"cmp"
 	"context"
 	"encoding/json"
 	"errors"
@@ -9,13 +11,18 @@ import (
 	"io"
 	"iter"
 	"math"
+	"os"
 	"os/exec"
 	"path/filepath"
+	"regexp"
+	"slices"
 	"strconv"
 	"strings"
 	"time"
 
 	"github.com/rs/zerolog/log"
+
+	"encz/proc"
 )
 
 // EncodeParams represents parameters for video encoding
@@ -29,24 +36,369 @@ type EncodeParams struct {
 	Width      int
 	Height     int
 	ExtraArgs  []string
+	AudioCopy  bool
+	// VideoEncoder is the ffmpeg video encoder, DefaultVideoEncoder when empty
+	VideoEncoder string
+	// LogOutput receives FFmpeg's stderr and progress output
+	LogOutput io.Writer
+	// Threads limits the threads of software encoders, 0 for automatic
+	Threads int
+	// InputArgs are input options placed before -i, e.g. -hwaccel
+	InputArgs []string
+	// OutputArgs are output options placed before the output path, like ExtraArgs
+	OutputArgs []string
+	// VideoFilters are appended to the filter chain after scaling
+	VideoFilters []string
+	// AccurateSeek decodes up to FromTime instead of cutting at the nearest second
+	AccurateSeek bool
+	// Metadata controls the metadata copied from the input
+	Metadata MetadataOptions
+	// SampleAR is the sample aspect ratio of the input, anamorphic inputs are
+	// scaled to square pixels
+	SampleAR float64
+	// HWDecode decodes the input with the HWAccel of the encoder
+	HWDecode bool
+	// GPU selects the device of NVENC, VAAPI and QSV encoders, see ValidateGPU
+	GPU string
+	// Detelecine restores the film frames of telecined input
+	Detelecine bool
+	// Grain is GrainKeep, GrainSynthesize, GrainRemove or empty to leave it to the encoder
+	Grain string
+	// Stabilize smooths camera shake, analysing the motion in a first pass
+	Stabilize bool
+	// Watermark is overlaid on the scaled video when its Path is set
+	Watermark Watermark
+	// VideoTrack is the video stream encoded, counted from 0 among the video streams
+	VideoTrack int
+	// Audio and Subtitles select the streams kept besides the video
+	Audio     Tracks
+	Subtitles Tracks
+	// Attachments keeps the attachments of the input, like fonts, in Matroska outputs
+	Attachments bool
+	// Lossless encodes every pixel of the input exactly, see SupportsLossless
+	Lossless bool
+	// Tune is the -tune of libx264 or libx265, like animation
+	Tune string
+	// X265Params are key=value options of libx265, overriding those set from
+	// the other params
+	X265Params []string
+	// AudioEncoder encodes the audio tracks, FFmpeg's default for the container when empty
+	AudioEncoder string
+	// AudioTracks are the bitrates and channels of the output audio tracks in order
+	AudioTracks []AudioTrack
+
+	// Stdin is read for a "pipe:0" input, InputDuration is its length as
+	// streams can't be probed ahead. Stdout receives a "pipe:1" output, whose
+	// format is set with -f in OutputArgs, and progress is read from stderr then.
+	Stdin         io.Reader
+	InputDuration time.Duration
+	Stdout        io.Writer
+
+	// transforms is the camera motion file of the stabilization pass
+	transforms string
+}
+
+// Executables run by the package, overridable for systems with several FFmpeg builds
+var (
+	Binary      = "ffmpeg"
+	ProbeBinary = "ffprobe"
+)
+
+// Film grain handling of EncodeParams.Grain
+const (
+	// GrainKeep tunes x265 to spend bits on the grain instead of smoothing it
+	GrainKeep = "keep"
+	// GrainSynthesize denoises the input and has AV1 players add the grain back
+	GrainSynthesize = "synthesize"
+	// GrainRemove denoises the input
+	GrainRemove = "remove"
+)
+
+// SupportsGrainSynthesis reports whether encoder can describe the grain of the
+// input for players to synthesize, which the AV1 software encoders do
+func SupportsGrainSynthesis(encoder string) bool {
+	switch cmp.Or(encoder, DefaultVideoEncoder) {
+	case "libsvtav1", "libaom-av1":
+		return true
+	}
+	return false
+}
+
+// IsSoftwareEncoder reports whether encoder runs on the CPU rather than dedicated hardware
+func IsSoftwareEncoder(encoder string) bool {
+	return strings.HasPrefix(encoder, "lib")
+}
+
+// QualityHigherIsBetter reports whether higher quality values mean better
+// quality for encoder. VideoToolbox uses a 1-100 quality scale, while the
+// CRF/CQ style rate control of other encoders treats lower values as better.
+func QualityHigherIsBetter(encoder string) bool {
+	return strings.HasSuffix(cmp.Or(encoder, DefaultVideoEncoder), "_videotoolbox")
+}
+
+// PixelFormat returns the pixel format frames are converted to for encoder, or an
+// empty string to leave it to FFmpeg. Without one FFmpeg passes 4:2:2 and 4:4:4
+// sources on as they are, which the main and main10 profiles reject.
+func PixelFormat(encoder string, is10Bit bool) string {
+	encoder = cmp.Or(encoder, DefaultVideoEncoder)
+	switch {
+	case strings.HasSuffix(encoder, "_vaapi"):
+		// Frames are uploaded to the GPU by a filter, which picks the format
+		return ""
+	case strings.HasSuffix(encoder, "_videotoolbox"), strings.HasSuffix(encoder, "_qsv"):
+		if is10Bit {
+			return "p010le"
+		}
+		return "nv12"
+	case strings.HasSuffix(encoder, "_nvenc"):
+		if is10Bit {
+			return "p010le"
+		}
+		return "yuv420p"
+	default:
+		if is10Bit {
+			return "yuv420p10le"
+		}
+		return "yuv420p"
+	}
+}
+
+// videoCodecArgs returns the encoder selection, rate control and profile arguments
+func videoCodecArgs(params EncodeParams) []string {
+	encoder := cmp.Or(params.VideoEncoder, DefaultVideoEncoder)
+	quality := fmt.Sprintf("%.0f", params.Quality)
+
+	args := []string{"-c:v", encoder}
+	var x265Params []string
+
+	switch {
+	case params.Lossless:
+		args = append(args, losslessArgs(encoder)...)
+		if encoder == "libx265" {
+			x265Params = append(x265Params, "lossless=1")
+		}
+	case strings.HasSuffix(encoder, "_videotoolbox"):
+		args = append(args, "-q:v", quality)
+	case strings.HasSuffix(encoder, "_nvenc"):
+		args = append(args, "-rc", "vbr", "-cq", quality)
+	case strings.HasSuffix(encoder, "_qsv"):
+		args = append(args, "-global_quality", quality)
+	case strings.HasSuffix(encoder, "_vaapi"):
+		args = append(args, "-qp", quality)
+	default:
+		args = append(args, "-crf", quality)
+	}
+
+	if strings.HasPrefix(encoder, "hevc_") || encoder == "libx265" {
+		profile := "main"
+		if params.Is10Bit {
+			profile = "main10"
+		}
+		args = append(args, "-profile:v", profile)
+	}
+
+	if pixFmt := PixelFormat(encoder, params.Is10Bit); pixFmt != "" {
+		args = append(args, "-pix_fmt", pixFmt)
+	}
+	args = append(args, gpuOutputArgs(params)...)
+
+	switch {
+	case params.Tune != "" && (encoder == "libx264" || encoder == "libx265"):
+		args = append(args, "-tune", params.Tune)
+	case params.Grain == GrainKeep && encoder == "libx265":
+		args = append(args, "-tune", "grain")
+	case params.Grain == GrainSynthesize && encoder == "libsvtav1":
+		args = append(args, "-svtav1-params", "film-grain=8:film-grain-denoise=1")
+	case params.Grain == GrainSynthesize && encoder == "libaom-av1":
+		args = append(args, "-denoise-noise-level", "8")
+	}
+
+	if params.Threads > 0 {
+		args = append(args, "-threads", strconv.Itoa(params.Threads))
+		// libx265 ignores -threads and sizes its own thread pool
+		if encoder == "libx265" {
+			x265Params = append(x265Params, fmt.Sprintf("pools=%d", params.Threads))
+		}
+	}
+	if encoder == "libx265" {
+		x265Params = mergeOptions(x265Params, params.X265Params)
+	}
+	if len(x265Params) > 0 {
+		args = append(args, "-x265-params", strings.Join(x265Params, ":"))
+	}
+
+	return args
+}
+
+// mergeOptions returns the key=value options of base with those of extra
+// added, replacing the base options of the same keys
+func mergeOptions(base, extra []string) []string {
+	key := func(option string) string {
+		k, _, _ := strings.Cut(option, "=")
+		return k
+	}
+	var merged []string
+	for _, option := range base {
+		if !slices.ContainsFunc(extra, func(e string) bool { return key(e) == key(option) }) {
+			merged = append(merged, option)
+		}
+	}
+	return append(merged, extra...)
+}
+
+// SupportsLossless reports whether encoder can encode losslessly
+func SupportsLossless(encoder string) bool {
+	switch cmp.Or(encoder, DefaultVideoEncoder) {
+	case "libx265", "libx264", "ffv1", "hevc_nvenc", "h264_nvenc":
+		return true
+	}
+	return false
+}
+
+// losslessArgs returns the rate control of encoder for lossless encoding,
+// x265 takes it among its own parameters
+func losslessArgs(encoder string) []string {
+	switch encoder {
+	case "libx264":
+		return []string{"-qp", "0"}
+	case "ffv1":
+		// Intra-only with checksummed slices, the archival settings of FFV1 version 3
+		return []string{"-level", "3", "-g", "1", "-slicecrc", "1"}
+	case "hevc_nvenc", "h264_nvenc":
+		return []string{"-tune", "lossless"}
+	}
+	return nil
+}
+
+// scaleFilter returns the scale filter for the requested dimensions, or an empty string
+func scaleFilter(params EncodeParams) string {
+	switch {
+	case params.Width > 0 && params.Height > 0:
+		// Both dimensions specified - scale to exact size maintaining aspect ratio (fit within)
+		return fmt.Sprintf("scale=%d:%d:force_original_aspect_ratio=decrease", params.Width, params.Height)
+	case params.Width > 0:
+		// Only width specified - scale proportionally
+		return fmt.Sprintf("scale=%d:-2", params.Width)
+	case params.Height > 0:
+		// Only height specified - scale proportionally
+		return fmt.Sprintf("scale=-2:%d", params.Height)
+	default:
+		return ""
+	}
+}
+
+// videoFilter returns the source, stabilize, scale and denoise filters followed
+// by the extra filters and the watermark, or an empty string
+func videoFilter(params EncodeParams) string {
+	filters := sourceFilters(params)
+	if params.transforms != "" {
+		filters = append(filters, stabilizeFilter(params.transforms))
+	}
+	if filter := scaleFilter(params); filter != "" {
+		filters = append(filters, filter)
+	}
+	// Denoising after scaling filters fewer pixels
+	if params.Grain == GrainRemove {
+		filters = append(filters, "hqdn3d")
+	}
+	filters = append(filters, params.VideoFilters...)
+	return params.Watermark.overlay(strings.Join(filters, ","), "")
+}
+
+// sourceFilters returns the filters restoring the frames of the source: the
+// film frames of telecined video and square pixels
+func sourceFilters(params EncodeParams) []string {
+	var filters []string
+	// Field matching needs the fields as they were interlaced
+	if params.Detelecine {
+		filters = append(filters, telecineFilter)
+	}
+	// Players disagree on anamorphic video, square pixels display the same everywhere
+	if isAnamorphic(params.SampleAR) {
+		filters = append(filters, "scale=trunc(iw*sar/2)*2:ih,setsar=1")
+	}
+	return filters
 }
 
 // ProbeResult represents the output of ffprobe analysis
 type ProbeResult struct {
-	Duration    time.Duration
-	Codec       string
-	FPS         float64
-	SizeBytes   int64
-	Width       int
-	Height      int
-	Bitrate     int64
-	Container   string
-	AspectRatio float64
-	SampleAR    float64
+	Duration  time.Duration
+	Codec     string
+	FPS       float64
+	SizeBytes int64
+	Width     int
+	Height    int
+	PixFmt    string
+	Bitrate   int64
+	// ColorTransfer is the transfer characteristic, like smpte2084 for HDR10
+	ColorTransfer string
+	Container     string
+	AspectRatio   float64
+	SampleAR      float64
+	// Tags are the global metadata of the container
+	Tags map[string]string
+	// AudioLanguages and SubtitleLanguages are the language tags of the tracks
+	// of each kind in order, empty for untagged tracks
+	AudioLanguages    []string
+	SubtitleLanguages []string
+	// AudioCodecs and AudioChannels are the codecs and channel counts of the
+	// audio tracks in order
+	AudioCodecs   []string
+	AudioChannels []int
+	// SubtitleCodecs are the codecs of the subtitle tracks in order
+	SubtitleCodecs []string
+	// Fonts is the number of font attachments, which styled subtitles render with
+	Fonts int
+}
+
+// HDR returns the kind of HDR of the video, HDR for PQ (HDR10) and HLG for
+// hybrid log-gamma, or an empty string for SDR. Dolby Vision layers aren't
+// kept by encodes, so they are not reported.
+func (p ProbeResult) HDR() string {
+	switch p.ColorTransfer {
+	case "smpte2084":
+		return "HDR"
+	case "arib-std-b67":
+		return "HLG"
+	}
+	return ""
+}
+
+var bitDepthRegex = regexp.MustCompile(`p0?(\d{2})(le|be)?$`)
+
+// BitDepth returns the bits per component of a pixel format, like 10 for
+// yuv420p10le and p010le, or 8 for the 8-bit formats
+func BitDepth(pixFmt string) int {
+	if m := bitDepthRegex.FindStringSubmatch(pixFmt); m != nil {
+		depth, _ := strconv.Atoi(m[1])
+		return depth
+	}
+	return 8
 }
 
+// IsVertical reports whether the video is displayed taller than wide
 func (p ProbeResult) IsVertical() bool {
-	return p.Width < p.Height
+	width, height := p.DisplaySize()
+	return width < height
+}
+
+// IsAnamorphic reports whether the pixels of the video aren't square
+func (p ProbeResult) IsAnamorphic() bool {
+	return isAnamorphic(p.SampleAR)
+}
+
+// DisplaySize returns the size of the video with square pixels, which is what
+// anamorphic videos are encoded to
+func (p ProbeResult) DisplaySize() (int, int) {
+	if !p.IsAnamorphic() {
+		return p.Width, p.Height
+	}
+	return int(math.Round(float64(p.Width)*p.SampleAR/2)) * 2, p.Height
+}
+
+// isAnamorphic reports whether a sample aspect ratio is far enough from 1 to matter
+func isAnamorphic(sar float64) bool {
+	return sar > 0 && math.Abs(sar-1) > 0.01
 }
 
 // probeOutput represents the JSON structure returned by ffprobe
@@ -63,19 +415,27 @@ type probeStream struct {
 	RFrameRate        string `json:"r_frame_rate"`
 	BitRate           string `json:"bit_rate"`
 	SampleAspectRatio string `json:"sample_aspect_ratio"`
+	PixFmt            string `json:"pix_fmt"`
+	ColorTransfer     string `json:"color_transfer"`
+	Channels          int    `json:"channels"`
+	Tags              struct {
+		Language string `json:"language"`
+		MimeType string `json:"mimetype"`
+	} `json:"tags"`
 }
 
 type probeFormat struct {
-	Duration string `json:"duration"`
-	Size     string `json:"size"`
-	BitRate  string `json:"bit_rate"`
+	Duration string            `json:"duration"`
+	Size     string            `json:"size"`
+	BitRate  string            `json:"bit_rate"`
+	Tags     map[string]string `json:"tags"`
 }
 
 // Probe analyzes a video file and returns metadata
 func Probe(ctx context.Context, videoPath string) (ProbeResult, error) {
 	log.Ctx(ctx).Printf("Executing ffprobe on %s", videoPath)
 
-	cmd := exec.CommandContext(ctx, "ffprobe",
+	cmd := exec.CommandContext(ctx, ProbeBinary,
 		"-v", "error",
 		"-show_streams",
 		"-show_format",
@@ -107,7 +467,15 @@ func Probe(ctx context.Context, videoPath string) (ProbeResult, error) {
 
 	durationSec, err := strconv.ParseFloat(result.Format.Duration, 64)
 	if err != nil {
-		return ProbeResult{}, fmt.Errorf("failed to parse duration: %w", err)
+		// Some .ts and fragmented files don't report a container duration
+		log.Ctx(ctx).Debug().
+			Str("duration", result.Format.Duration).
+			Msg("container has no duration, estimating from packets")
+
+		durationSec, err = estimateDuration(ctx, videoPath)
+		if err != nil {
+			return ProbeResult{}, fmt.Errorf("failed to determine duration: %w", err)
+		}
 	}
 	duration := time.Duration(durationSec) * time.Second
 
@@ -126,20 +494,109 @@ func Probe(ctx context.Context, videoPath string) (ProbeResult, error) {
 
 	container := strings.ToLower(strings.TrimPrefix(filepath.Ext(videoPath), "."))
 
+	var audioLanguages, subtitleLanguages, subtitleCodecs []string
+	var audioCodecs []string
+	var audioChannels []int
+	var fonts int
+	for _, stream := range result.Streams {
+		switch stream.CodecType {
+		case "audio":
+			audioLanguages = append(audioLanguages, strings.ToLower(stream.Tags.Language))
+			audioCodecs = append(audioCodecs, stream.CodecName)
+			audioChannels = append(audioChannels, stream.Channels)
+		case "subtitle":
+			subtitleLanguages = append(subtitleLanguages, strings.ToLower(stream.Tags.Language))
+			subtitleCodecs = append(subtitleCodecs, stream.CodecName)
+		case "attachment":
+			if isFont(stream.CodecName, stream.Tags.MimeType) {
+				fonts++
+			}
+		}
+	}
+
 	return ProbeResult{
-		Duration:    duration,
-		Codec:       videoStream.CodecName,
-		FPS:         fps,
-		SizeBytes:   size,
-		Width:       videoStream.Width,
-		Height:      videoStream.Height,
-		Bitrate:     bitrate,
-		Container:   container,
-		AspectRatio: aspectRatio,
-		SampleAR:    sampleAR,
+		Duration:      duration,
+		Codec:         videoStream.CodecName,
+		FPS:           fps,
+		SizeBytes:     size,
+		Width:         videoStream.Width,
+		Height:        videoStream.Height,
+		PixFmt:        videoStream.PixFmt,
+		Bitrate:       bitrate,
+		ColorTransfer: videoStream.ColorTransfer,
+		Container:     container,
+		AspectRatio:   aspectRatio,
+		SampleAR:      sampleAR,
+		Tags:          result.Format.Tags,
+
+		AudioLanguages:    audioLanguages,
+		SubtitleLanguages: subtitleLanguages,
+		AudioCodecs:       audioCodecs,
+		AudioChannels:     audioChannels,
+		SubtitleCodecs:    subtitleCodecs,
+		Fonts:             fonts,
 	}, nil
 }
 
+// isFont reports whether an attachment of codec and MIME type is a font. Muxers
+// label fonts inconsistently, e.g. application/x-truetype-font or font/otf.
+func isFont(codec, mimeType string) bool {
+	switch codec {
+	case "ttf", "otf":
+		return true
+	}
+	return strings.Contains(strings.ToLower(mimeType), "font")
+}
+
+// estimateDuration estimates the duration in seconds by scanning the packet
+// timestamps of the video stream, which doesn't require decoding any frames
+func estimateDuration(ctx context.Context, videoPath string) (float64, error) {
+	cmd := exec.CommandContext(ctx, ProbeBinary,
+		"-v", "error",
+		"-select_streams", "v:0",
+		"-show_entries", "packet=pts_time,duration_time",
+		"-of", "csv=p=0",
+		videoPath)
+
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return 0, fmt.Errorf("failed to create stdout pipe: %w", err)
+	}
+
+	if err := cmd.Start(); err != nil {
+		return 0, fmt.Errorf("failed to run ffprobe: %w", err)
+	}
+
+	// Lines look like "12.345000,0.041708"; packets aren't necessarily in pts order
+	start, end := math.Inf(1), math.Inf(-1)
+	scanner := bufio.NewScanner(stdout)
+	for scanner.Scan() {
+		parts := strings.Split(strings.TrimSpace(scanner.Text()), ",")
+		pts, err := strconv.ParseFloat(parts[0], 64)
+		if err != nil {
+			continue
+		}
+
+		var duration float64
+		if len(parts) > 1 {
+			duration, _ = strconv.ParseFloat(parts[1], 64)
+		}
+
+		start = min(start, pts)
+		end = max(end, pts+duration)
+	}
+
+	if err := cmd.Wait(); err != nil {
+		return 0, fmt.Errorf("failed to scan packets: %w", err)
+	}
+
+	if end <= start {
+		return 0, errors.New("no packet timestamps found")
+	}
+
+	return end - start, nil
+}
+
 // parseFPS parses frame rate string like "30000/1001"
 func parseFPS(rFrameRate string) float64 {
 	parts := strings.Split(rFrameRate, "/")
@@ -178,12 +635,147 @@ func parseSampleAspectRatio(sar string) float64 {
 	return w / h
 }
 
+// AudioStreamHashes returns a hash of the packets of each audio stream in a file.
+// Stream-copied audio must hash identically in the source and the output.
+func AudioStreamHashes(ctx context.Context, videoPath string) ([]string, error) {
+	cmd := exec.CommandContext(ctx, Binary,
+		"-v", "error",
+		"-i", videoPath,
+		"-map", "0:a",
+		"-c", "copy",
+		"-f", "streamhash",
+		"-hash", "sha256",
+		"-")
+
+	output, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("failed to hash audio streams: %w", err)
+	}
+
+	// Lines look like "0,a,SHA256=..."
+	var hashes []string
+	for line := range strings.Lines(string(output)) {
+		parts := strings.SplitN(strings.TrimSpace(line), ",", 3)
+		if len(parts) == 3 {
+			hashes = append(hashes, parts[2])
+		}
+	}
+
+	return hashes, nil
+}
+
+// Version returns the version line of ffmpeg
+func Version(ctx context.Context) (string, error) {
+	return toolVersion(ctx, Binary)
+}
+
+// ProbeVersion returns the version line of ffprobe
+func ProbeVersion(ctx context.Context) (string, error) {
+	return toolVersion(ctx, ProbeBinary)
+}
+
+// toolVersion returns the first line of `binary -version` without the copyright notice
+func toolVersion(ctx context.Context, binary string) (string, error) {
+	output, err := exec.CommandContext(ctx, binary, "-version").Output()
+	if err != nil {
+		return "", fmt.Errorf("failed to get %s version: %w", binary, err)
+	}
+	line, _, _ := strings.Cut(string(output), "\n")
+	line, _, _ = strings.Cut(line, " Copyright")
+	return strings.TrimSpace(line), nil
+}
+
+// WriteTestClip writes a short synthetic video to path, for checking encoders
+func WriteTestClip(ctx context.Context, path string) error {
+	cmd := exec.CommandContext(ctx, Binary,
+		"-v", "error",
+		"-y",
+		"-f", "lavfi",
+		"-i", "testsrc2=size=320x240:rate=25:duration=1",
+		"-c:v", "libx264",
+		path)
+	if output, err := cmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("failed to write test clip: %w: %s", err, strings.TrimSpace(string(output)))
+	}
+	return nil
+}
+
+// WriteBenchClip writes a 1080p synthetic video to path, for benchmarking encoders
+func WriteBenchClip(ctx context.Context, path string, duration time.Duration) error {
+	cmd := exec.CommandContext(ctx, Binary,
+		"-v", "error",
+		"-y",
+		"-f", "lavfi",
+		"-i", "testsrc2=size=1920x1080:rate=25:duration="+seconds(duration),
+		"-c:v", "libx264",
+		"-preset", "ultrafast",
+		"-crf", "12",
+		path)
+	if output, err := cmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("failed to write bench clip: %w: %s", err, strings.TrimSpace(string(output)))
+	}
+	return nil
+}
+
+// VideoEncoders returns the names of the video encoders FFmpeg was built with
+func VideoEncoders(ctx context.Context) ([]string, error) {
+	return listEncoders(ctx, 'V')
+}
+
+// listEncoders returns the names of the encoders of kind, V for video or A for audio
+func listEncoders(ctx context.Context, kind byte) ([]string, error) {
+	output, err := exec.CommandContext(ctx, Binary, "-hide_banner", "-encoders").Output()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list encoders: %w", err)
+	}
+
+	// Lines look like " V....D libx265              libx265 H.265 / HEVC"
+	var encoders []string
+	for line := range strings.Lines(string(output)) {
+		fields := strings.Fields(line)
+		if len(fields) >= 2 && len(fields[0]) == 6 && fields[0][0] == kind {
+			encoders = append(encoders, fields[1])
+		}
+	}
+
+	return encoders, nil
+}
+
+// EncoderWorks reports whether encoder can actually encode on this machine.
+// Hardware encoders are often built in without the hardware being present.
+func EncoderWorks(ctx context.Context, encoder string) bool {
+	cmd := exec.CommandContext(ctx, Binary,
+		"-v", "error",
+		"-f", "lavfi",
+		"-i", "color=black:size=256x256:duration=0.1",
+		"-frames:v", "1",
+		"-c:v", encoder,
+		"-f", "null",
+		"-")
+	return cmd.Run() == nil
+}
+
+// Phases reported in EncodeProgress
+const (
+	PhaseProbing     = "probing"
+	PhaseSplitting   = "splitting"
+	PhaseStabilizing = "stabilizing"
+	PhaseEncoding    = "encoding"
+	PhaseMuxing      = "muxing"
+)
+
 // EncodeProgress represents encoding progress information
 type EncodeProgress struct {
+	// Phase is one of the Phase constants
+	Phase       string
 	Percent     float64
 	FPSAvg      float64
 	ETA         time.Duration
 	CurrentSize int64
+	// OutTime is the duration of media encoded so far
+	OutTime time.Duration
+	// Speed is the media duration encoded per second, e.g. 2.5 for "2.5x"
+	Speed float64
 }
 
 func (e *EncodeProgress) String() string {
@@ -209,166 +801,330 @@ type ProgressCallback = func(progress EncodeProgress)
 
 // Encode encodes video using FFmpeg
 func Encode(ctx context.Context, params EncodeParams, onProgress ProgressCallback) error {
-	args := []string{
-		"ffmpeg",
-		"-y",
-		"-progress", "pipe:1",
-		"-stats_period", "3",
-		"-i", params.InputPath,
-		"-c:v", "hevc_videotoolbox",
-		"-q:v", fmt.Sprintf("%.0f", params.Quality),
-		"-profile:v", "main",
-		"-map_metadata", "0",
-		"-metadata", fmt.Sprintf("title=%s", strings.TrimSuffix(filepath.Base(params.InputPath), filepath.Ext(params.InputPath))),
-	}
-
-	// Add video scaling filter if width or height are specified
-	if params.Width > 0 || params.Height > 0 {
-		var scaleFilter string
-		if params.Width > 0 && params.Height > 0 {
-			// Both dimensions specified - scale to exact size maintaining aspect ratio (fit within)
-			scaleFilter = fmt.Sprintf("scale=%d:%d:force_original_aspect_ratio=decrease", params.Width, params.Height)
-		} else if params.Width > 0 {
-			// Only width specified - scale proportionally
-			scaleFilter = fmt.Sprintf("scale=%d:-2", params.Width)
-		} else {
-			// Only height specified - scale proportionally
-			scaleFilter = fmt.Sprintf("scale=-2:%d", params.Height)
-		}
-		args = append(args, "-vf", scaleFilter)
+	total, err := encodeTotal(ctx, params, onProgress)
+	if err != nil {
+		return err
+	}
+
+	params, cleanup, err := withStabilization(ctx, params, total, onProgress)
+	if err != nil {
+		return err
+	}
+	defer cleanup()
+
+	args := encodeInputArgs(params)
+	args = append(args, accurateTrimArgs(params)...)
+
+	args = append(args, streamArgs(params)...)
+	args = append(args, videoCodecArgs(params)...)
+
+	args = append(args, audioArgs(params)...)
+	args = append(args, metadataArgs(params, 0, 0)...)
+
+	if filter := videoFilter(params); filter != "" {
+		args = append(args, "-vf", filter)
 	}
 
+	args = append(args, params.OutputArgs...)
+	args = append(args, params.ExtraArgs...)
 	args = append(args, params.OutputPath)
 
-	if params.Is10Bit {
-		// Replace profile with main10
-		for i, arg := range args {
-			if arg == "main" && i > 0 && args[i-1] == "-profile:v" {
-				args[i] = "main10"
-				break
-			}
-		}
+	return runEncode(ctx, args, params, total, onProgress)
+}
+
+// encodeTotal returns what the progress of an encode is measured against
+func encodeTotal(ctx context.Context, params EncodeParams, onProgress ProgressCallback) (progressTotal, error) {
+	if params.Duration > 0 {
+		return progressTotal{duration: params.Duration}, nil
+	}
+	// Probing a stream would consume it, progress is unknown without its length
+	if params.Stdin != nil {
+		return progressTotal{duration: max(0, params.InputDuration-params.FromTime)}, nil
 	}
 
-	if params.FromTime > 0 {
-		// Insert before -i
-		var newArgs []string
-		for _, arg := range args {
-			if arg == "-i" {
-				newArgs = append(newArgs, "-ss", fmt.Sprintf("%d", int(params.FromTime.Seconds())))
-			}
-			newArgs = append(newArgs, arg)
-		}
-		args = newArgs
+	if onProgress != nil {
+		onProgress(EncodeProgress{Phase: PhaseProbing})
+	}
+	probe, err := Probe(ctx, params.InputPath)
+	if err != nil {
+		return progressTotal{}, fmt.Errorf("failed to probe video: %w", err)
 	}
 
-	var totalDuration time.Duration
-	if params.Duration > 0 {
-		totalDuration = params.Duration
-		// Insert before -i
-		var newArgs []string
-		for _, arg := range args {
-			if arg == "-i" {
-				newArgs = append(newArgs, "-t", fmt.Sprintf("%d", int(params.Duration.Seconds())))
-			}
-			newArgs = append(newArgs, arg)
-		}
-		args = newArgs
-	} else {
-		// probe
-		probe, err := Probe(ctx, params.InputPath)
-		if err != nil {
-			return fmt.Errorf("failed to probe video: %w", err)
-		}
-		totalDuration = probe.Duration
+	// Only the part after --from is encoded
+	duration := max(0, probe.Duration-params.FromTime)
+	return progressTotal{
+		duration: duration,
+		frames:   int64(duration.Seconds() * probe.FPS),
+	}, nil
+}
+
+// encodeInputArgs returns the command up to and including the input
+func encodeInputArgs(params EncodeParams) []string {
+	// Stdout carries piped outputs, their progress goes to stderr
+	progress := "pipe:1"
+	if params.Stdout != nil {
+		progress = "pipe:2"
 	}
+	args := []string{
+		Binary,
+		"-y",
+		"-progress", progress,
+		"-stats_period", "3",
+	}
+	if params.Stdout != nil {
+		// The stats line would garble the progress on stderr
+		args = append(args, "-nostats")
+	}
+	args = append(args, trimArgs(params)...)
+	if params.HWDecode {
+		args = append(args, "-hwaccel", HWAccel(params.VideoEncoder))
+	}
+	args = append(args, gpuInputArgs(params)...)
+	args = append(args, params.InputArgs...)
+	return append(args, "-i", params.InputPath)
+}
 
-	args = append(args, params.ExtraArgs...)
+// HWAccel returns the -hwaccel method decoding on the same hardware as encoder.
+// Decoded frames are copied back to system memory, so filters work as usual.
+func HWAccel(encoder string) string {
+	switch encoder = cmp.Or(encoder, DefaultVideoEncoder); {
+	case strings.HasSuffix(encoder, "_videotoolbox"):
+		return "videotoolbox"
+	case strings.HasSuffix(encoder, "_nvenc"):
+		return "cuda"
+	case strings.HasSuffix(encoder, "_qsv"):
+		return "qsv"
+	case strings.HasSuffix(encoder, "_vaapi"):
+		return "vaapi"
+	default:
+		return "auto"
+	}
+}
 
+// runEncode runs an encode command, reporting its progress
+func runEncode(ctx context.Context, args []string, params EncodeParams, total progressTotal, onProgress ProgressCallback) error {
 	log.Ctx(ctx).Debug().Strs("args", args).Msg("starting ffmpeg encoding")
 
-	cmd := exec.CommandContext(ctx, args[0], args[1:]...)
+	cmd := proc.Command(ctx, args[0], args[1:]...)
+	cmd.Stdin = params.Stdin
+	tail := proc.NewTail(3)
+	var logOutput io.Writer = tail
+	if params.LogOutput != nil {
+		logOutput = io.MultiWriter(tail, params.LogOutput)
+	}
 
-	stdout, err := cmd.StdoutPipe()
+	var progressPipe io.Reader
+	var err error
+	if params.Stdout != nil {
+		cmd.Stdout = params.Stdout
+		progressPipe, err = cmd.StderrPipe()
+	} else {
+		cmd.Stderr = logOutput
+		progressPipe, err = cmd.StdoutPipe()
+	}
 	if err != nil {
-		return fmt.Errorf("failed to create stdout pipe: %w", err)
+		return fmt.Errorf("failed to create progress pipe: %w", err)
 	}
 
 	if err := cmd.Start(); err != nil {
 		return fmt.Errorf("failed to start FFmpeg: %w", err)
 	}
+	defer proc.Track(cmd)()
 
-	// Parse progress using iterator
-	if onProgress != nil {
-		go func() {
-			for progress := range iterProgress(stdout, totalDuration) {
-				onProgress(progress)
-			}
-		}()
+	// Errors share stderr with the progress of piped outputs, which is kept
+	// out of the error message
+	progressOutput := progressPipe
+	errorOutput := &errorLines{w: tail}
+	if params.Stdout != nil {
+		var w io.Writer = errorOutput
+		if params.LogOutput != nil {
+			w = io.MultiWriter(errorOutput, params.LogOutput)
+		}
+		progressOutput = io.TeeReader(progressPipe, w)
+	} else if params.LogOutput != nil {
+		progressOutput = io.TeeReader(progressPipe, params.LogOutput)
+	}
+
+	// The pipe is always drained, FFmpeg would block once it's full otherwise.
+	// Reading must finish before Wait, which closes the pipe.
+	var last EncodeProgress
+	for progress := range iterProgress(progressOutput, total) {
+		last = progress
+		if onProgress != nil {
+			onProgress(progress)
+		}
+	}
+	_, _ = io.Copy(io.Discard, progressOutput)
+	errorOutput.Flush()
+
+	if err := cmd.Wait(); err != nil {
+		if msg := tail.String(); msg != "" {
+			return fmt.Errorf("ffmpeg failed: %w: %s", err, msg)
+		}
+		return fmt.Errorf("ffmpeg failed: %w", err)
+	}
+
+	if onProgress != nil && last.Percent < 100 {
+		last.Phase, last.Percent, last.ETA = PhaseEncoding, 100, 0
+		if stat, err := os.Stat(params.OutputPath); err == nil {
+			last.CurrentSize = stat.Size()
+		}
+		onProgress(last)
+	}
+	return nil
+}
+
+// errorLines passes the lines written to it on to w, except the key=value
+// lines of -progress
+type errorLines struct {
+	w       io.Writer
+	partial []byte
+}
+
+func (e *errorLines) Write(p []byte) (int, error) {
+	data := append(e.partial, p...)
+	for {
+		i := bytes.IndexByte(data, '\n')
+		if i < 0 {
+			break
+		}
+		e.writeLine(data[:i+1])
+		data = data[i+1:]
+	}
+	e.partial = append(e.partial[:0], data...)
+	return len(p), nil
+}
+
+// Flush passes on the last line if it didn't end with a newline
+func (e *errorLines) Flush() {
+	e.writeLine(e.partial)
+	e.partial = e.partial[:0]
+}
+
+func (e *errorLines) writeLine(line []byte) {
+	if len(bytes.TrimSpace(line)) > 0 && !isProgressLine(string(line)) {
+		_, _ = e.w.Write(line)
 	}
+}
 
-	return cmd.Wait()
+// isProgressLine reports whether line is a key=value line of -progress, like
+// out_time_us=1000 or bitrate= 512.0kbits/s
+func isProgressLine(line string) bool {
+	key, _, ok := strings.Cut(strings.TrimSpace(line), "=")
+	return ok && key != "" && strings.Trim(key, "abcdefghijklmnopqrstuvwxyz0123456789_") == ""
 }
 
-// iterProgress returns an iterator that yields EncodeProgress updates from FFmpeg output
-func iterProgress(r io.Reader, totalDuration time.Duration) iter.Seq[EncodeProgress] {
+// progressTotal is what progress is measured against. Frames are only used
+// when ffmpeg can't report the output time, e.g. for image sequence inputs.
+type progressTotal struct {
+	duration time.Duration
+	frames   int64
+}
+
+// iterProgress returns an iterator that yields EncodeProgress updates from FFmpeg output.
+// FFmpeg writes key=value lines in blocks, each ending with a progress= line.
+func iterProgress(r io.Reader, total progressTotal) iter.Seq[EncodeProgress] {
 	return func(yield func(EncodeProgress) bool) {
 		scanner := bufio.NewScanner(r)
-		var currentProgress EncodeProgress
+		currentProgress := EncodeProgress{Phase: PhaseEncoding}
 		var startTime time.Time
-		progressStarted := false
+		var frame int64
+		outTimeKnown := false
 
 		for scanner.Scan() {
-			line := strings.TrimSpace(scanner.Text())
-
-			// Track when progress starts
-			if strings.HasPrefix(line, "progress=continue") && !progressStarted {
-				startTime = time.Now()
-				progressStarted = true
+			key, value, ok := strings.Cut(strings.TrimSpace(scanner.Text()), "=")
+			if !ok || value == "N/A" {
+				continue
 			}
 
-			// Parse FPS
-			if strings.HasPrefix(line, "fps=") {
-				fpsStr := strings.TrimPrefix(line, "fps=")
-				if fps, err := strconv.ParseFloat(fpsStr, 64); err == nil {
+			switch key {
+			case "frame":
+				if n, err := strconv.ParseInt(value, 10, 64); err == nil {
+					frame = n
+				}
+			case "fps":
+				if fps, err := strconv.ParseFloat(value, 64); err == nil {
 					currentProgress.FPSAvg = fps
 				}
-			}
-
-			// Parse total size
-			if strings.HasPrefix(line, "total_size=") {
-				sizeStr := strings.TrimPrefix(line, "total_size=")
-				if size, err := strconv.ParseInt(sizeStr, 10, 64); err == nil {
+			case "total_size":
+				if size, err := strconv.ParseInt(value, 10, 64); err == nil {
 					currentProgress.CurrentSize = size
 				}
-			}
+			case "out_time_us", "out_time_ms":
+				// Both are in microseconds, out_time_ms is misnamed
+				if us, err := strconv.ParseInt(value, 10, 64); err == nil && us >= 0 {
+					currentProgress.OutTime = time.Duration(us) * time.Microsecond
+					outTimeKnown = true
+				}
+			case "out_time":
+				if d, ok := parseOutTime(value); ok {
+					currentProgress.OutTime = d
+					outTimeKnown = true
+				}
+			case "speed":
+				if speed, err := strconv.ParseFloat(strings.TrimSuffix(value, "x"), 64); err == nil {
+					currentProgress.Speed = speed
+				}
+			case "progress":
+				if startTime.IsZero() {
+					startTime = time.Now()
+				}
+
+				percent, ok := progressPercent(total, currentProgress.OutTime, outTimeKnown, frame)
+				if !ok {
+					continue
+				}
+				if value == "end" {
+					percent = 100
+				}
+				currentProgress.Percent = round(percent, 2)
+
+				// FFmpeg's speed is more reliable than extrapolating the elapsed time
+				currentProgress.ETA = 0
+				if outTimeKnown && currentProgress.Speed > 0 && total.duration > currentProgress.OutTime {
+					remaining := float64(total.duration-currentProgress.OutTime) / currentProgress.Speed
+					currentProgress.ETA = time.Duration(remaining).Truncate(time.Second)
+				} else if percent > 0 && percent < 100 {
+					elapsed := time.Since(startTime)
+					estimated := time.Duration(float64(elapsed) * 100 / percent)
+					currentProgress.ETA = (estimated - elapsed).Truncate(time.Second)
+				}
 
-			if strings.HasPrefix(line, "out_time_ms=") {
-				// Parse time progress from FFmpeg
-				timeMs := strings.TrimPrefix(line, "out_time_ms=")
-				if ms, err := strconv.ParseInt(timeMs, 10, 64); err == nil {
-					if totalDuration > 0 {
-						currentTime := time.Duration(ms * 1000)
-						percent := round(min(100.0, float64(currentTime)/float64(totalDuration)*100), 2)
-						currentProgress.Percent = percent
-
-						// Calculate ETA if we have progress and time elapsed
-						if progressStarted && percent > 0 && percent < 100 {
-							elapsed := time.Since(startTime)
-							estimated := time.Duration(float64(elapsed) * 100 / percent)
-							currentProgress.ETA = (estimated - elapsed).Truncate(time.Second)
-						}
-
-						if !yield(currentProgress) {
-							return
-						}
-					}
+				if !yield(currentProgress) {
+					return
 				}
+				outTimeKnown = false
 			}
 		}
 	}
 }
 
+// progressPercent measures progress by the output time, falling back to the frame count
+func progressPercent(total progressTotal, outTime time.Duration, outTimeKnown bool, frame int64) (float64, bool) {
+	switch {
+	case outTimeKnown && total.duration > 0:
+		return min(100, float64(outTime)/float64(total.duration)*100), true
+	case frame > 0 && total.frames > 0:
+		return min(100, float64(frame)/float64(total.frames)*100), true
+	}
+	return 0, false
+}
+
+// parseOutTime parses the HH:MM:SS.micro format of out_time
+func parseOutTime(s string) (time.Duration, bool) {
+	parts := strings.Split(s, ":")
+	if len(parts) != 3 {
+		return 0, false
+	}
+	h, err1 := strconv.Atoi(parts[0])
+	m, err2 := strconv.Atoi(parts[1])
+	sec, err3 := strconv.ParseFloat(parts[2], 64)
+	if err1 != nil || err2 != nil || err3 != nil || h < 0 {
+		return 0, false
+	}
+	return time.Duration(h)*time.Hour + time.Duration(m)*time.Minute + time.Duration(sec*float64(time.Second)), true
+}
+
 func round(n float64, precision int) float64 {
 	if precision < 0 {
 		return n
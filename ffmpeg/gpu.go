@@ -0,0 +1,151 @@
+package ffmpeg
+
+import (
+	"cmp"
+	"context"
+	"fmt"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// NvidiaSMIBinary is the NVIDIA tool reporting the GPUs and their encoder sessions
+var NvidiaSMIBinary = "nvidia-smi"
+
+// GPU is an NVIDIA GPU, or a VAAPI and QSV render node
+type GPU struct {
+	// Device is the NVENC index like "1", or the render node like /dev/dri/renderD129
+	Device string
+	Name   string
+	// Sessions is the number of encoder sessions in use, -1 when unknown
+	Sessions int
+	// EncoderUtilization is the percentage of time the encoder was busy, -1 when unknown
+	EncoderUtilization int
+}
+
+// IsGPUEncoder reports whether encoder runs on a GPU selected with EncodeParams.GPU
+func IsGPUEncoder(encoder string) bool {
+	encoder = cmp.Or(encoder, DefaultVideoEncoder)
+	return strings.HasSuffix(encoder, "_nvenc") || strings.HasSuffix(encoder, "_vaapi") || strings.HasSuffix(encoder, "_qsv")
+}
+
+// ValidateGPU checks that gpu selects a device of encoder: an index for NVENC,
+// a render node for VAAPI and QSV
+func ValidateGPU(encoder, gpu string) error {
+	encoder = cmp.Or(encoder, DefaultVideoEncoder)
+	switch {
+	case strings.HasSuffix(encoder, "_nvenc"):
+		if index, err := strconv.Atoi(gpu); err != nil || index < 0 {
+			return fmt.Errorf("invalid GPU %q: %s expects the index of an NVIDIA GPU, e.g. 1", gpu, encoder)
+		}
+	case strings.HasSuffix(encoder, "_vaapi"), strings.HasSuffix(encoder, "_qsv"):
+		if !filepath.IsAbs(gpu) {
+			return fmt.Errorf("invalid GPU %q: %s expects a render node, e.g. /dev/dri/renderD129", gpu, encoder)
+		}
+	default:
+		return fmt.Errorf("%s doesn't run on a GPU, only NVENC, VAAPI and QSV encoders do", encoder)
+	}
+	return nil
+}
+
+// gpuInputArgs returns the input options opening the GPU of params, which
+// VAAPI and QSV encode on and hardware decoding of NVENC encodes uses
+func gpuInputArgs(params EncodeParams) []string {
+	if params.GPU == "" {
+		return nil
+	}
+	switch encoder := cmp.Or(params.VideoEncoder, DefaultVideoEncoder); {
+	case strings.HasSuffix(encoder, "_nvenc") && params.HWDecode:
+		return []string{"-hwaccel_device", params.GPU}
+	case strings.HasSuffix(encoder, "_vaapi"):
+		return []string{"-vaapi_device", params.GPU}
+	case strings.HasSuffix(encoder, "_qsv"):
+		return []string{"-qsv_device", params.GPU}
+	}
+	return nil
+}
+
+// gpuOutputArgs returns the encoder options selecting the GPU of params
+func gpuOutputArgs(params EncodeParams) []string {
+	if params.GPU != "" && strings.HasSuffix(cmp.Or(params.VideoEncoder, DefaultVideoEncoder), "_nvenc") {
+		return []string{"-gpu", params.GPU}
+	}
+	return nil
+}
+
+// NvidiaGPUs lists the NVIDIA GPUs with the encoder sessions they're running
+// and how busy their encoders are.
+// It returns no GPUs without nvidia-smi.
+func NvidiaGPUs(ctx context.Context) ([]GPU, error) {
+	if _, err := exec.LookPath(NvidiaSMIBinary); err != nil {
+		return nil, nil
+	}
+	out, err := exec.CommandContext(ctx, NvidiaSMIBinary,
+		"--query-gpu=index,name,encoder.stats.sessionCount,utilization.encoder",
+		"--format=csv,noheader,nounits").Output()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list NVIDIA GPUs: %w", err)
+	}
+
+	var gpus []GPU
+	for _, line := range strings.Split(strings.TrimSpace(string(out)), "\n") {
+		fields := strings.Split(line, ",")
+		if len(fields) != 4 {
+			continue
+		}
+		gpu := GPU{Device: strings.TrimSpace(fields[0]), Name: strings.TrimSpace(fields[1]), Sessions: -1, EncoderUtilization: -1}
+		// Unsupported values read [N/A]
+		if sessions, err := strconv.Atoi(strings.TrimSpace(fields[2])); err == nil {
+			gpu.Sessions = sessions
+		}
+		if utilization, err := strconv.Atoi(strings.TrimSpace(fields[3])); err == nil {
+			gpu.EncoderUtilization = utilization
+		}
+		gpus = append(gpus, gpu)
+	}
+	return gpus, nil
+}
+
+// RenderNodes lists the render nodes VAAPI and QSV encoders open
+func RenderNodes() []GPU {
+	nodes, _ := filepath.Glob("/dev/dri/renderD*")
+	gpus := make([]GPU, 0, len(nodes))
+	for _, node := range nodes {
+		gpus = append(gpus, GPU{Device: node, Name: filepath.Base(node), Sessions: -1, EncoderUtilization: -1})
+	}
+	return gpus
+}
+
+// SessionLimit finds how many concurrent sessions encoder can open on gpu by
+// starting up to limit test encodes at once. Sessions used by other apps
+// count against it.
+func SessionLimit(ctx context.Context, encoder, gpu string, limit int) int {
+	params := EncodeParams{VideoEncoder: encoder, GPU: gpu}
+	args := []string{"-v", "error", "-re", "-f", "lavfi", "-i", "color=black:size=256x256:duration=3"}
+	args = append(args, gpuInputArgs(params)...)
+	args = append(args, "-c:v", encoder)
+	args = append(args, gpuOutputArgs(params)...)
+	args = append(args, "-f", "null", "-")
+
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	started := 0
+	for range limit {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			ctx, cancel := context.WithTimeout(ctx, time.Minute)
+			defer cancel()
+			if exec.CommandContext(ctx, Binary, args...).Run() == nil {
+				mu.Lock()
+				started++
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+	return started
+}
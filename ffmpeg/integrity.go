@@ -0,0 +1,40 @@
+package ffmpeg
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os/exec"
+	"strings"
+	"time"
+)
+
+// DecodeErrors decodes length of the input from at, discarding the frames, and
+// returns the errors ffmpeg reported, one per line
+func DecodeErrors(ctx context.Context, input string, at, length time.Duration) ([]string, error) {
+	cmd := exec.CommandContext(ctx, Binary,
+		"-hide_banner",
+		"-nostats",
+		"-v", "error",
+		"-ss", seconds(at),
+		"-t", seconds(length),
+		"-i", input,
+		"-map", "0:v:0",
+		"-map", "0:a?",
+		"-f", "null", "-")
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	err := cmd.Run()
+
+	var errs []string
+	for line := range strings.Lines(stderr.String()) {
+		if line = strings.TrimSpace(line); line != "" {
+			errs = append(errs, line)
+		}
+	}
+	// Damaged streams are reported above, a failed run means the input can't be read at all
+	if err != nil && ctx.Err() == nil {
+		return errs, fmt.Errorf("failed to decode %s: %w: %s", input, err, strings.Join(errs[max(0, len(errs)-3):], "; "))
+	}
+	return errs, err
+}
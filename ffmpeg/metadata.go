@@ -0,0 +1,163 @@
+package ffmpeg
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// MetadataOptions controls the metadata and chapters written to an output
+type MetadataOptions struct {
+	// Strip drops the global metadata and chapters of the source
+	Strip bool
+	// Remove lists tags of the source left out of the copy
+	Remove []string
+	// Title is the title tag of the output, the title of the source is copied when empty
+	Title string
+	// Set are key=value tags written to the output, whether or not the source is stripped
+	Set []string
+	// Dispositions flag the default and forced tracks of the output, in order
+	Dispositions []Disposition
+}
+
+// Disposition sets the flags of output tracks
+type Disposition struct {
+	// Kind is "a" for audio or "s" for subtitles
+	Kind string
+	// Track is counted from 0 among the output tracks of Kind, -1 for all of them
+	Track int
+	// Flags are like "default", "default+forced" or "0" to clear them
+	Flags string
+}
+
+// option returns the -disposition option of d
+func (d Disposition) option() string {
+	if d.Track < 0 {
+		return "-disposition:" + d.Kind
+	}
+	return fmt.Sprintf("-disposition:%s:%d", d.Kind, d.Track)
+}
+
+// privateKeys are parts of tag names that identify a location or device
+var privateKeys = []string{"location", "gps", "serial", "identifier", "camera", "lens"}
+
+// privateNames are the last dotted part of tag names like com.apple.quicktime.make
+var privateNames = []string{"make", "model", "software", "manufacturer", "version"}
+
+// PrivateTags returns the tags of a probe that reveal where or with which
+// device a video was recorded, like the GPS coordinates phones write.
+// The creation date is kept.
+func PrivateTags(tags map[string]string) []string {
+	var private []string
+	for key := range tags {
+		lower := strings.ToLower(key)
+		name := lower[strings.LastIndexByte(lower, '.')+1:]
+		if slices.Contains(privateNames, name) || slices.ContainsFunc(privateKeys, func(k string) bool {
+			return strings.Contains(lower, k)
+		}) {
+			private = append(private, key)
+		}
+	}
+	slices.Sort(private)
+	return private
+}
+
+// metadataArgs returns the options copying the global metadata, which includes
+// the creation date, from input metadataInput and the chapters from chaptersInput
+func metadataArgs(params EncodeParams, metadataInput, chaptersInput int) []string {
+	var args []string
+	if params.Metadata.Strip {
+		args = append(args, "-map_metadata", "-1", "-map_chapters", "-1")
+	} else {
+		args = append(args,
+			"-map_metadata", strconv.Itoa(metadataInput),
+			"-map_chapters", strconv.Itoa(chaptersInput),
+		)
+	}
+
+	// Empty values remove the tags
+	for _, key := range params.Metadata.Remove {
+		args = append(args, "-metadata", key+"=")
+	}
+
+	if params.Metadata.Title != "" {
+		args = append(args, "-metadata", "title="+params.Metadata.Title)
+	}
+	for _, tag := range params.Metadata.Set {
+		args = append(args, "-metadata", tag)
+	}
+	for _, d := range params.Metadata.Dispositions {
+		args = append(args, d.option(), d.Flags)
+	}
+
+	// MP4 drops tags that have no atom of their own unless told to keep them
+	if (!params.Metadata.Strip || len(params.Metadata.Set) > 0) && isMP4(params.OutputPath) {
+		args = append(args, "-movflags", "+use_metadata_tags")
+	}
+	return args
+}
+
+// isMP4 reports whether path is written by the MP4 muxer
+func isMP4(path string) bool {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".mp4", ".m4v", ".mov":
+		return true
+	}
+	return false
+}
+
+// ApplyMetadata rewrites the metadata of an MP4 encoded by another tool from the
+// source, the way Encode writes it. Streams and chapters of the encode are kept,
+// with the audio tracks shifted by delays, one per track in order.
+func ApplyMetadata(ctx context.Context, source, encoded string, meta MetadataOptions, delays []time.Duration) error {
+	tmp := encoded + ".metadata.tmp"
+	defer os.Remove(tmp)
+
+	params := EncodeParams{InputPath: source, Metadata: meta}
+	args := []string{"-y", "-v", "error", "-i", encoded}
+	// Without a source FFmpeg can read, such as a DVD, the tags are kept from the encode
+	metadataInput := 0
+	inputs := 1
+	if source != "" {
+		args = append(args, "-i", source)
+		metadataInput = 1
+		inputs++
+	}
+
+	if !slices.ContainsFunc(delays, func(d time.Duration) bool { return d != 0 }) {
+		args = append(args, "-map", "0")
+	} else {
+		// Copied streams can only be shifted by reading their input with an offset
+		var maps []string
+		for i, delay := range delays {
+			input := 0
+			if delay != 0 {
+				args = append(args, "-itsoffset", seconds(delay), "-i", encoded)
+				input = inputs
+				inputs++
+			}
+			maps = append(maps, "-map", fmt.Sprintf("%d:a:%d", input, i))
+		}
+		args = append(args, "-map", "0:v")
+		args = append(args, maps...)
+		args = append(args, "-map", "0:s?")
+	}
+	args = append(args, "-c", "copy")
+	args = append(args, metadataArgs(params, metadataInput, 0)...)
+	args = append(args, "-movflags", "+faststart+use_metadata_tags", "-f", "mp4", tmp)
+
+	cmd := exec.CommandContext(ctx, Binary, args...)
+	if out, err := cmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("failed to write metadata: %w: %s", err, strings.TrimSpace(string(out)))
+	}
+	if err := os.Rename(tmp, encoded); err != nil {
+		return fmt.Errorf("failed to replace encode: %w", err)
+	}
+	return nil
+}
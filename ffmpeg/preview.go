@@ -0,0 +1,60 @@
+package ffmpeg
+
+import (
+	"context"
+	"fmt"
+	"os/exec"
+	"strings"
+	"time"
+)
+
+// Preview formats
+const (
+	PreviewGIF  = "gif"
+	PreviewWebP = "webp"
+)
+
+// PreviewParams represents parameters for an animated preview clip
+type PreviewParams struct {
+	InputPath  string
+	OutputPath string
+	At         time.Duration
+	Length     time.Duration
+	Width      int
+	FPS        int
+	// Format is PreviewGIF or PreviewWebP
+	Format string
+	// Watermark is overlaid on the scaled clip when its Path is set
+	Watermark Watermark
+}
+
+// Preview writes a short looping animation of the input
+func Preview(ctx context.Context, params PreviewParams) error {
+	scale := fmt.Sprintf("fps=%d,scale=%d:-2:flags=lanczos", params.FPS, params.Width)
+	scale = params.Watermark.overlay(scale, "")
+
+	args := []string{
+		"-y",
+		"-v", "error",
+		"-ss", seconds(params.At),
+		"-t", seconds(params.Length),
+		"-i", params.InputPath,
+		"-an",
+	}
+	switch params.Format {
+	case PreviewGIF:
+		// A palette made for the clip looks far better than the default one
+		args = append(args, "-vf", scale+",split[a][b];[a]palettegen=stats_mode=diff[p];[b][p]paletteuse=dither=bayer")
+	case PreviewWebP:
+		args = append(args, "-vf", scale, "-c:v", "libwebp", "-quality", "70")
+	default:
+		return fmt.Errorf("unknown preview format %q", params.Format)
+	}
+	args = append(args, "-loop", "0", params.OutputPath)
+
+	cmd := exec.CommandContext(ctx, Binary, args...)
+	if out, err := cmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("failed to create preview: %w: %s", err, strings.TrimSpace(string(out)))
+	}
+	return nil
+}
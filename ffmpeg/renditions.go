@@ -0,0 +1,90 @@
+package ffmpeg
+
+import (
+	"cmp"
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Rendition is one output of EncodeRenditions. Either Width or Height is set,
+// the other follows the aspect ratio.
+type Rendition struct {
+	Width      int
+	Height     int
+	Quality    float64
+	OutputPath string
+	Metadata   MetadataOptions
+}
+
+// EncodeRenditions encodes several renditions of the input in a single FFmpeg
+// run, decoding the input once and splitting the frames between the scalers.
+// Width, Height, Quality and OutputPath of params are replaced by the renditions.
+func EncodeRenditions(ctx context.Context, params EncodeParams, renditions []Rendition, onProgress ProgressCallback) error {
+	total, err := encodeTotal(ctx, params, onProgress)
+	if err != nil {
+		return err
+	}
+
+	params, cleanup, err := withStabilization(ctx, params, total, onProgress)
+	if err != nil {
+		return err
+	}
+	defer cleanup()
+
+	args := encodeInputArgs(params)
+
+	// The source filters and stabilization run once, before the frames are
+	// split between the scalers
+	shared := sourceFilters(params)
+	if params.transforms != "" {
+		shared = append(shared, stabilizeFilter(params.transforms))
+	}
+
+	var graph strings.Builder
+	graph.WriteString(videoInput(params))
+	for _, filter := range shared {
+		graph.WriteString(filter + ",")
+	}
+	fmt.Fprintf(&graph, "split=%d", len(renditions))
+	for i := range renditions {
+		fmt.Fprintf(&graph, "[s%d]", i)
+	}
+	for i, r := range renditions {
+		scaled := params
+		scaled.Width, scaled.Height = r.Width, r.Height
+		scaled.Detelecine, scaled.SampleAR, scaled.transforms = false, 0, ""
+		scaled.Watermark = Watermark{}
+		chain := params.Watermark.overlay(cmp.Or(videoFilter(scaled), "null"), strconv.Itoa(i))
+		fmt.Fprintf(&graph, ";[s%d]%s[v%d]", i, chain, i)
+	}
+	args = append(args, "-filter_complex", graph.String())
+
+	// Output options apply to the next output only, so they are repeated for each
+	for i, r := range renditions {
+		output := params
+		output.Quality = r.Quality
+		output.OutputPath = r.OutputPath
+		output.Metadata = r.Metadata
+
+		args = append(args, "-map", fmt.Sprintf("[v%d]", i))
+		if selectsStreams(output) {
+			args = append(args, keptStreamArgs(output)...)
+		} else {
+			// Streaming players pick the audio, every track is kept
+			args = append(args, "-map", "0:a?")
+		}
+		args = append(args, accurateTrimArgs(output)...)
+		args = append(args, videoCodecArgs(output)...)
+		args = append(args, audioArgs(output)...)
+		args = append(args, metadataArgs(output, 0, 0)...)
+		args = append(args, output.OutputArgs...)
+		args = append(args, output.ExtraArgs...)
+		args = append(args, r.OutputPath)
+	}
+
+	// The final size is reported by FFmpeg, there's no single output to measure
+	params.OutputPath = ""
+	return runEncode(ctx, args, params, total, onProgress)
+}
@@ -0,0 +1,68 @@
+package ffmpeg
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// stabilizeFilter smooths the camera motion described by transforms over 10
+// frames each way, zooming in just enough to hide the moving borders, and
+// sharpens the frames vidstabtransform softens by interpolating
+func stabilizeFilter(transforms string) string {
+	return fmt.Sprintf("vidstabtransform=input=%s:smoothing=10:optzoom=1,unsharp=5:5:0.8:3:3:0.4", filterPath(transforms))
+}
+
+// filterPath quotes path for a filter option, Windows drive letters would end the option otherwise
+func filterPath(path string) string {
+	return "'" + strings.ReplaceAll(filepath.ToSlash(path), ":", `\:`) + "'"
+}
+
+// withStabilization runs the motion detection pass when params.Stabilize is set
+// and returns params transforming the frames by its results, along with a
+// function removing the transforms file
+func withStabilization(ctx context.Context, params EncodeParams, total progressTotal, onProgress ProgressCallback) (EncodeParams, func(), error) {
+	if !params.Stabilize {
+		return params, func() {}, nil
+	}
+
+	dir, err := os.MkdirTemp("", "encz-stabilize-*")
+	if err != nil {
+		return params, nil, fmt.Errorf("failed to create temp dir: %w", err)
+	}
+	cleanup := func() { _ = os.RemoveAll(dir) }
+
+	transforms := filepath.Join(dir, "transforms.trf")
+	if err := detectMotion(ctx, params, transforms, total, onProgress); err != nil {
+		cleanup()
+		return params, nil, err
+	}
+
+	params.transforms = transforms
+	return params, cleanup, nil
+}
+
+// detectMotion runs vidstabdetect on the frames the encode will see, writing
+// the camera motion to transforms
+func detectMotion(ctx context.Context, params EncodeParams, transforms string, total progressTotal, onProgress ProgressCallback) error {
+	filters := append(sourceFilters(params), "vidstabdetect=shakiness=5:accuracy=15:result="+filterPath(transforms))
+
+	args := encodeInputArgs(params)
+	args = append(args, accurateTrimArgs(params)...)
+	args = append(args, "-map", fmt.Sprintf("0:v:%d", params.VideoTrack), "-vf", strings.Join(filters, ","), "-f", "null", "-")
+
+	// Nothing is written, only the time is reported
+	params.OutputPath = ""
+	err := runEncode(ctx, args, params, total, func(p EncodeProgress) {
+		if onProgress != nil {
+			p.Phase, p.CurrentSize = PhaseStabilizing, 0
+			onProgress(p)
+		}
+	})
+	if err != nil {
+		return fmt.Errorf("failed to detect camera motion: %w", err)
+	}
+	return nil
+}
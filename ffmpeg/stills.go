@@ -0,0 +1,106 @@
+package ffmpeg
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"encz/proc"
+)
+
+// ExtractFrame writes the frame of input at the given time as a JPEG
+func ExtractFrame(ctx context.Context, input string, at time.Duration, output string) error {
+	cmd := exec.CommandContext(ctx, Binary,
+		"-y",
+		"-v", "error",
+		"-ss", seconds(at),
+		"-i", input,
+		"-frames:v", "1",
+		"-q:v", "2",
+		output)
+	if out, err := cmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("failed to extract frame at %s: %w: %s", at, err, strings.TrimSpace(string(out)))
+	}
+	return nil
+}
+
+// SpriteSheet tiles images into a single JPEG, scaling each to width and
+// placing them in rows of columns images
+func SpriteSheet(ctx context.Context, images []string, width, columns int, output string) error {
+	var list strings.Builder
+	for _, path := range images {
+		abs, err := filepath.Abs(path)
+		if err != nil {
+			return fmt.Errorf("failed to get absolute path: %w", err)
+		}
+		fmt.Fprintf(&list, "file %s\n", proc.ShellQuote(abs))
+	}
+
+	listFile, err := os.CreateTemp("", "encz-sprites-*.txt")
+	if err != nil {
+		return fmt.Errorf("failed to create image list: %w", err)
+	}
+	defer os.Remove(listFile.Name())
+	if _, err := listFile.WriteString(list.String()); err != nil {
+		listFile.Close()
+		return fmt.Errorf("failed to write image list: %w", err)
+	}
+	listFile.Close()
+
+	rows := (len(images) + columns - 1) / columns
+	cmd := exec.CommandContext(ctx, Binary,
+		"-y",
+		"-v", "error",
+		"-f", "concat",
+		"-safe", "0",
+		"-i", listFile.Name(),
+		"-vf", "scale="+strconv.Itoa(width)+":-2,tile="+strconv.Itoa(columns)+"x"+strconv.Itoa(rows),
+		"-frames:v", "1",
+		"-q:v", "3",
+		output)
+	if out, err := cmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("failed to create sprite sheet: %w: %s", err, strings.TrimSpace(string(out)))
+	}
+	return nil
+}
+
+// ScaledFrame writes the frame of input at the given time as a PNG scaled to width x height
+func ScaledFrame(ctx context.Context, input string, at time.Duration, width, height int, output string) error {
+	cmd := exec.CommandContext(ctx, Binary,
+		"-y",
+		"-v", "error",
+		"-ss", seconds(at),
+		"-i", input,
+		"-vf", fmt.Sprintf("scale=%d:%d:flags=lanczos,setsar=1", width, height),
+		"-frames:v", "1",
+		output)
+	if out, err := cmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("failed to extract frame at %s: %w: %s", at, err, strings.TrimSpace(string(out)))
+	}
+	return nil
+}
+
+// SideBySide writes the frames of left and right at the given time next to each
+// other as a PNG, scaling both to width x height
+func SideBySide(ctx context.Context, left, right string, at time.Duration, width, height int, output string) error {
+	scale := fmt.Sprintf("scale=%d:%d:flags=lanczos,setsar=1", width, height)
+	cmd := exec.CommandContext(ctx, Binary,
+		"-y",
+		"-v", "error",
+		"-ss", seconds(at),
+		"-i", left,
+		"-ss", seconds(at),
+		"-i", right,
+		"-filter_complex", "[0:v]"+scale+"[l];[1:v]"+scale+"[r];[l][r]hstack",
+		"-frames:v", "1",
+		output)
+	if out, err := cmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("failed to create comparison at %s: %w: %s", at, err, strings.TrimSpace(string(out)))
+	}
+	return nil
+}
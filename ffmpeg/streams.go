@@ -0,0 +1,83 @@
+package ffmpeg
+
+import "fmt"
+
+// Tracks selects the audio or subtitle streams of the input kept in the output
+type Tracks struct {
+	// All keeps every stream, None drops them and Indices keeps the listed
+	// ones, counted from 0 among the streams of their kind. The zero value
+	// keeps the default selection.
+	All     bool
+	None    bool
+	Indices []int
+}
+
+// IsDefault reports whether t keeps the default selection
+func (t Tracks) IsDefault() bool {
+	return !t.All && !t.None && len(t.Indices) == 0
+}
+
+// maps returns the -map options of the streams of kind ("a" or "s") of the
+// input numbered input kept by t, with def for the default selection
+func (t Tracks) maps(input int, kind string, def ...string) []string {
+	switch {
+	case t.None:
+		return nil
+	case t.All:
+		return []string{"-map", fmt.Sprintf("%d:%s?", input, kind)}
+	case len(t.Indices) > 0:
+		var args []string
+		for _, i := range t.Indices {
+			args = append(args, "-map", fmt.Sprintf("%d:%s:%d", input, kind, i))
+		}
+		return args
+	default:
+		return def
+	}
+}
+
+// selectsStreams reports whether params replace ffmpeg's default stream selection
+func selectsStreams(params EncodeParams) bool {
+	return params.VideoTrack > 0 || !params.Audio.IsDefault() || !params.Subtitles.IsDefault() || params.Attachments
+}
+
+// videoInput returns the filter graph label of the video stream encoded
+func videoInput(params EncodeParams) string {
+	return fmt.Sprintf("[0:v:%d]", params.VideoTrack)
+}
+
+// streamArgs returns the options keeping the selected streams of the input,
+// none when ffmpeg's default of one stream of each kind is kept. Once streams
+// are selected, the kinds left to the default keep their first stream.
+func streamArgs(params EncodeParams) []string {
+	if !selectsStreams(params) {
+		return nil
+	}
+
+	args := []string{"-map", fmt.Sprintf("0:v:%d", params.VideoTrack)}
+	return append(args, keptStreamArgs(params)...)
+}
+
+// keptStreamArgs returns the options keeping the selected audio, subtitles
+// and attachments
+func keptStreamArgs(params EncodeParams) []string {
+	args := params.Audio.maps(0, "a", "-map", "0:a:0?")
+	return append(args, sideStreamArgs(params, params.Subtitles.maps(0, "s", "-map", "0:s:0?"))...)
+}
+
+// sideStreamArgs returns the options of the subtitles mapped by maps and the
+// attachments, which only Matroska can carry. Matroska keeps subtitles as is,
+// converting them would fail for picture-based ones.
+func sideStreamArgs(params EncodeParams, maps []string) []string {
+	args := maps
+	if isMP4(params.OutputPath) {
+		return args
+	}
+	if len(maps) > 0 {
+		args = append(args, "-c:s", "copy")
+	}
+	if params.Attachments {
+		args = append(args, "-map", "0:t?", "-c:t", "copy")
+	}
+	return args
+}
@@ -0,0 +1,64 @@
+package ffmpeg
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"math"
+	"os/exec"
+	"regexp"
+	"strconv"
+	"time"
+)
+
+// telecineFrames is the number of frames analysed by DetectTelecine, 20 seconds at 29.97fps
+const telecineFrames = 600
+
+// telecineFilter matches the fields of telecined frames back into film frames,
+// deinterlaces the frames left combed and drops the duplicate of every five
+const telecineFilter = "fieldmatch=combmatch=full,yadif=deint=interlaced,decimate"
+
+// repeatedFieldsRegex matches the summary idet prints for the whole run, like
+// "Repeated Fields: Neither:   412 Top:    94 Bottom:    95"
+var repeatedFieldsRegex = regexp.MustCompile(`Repeated Fields: Neither:\s*(\d+)\s*Top:\s*(\d+)\s*Bottom:\s*(\d+)`)
+
+// IsTelecineRate reports whether fps is the 29.97fps of NTSC video, which film
+// is telecined to by repeating fields
+func IsTelecineRate(fps float64) bool {
+	return math.Abs(fps-30000.0/1001) < 0.01
+}
+
+// DetectTelecine reports whether input looks telecined, by counting the
+// repeated fields in the frames from at. Pulldown repeats a field in two of
+// every five frames, progressive and interlaced video repeat none.
+func DetectTelecine(ctx context.Context, input string, at time.Duration) (bool, error) {
+	cmd := exec.CommandContext(ctx, Binary,
+		"-hide_banner",
+		"-ss", seconds(at),
+		"-i", input,
+		"-map", "0:v:0",
+		"-vf", "idet",
+		"-frames:v", strconv.Itoa(telecineFrames),
+		"-an",
+		"-f", "null", "-")
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return false, fmt.Errorf("failed to detect telecine: %w", err)
+	}
+
+	m := repeatedFieldsRegex.FindSubmatch(stderr.Bytes())
+	if m == nil {
+		return false, fmt.Errorf("no field statistics in ffmpeg output")
+	}
+	neither, _ := strconv.Atoi(string(m[1]))
+	top, _ := strconv.Atoi(string(m[2]))
+	bottom, _ := strconv.Atoi(string(m[3]))
+	total := neither + top + bottom
+	if total == 0 {
+		return false, nil
+	}
+
+	// 40% for clean pulldown, idet misses some in low motion scenes
+	return float64(top+bottom)/float64(total) >= 0.2, nil
+}
@@ -0,0 +1,64 @@
+package ffmpeg
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os/exec"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var vmafScoreRegex = regexp.MustCompile(`VMAF score: ([\d.]+)`)
+
+// CutSample copies length of the video and audio of input starting at the keyframe
+// before at, without re-encoding, so it can serve as the reference of a quality test
+func CutSample(ctx context.Context, input string, at, length time.Duration, output string) error {
+	cmd := exec.CommandContext(ctx, Binary,
+		"-y",
+		"-v", "error",
+		"-ss", seconds(at),
+		"-t", seconds(length),
+		"-i", input,
+		"-map", "0:v:0",
+		"-map", "0:a?",
+		"-c", "copy",
+		output)
+	if out, err := cmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("failed to cut sample: %w: %s", err, strings.TrimSpace(string(out)))
+	}
+	return nil
+}
+
+// VMAF scores distorted against reference, scaling distorted to the reference size.
+// It requires an ffmpeg built with libvmaf.
+func VMAF(ctx context.Context, distorted, reference string, width, height int) (float64, error) {
+	filter := fmt.Sprintf("[0:v]scale=%d:%d:flags=bicubic,setpts=PTS-STARTPTS[d];[1:v]setpts=PTS-STARTPTS[r];[d][r]libvmaf", width, height)
+	cmd := exec.CommandContext(ctx, Binary,
+		"-hide_banner",
+		"-i", distorted,
+		"-i", reference,
+		"-lavfi", filter,
+		"-f", "null", "-")
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		tail := stderr.String()
+		if i := strings.LastIndexByte(strings.TrimSpace(tail), '\n'); i >= 0 {
+			tail = tail[i+1:]
+		}
+		return 0, fmt.Errorf("failed to compute VMAF: %w: %s", err, strings.TrimSpace(tail))
+	}
+
+	m := vmafScoreRegex.FindSubmatch(stderr.Bytes())
+	if m == nil {
+		return 0, fmt.Errorf("no VMAF score in ffmpeg output, is ffmpeg built with libvmaf?")
+	}
+	score, err := strconv.ParseFloat(string(m[1]), 64)
+	if err != nil {
+		return 0, fmt.Errorf("failed to parse VMAF score: %w", err)
+	}
+	return score, nil
+}
@@ -0,0 +1,53 @@
+package ffmpeg
+
+import (
+	"cmp"
+	"fmt"
+	"slices"
+)
+
+// WatermarkPositions are the corners and the center a watermark can be placed at
+var WatermarkPositions = []string{"top-left", "top-right", "bottom-left", "bottom-right", "center"}
+
+// Watermark is an image overlaid on the video, such as a logo
+type Watermark struct {
+	Path string
+	// Position is one of WatermarkPositions
+	Position string
+	// Opacity is from 0 for invisible to 1 for opaque
+	Opacity float64
+}
+
+// IsValidWatermarkPosition reports whether position is one of WatermarkPositions
+func IsValidWatermarkPosition(position string) bool {
+	return slices.Contains(WatermarkPositions, position)
+}
+
+// overlay returns chain followed by the overlay of the watermark, or chain
+// when there's no watermark. id tells the labels of the branches of a filter
+// graph apart.
+func (w Watermark) overlay(chain, id string) string {
+	if w.Path == "" {
+		return chain
+	}
+	video, logo := "wmv"+id, "wml"+id
+	return fmt.Sprintf("%s[%s];movie=%s,format=rgba,colorchannelmixer=aa=%g[%s];[%s][%s]overlay=%s",
+		cmp.Or(chain, "null"), video, filterPath(w.Path), w.Opacity, logo, video, logo, w.coordinates())
+}
+
+// coordinates returns the overlay position, with a margin of 3% of the video height
+func (w Watermark) coordinates() string {
+	const margin = "H*0.03"
+	switch w.Position {
+	case "top-left":
+		return margin + ":" + margin
+	case "top-right":
+		return "W-w-" + margin + ":" + margin
+	case "bottom-left":
+		return margin + ":H-h-" + margin
+	case "center":
+		return "(W-w)/2:(H-h)/2"
+	default:
+		return "W-w-" + margin + ":H-h-" + margin
+	}
+}
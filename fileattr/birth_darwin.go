@@ -0,0 +1,22 @@
+package fileattr
+
+import (
+	"os"
+	"syscall"
+	"unsafe"
+
+	"golang.org/x/sys/unix"
+)
+
+// copyBirthTime sets the creation time with setattrlist
+func copyBirthTime(info os.FileInfo, dst string) error {
+	stat, ok := info.Sys().(*syscall.Stat_t)
+	if !ok {
+		return nil
+	}
+
+	attrs := unix.Attrlist{Bitmapcount: unix.ATTR_BIT_MAP_COUNT, Commonattr: unix.ATTR_CMN_CRTIME}
+	crtime := unix.Timespec{Sec: stat.Birthtimespec.Sec, Nsec: stat.Birthtimespec.Nsec}
+	buf := unsafe.Slice((*byte)(unsafe.Pointer(&crtime)), unsafe.Sizeof(crtime))
+	return unix.Setattrlist(dst, &attrs, buf, 0)
+}
@@ -0,0 +1,10 @@
+//go:build !darwin && !windows
+
+package fileattr
+
+import "os"
+
+// copyBirthTime does nothing where the creation time can't be set, like Linux
+func copyBirthTime(info os.FileInfo, dst string) error {
+	return nil
+}
@@ -0,0 +1,30 @@
+package fileattr
+
+import (
+	"os"
+	"syscall"
+
+	"golang.org/x/sys/windows"
+)
+
+// copyBirthTime sets the creation time with SetFileTime
+func copyBirthTime(info os.FileInfo, dst string) error {
+	data, ok := info.Sys().(*syscall.Win32FileAttributeData)
+	if !ok {
+		return nil
+	}
+
+	path, err := windows.UTF16PtrFromString(dst)
+	if err != nil {
+		return err
+	}
+	handle, err := windows.CreateFile(path, windows.FILE_WRITE_ATTRIBUTES, windows.FILE_SHARE_READ|windows.FILE_SHARE_WRITE,
+		nil, windows.OPEN_EXISTING, windows.FILE_ATTRIBUTE_NORMAL, 0)
+	if err != nil {
+		return err
+	}
+	defer windows.CloseHandle(handle)
+
+	created := windows.Filetime(data.CreationTime)
+	return windows.SetFileTime(handle, &created, nil, nil)
+}
@@ -0,0 +1,33 @@
+// Package fileattr copies file attributes that a re-encode loses, like the
+// modification date and extended attributes, from a source to an output
+package fileattr
+
+import (
+	"fmt"
+	"os"
+	"time"
+)
+
+// CopyTimes sets the modification time of dst to that of src, and the creation
+// time too where the system allows setting it (macOS and Windows)
+func CopyTimes(src, dst string) error {
+	info, err := os.Stat(src)
+	if err != nil {
+		return fmt.Errorf("failed to stat source: %w", err)
+	}
+
+	// A zero access time leaves it unchanged
+	if err := os.Chtimes(dst, time.Time{}, info.ModTime()); err != nil {
+		return fmt.Errorf("failed to set modification time: %w", err)
+	}
+	if err := copyBirthTime(info, dst); err != nil {
+		return fmt.Errorf("failed to set creation time: %w", err)
+	}
+	return nil
+}
+
+// CopyXattrs copies the extended attributes of src to dst, which hold the Finder
+// tags and labels on macOS. Attributes that can't be set are skipped and reported.
+func CopyXattrs(src, dst string) error {
+	return copyXattrs(src, dst)
+}
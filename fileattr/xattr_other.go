@@ -0,0 +1,8 @@
+//go:build !linux && !darwin
+
+package fileattr
+
+// copyXattrs does nothing where extended attributes aren't supported
+func copyXattrs(src, dst string) error {
+	return nil
+}
@@ -0,0 +1,73 @@
+//go:build linux || darwin
+
+package fileattr
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"runtime"
+	"strings"
+
+	"golang.org/x/sys/unix"
+)
+
+// copyXattrs copies the attributes one by one, the system has no call copying them all
+func copyXattrs(src, dst string) error {
+	names, err := listXattrs(src)
+	if err != nil {
+		return fmt.Errorf("failed to list extended attributes: %w", err)
+	}
+
+	var errs []error
+	for _, name := range names {
+		// Other Linux namespaces are for the kernel and need privileges
+		if runtime.GOOS == "linux" && !strings.HasPrefix(name, "user.") {
+			continue
+		}
+		value, err := getXattr(src, name)
+		if err == nil {
+			err = unix.Setxattr(dst, name, value, 0)
+		}
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", name, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// listXattrs returns the names of the extended attributes of path
+func listXattrs(path string) ([]string, error) {
+	size, err := unix.Listxattr(path, nil)
+	if err != nil || size == 0 {
+		if errors.Is(err, unix.ENOTSUP) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	buf := make([]byte, size)
+	if size, err = unix.Listxattr(path, buf); err != nil {
+		return nil, err
+	}
+
+	var names []string
+	for name := range bytes.SplitSeq(buf[:size], []byte{0}) {
+		if len(name) > 0 {
+			names = append(names, string(name))
+		}
+	}
+	return names, nil
+}
+
+// getXattr returns the value of an extended attribute of path
+func getXattr(path, name string) ([]byte, error) {
+	size, err := unix.Getxattr(path, name, nil)
+	if err != nil {
+		return nil, err
+	}
+	value := make([]byte, size)
+	if size, err = unix.Getxattr(path, name, value); err != nil {
+		return nil, err
+	}
+	return value[:size], nil
+}
@@ -0,0 +1,158 @@
+package main
+
+import (
+	"cmp"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"regexp"
+	"strings"
+	"unicode/utf8"
+
+	"encz/ffmpeg"
+)
+
+// maxFilenameBytes is the longest output name, leaving room within the 255 byte
+// limit of most filesystems for the extras named after it, like "-sprites.jpg"
+const maxFilenameBytes = 255 - len("-sprites.jpg")
+
+// defaultNameTemplate is the name outputs always had, e.g. "movie [1080p, x265]"
+const defaultNameTemplate = "{stem} [{resolution}, {codec}, {tag}]"
+
+// nameLabels are the values of the placeholders of a --name-template
+type nameLabels struct {
+	Resolution string
+	Codec      string
+	// Tag is the tag of the lossless modes, like "lossless"
+	Tag string
+	// BitDepth is like "10bit", empty for 8-bit outputs
+	BitDepth string
+	// HDR is HDR or HLG, empty for SDR outputs
+	HDR string
+}
+
+var (
+	// tagWordRegex matches a word source names are tagged with, by encz or release groups
+	tagWordRegex = regexp.MustCompile(`(?i)^(\d{3,4}[pi]|[248]k|uhd|x26[45]|h\.?26[45]|hevc|avc|av1|vp9|xvid|divx|ffv1|(8|10|12)[ -]?bit|hdr(10\+?)?|hlg|sdr|dv|lossless|visually lossless)$`)
+	// tagGroupRegex matches a group in brackets or parentheses, like "[1080p, x265]"
+	tagGroupRegex = regexp.MustCompile(`\s*[\[(]([^\[\]()]*)[\])]`)
+	// sceneTagRegex matches a tag between the dots of a scene release name, like
+	// ".1080p." in "Movie.2019.1080p.x264-GROUP", keeping the separator after it
+	sceneTagRegex = regexp.MustCompile(`(?i)[._ ](\d{3,4}p|[248]k|x26[45]|h\.?26[45]|hevc|avc|10bit|hdr(10\+?)?)([._ -]|$)`)
+
+	// Separators left by placeholders without a value, like "[1080p, , x265, ]"
+	repeatedCommaRegex = regexp.MustCompile(`,(\s*,)+`)
+	leadingCommaRegex  = regexp.MustCompile(`([\[(])\s*,\s*`)
+	trailingCommaRegex = regexp.MustCompile(`\s*,\s*([\])])`)
+)
+
+// nameLabels returns the labels of an output of the source described by probe:
+// the bit depth is that of the pixel format it's encoded to, and the HDR of the
+// source is kept by outputs of at least 10 bits
+func (c *cliArgs) nameLabels(probe ffmpeg.ProbeResult) nameLabels {
+	labels := nameLabels{Codec: c.codecLabel(), Tag: c.qualityTag()}
+	pixFmt := cmp.Or(ffmpeg.PixelFormat(c.VideoEncoder, c.Is10Bit), probe.PixFmt)
+	if depth := ffmpeg.BitDepth(pixFmt); depth > 8 {
+		labels.BitDepth = fmt.Sprintf("%dbit", depth)
+		labels.HDR = probe.HDR()
+	}
+	return labels
+}
+
+// validateNameTemplate checks that outputs named by template stay apart
+func validateNameTemplate(template string) error {
+	if !strings.Contains(template, "{stem}") {
+		return fmt.Errorf("invalid --name-template %q: it must contain {stem}", template)
+	}
+	if strings.ContainsAny(template, `/\`) {
+		return fmt.Errorf("invalid --name-template %q: it names a file, not a folder", template)
+	}
+	return nil
+}
+
+// formatFilename fills the placeholders of a --name-template, dropping what's
+// left of those without a value, and shortens stems too long for the filesystem
+func formatFilename(template, stem string, labels nameLabels, ext string) string {
+	name := strings.NewReplacer(
+		"{resolution}", labels.Resolution,
+		"{codec}", labels.Codec,
+		"{tag}", labels.Tag,
+		"{bitdepth}", labels.BitDepth,
+		"{hdr}", labels.HDR,
+	).Replace(template)
+
+	name = repeatedCommaRegex.ReplaceAllString(name, ",")
+	name = leadingCommaRegex.ReplaceAllString(name, "$1")
+	name = trailingCommaRegex.ReplaceAllString(name, "$1")
+	name = emptyGroupRegex.ReplaceAllString(name, "")
+	name = strings.TrimSpace(spacesRegex.ReplaceAllString(name, " "))
+
+	before, after, _ := strings.Cut(name, "{stem}")
+	return fitFilename(before+stem, after, ext)
+}
+
+// stripTags removes the resolution, codec and bit depth tags from the stem of a
+// source name, so re-encoding a previous output doesn't tag it twice, e.g.
+// "Movie [1080p, x265]" and "Movie.2019.1080p.x264-GROUP" become "Movie" and
+// "Movie.2019-GROUP". Groups holding anything else, like "(2019)", are kept.
+func stripTags(stem string) string {
+	stripped := tagGroupRegex.ReplaceAllStringFunc(stem, func(group string) string {
+		if isTagGroup(tagGroupRegex.FindStringSubmatch(group)[1]) {
+			return ""
+		}
+		return group
+	})
+	// Adjacent tags share a separator, each pass removes every other one
+	for {
+		next := sceneTagRegex.ReplaceAllString(stripped, "${3}")
+		if next == stripped {
+			break
+		}
+		stripped = next
+	}
+
+	stripped = strings.TrimSpace(spacesRegex.ReplaceAllString(stripped, " "))
+	if stripped == "" {
+		return stem
+	}
+	return stripped
+}
+
+// isTagGroup reports whether the contents of a group are only tags, like
+// "1080p, x265" or "HEVC 10bit"
+func isTagGroup(contents string) bool {
+	if strings.TrimSpace(contents) == "" {
+		return false
+	}
+	for _, label := range strings.Split(contents, ",") {
+		label = strings.TrimSpace(label)
+		if tagWordRegex.MatchString(label) {
+			continue
+		}
+		for _, word := range strings.Fields(label) {
+			if !tagWordRegex.MatchString(word) {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// fitFilename joins the stem of an output name with its labels, e.g.
+// " [1080p, x265]", and extension. Stems too long for the filesystem are cut at
+// a character boundary and end with a hash of the whole stem, so outputs of
+// long names sharing their start don't overwrite each other.
+func fitFilename(stem, labels, ext string) string {
+	if len(stem)+len(labels)+len(ext) <= maxFilenameBytes {
+		return stem + labels + ext
+	}
+
+	sum := sha256.Sum256([]byte(stem))
+	hash := "~" + hex.EncodeToString(sum[:4])
+
+	cut := max(maxFilenameBytes-len(labels)-len(ext)-len(hash), 0)
+	for cut > 0 && !utf8.RuneStart(stem[cut]) {
+		cut--
+	}
+	return strings.TrimRight(stem[:cut], " .-_") + hash + labels + ext
+}
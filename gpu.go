@@ -0,0 +1,69 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/rs/zerolog/log"
+
+	"encz/ffmpeg"
+	"encz/handbrake"
+)
+
+// isNVENC reports whether the video encoder of c is an NVENC encoder of either engine
+func (c *cliArgs) isNVENC() bool {
+	encoder := videoEncoderName(*c)
+	return strings.HasSuffix(encoder, "_nvenc") || strings.HasPrefix(encoder, "nvenc_")
+}
+
+// validateGPU checks that --gpu selects a device of the video encoder. auto
+// picks an NVIDIA GPU, VAAPI and QSV devices are named explicitly.
+func (c *cliArgs) validateGPU() error {
+	switch {
+	case c.GPU == "":
+		return nil
+	case c.GPU == "auto":
+		if !c.isNVENC() {
+			return fmt.Errorf("--gpu auto picks between NVIDIA GPUs, %s isn't an NVENC encoder", videoEncoderName(*c))
+		}
+		return nil
+	case c.Encoder == "ffmpeg":
+		return ffmpeg.ValidateGPU(c.VideoEncoder, c.GPU)
+	}
+	return handbrake.ValidateGPU(c.VideoEncoder, c.GPU)
+}
+
+// resolveGPU turns --gpu auto into the NVIDIA GPU running the fewest encoder
+// sessions, spreading concurrent jobs across the GPUs
+func resolveGPU(ctx context.Context, args cliArgs) string {
+	if args.GPU != "auto" {
+		return args.GPU
+	}
+	gpus, err := ffmpeg.NvidiaGPUs(ctx)
+	if err != nil {
+		log.Ctx(ctx).Warn().Err(err).Msg("failed to list GPUs, using the default one")
+		return ""
+	}
+
+	var picked *ffmpeg.GPU
+	for i, gpu := range gpus {
+		if gpu.Sessions < 0 {
+			continue
+		}
+		if picked == nil || gpu.Sessions < picked.Sessions {
+			picked = &gpus[i]
+		}
+	}
+	if picked == nil {
+		log.Ctx(ctx).Warn().Msg("no NVIDIA GPU reports its encoder sessions, using the default one")
+		return ""
+	}
+
+	log.Ctx(ctx).Info().
+		Str("gpu", picked.Device).
+		Str("name", picked.Name).
+		Int("sessions", picked.Sessions).
+		Msg("encoding on the GPU with the fewest encoder sessions")
+	return picked.Device
+}
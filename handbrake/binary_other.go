@@ -0,0 +1,8 @@
+//go:build !windows
+
+package handbrake
+
+// FindBinary returns the HandBrakeCLI executable to run, package managers put it on PATH
+func FindBinary() string {
+	return Binary
+}
@@ -0,0 +1,34 @@
+package handbrake
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+)
+
+// FindBinary returns the HandBrakeCLI executable to run. The Windows download
+// is a zip without an installer, so besides PATH it's looked up next to encz
+// and in the HandBrake folder of Program Files.
+func FindBinary() string {
+	if _, err := exec.LookPath(Binary); err == nil {
+		return Binary
+	}
+
+	var dirs []string
+	if exe, err := os.Executable(); err == nil {
+		dirs = append(dirs, filepath.Dir(exe))
+	}
+	for _, env := range []string{"ProgramFiles", "ProgramFiles(x86)"} {
+		if dir := os.Getenv(env); dir != "" {
+			dirs = append(dirs, filepath.Join(dir, "HandBrake"))
+		}
+	}
+
+	for _, dir := range dirs {
+		path := filepath.Join(dir, "HandBrakeCLI.exe")
+		if _, err := os.Stat(path); err == nil {
+			return path
+		}
+	}
+	return Binary
+}
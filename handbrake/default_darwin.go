@@ -0,0 +1,9 @@
+package handbrake
+
+// DefaultVideoEncoder is the video encoder used when none is specified.
+// Every Mac since 2017 encodes HEVC with VideoToolbox.
+const DefaultVideoEncoder = "vt_h265"
+
+// aacEncoder is the AAC encoder of Apple's Core Audio, which sounds better
+// than HandBrake's own at the same bitrate
+const aacEncoder = "ca_aac"
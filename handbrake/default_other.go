@@ -0,0 +1,10 @@
+//go:build !darwin
+
+package handbrake
+
+// DefaultVideoEncoder is the video encoder used when none is specified.
+// Hardware encoders depend on the GPU elsewhere, x265 runs anywhere.
+const DefaultVideoEncoder = "x265"
+
+// aacEncoder is the AAC encoder of HandBrake, Core Audio's is only on macOS
+const aacEncoder = "av_aac"
@@ -1,6 +1,7 @@
 package handbrake
 
 import (
+	"cmp"
 	"context"
 	"fmt"
 	"io"
@@ -8,12 +9,15 @@ import (
 	"math"
 	"os"
 	"os/exec"
-	"regexp"
+	"slices"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/rs/zerolog/log"
+
+	"encz/proc"
 )
 
 // EncodeParams represents parameters for HandBrake video encoding
@@ -28,10 +32,167 @@ type EncodeParams struct {
 	Width      int
 	Height     int
 	ExtraArgs  []string
+	AudioCopy  bool
+	// VideoEncoder is the HandBrake video encoder, DefaultVideoEncoder when empty.
+	// The 10-bit variant is selected automatically when Is10Bit is set.
+	VideoEncoder string
+	// Verbosity is the HandBrake log level used when LogOutput is set
+	Verbosity int
+	// LogOutput receives HandBrake's detailed log (scan results, filter
+	// decisions, muxer info), which HandBrake writes to stderr
+	LogOutput io.Writer
+	// Threads limits the thread pool of the x265 encoder, 0 for automatic
+	Threads int
+	// AccurateSeek uses frame numbers for the start and stop points, which requires FPS
+	AccurateSeek bool
+	// FPS is the frame rate of the input
+	FPS float64
+	// StripMetadata leaves out the chapter markers
+	StripMetadata bool
+	// SampleAR is the sample aspect ratio of the input, anamorphic inputs are
+	// scaled to square pixels
+	SampleAR float64
+	// HWDecode decodes on the hardware of the encoder, where HandBrake supports it
+	HWDecode bool
+	// Detelecine restores the film frames of telecined input
+	Detelecine bool
+	// Grain is keep, synthesize, remove or empty to leave it to the encoder
+	Grain string
+	// Title is the title of a DVD or Blu-ray to encode, 0 for HandBrake's default
+	Title int
+	// Audio and Subtitles select the tracks kept besides the video
+	Audio     Tracks
+	Subtitles Tracks
+	// Lossless encodes every pixel of the input exactly, see SupportsLossless
+	Lossless bool
+	// Tune is the --encoder-tune of x264 or x265, like animation
+	Tune string
+	// EncoderOptions are key=value options of the video encoder, passed with
+	// --encopts and overriding those set from the other params
+	EncoderOptions []string
+	// AudioCodec is the codec of the audio tracks, AC3 when empty
+	AudioCodec string
+	// AudioTracks are the codecs and bitrates of the output audio tracks in
+	// order, AudioCodec at HandBrake's default bitrate when empty
+	AudioTracks []AudioTrack
+	// AudioGain changes the volume of the encoded audio tracks in dB
+	AudioGain float64
+	// GPU is the index of the NVIDIA GPU NVENC encoders run on, see ValidateGPU
+	GPU string
+}
+
+// AudioTrack is how an output audio track is encoded
+type AudioTrack struct {
+	// Codec is aac, opus, ac3, eac3 or copy to pass the track through
+	Codec string
+	// Bitrate is in kbps, ignored for passed through tracks
+	Bitrate int
+}
+
+// mergeOptions returns the key=value options of base with those of extra
+// added, replacing the base options of the same keys
+func mergeOptions(base, extra []string) []string {
+	key := func(option string) string {
+		k, _, _ := strings.Cut(option, "=")
+		return k
+	}
+	var merged []string
+	for _, option := range base {
+		if !slices.ContainsFunc(extra, func(e string) bool { return key(e) == key(option) }) {
+			merged = append(merged, option)
+		}
+	}
+	return append(merged, extra...)
+}
+
+// SupportsLossless reports whether encoder can encode losslessly
+func SupportsLossless(encoder string) bool {
+	encoder = cmp.Or(encoder, DefaultVideoEncoder)
+	return strings.HasPrefix(encoder, "x265") || strings.HasPrefix(encoder, "x264")
+}
+
+// quality returns the --quality of an encode, x264 is lossless at 0
+func quality(params EncodeParams, encoder string) string {
+	if params.Lossless && strings.HasPrefix(encoder, "x264") {
+		return "0"
+	}
+	return fmt.Sprintf("%.0f", params.Quality)
+}
+
+// audioEncoder returns the HandBrake encoder of codec, aac, opus, ac3, eac3 or copy
+func audioEncoder(codec string) string {
+	if codec == "aac" {
+		return aacEncoder
+	}
+	return codec
+}
+
+// Binary is the HandBrakeCLI executable
+var Binary = "HandBrakeCLI"
+
+// ValidateGPU checks that gpu selects a device of encoder. Only NVENC
+// encoders can be told which GPU to use, by its index.
+func ValidateGPU(encoder, gpu string) error {
+	encoder = cmp.Or(encoder, DefaultVideoEncoder)
+	if !strings.HasPrefix(encoder, "nvenc_") {
+		return fmt.Errorf("HandBrake can't select the GPU of %s, only of NVENC encoders", encoder)
+	}
+	if index, err := strconv.Atoi(gpu); err != nil || index < 0 {
+		return fmt.Errorf("invalid GPU %q: %s expects the index of an NVIDIA GPU, e.g. 1", gpu, encoder)
+	}
+	return nil
+}
+
+// IsHardwareEncoder reports whether encoder runs on dedicated hardware
+func IsHardwareEncoder(encoder string) bool {
+	for _, prefix := range []string{"vt_", "nvenc_", "qsv_", "vce_", "mf_"} {
+		if strings.HasPrefix(cmp.Or(encoder, DefaultVideoEncoder), prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// SupportsGrainSynthesis reports whether encoder can describe the grain of the
+// input for players to synthesize, which the SVT-AV1 encoder does
+func SupportsGrainSynthesis(encoder string) bool {
+	return strings.HasPrefix(cmp.Or(encoder, DefaultVideoEncoder), "svt_av1")
+}
+
+// QualityHigherIsBetter reports whether higher quality values mean better
+// quality for encoder. VideoToolbox uses a 1-100 quality scale, while the
+// RF/CQ style rate control of other encoders treats lower values as better.
+func QualityHigherIsBetter(encoder string) bool {
+	return strings.HasPrefix(cmp.Or(encoder, DefaultVideoEncoder), "vt_")
+}
+
+// videoEncoder returns the HandBrake encoder name for the requested bit depth
+func videoEncoder(params EncodeParams) string {
+	encoder := cmp.Or(params.VideoEncoder, DefaultVideoEncoder)
+	if params.Is10Bit && !strings.HasSuffix(encoder, "_10bit") {
+		encoder += "_10bit"
+	}
+	return encoder
+}
+
+// hwDecoder returns the --enable-hw-decoding type matching encoder, or an empty
+// string when HandBrake can't decode on that hardware
+func hwDecoder(encoder string) string {
+	switch {
+	case strings.HasPrefix(encoder, "vt_"):
+		return "videotoolbox"
+	case strings.HasPrefix(encoder, "nvenc_"):
+		return "nvdec"
+	case strings.HasPrefix(encoder, "qsv_"):
+		return "qsv"
+	}
+	return ""
 }
 
 // EncodeProgress represents encoding progress information
 type EncodeProgress struct {
+	// Phase is one of the Phase constants
+	Phase       string
 	Percent     float64
 	FPSAvg      float64
 	ETA         time.Duration
@@ -102,40 +263,143 @@ func iterLines(reader io.Reader) iter.Seq[string] {
 	}
 }
 
+// Version returns the HandBrake version, e.g. "HandBrake 1.7.3"
+func Version(ctx context.Context) (string, error) {
+	output, err := exec.CommandContext(ctx, Binary, "--version").Output()
+	if err != nil {
+		return "", fmt.Errorf("failed to get HandBrake version: %w", err)
+	}
+	for line := range strings.Lines(string(output)) {
+		if strings.HasPrefix(line, "HandBrake") {
+			return strings.TrimSpace(line), nil
+		}
+	}
+	return strings.TrimSpace(string(output)), nil
+}
+
+// EncoderWorks checks that encoder can encode samplePath on this machine,
+// using the 10-bit variant like Encode does when is10Bit is set
+func EncoderWorks(ctx context.Context, encoder string, is10Bit bool, samplePath string) error {
+	encoder = videoEncoder(EncodeParams{VideoEncoder: encoder, Is10Bit: is10Bit})
+	output := samplePath + ".handbrake.mp4"
+	defer os.Remove(output)
+
+	cmd := exec.CommandContext(ctx, Binary,
+		"--input", samplePath,
+		"--output", output,
+		"--encoder", encoder,
+		"--quality", "30",
+		"--audio", "none")
+	if out, err := cmd.CombinedOutput(); err != nil {
+		// The reason is usually in the last lines of the log
+		lines := strings.Split(strings.TrimSpace(string(out)), "\n")
+		return fmt.Errorf("test encode failed: %w: %s", err, lines[len(lines)-1])
+	}
+	return nil
+}
+
 // Encode encodes video using HandBrake
 func Encode(ctx context.Context, params EncodeParams, onProgress ProgressCallback) error {
-	encoder := "vt_h265"
-	if params.Is10Bit {
-		encoder = "vt_h265_10bit"
-	}
+	encoder := videoEncoder(params)
 
 	args := []string{
-		"HandbrakeCLI",
+		Binary,
 		"--format", "av_mp4",
 		"--input", params.InputPath,
 		"--output", params.OutputPath,
 		"--optimize",
 		"--encoder", encoder,
-		"--quality", fmt.Sprintf("%.0f", params.Quality),
+		"--quality", quality(params, encoder),
 		"--vfr",
-		"--aencoder", "ac3",
-		"--ab", "160",
-		"--non-anamorphic",
-		"--verbose", "1",
+		"--json",
 	}
 
-	if params.FromTime > 0 {
-		args = append(args, "--start-at", fmt.Sprintf("duration:%0.1f", params.FromTime.Seconds()))
+	args = append(args, params.Audio.trackArgs("--audio", "--all-audio")...)
+	switch {
+	case params.Audio.None:
+	case params.AudioCopy:
+		args = append(args, "--aencoder", params.Audio.perTrack("copy"))
+	case params.AudioCodec == "":
+		args = append(args, "--aencoder", params.Audio.perTrack("ac3"), "--ab", params.Audio.perTrack("160"))
+	case len(params.AudioTracks) > 0:
+		encoders := make([]string, len(params.AudioTracks))
+		bitrates := make([]string, len(params.AudioTracks))
+		for i, track := range params.AudioTracks {
+			encoders[i] = audioEncoder(track.Codec)
+			bitrates[i] = strconv.Itoa(track.Bitrate)
+		}
+		args = append(args, "--aencoder", strings.Join(encoders, ","), "--ab", strings.Join(bitrates, ","))
+	default:
+		args = append(args, "--aencoder", params.Audio.perTrack(audioEncoder(params.AudioCodec)))
+	}
+	if params.AudioGain != 0 && !params.Audio.None && !params.AudioCopy {
+		gain := strconv.FormatFloat(params.AudioGain, 'f', -1, 64)
+		gains := params.Audio.perTrack(gain)
+		if len(params.AudioTracks) > 0 {
+			gains = strings.Repeat(gain+",", len(params.AudioTracks)-1) + gain
+		}
+		args = append(args, "--gain", gains)
 	}
+	args = append(args, params.Subtitles.trackArgs("--subtitle", "--all-subtitles")...)
 
-	if params.Duration > 0 {
-		args = append(args, "--stop-at", fmt.Sprintf("duration:%0.1f", params.Duration.Seconds()))
+	// Square pixels display the same in every player
+	if params.SampleAR > 0 && math.Abs(params.SampleAR-1) > 0.01 {
+		args = append(args, "--non-anamorphic")
+	}
+
+	args = append(args, "--verbose", strconv.Itoa(verbosity(params)))
+
+	args = append(args, trimArgs(params)...)
+
+	if params.Title > 0 {
+		args = append(args, "--title", strconv.Itoa(params.Title))
+	}
+
+	if !params.StripMetadata {
+		args = append(args, "--markers")
+	}
+
+	if decoder := hwDecoder(encoder); params.HWDecode && decoder != "" {
+		args = append(args, "--enable-hw-decoding", decoder)
+	}
+
+	if params.Detelecine {
+		// Frames left combed after field matching are deinterlaced
+		args = append(args, "--detelecine", "--comb-detect", "--decomb")
 	}
 
 	if params.Denoise {
 		args = append(args, "--hqdn3d", "light")
 	}
 
+	var encopts []string
+	if params.Threads > 0 && strings.HasPrefix(encoder, "x265") {
+		encopts = append(encopts, fmt.Sprintf("pools=%d", params.Threads))
+	}
+	if params.Lossless && strings.HasPrefix(encoder, "x265") {
+		encopts = append(encopts, "lossless=1")
+	}
+	// HandBrake passes the options of its FFmpeg encoders on as they are
+	if params.GPU != "" && strings.HasPrefix(encoder, "nvenc_") {
+		encopts = append(encopts, "gpu="+params.GPU)
+	}
+
+	switch {
+	case params.Tune != "" && (strings.HasPrefix(encoder, "x264") || strings.HasPrefix(encoder, "x265")):
+		args = append(args, "--encoder-tune", params.Tune)
+	case params.Grain == "keep" && strings.HasPrefix(encoder, "x265"):
+		args = append(args, "--encoder-tune", "grain")
+	case params.Grain == "synthesize" && strings.HasPrefix(encoder, "svt_av1"):
+		encopts = append(encopts, "film-grain=8", "film-grain-denoise=1")
+	case params.Grain == "remove":
+		args = append(args, "--nlmeans", "medium", "--nlmeans-tune", "grain")
+	}
+
+	encopts = mergeOptions(encopts, params.EncoderOptions)
+	if len(encopts) > 0 {
+		args = append(args, "--encopts", strings.Join(encopts, ":"))
+	}
+
 	// Add video scaling parameters if width or height are specified
 	if params.Width > 0 || params.Height > 0 {
 		if params.Width > 0 && params.Height > 0 {
@@ -154,67 +418,101 @@ func Encode(ctx context.Context, params EncodeParams, onProgress ProgressCallbac
 
 	log.Ctx(ctx).Debug().Strs("args", args).Msg("starting handbrake encoding")
 
-	cmd := exec.CommandContext(ctx, args[0], args[1:]...)
+	cmd := proc.Command(ctx, args[0], args[1:]...)
+	tail := proc.NewTail(3)
+	var logOutput io.Writer = tail
+	if params.LogOutput != nil {
+		logOutput = io.MultiWriter(tail, params.LogOutput)
+	}
 
 	stdout, err := cmd.StdoutPipe()
 	if err != nil {
 		return fmt.Errorf("failed to create stdout pipe: %w", err)
 	}
+	stderr, err := cmd.StderrPipe()
+	if err != nil {
+		return fmt.Errorf("failed to create stderr pipe: %w", err)
+	}
 
 	log.Ctx(ctx).Debug().Msg("starting handbrake process")
 
 	if err := cmd.Start(); err != nil {
 		return fmt.Errorf("failed to start handbrake: %w", err)
 	}
+	defer proc.Track(cmd)()
+
+	// Some HandBrake versions write progress to stderr along with the log,
+	// so both pipes are parsed. Both must be drained before Wait, which closes them.
+	var mu sync.Mutex
+	var last EncodeProgress
+	report := func(progress EncodeProgress) {
+		mu.Lock()
+		defer mu.Unlock()
+		last = progress
+		if onProgress != nil {
+			onProgress(progress)
+		}
+	}
 
-	if onProgress != nil {
+	var wg sync.WaitGroup
+	for _, r := range []io.Reader{stdout, io.TeeReader(stderr, logOutput)} {
+		wg.Add(1)
 		go func() {
-			for line := range iterLines(stdout) {
-				if progress, ok := parseProgress(line, params.OutputPath); ok {
-					onProgress(progress)
-				}
+			defer wg.Done()
+			for progress := range iterProgress(r, params.OutputPath) {
+				report(progress)
 			}
+			_, _ = io.Copy(io.Discard, r)
 		}()
 	}
+	wg.Wait()
 
 	if err := cmd.Wait(); err != nil {
+		if msg := tail.String(); msg != "" {
+			return fmt.Errorf("handbrake failed: %w: %s", err, msg)
+		}
 		return fmt.Errorf("handbrake failed: %w", err)
 	}
 
+	if onProgress != nil && (last.Percent < 100 || last.Phase != PhaseEncoding) {
+		last.Phase, last.Percent, last.ETA = PhaseEncoding, 100, 0
+		if stat, err := os.Stat(params.OutputPath); err == nil {
+			last.CurrentSize = stat.Size()
+		}
+		onProgress(last)
+	}
+
 	return nil
 }
 
-// parseProgress extracts progress information from HandBrake output line
-func parseProgress(line string, outputPath string) (EncodeProgress, bool) {
-	progressRe := regexp.MustCompile(`Encoding: task \d+ of \d+, ([\d.]+) %(?:\s*\([^,]+,\s*avg\s+([\d.]+)\s*fps,\s*ETA\s+([^)]+)\))?`)
-
-	matches := progressRe.FindStringSubmatch(line)
-	if len(matches) < 2 {
-		return EncodeProgress{}, false
+// trimArgs returns the start and stop points of the requested time range.
+// Accurate seeking uses frame numbers, the stop point is relative to the start.
+func trimArgs(params EncodeParams) []string {
+	point := func(d time.Duration) string {
+		if params.AccurateSeek && params.FPS > 0 {
+			return fmt.Sprintf("frame:%d", int(math.Round(d.Seconds()*params.FPS)))
+		}
+		return fmt.Sprintf("duration:%0.1f", d.Seconds())
 	}
 
-	percent, _ := strconv.ParseFloat(matches[1], 64)
-
-	var fpsAvg float64
-	var eta time.Duration
-
-	// Check if we have FPS and ETA data
-	if len(matches) >= 4 && matches[2] != "" {
-		fpsAvg, _ = strconv.ParseFloat(matches[2], 64)
-		etaStr := strings.TrimSpace(matches[3])
-		eta, _ = time.ParseDuration(etaStr)
+	var args []string
+	if params.FromTime > 0 {
+		args = append(args, "--start-at", point(params.FromTime))
 	}
-
-	// Get current file size
-	var currentSize int64
-	if stat, err := os.Stat(outputPath); err == nil {
-		currentSize = stat.Size()
+	if params.Duration > 0 {
+		args = append(args, "--stop-at", point(params.Duration))
 	}
+	return args
+}
 
-	return EncodeProgress{
-		Percent:     math.Round(percent*10) / 10,
-		FPSAvg:      fpsAvg,
-		ETA:         eta,
-		CurrentSize: currentSize,
-	}, true
+// verbosity returns the HandBrake log level to use. Without a log output the
+// extra detail would be discarded, so the quiet default is kept.
+func verbosity(params EncodeParams) int {
+	if params.LogOutput == nil {
+		return 1
+	}
+	if params.Verbosity <= 0 {
+		return 2
+	}
+	return params.Verbosity
 }
@@ -0,0 +1,122 @@
+package handbrake
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"iter"
+	"os"
+	"strings"
+	"time"
+)
+
+// Phases reported in EncodeProgress. Multi-pass encodes report "pass N/M" instead of PhaseEncoding.
+const (
+	PhaseScanning = "scanning"
+	PhaseEncoding = "encoding"
+	PhaseMuxing   = "muxing"
+)
+
+// jsonProgress is a "Progress: {...}" block written by HandBrake with --json
+type jsonProgress struct {
+	State    string `json:"State"`
+	Scanning struct {
+		Progress float64 `json:"Progress"`
+	} `json:"Scanning"`
+	Working struct {
+		Progress   float64 `json:"Progress"`
+		Pass       int     `json:"Pass"`
+		PassCount  int     `json:"PassCount"`
+		Rate       float64 `json:"Rate"`
+		RateAvg    float64 `json:"RateAvg"`
+		ETASeconds int     `json:"ETASeconds"`
+	} `json:"Working"`
+	Muxing struct {
+		Progress float64 `json:"Progress"`
+	} `json:"Muxing"`
+}
+
+// iterJSONBlocks returns an iterator over the "Name: {...}" blocks of HandBrake's JSON output.
+// Each block starts with a line ending in "{" and ends with a "}" line without indentation.
+func iterJSONBlocks(r io.Reader) iter.Seq2[string, []byte] {
+	return func(yield func(string, []byte) bool) {
+		var name string
+		var body strings.Builder
+		inBlock := false
+
+		for line := range iterLines(r) {
+			if !inBlock {
+				if before, ok := strings.CutSuffix(line, ": {"); ok {
+					name = before
+					body.Reset()
+					body.WriteString("{")
+					inBlock = true
+				}
+				continue
+			}
+
+			body.WriteString(line)
+			if line == "}" {
+				inBlock = false
+				if !yield(name, []byte(body.String())) {
+					return
+				}
+			}
+		}
+	}
+}
+
+// iterProgress returns an iterator that yields EncodeProgress updates from HandBrake's JSON output
+func iterProgress(r io.Reader, outputPath string) iter.Seq[EncodeProgress] {
+	return func(yield func(EncodeProgress) bool) {
+		for name, body := range iterJSONBlocks(r) {
+			if name != "Progress" {
+				continue
+			}
+
+			var p jsonProgress
+			if err := json.Unmarshal(body, &p); err != nil {
+				continue
+			}
+
+			progress, ok := progressFromJSON(p)
+			if !ok {
+				continue
+			}
+
+			if stat, err := os.Stat(outputPath); err == nil {
+				progress.CurrentSize = stat.Size()
+			}
+
+			if !yield(progress) {
+				return
+			}
+		}
+	}
+}
+
+// progressFromJSON converts a progress block, reporting false for states without progress
+func progressFromJSON(p jsonProgress) (EncodeProgress, bool) {
+	switch p.State {
+	case "SCANNING":
+		return EncodeProgress{Phase: PhaseScanning}, true
+	case "WORKING":
+		w := p.Working
+		// Progress is per pass, the percentage covers all of them
+		fraction := w.Progress
+		phase := PhaseEncoding
+		if w.PassCount > 1 && w.Pass > 0 {
+			fraction = (float64(w.Pass-1) + w.Progress) / float64(w.PassCount)
+			phase = fmt.Sprintf("pass %d/%d", w.Pass, w.PassCount)
+		}
+		return EncodeProgress{
+			Phase:   phase,
+			Percent: round(fraction*100, 1),
+			FPSAvg:  w.RateAvg,
+			ETA:     time.Duration(w.ETASeconds) * time.Second,
+		}, true
+	case "MUXING":
+		return EncodeProgress{Phase: PhaseMuxing, Percent: 100}, true
+	}
+	return EncodeProgress{}, false
+}
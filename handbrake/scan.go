@@ -0,0 +1,113 @@
+package handbrake
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// Title is a title of a DVD or Blu-ray, as scanned by HandBrake
+type Title struct {
+	Index     int
+	Duration  time.Duration
+	Width     int
+	Height    int
+	FPS       float64
+	SampleAR  float64
+	Chapters  int
+	Audio     int
+	Subtitles int
+}
+
+// scanOutput is the part of HandBrake's JSON title set encz uses
+type scanOutput struct {
+	MainFeature int `json:"MainFeature"`
+	TitleList   []struct {
+		Index    int `json:"Index"`
+		Duration struct {
+			Ticks int64 `json:"Ticks"`
+		} `json:"Duration"`
+		FrameRate struct {
+			Num int `json:"Num"`
+			Den int `json:"Den"`
+		} `json:"FrameRate"`
+		Geometry struct {
+			Width  int `json:"Width"`
+			Height int `json:"Height"`
+			PAR    struct {
+				Num int `json:"Num"`
+				Den int `json:"Den"`
+			} `json:"PAR"`
+		} `json:"Geometry"`
+		ChapterList  []json.RawMessage `json:"ChapterList"`
+		AudioList    []json.RawMessage `json:"AudioList"`
+		SubtitleList []json.RawMessage `json:"SubtitleList"`
+	} `json:"TitleList"`
+}
+
+// discDirs are the folders holding the video of DVDs and Blu-rays
+var discDirs = []string{"VIDEO_TS", "BDMV"}
+
+// DiscRoot returns the folder of the DVD or Blu-ray at path, which is either
+// the disc folder or its VIDEO_TS or BDMV folder
+func DiscRoot(path string) (string, bool) {
+	for _, dir := range discDirs {
+		if strings.EqualFold(filepath.Base(path), dir) {
+			return filepath.Dir(path), true
+		}
+		if info, err := os.Stat(filepath.Join(path, dir)); err == nil && info.IsDir() {
+			return path, true
+		}
+	}
+	return "", false
+}
+
+// Scan returns the titles of the DVD or Blu-ray at input, and the index of
+// the title HandBrake considers the main feature, 0 when it found none
+func Scan(ctx context.Context, input string) ([]Title, int, error) {
+	cmd := exec.CommandContext(ctx, Binary, "--input", input, "--title", "0", "--scan", "--json")
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return nil, 0, fmt.Errorf("failed to scan titles: %w", err)
+	}
+
+	// The title set follows the progress objects, all of them labelled
+	_, set, ok := bytes.Cut(stdout.Bytes(), []byte("JSON Title Set:"))
+	if !ok {
+		return nil, 0, fmt.Errorf("failed to scan titles: no title set in HandBrake output")
+	}
+	var result scanOutput
+	if err := json.NewDecoder(bytes.NewReader(set)).Decode(&result); err != nil {
+		return nil, 0, fmt.Errorf("failed to parse titles: %w", err)
+	}
+
+	titles := make([]Title, 0, len(result.TitleList))
+	for _, t := range result.TitleList {
+		title := Title{
+			Index: t.Index,
+			// Ticks are of the 90kHz MPEG clock
+			Duration:  time.Duration(t.Duration.Ticks) * time.Second / 90000,
+			Width:     t.Geometry.Width,
+			Height:    t.Geometry.Height,
+			Chapters:  len(t.ChapterList),
+			Audio:     len(t.AudioList),
+			Subtitles: len(t.SubtitleList),
+		}
+		if t.FrameRate.Den > 0 {
+			title.FPS = float64(t.FrameRate.Num) / float64(t.FrameRate.Den)
+		}
+		if t.Geometry.PAR.Den > 0 {
+			title.SampleAR = float64(t.Geometry.PAR.Num) / float64(t.Geometry.PAR.Den)
+		}
+		titles = append(titles, title)
+	}
+	return titles, result.MainFeature, nil
+}
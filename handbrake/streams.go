@@ -0,0 +1,44 @@
+package handbrake
+
+import (
+	"strconv"
+	"strings"
+)
+
+// Tracks selects the audio or subtitle tracks of the input kept in the output
+type Tracks struct {
+	// All keeps every track, None drops them and Indices keeps the listed
+	// ones, counted from 0 among the tracks of their kind. The zero value
+	// keeps HandBrake's default of the first audio track and no subtitles.
+	All     bool
+	None    bool
+	Indices []int
+}
+
+// trackArgs returns the options selecting tracks with flag, e.g. --audio, where
+// HandBrake numbers tracks from 1, and allFlag
+func (t Tracks) trackArgs(flag, allFlag string) []string {
+	switch {
+	case t.None:
+		return []string{flag, "none"}
+	case t.All:
+		return []string{allFlag}
+	case len(t.Indices) > 0:
+		numbers := make([]string, len(t.Indices))
+		for i, index := range t.Indices {
+			numbers[i] = strconv.Itoa(index + 1)
+		}
+		return []string{flag, strings.Join(numbers, ",")}
+	}
+	return nil
+}
+
+// perTrack repeats value for each selected track, HandBrake options like
+// --aencoder take one value per track
+func (t Tracks) perTrack(value string) string {
+	values := make([]string, max(1, len(t.Indices)))
+	for i := range values {
+		values[i] = value
+	}
+	return strings.Join(values, ",")
+}
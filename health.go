@@ -0,0 +1,53 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/rs/zerolog/log"
+)
+
+// healthServer answers the health checks of container runtimes for encz serve
+type healthServer struct {
+	server *http.Server
+}
+
+// startHealthServer serves /healthz, answering while the server runs, and
+// /readyz, answering while it takes jobs, so a draining server gets no more
+// of them
+func startHealthServer(ctx context.Context, addr string) (*healthServer, error) {
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, fmt.Errorf("failed to listen for health checks: %w", err)
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /healthz", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintln(w, "ok")
+	})
+	mux.HandleFunc("GET /readyz", func(w http.ResponseWriter, r *http.Request) {
+		if stopping() {
+			http.Error(w, "stopping", http.StatusServiceUnavailable)
+			return
+		}
+		fmt.Fprintln(w, "ready")
+	})
+
+	s := &healthServer{server: &http.Server{Handler: mux, ReadHeaderTimeout: 10 * time.Second}}
+	go func() {
+		if err := s.server.Serve(listener); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			log.Ctx(ctx).Warn().Err(err).Msg("health checks stopped")
+		}
+	}()
+	log.Ctx(ctx).Info().Str("address", listener.Addr().String()).Msg("serving health checks")
+	return s, nil
+}
+
+// Close stops answering health checks
+func (s *healthServer) Close() {
+	_ = s.server.Close()
+}
@@ -0,0 +1,196 @@
+package history
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+
+	"encz/ffmpeg"
+	"encz/handbrake"
+	"encz/lock"
+)
+
+// chunkSize is the number of bytes hashed at each sampled offset
+const chunkSize = 1 << 20
+
+// Settings represents the encode settings that determine output quality
+type Settings struct {
+	Encoder      string        `json:"encoder"`
+	VideoEncoder string        `json:"video_encoder,omitempty"`
+	Quality      float64       `json:"quality"`
+	Is10Bit      bool          `json:"is_10bit"`
+	Width        int           `json:"width,omitempty"`
+	Height       int           `json:"height,omitempty"`
+	FromTime     time.Duration `json:"from_time,omitempty"`
+	Duration     time.Duration `json:"duration,omitempty"`
+	// Lossless outputs are as good as any encode, whatever their quality
+	Lossless bool `json:"lossless,omitempty"`
+}
+
+// Covers reports whether an encode made with these settings is at least as
+// good as one requested with want, making a new encode redundant
+func (s Settings) Covers(want Settings) bool {
+	if s.Encoder != want.Encoder || s.VideoEncoder != want.VideoEncoder {
+		return false
+	}
+	if s.Width != want.Width || s.Height != want.Height {
+		return false
+	}
+	if s.FromTime != want.FromTime || s.Duration != want.Duration {
+		return false
+	}
+	if want.Is10Bit && !s.Is10Bit {
+		return false
+	}
+	if s.Lossless || want.Lossless {
+		return s.Lossless
+	}
+	if s.qualityHigherIsBetter() {
+		return s.Quality >= want.Quality
+	}
+	return s.Quality <= want.Quality
+}
+
+// qualityHigherIsBetter reports whether higher quality values mean better
+// quality for the video encoder of the settings
+func (s Settings) qualityHigherIsBetter() bool {
+	if s.Encoder == "ffmpeg" {
+		return ffmpeg.QualityHigherIsBetter(s.VideoEncoder)
+	}
+	return handbrake.QualityHigherIsBetter(s.VideoEncoder)
+}
+
+// Record represents a finished encode stored in the history database
+type Record struct {
+	Hash       string    `json:"hash"`
+	SourcePath string    `json:"source_path"`
+	OutputPath string    `json:"output_path"`
+	Settings   Settings  `json:"settings"`
+	EncodedAt  time.Time `json:"encoded_at"`
+}
+
+// DB is a JSON file backed history of finished encodes
+type DB struct {
+	path    string
+	Records []Record `json:"records"`
+}
+
+// DefaultPath returns the history database location in the user config dir
+func DefaultPath() (string, error) {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return "", fmt.Errorf("failed to find config dir: %w", err)
+	}
+	return filepath.Join(dir, "encz", "history.json"), nil
+}
+
+// Open loads the history database at path. A missing file yields an empty database.
+func Open(path string) (*DB, error) {
+	db := &DB{path: path}
+
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return db, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read history: %w", err)
+	}
+
+	if err := json.Unmarshal(data, db); err != nil {
+		return nil, fmt.Errorf("failed to parse history: %w", err)
+	}
+
+	return db, nil
+}
+
+// FindCovering returns the first record for hash whose settings cover want
+func (db *DB) FindCovering(hash string, want Settings) (Record, bool) {
+	for _, r := range db.Records {
+		if r.Hash == hash && r.Settings.Covers(want) {
+			return r, true
+		}
+	}
+	return Record{}, false
+}
+
+// Add appends a record and saves the database. The file is read again under
+// a lock first, keeping the records other processes added since Open.
+func (db *DB) Add(r Record) error {
+	if err := os.MkdirAll(filepath.Dir(db.path), 0755); err != nil {
+		return fmt.Errorf("failed to create history dir: %w", err)
+	}
+
+	l, err := lock.Acquire(db.path + ".lock")
+	if err != nil {
+		return fmt.Errorf("failed to lock history: %w", err)
+	}
+	defer l.Release()
+
+	current, err := Open(db.path)
+	if err != nil {
+		return err
+	}
+	db.Records = append(current.Records, r)
+	return db.save()
+}
+
+// save atomically writes the database to disk, through a temporary file of
+// its own so concurrent writers don't mix their files
+func (db *DB) save() error {
+	data, err := json.MarshalIndent(db, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode history: %w", err)
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(db.path), filepath.Base(db.path)+".*.tmp")
+	if err != nil {
+		return fmt.Errorf("failed to write history: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	_, err = tmp.Write(data)
+	if err == nil {
+		err = tmp.Chmod(0644)
+	}
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return fmt.Errorf("failed to write history: %w", err)
+	}
+	return os.Rename(tmp.Name(), db.path)
+}
+
+// HashFile computes a fast partial hash of a file from its size and a chunk
+// at the start, middle and end, avoiding reading multi-gigabyte sources fully
+func HashFile(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	stat, err := f.Stat()
+	if err != nil {
+		return "", err
+	}
+	size := stat.Size()
+
+	h := sha256.New()
+	fmt.Fprintf(h, "%d:", size)
+
+	for _, offset := range []int64{0, size/2 - chunkSize/2, size - chunkSize} {
+		offset = max(0, offset)
+		if _, err := io.Copy(h, io.NewSectionReader(f, offset, chunkSize)); err != nil {
+			return "", fmt.Errorf("failed to hash %s: %w", path, err)
+		}
+	}
+
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
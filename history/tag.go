@@ -0,0 +1,90 @@
+package history
+
+import (
+	"strconv"
+	"strings"
+	"time"
+)
+
+// TagKey is the metadata tag outputs carry their settings in
+const TagKey = "encz"
+
+// Tag formats the settings for the metadata of an output written by the given
+// encz version, like "encz v1.2 engine=handbrake encoder=vt_h265 quality=35 10bit=true"
+func (s Settings) Tag(version string) string {
+	fields := []string{
+		"encz", version,
+		"engine=" + s.Encoder,
+	}
+	if s.VideoEncoder != "" {
+		fields = append(fields, "encoder="+s.VideoEncoder)
+	}
+	fields = append(fields,
+		"quality="+strconv.FormatFloat(s.Quality, 'f', -1, 64),
+		"10bit="+strconv.FormatBool(s.Is10Bit),
+	)
+	if s.Width > 0 {
+		fields = append(fields, "width="+strconv.Itoa(s.Width))
+	}
+	if s.Height > 0 {
+		fields = append(fields, "height="+strconv.Itoa(s.Height))
+	}
+	if s.FromTime > 0 {
+		fields = append(fields, "from="+s.FromTime.String())
+	}
+	if s.Duration > 0 {
+		fields = append(fields, "duration="+s.Duration.String())
+	}
+	if s.Lossless {
+		fields = append(fields, "lossless=true")
+	}
+	return strings.Join(fields, " ")
+}
+
+// ParseTag parses the settings tag of an output, ok is false for other values
+func ParseTag(tag string) (s Settings, ok bool) {
+	fields := strings.Fields(tag)
+	if len(fields) < 3 || fields[0] != "encz" {
+		return Settings{}, false
+	}
+
+	for _, field := range fields[2:] {
+		key, value, _ := strings.Cut(field, "=")
+		var err error
+		switch key {
+		case "engine":
+			s.Encoder = value
+		case "encoder":
+			s.VideoEncoder = value
+		case "quality":
+			s.Quality, err = strconv.ParseFloat(value, 64)
+		case "10bit":
+			s.Is10Bit, err = strconv.ParseBool(value)
+		case "width":
+			s.Width, err = strconv.Atoi(value)
+		case "height":
+			s.Height, err = strconv.Atoi(value)
+		case "from":
+			s.FromTime, err = time.ParseDuration(value)
+		case "duration":
+			s.Duration, err = time.ParseDuration(value)
+		case "lossless":
+			s.Lossless, err = strconv.ParseBool(value)
+		}
+		if err != nil {
+			return Settings{}, false
+		}
+	}
+	return s, s.Encoder != ""
+}
+
+// FindTag returns the settings tag among the tags of a probe. Tag names are
+// matched case-insensitively, Matroska tools tend to upper-case them.
+func FindTag(tags map[string]string) (Settings, bool) {
+	for key, value := range tags {
+		if strings.EqualFold(key, TagKey) {
+			return ParseTag(value)
+		}
+	}
+	return Settings{}, false
+}
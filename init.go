@@ -0,0 +1,207 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"slices"
+	"strconv"
+	"strings"
+
+	"encz/config"
+	"encz/ffmpeg"
+	"encz/handbrake"
+)
+
+// initMain implements `encz init`, a guided setup writing a starter config file
+func initMain(arguments []string) {
+	fs := flag.NewFlagSet("init", flag.ExitOnError)
+	path := fs.String("config", "", "path of the config file to write (default: user config dir)")
+	force := fs.Bool("force", false, "overwrite an existing config file")
+	_ = fs.Parse(arguments)
+
+	if err := runInit(context.Background(), *path, *force, os.Stdin, os.Stdout); err != nil {
+		fmt.Fprintln(os.Stderr, "error:", err)
+		os.Exit(1)
+	}
+}
+
+func runInit(ctx context.Context, path string, force bool, in io.Reader, out io.Writer) error {
+	if path == "" {
+		var err error
+		if path, err = config.DefaultPath(); err != nil {
+			return err
+		}
+	}
+	if _, err := os.Stat(path); err == nil && !force {
+		return fmt.Errorf("config already exists at %s (use -force to overwrite)", path)
+	}
+
+	p := &prompter{in: bufio.NewReader(in), out: out}
+
+	fmt.Fprintln(out, "Checking installed tools...")
+	tools := map[string]bool{}
+	for _, tool := range []string{"ffmpeg", "ffprobe", "HandBrakeCLI"} {
+		_, err := exec.LookPath(tool)
+		tools[tool] = err == nil
+		fmt.Fprintf(out, "  %-13s %s\n", tool, foundLabel(tools[tool]))
+	}
+	if !tools["ffprobe"] {
+		fmt.Fprintln(out, "ffprobe is required to read video files, install FFmpeg before encoding.")
+	}
+
+	var ffmpegEncoders []string
+	if tools["ffmpeg"] {
+		fmt.Fprintln(out, "\nChecking HEVC encoders...")
+		encoders, err := ffmpeg.VideoEncoders(ctx)
+		if err != nil {
+			return err
+		}
+		for _, encoder := range hevcEncoders(encoders) {
+			if !ffmpeg.EncoderWorks(ctx, encoder) {
+				fmt.Fprintf(out, "  %-18s unavailable\n", encoder)
+				continue
+			}
+			fmt.Fprintf(out, "  %-18s works\n", encoder)
+			ffmpegEncoders = append(ffmpegEncoders, encoder)
+		}
+	}
+
+	var engines []string
+	if tools["HandBrakeCLI"] {
+		engines = append(engines, "handbrake")
+	}
+	if tools["ffmpeg"] {
+		engines = append(engines, "ffmpeg")
+	}
+	if len(engines) == 0 {
+		return errors.New("neither HandBrakeCLI nor ffmpeg was found, install one of them and run encz init again")
+	}
+
+	fmt.Fprintln(out)
+	engine := p.choose("Encoder engine", engines, engines[0])
+
+	var videoEncoder string
+	var higherIsBetter bool
+	if engine == "ffmpeg" {
+		if len(ffmpegEncoders) == 0 {
+			return errors.New("ffmpeg has no working HEVC encoder")
+		}
+		// Prefer hardware encoders, which are much faster
+		suggested := ffmpegEncoders[0]
+		if i := slices.IndexFunc(ffmpegEncoders, func(e string) bool { return !ffmpeg.IsSoftwareEncoder(e) }); i >= 0 {
+			suggested = ffmpegEncoders[i]
+		}
+		videoEncoder = p.choose("Video encoder", ffmpegEncoders, suggested)
+		higherIsBetter = ffmpeg.QualityHigherIsBetter(videoEncoder)
+	} else {
+		videoEncoder = p.ask("Video encoder (e.g. vt_h265, nvenc_h265, qsv_h265, x265)", handbrake.DefaultVideoEncoder)
+		higherIsBetter = handbrake.QualityHigherIsBetter(videoEncoder)
+	}
+
+	// Constant quality scales run in opposite directions depending on the encoder
+	qualityHint, suggestedQuality := "lower is better", 24.0
+	if higherIsBetter {
+		qualityHint, suggestedQuality = "higher is better", 35.0
+	}
+	quality := p.number(fmt.Sprintf("Default quality (%s)", qualityHint), suggestedQuality)
+
+	settings := []config.Setting{
+		{Key: "encoder", Value: engine},
+		{Key: "video_encoder", Value: videoEncoder},
+		{Key: "quality", Value: quality, Comment: qualityHint},
+	}
+
+	if !p.confirm("Save encoded files next to the originals?", true) {
+		dir := p.ask("Output directory", "")
+		if dir != "" {
+			settings = append(settings, config.Setting{Key: "output_dir", Value: dir})
+		}
+	}
+
+	replace := p.confirm("Delete originals after a successful encode?", false)
+	settings = append(settings, config.Setting{Key: "replace", Value: replace, Comment: "delete the original after a successful encode"})
+
+	if err := config.Write(path, settings); err != nil {
+		return err
+	}
+	fmt.Fprintf(out, "\nWrote %s\nFlags given on the command line override these defaults.\n", path)
+	return nil
+}
+
+func foundLabel(found bool) string {
+	if found {
+		return "found"
+	}
+	return "not found"
+}
+
+// prompter asks questions on a terminal, falling back to the suggested
+// answers when the input ends
+type prompter struct {
+	in  *bufio.Reader
+	out io.Writer
+}
+
+// ask returns the answer to question, or def for an empty answer
+func (p *prompter) ask(question, def string) string {
+	if def != "" {
+		fmt.Fprintf(p.out, "%s [%s]: ", question, def)
+	} else {
+		fmt.Fprintf(p.out, "%s: ", question)
+	}
+
+	line, err := p.in.ReadString('\n')
+	if err != nil && line == "" {
+		fmt.Fprintln(p.out)
+	}
+	if answer := strings.TrimSpace(line); answer != "" {
+		return answer
+	}
+	return def
+}
+
+// choose asks until the answer is one of options
+func (p *prompter) choose(question string, options []string, def string) string {
+	for {
+		answer := p.ask(fmt.Sprintf("%s (%s)", question, strings.Join(options, ", ")), def)
+		if slices.Contains(options, answer) {
+			return answer
+		}
+		fmt.Fprintf(p.out, "Please choose one of: %s\n", strings.Join(options, ", "))
+	}
+}
+
+// confirm asks a yes/no question
+func (p *prompter) confirm(question string, def bool) bool {
+	hint := "y/N"
+	if def {
+		hint = "Y/n"
+	}
+	for {
+		switch strings.ToLower(p.ask(fmt.Sprintf("%s (%s)", question, hint), "")) {
+		case "":
+			return def
+		case "y", "yes":
+			return true
+		case "n", "no":
+			return false
+		}
+	}
+}
+
+// number asks until the answer is a number
+func (p *prompter) number(question string, def float64) float64 {
+	for {
+		answer := p.ask(question, strconv.FormatFloat(def, 'f', -1, 64))
+		if value, err := strconv.ParseFloat(answer, 64); err == nil {
+			return value
+		}
+		fmt.Fprintln(p.out, "Please enter a number")
+	}
+}
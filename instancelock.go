@@ -0,0 +1,77 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"time"
+
+	"github.com/rs/zerolog/log"
+
+	"encz/lock"
+)
+
+// lockPollInterval is how often a waiting instance retries taking the lock
+const lockPollInterval = 5 * time.Second
+
+// defaultLockFile is shared by all users, so their runs don't overlap either.
+// $TMPDIR is per user on macOS, like the temp folder on Windows, which keeps
+// a lock per user.
+func defaultLockFile() string {
+	if runtime.GOOS == "windows" {
+		return filepath.Join(os.TempDir(), "encz.lock")
+	}
+	return "/tmp/encz.lock"
+}
+
+// acquireLock takes the lock shared by all encz processes according to --lock,
+// and exits when it is held by another process and --lock is fail.
+// The returned func releases the lock, the OS releases it if the process exits first.
+func acquireLock(ctx context.Context, args cliArgs) func() {
+	if args.Lock == "off" {
+		return func() {}
+	}
+
+	l, err := waitForLock(ctx, args.LockFile, args.Lock == "wait")
+	if err != nil {
+		log.Ctx(ctx).Fatal().Err(err).Send()
+	}
+
+	return func() {
+		if err := l.Release(); err != nil {
+			log.Ctx(ctx).Warn().Err(err).Msg("failed to release lock")
+		}
+	}
+}
+
+// waitForLock takes the lock at path, waiting for the other process to finish when wait is set
+func waitForLock(ctx context.Context, path string, wait bool) (*lock.Lock, error) {
+	logged := false
+	for {
+		l, err := lock.TryAcquire(path)
+		if !errors.Is(err, lock.ErrLocked) {
+			return l, err
+		}
+
+		owner := "another encz"
+		if pid := lock.Owner(path); pid > 0 {
+			owner = fmt.Sprintf("another encz (pid %d)", pid)
+		}
+		if !wait {
+			return nil, fmt.Errorf("%s is already encoding, use --lock wait to queue behind it", owner)
+		}
+		if !logged {
+			log.Ctx(ctx).Info().Str("lock_file", path).Msgf("%s is encoding, waiting for it to finish", owner)
+			logged = true
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(lockPollInterval):
+		}
+	}
+}
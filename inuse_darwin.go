@@ -0,0 +1,30 @@
+package main
+
+import (
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+)
+
+// openForWriting reports whether another process has path open for writing,
+// as listed by lsof. Readers, like media servers streaming the file, don't count.
+func openForWriting(path string) bool {
+	// lsof exits with 1 when no process has the file open
+	output, _ := exec.Command("lsof", "-F", "pa", "--", path).Output()
+
+	self := "p" + strconv.Itoa(os.Getpid())
+	var pid string
+	for line := range strings.Lines(string(output)) {
+		line = strings.TrimSpace(line)
+		switch {
+		case strings.HasPrefix(line, "p"):
+			pid = line
+		case line == "aw" || line == "au":
+			if pid != self {
+				return true
+			}
+		}
+	}
+	return false
+}
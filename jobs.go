@@ -0,0 +1,187 @@
+package main
+
+import (
+	"context"
+	"math"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/rs/zerolog/log"
+
+	"encz/notify"
+)
+
+// runJob encodes a single file and notifies the configured integrations of the outcome
+func runJob(ctx context.Context, args cliArgs) (encodeResult, error) {
+	start := time.Now()
+
+	var logPath string
+	if args.LogDir != "" {
+		jobCtx, logFile, err := createJobLog(ctx, args.LogDir, inputName(args.VideoPath))
+		if err != nil {
+			return encodeResult{}, err
+		}
+		defer logFile.Close()
+		ctx = jobCtx
+		logPath = logFile.Name()
+		log.Ctx(ctx).Debug().Str("version", version).Msg("job started")
+	}
+
+	stopWatching, err := waitToStart(ctx, args)
+	if err != nil {
+		return encodeResult{}, err
+	}
+	defer stopWatching()
+	// Deferred jobs don't count the waiting time
+	start = time.Now()
+
+	// Integrations must still run when the job was cancelled
+	hookCtx := context.WithoutCancel(ctx)
+
+	startEvent := newJobEvent(args, encodeResult{}, nil)
+	startEvent.Type = notify.EventStart
+	startEvent.LogPath = logPath
+	sendWebhooks(hookCtx, args.Webhooks, startEvent)
+
+	var result encodeResult
+	if args.PreHook != "" {
+		err = notify.Hook(ctx, args.PreHook, startEvent)
+	}
+	if err == nil {
+		result, err = runWithRetries(ctx, args)
+	}
+
+	event := newJobEvent(args, result, err)
+	event.ElapsedSeconds = time.Since(start).Seconds()
+	event.LogPath = logPath
+	result.Event = event
+
+	// Only reaches the console with --debug, the caller reports failures
+	log.Ctx(ctx).Debug().
+		Str("status", event.Status()).
+		Str("error", event.Error).
+		Float64("elapsed_seconds", event.ElapsedSeconds).
+		Msg("job finished")
+
+	if args.OnCompleteExec != "" {
+		if err := notify.Exec(hookCtx, args.OnCompleteExec, event); err != nil {
+			log.Ctx(ctx).Warn().Err(err).Msg("on-complete command failed")
+		}
+	}
+	if args.PostHook != "" {
+		if err := notify.Hook(hookCtx, args.PostHook, event); err != nil {
+			log.Ctx(ctx).Warn().Err(err).Msg("post-hook failed")
+		}
+	}
+	sendWebhooks(hookCtx, args.Webhooks, event)
+
+	return result, err
+}
+
+// waitToStart blocks until the schedule window and power source allow the job to start,
+// then pauses the job whenever they stop allowing it until the returned func is called
+func waitToStart(ctx context.Context, args cliArgs) (func(), error) {
+	var sched *schedule
+	if args.Schedule != "" {
+		var err error
+		if sched, err = parseSchedule(args.Schedule); err != nil {
+			return nil, err
+		}
+	}
+
+	// Check both again after waiting, the power may have gone while waiting for the window
+	for {
+		if sched != nil {
+			if err := sched.wait(ctx); err != nil {
+				return nil, err
+			}
+		}
+		if args.RequireAC {
+			if err := waitForAC(ctx); err != nil {
+				return nil, err
+			}
+		}
+		if (sched == nil || !sched.closed()) && (!args.RequireAC || !onBattery(ctx)) {
+			break
+		}
+	}
+
+	watchCtx, stop := context.WithCancel(ctx)
+	if sched != nil && args.ScheduleAction == "pause" {
+		go pauseWhile(watchCtx, "outside the schedule window", sched.closed)
+	}
+	if args.RequireAC {
+		go pauseWhile(watchCtx, "running on battery", func() bool { return onBattery(watchCtx) })
+	}
+	return stop, nil
+}
+
+// sendWebhooks notifies the webhooks interested in event
+func sendWebhooks(ctx context.Context, hooks []notify.Webhook, event notify.Event) {
+	for _, hook := range hooks {
+		if !hook.Wants(event.Type) {
+			continue
+		}
+		if err := hook.Send(ctx, event); err != nil {
+			log.Ctx(ctx).Warn().Err(err).Str("event", string(event.Type)).Msg("webhook failed")
+		}
+	}
+}
+
+// parseWebhook parses a --webhook value of the form [format=]url
+func parseWebhook(s string) notify.Webhook {
+	if format, url, ok := strings.Cut(s, "="); ok {
+		switch format {
+		case notify.FormatJSON, notify.FormatDiscord, notify.FormatSlack:
+			return notify.Webhook{URL: url, Format: format}
+		}
+	}
+	return notify.Webhook{URL: s}
+}
+
+// newJobEvent builds the event describing the outcome of a job
+func newJobEvent(args cliArgs, result encodeResult, err error) notify.Event {
+	inputPath := args.VideoPath
+	if !isURL(inputPath) {
+		inputPath, _ = filepath.Abs(inputPath)
+	}
+
+	event := notify.Event{
+		Type:         notify.EventComplete,
+		Time:         time.Now(),
+		InputPath:    inputPath,
+		OutputPath:   result.OutputPath,
+		Encoder:      args.Encoder,
+		VideoEncoder: args.VideoEncoder,
+		Quality:      args.Quality,
+		Is10Bit:      args.Is10Bit,
+		Skipped:      result.Skipped,
+	}
+
+	if err != nil {
+		event.Type = notify.EventFailure
+		event.Error = err.Error()
+	}
+
+	event.InputSize = result.InputSize
+	if info, err := os.Stat(inputPath); err == nil && event.InputSize == 0 {
+		event.InputSize = info.Size()
+	}
+
+	if err == nil && !result.Skipped {
+		event.OutputSize = result.OutputSize
+		if info, err := os.Stat(result.OutputPath); err == nil && event.OutputSize == 0 {
+			event.OutputSize = info.Size()
+		}
+		if event.OutputSize > 0 {
+			event.SavedBytes = event.InputSize - event.OutputSize
+			if event.InputSize > 0 {
+				event.SavedPercent = math.Round(float64(event.SavedBytes)/float64(event.InputSize)*1000) / 10
+			}
+		}
+	}
+
+	return event
+}
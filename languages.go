@@ -0,0 +1,74 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/rs/zerolog/log"
+
+	"encz/ffmpeg"
+)
+
+// parseLanguages adds the comma-separated languages of value to langs. "none"
+// clears them, turning off a preference of the config file.
+func parseLanguages(value string, langs *[]string) error {
+	if value == "none" {
+		*langs = []string{}
+		return nil
+	}
+	for _, lang := range strings.Split(value, ",") {
+		lang = strings.ToLower(strings.TrimSpace(lang))
+		if lang == "" {
+			return fmt.Errorf("invalid language list %q", value)
+		}
+		*langs = append(*langs, lang)
+	}
+	return nil
+}
+
+// preferredTracks returns the tracks tagged with one of langs, grouped by
+// language in the order of preference, then in the order of the source
+func preferredTracks(trackLangs, langs []string) []int {
+	var tracks []int
+	for _, lang := range langs {
+		for i, trackLang := range trackLangs {
+			if trackLang == lang && !slices.Contains(tracks, i) {
+				tracks = append(tracks, i)
+			}
+		}
+	}
+	return tracks
+}
+
+// applyLanguages selects the audio and subtitle tracks in the preferred
+// languages of the source, for the kinds --map doesn't select. The first
+// preferred audio track is made the default unless --default-audio says
+// otherwise. Sources without a track in the languages keep the default
+// selection.
+func (c *cliArgs) applyLanguages(ctx context.Context, probe ffmpeg.ProbeResult) error {
+	if len(c.AudioLangs) > 0 && c.Streams.Audio.isDefault() {
+		if tracks := preferredTracks(probe.AudioLanguages, c.AudioLangs); len(tracks) > 0 {
+			c.Streams.Audio = trackSelection{Indices: tracks}
+			if c.TrackFlags.DefaultAudio < 0 {
+				c.TrackFlags.DefaultAudio = tracks[0]
+			}
+			log.Ctx(ctx).Debug().Ints("tracks", tracks).Msg("selected audio tracks in the preferred languages")
+		} else if len(probe.AudioLanguages) > 0 {
+			log.Ctx(ctx).Info().Strs("languages", probe.AudioLanguages).Msg("no audio track in the preferred languages, keeping the default")
+		}
+	}
+
+	if len(c.SubtitleLangs) > 0 && c.Streams.Subtitles.isDefault() {
+		if tracks := preferredTracks(probe.SubtitleLanguages, c.SubtitleLangs); len(tracks) > 0 {
+			c.Streams.Subtitles = trackSelection{Indices: tracks}
+			log.Ctx(ctx).Debug().Ints("tracks", tracks).Msg("selected subtitle tracks in the preferred languages")
+		} else if len(probe.SubtitleLanguages) > 0 {
+			log.Ctx(ctx).Info().Strs("languages", probe.SubtitleLanguages).Msg("no subtitle track in the preferred languages, keeping the default")
+		}
+	}
+
+	// Flagged tracks must still be kept with the new selection
+	return c.validateTrackFlags(&probe)
+}
@@ -0,0 +1,469 @@
+package main
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/rs/zerolog"
+	"github.com/rs/zerolog/log"
+
+	"encz/ffmpeg"
+	"encz/history"
+	"encz/library"
+	"encz/proc"
+	"encz/tui"
+)
+
+// libraryArgs represents the arguments of the library command
+type libraryArgs struct {
+	cliArgs
+	StatePath   string
+	RetryFailed bool
+	TUI         bool
+	Filter      library.Filter
+	// ReportPath is the CSV or JSON file the batch report is written to
+	ReportPath string
+	// ControlSocket is the Unix socket other programs control the run through
+	ControlSocket string
+	// FailFast stops the run at the first file that fails
+	FailFast bool
+}
+
+// libraryMain implements `encz library [flags] <root>`
+func libraryMain(arguments []string) {
+	fs := flag.NewFlagSet("library", flag.ExitOnError)
+	statePath := fs.String("state", "", "path to the library state file (default: <root>/.encz-state.json)")
+	retryFailed := fs.Bool("retry-failed", false, "retry files that failed in previous runs")
+	interactive := fs.Bool("tui", false, "show a full-screen interactive view with the queue, progress and logs")
+	reportPath := fs.String("report", "", "also write the table of the files of the run to this .csv or .json file")
+	var failFast bool
+	failFastFlags(fs, &failFast)
+	controlSocket := fs.String("control-socket", "", "listen on this Unix socket for commands from encz control: status, skip, cancel, add and pause")
+	var filter library.Filter
+	listVar(fs, "include", "only process files matching this glob, e.g. '*.mkv' (repeatable)", func() { filter.Include = nil }, func(s string) error {
+		filter.Include = append(filter.Include, s)
+		return nil
+	})
+	listVar(fs, "exclude", "skip files and directories matching this glob, e.g. '*sample*' (repeatable)", func() { filter.Exclude = nil }, func(s string) error {
+		filter.Exclude = append(filter.Exclude, s)
+		return nil
+	})
+
+	args := libraryArgs{cliArgs: parseArgs(fs, arguments)}
+	args.StatePath = *statePath
+	args.RetryFailed = *retryFailed
+	args.TUI = *interactive
+	args.Filter = filter
+	args.ReportPath = *reportPath
+	args.ControlSocket = *controlSocket
+	args.FailFast = failFast
+
+	if err := setupLogging(args.cliArgs); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+
+	ctx, cancel := interruptContext()
+	defer cancel()
+	watchPauseSignals(ctx)
+	watchStatusSignal(ctx)
+
+	if err := cmp.Or(args.Validate(), args.validateBatch(), args.Filter.Validate(), validateReportPath(args.ReportPath)); err != nil {
+		exitInvalid(ctx, err)
+	}
+
+	if args.TUI && args.Estimate && !args.Yes {
+		exitInvalid(ctx, errors.New("--estimate asks for confirmation, add --yes to combine it with --tui"))
+	}
+
+	checkPreflight(ctx, args.cliArgs)
+	defer acquireLock(ctx, args.cliArgs)()
+
+	if args.unattended() {
+		if args.TUI {
+			exitInvalid(ctx, errors.New("--tui cannot be combined with --cron or --quiet"))
+		}
+		ctx = withProgressView(ctx, discardView{})
+	}
+
+	summary, err := runLibrary(ctx, args)
+	reportBatch(ctx, summary.Files, args.ReportPath)
+	if args.unattended() || useColor(os.Stdout) {
+		printLibrarySummary(os.Stdout, summary, useColor(os.Stdout))
+	}
+	exitOnError(ctx, err)
+}
+
+// librarySummary counts the outcomes of a library run
+type librarySummary struct {
+	Root       string
+	Unchanged  int
+	Encoded    int
+	Skipped    int
+	Failed     int
+	SavedBytes int64
+	// TotalSavedBytes is the space saved by all runs on the library
+	TotalSavedBytes int64
+	Elapsed         time.Duration
+	// Files are the report rows of the files encoded, or tried to, in this run
+	Files []fileStats
+}
+
+func (s librarySummary) String(queued int, eta time.Duration) string {
+	text := fmt.Sprintf("%d encoded, %d skipped, %d failed, %d unchanged, %d queued, %s saved",
+		s.Encoded, s.Skipped, s.Failed, s.Unchanged, queued, formatBytes(s.SavedBytes))
+	if eta > 0 {
+		text += ", ETA " + eta.String()
+	}
+	return text
+}
+
+// batchETA estimates the remaining time of a library run from the source bytes processed so far
+type batchETA struct {
+	start     time.Time
+	done      int64
+	remaining int64
+}
+
+// processed moves a file of the given size from remaining to done
+func (b *batchETA) processed(size int64) {
+	b.done += size
+	b.remaining = max(0, b.remaining-size)
+}
+
+// eta returns the estimated remaining time, or 0 before the first file is processed
+func (b *batchETA) eta() time.Duration {
+	if b.done == 0 || b.remaining == 0 {
+		return 0
+	}
+	elapsed := time.Since(b.start)
+	return time.Duration(float64(elapsed) * float64(b.remaining) / float64(b.done)).Truncate(time.Second)
+}
+
+// runLibrary processes the new and changed files of a library
+func runLibrary(ctx context.Context, args libraryArgs) (summary librarySummary, err error) {
+	start := time.Now()
+
+	root, err := filepath.Abs(args.VideoPath)
+	if err != nil {
+		return librarySummary{}, fmt.Errorf("failed to get absolute path: %w", err)
+	}
+
+	state, err := library.Load(cmp.Or(args.StatePath, library.DefaultStatePath(root)))
+	if err != nil {
+		return librarySummary{}, err
+	}
+
+	files, err := library.Walk(root, args.Filter)
+	if err != nil {
+		return librarySummary{}, err
+	}
+
+	log.Ctx(ctx).Info().
+		Str("root", root).
+		Int("files", len(files)).
+		Msg("scanned library")
+
+	summary.Root = root
+	// The summary is printed even when the run stops early
+	defer func() {
+		summary.TotalSavedBytes = state.TotalSavedBytes()
+		summary.Elapsed = time.Since(start)
+	}()
+
+	queue := &jobQueue{}
+	sizes := map[string]int64{}
+	batch := &batchETA{}
+	for _, rel := range files {
+		info, err := os.Stat(filepath.Join(root, rel))
+		if err != nil {
+			return summary, err
+		}
+
+		if entry, ok := state.Lookup(rel, info); ok {
+			if entry.Decision != library.DecisionFailed || !args.RetryFailed {
+				summary.Unchanged++
+				continue
+			}
+		}
+		queue.Push(rel)
+		sizes[rel] = info.Size()
+		batch.remaining += info.Size()
+	}
+	batch.start = time.Now()
+
+	control := &batchControl{}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	var server *controlServer
+	if args.ControlSocket != "" {
+		server, err = startControlServer(ctx, args.ControlSocket, root, queue, control, cancel)
+		if err != nil {
+			return summary, err
+		}
+		defer server.Close()
+	}
+
+	var app *tui.App
+	if args.TUI {
+		app = tui.New("encz library "+root, queue)
+		if err := app.Start(); err != nil {
+			return summary, err
+		}
+		defer app.Stop()
+
+		logWriter := zerolog.ConsoleWriter{Out: app, NoColor: true, TimeFormat: time.DateTime}
+		logger := log.Output(logWriter)
+		ctx = logger.WithContext(ctx)
+		ctx = withLogWriter(ctx, logWriter)
+		ctx = withProgressView(ctx, app)
+
+		go func() {
+			for action := range app.Actions() {
+				switch action {
+				case tui.ActionSkip:
+					control.skip()
+				case tui.ActionPause:
+					togglePause(ctx)
+					app.SetPaused(proc.Paused())
+				case tui.ActionQuit:
+					cancel()
+				}
+			}
+		}()
+	}
+
+	for {
+		if app != nil {
+			app.SetSummary(summary.String(queue.Len(), batch.eta()))
+		}
+		if server != nil {
+			server.setSummary(summary)
+		}
+
+		if stopping() {
+			log.Ctx(ctx).Warn().Int("queued", queue.Len()).Msg("stopping before the next file, as asked")
+			break
+		}
+		rel, ok := queue.Pop()
+		if !ok {
+			break
+		}
+		path := filepath.Join(root, rel)
+
+		info, err := os.Stat(path)
+		if err != nil {
+			log.Ctx(ctx).Warn().Err(err).Str("file", path).Msg("file disappeared, skipping")
+			batch.remaining -= sizes[rel]
+			continue
+		}
+
+		// Not recorded either, it's encoded once it's complete
+		if reason, err := unsettledReason(path, args.QuietPeriod); err == nil && reason != "" {
+			log.Ctx(ctx).Info().Str("file", path).Str("reason", reason).Msg("file is still being written, skipping until the next run")
+			batch.remaining -= sizes[rel]
+			continue
+		}
+
+		if app != nil {
+			app.SetCurrent(rel)
+		}
+		if server != nil {
+			server.setCurrent(rel)
+		}
+
+		fileCtx := control.begin(ctx)
+		entry, stats, err := processLibraryFile(fileCtx, args, path, info)
+		skipped := errors.Is(context.Cause(fileCtx), errSkipped)
+		control.end()
+		batch.processed(sizes[rel])
+
+		if app != nil {
+			app.SetCurrent("")
+		}
+		if server != nil {
+			server.setCurrent("")
+		}
+
+		if skipped {
+			// Not recorded, so the file is picked up again on the next run
+			log.Ctx(ctx).Info().Str("file", path).Msg("skipped by user")
+			continue
+		}
+		// Stopped files aren't recorded either, rather than as failed
+		if ctx.Err() != nil {
+			return summary, ctx.Err()
+		}
+		if err != nil {
+			return summary, err
+		}
+		state.Set(rel, entry)
+		if stats != nil {
+			stats.Path = rel
+			summary.Files = append(summary.Files, *stats)
+		}
+
+		switch entry.Decision {
+		case library.DecisionEncoded:
+			summary.Encoded++
+			summary.SavedBytes += entry.SavedBytes
+			if outputRel, ok := relativeTo(root, entry.OutputPath); ok {
+				if outputInfo, err := os.Stat(entry.OutputPath); err == nil {
+					state.Set(outputRel, &library.Entry{
+						Size:     outputInfo.Size(),
+						ModTime:  outputInfo.ModTime(),
+						Decision: library.DecisionOutput,
+					})
+				}
+			}
+		case library.DecisionSkipped:
+			summary.Skipped++
+		case library.DecisionFailed:
+			summary.Failed++
+		}
+
+		// Save after every file so an interrupted run keeps its progress
+		if err := state.Save(); err != nil {
+			return summary, err
+		}
+
+		if entry.Decision == library.DecisionFailed && args.FailFast {
+			log.Ctx(ctx).Warn().Int("queued", queue.Len()).Msg("stopping at the failed file, as asked with --fail-fast")
+			break
+		}
+
+		if eta := batch.eta(); eta > 0 {
+			log.Ctx(ctx).Info().
+				Int("queued", queue.Len()).
+				Str("eta", eta.String()).
+				Msg("library progress")
+		}
+	}
+
+	if err := state.Save(); err != nil {
+		return summary, err
+	}
+
+	log.Ctx(ctx).Info().
+		Int("encoded", summary.Encoded).
+		Int("skipped", summary.Skipped).
+		Int("failed", summary.Failed).
+		Int("unchanged", summary.Unchanged).
+		Str("saved", formatBytes(summary.SavedBytes)).
+		Str("saved_total", formatBytes(state.TotalSavedBytes())).
+		Msg("library run finished")
+
+	// Nothing to do is not a failure, failed files are
+	if summary.Failed > 0 {
+		return summary, batchError{failed: summary.Failed, total: summary.Encoded + summary.Skipped + summary.Failed}
+	}
+	return summary, nil
+}
+
+// processLibraryFile probes a single library file and encodes it if needed.
+// Failures of the file itself are recorded in the entry rather than returned.
+// The stats of the job are nil when the file wasn't handed to one.
+func processLibraryFile(ctx context.Context, args libraryArgs, path string, info os.FileInfo) (*library.Entry, *fileStats, error) {
+	entry := &library.Entry{
+		Size:    info.Size(),
+		ModTime: info.ModTime(),
+	}
+
+	probe, err := ffmpeg.Probe(ctx, path)
+	if err != nil {
+		log.Ctx(ctx).Warn().Err(err).Str("file", path).Msg("failed to probe library file")
+		entry.Decision = library.DecisionFailed
+		entry.Reason = err.Error()
+		return entry, nil, nil
+	}
+	entry.Codec = probe.Codec
+	entry.Width = probe.Width
+	entry.Height = probe.Height
+	entry.Duration = probe.Duration
+	entry.Bitrate = probe.Bitrate
+
+	if reason := librarySkipReason(probe); reason != "" {
+		entry.Decision = library.DecisionSkipped
+		entry.Reason = reason
+		return entry, nil, nil
+	}
+
+	log.Ctx(ctx).Info().Str("file", path).Msg("encoding library file")
+
+	fileArgs := args.cliArgs
+	fileArgs.VideoPath = path
+
+	result, err := runJob(ctx, fileArgs)
+	stats := newFileStats(path, result)
+	if err != nil {
+		if errors.Is(err, context.Canceled) || ctx.Err() != nil {
+			return nil, nil, err
+		}
+		log.Ctx(ctx).Error().Err(err).Str("file", path).Msg("failed to encode library file")
+		entry.Decision = library.DecisionFailed
+		entry.Reason = err.Error()
+		return entry, &stats, nil
+	}
+
+	entry.OutputPath = result.OutputPath
+	if result.Skipped {
+		entry.Decision = library.DecisionSkipped
+		entry.Reason = "already encoded"
+		return entry, &stats, nil
+	}
+
+	entry.Decision = library.DecisionEncoded
+	if result.OutputSize > 0 {
+		entry.SavedBytes = info.Size() - result.OutputSize
+	}
+
+	return entry, &stats, nil
+}
+
+// librarySkipReason returns why a probed file doesn't need encoding, or an empty string
+func librarySkipReason(probe ffmpeg.ProbeResult) string {
+	if _, ok := history.FindTag(probe.Tags); ok {
+		return "encz output"
+	}
+	switch probe.Codec {
+	case "hevc", "av1":
+		return "already " + probe.Codec
+	}
+	return ""
+}
+
+// relativeTo returns path relative to root if path is inside root
+func relativeTo(root, path string) (string, bool) {
+	rel, err := filepath.Rel(root, path)
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return "", false
+	}
+	return rel, true
+}
+
+// formatBytes formats a byte count using binary units
+func formatBytes(n int64) string {
+	const unit = 1024
+	if n < unit && n > -unit {
+		return fmt.Sprintf("%dB", n)
+	}
+
+	value := float64(n)
+	suffixes := []string{"KB", "MB", "GB", "TB"}
+	i := -1
+	for (value >= unit || value <= -unit) && i < len(suffixes)-1 {
+		value /= unit
+		i++
+	}
+
+	return fmt.Sprintf("%.1f%s", value, suffixes[i])
+}
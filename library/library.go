@@ -0,0 +1,218 @@
+package library
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+)
+
+// Decision records what happened to a file in the library
+type Decision string
+
+const (
+	DecisionEncoded Decision = "encoded"
+	DecisionSkipped Decision = "skipped"
+	DecisionFailed  Decision = "failed"
+	// DecisionOutput marks files produced by encz itself
+	DecisionOutput Decision = "output"
+)
+
+// videoExtensions lists the file extensions considered video files
+var videoExtensions = []string{
+	".mp4", ".m4v", ".mkv", ".mov", ".avi", ".wmv",
+	".ts", ".m2ts", ".webm", ".mpg", ".mpeg", ".flv",
+}
+
+// Entry represents the cached state of a single library file
+type Entry struct {
+	Size       int64         `json:"size"`
+	ModTime    time.Time     `json:"mod_time"`
+	Codec      string        `json:"codec,omitempty"`
+	Width      int           `json:"width,omitempty"`
+	Height     int           `json:"height,omitempty"`
+	Duration   time.Duration `json:"duration,omitempty"`
+	Bitrate    int64         `json:"bitrate,omitempty"`
+	Decision   Decision      `json:"decision"`
+	Reason     string        `json:"reason,omitempty"`
+	OutputPath string        `json:"output_path,omitempty"`
+	SavedBytes int64         `json:"saved_bytes,omitempty"`
+	UpdatedAt  time.Time     `json:"updated_at"`
+}
+
+// State is the JSON file backed state of a whole library
+type State struct {
+	path string
+	// Files maps paths relative to the library root to their state
+	Files map[string]*Entry `json:"files"`
+}
+
+// DefaultStatePath returns the state file location for a library root
+func DefaultStatePath(root string) string {
+	return filepath.Join(root, ".encz-state.json")
+}
+
+// Load reads the state file at path. A missing file yields an empty state.
+func Load(path string) (*State, error) {
+	state := &State{path: path, Files: map[string]*Entry{}}
+
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return state, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read library state: %w", err)
+	}
+
+	if err := json.Unmarshal(data, state); err != nil {
+		return nil, fmt.Errorf("failed to parse library state: %w", err)
+	}
+	if state.Files == nil {
+		state.Files = map[string]*Entry{}
+	}
+
+	return state, nil
+}
+
+// Save atomically writes the state to disk
+func (s *State) Save() error {
+	data, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode library state: %w", err)
+	}
+
+	tmp := s.path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return fmt.Errorf("failed to write library state: %w", err)
+	}
+
+	return os.Rename(tmp, s.path)
+}
+
+// Lookup returns the entry for rel if the file hasn't changed since it was recorded
+func (s *State) Lookup(rel string, info fs.FileInfo) (*Entry, bool) {
+	entry, ok := s.Files[rel]
+	if !ok {
+		return nil, false
+	}
+	if entry.Size != info.Size() || !entry.ModTime.Equal(info.ModTime()) {
+		return nil, false
+	}
+	return entry, true
+}
+
+// Set records the entry for rel
+func (s *State) Set(rel string, entry *Entry) {
+	entry.UpdatedAt = time.Now()
+	s.Files[rel] = entry
+}
+
+// TotalSavedBytes returns the disk space saved by all encodes in the library
+func (s *State) TotalSavedBytes() int64 {
+	var total int64
+	for _, entry := range s.Files {
+		total += entry.SavedBytes
+	}
+	return total
+}
+
+// IsVideo reports whether path has a known video file extension
+func IsVideo(path string) bool {
+	return slices.Contains(videoExtensions, strings.ToLower(filepath.Ext(path)))
+}
+
+// Filter selects files by glob patterns. Patterns without a slash match the
+// file or directory name, others match the path relative to the root.
+// Matching ignores case.
+type Filter struct {
+	// Include keeps only files matching one of the patterns, all files when empty
+	Include []string
+	// Exclude skips files and directories matching one of the patterns
+	Exclude []string
+}
+
+// Validate checks the syntax of the patterns
+func (f Filter) Validate() error {
+	for _, pattern := range slices.Concat(f.Include, f.Exclude) {
+		if _, err := filepath.Match(pattern, ""); err != nil {
+			return fmt.Errorf("invalid pattern %q: %w", pattern, err)
+		}
+	}
+	return nil
+}
+
+// excluded reports whether the file or directory at rel is excluded
+func (f Filter) excluded(rel string) bool {
+	return matchAny(f.Exclude, rel)
+}
+
+// included reports whether the file at rel passes the include patterns
+func (f Filter) included(rel string) bool {
+	return len(f.Include) == 0 || matchAny(f.Include, rel)
+}
+
+func matchAny(patterns []string, rel string) bool {
+	rel = strings.ToLower(filepath.ToSlash(rel))
+	name := path.Base(rel)
+	for _, pattern := range patterns {
+		pattern = strings.ToLower(filepath.ToSlash(pattern))
+		target := name
+		if strings.Contains(pattern, "/") {
+			target = rel
+		}
+		if ok, _ := path.Match(pattern, target); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// Walk returns the paths of the video files under root relative to root that
+// pass filter, skipping hidden files and directories
+func Walk(root string, filter Filter) ([]string, error) {
+	var files []string
+
+	err := filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if path == root {
+			return nil
+		}
+		if strings.HasPrefix(d.Name(), ".") {
+			if d.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+
+		rel, err := filepath.Rel(root, path)
+		if err != nil {
+			return err
+		}
+		if filter.excluded(rel) {
+			if d.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if d.IsDir() || !IsVideo(path) || !filter.included(rel) {
+			return nil
+		}
+
+		files = append(files, rel)
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to walk library: %w", err)
+	}
+
+	slices.Sort(files)
+	return files, nil
+}
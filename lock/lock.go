@@ -0,0 +1,103 @@
+// Package lock provides a lock file shared by all encz processes on a machine
+package lock
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ErrLocked is returned when another process holds the lock
+var ErrLocked = errors.New("lock is held by another process")
+
+// Lock is a held lock file
+type Lock struct {
+	file *os.File
+	// created is set when this process created the file, the only one it writes to
+	created bool
+}
+
+// pollInterval is how often Acquire retries taking a held lock
+const pollInterval = 50 * time.Millisecond
+
+// TryAcquire takes the lock at path without waiting, returning ErrLocked if another process holds it
+func TryAcquire(path string) (*Lock, error) {
+	return tryAcquire(path, 0666)
+}
+
+// Acquire takes the lock at path, waiting while another process holds it.
+// Unlike TryAcquire, the lock file is only writable by the current user.
+func Acquire(path string) (*Lock, error) {
+	for {
+		l, err := tryAcquire(path, 0644)
+		if !errors.Is(err, ErrLocked) {
+			return l, err
+		}
+		time.Sleep(pollInterval)
+	}
+}
+
+func tryAcquire(path string, perm os.FileMode) (*Lock, error) {
+	f, created, err := openFile(path, perm)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open lock file: %w", err)
+	}
+
+	if err := lockFile(f); err != nil {
+		f.Close()
+		return nil, err
+	}
+
+	// The pid is only informational, the lock itself is what counts. Existing
+	// files may be links others made to files of ours, they're never written.
+	if created {
+		_, _ = f.WriteAt([]byte(strconv.Itoa(os.Getpid())+"\n"), 0)
+	}
+
+	return &Lock{file: f, created: created}, nil
+}
+
+// openFile opens the lock file at path, reporting whether it created it. New
+// files get perm despite the umask, so all users can share them with 0666,
+// existing ones are only read, which is enough to lock them. Symlinks aren't
+// followed, so others can't have the lock file created elsewhere.
+func openFile(path string, perm os.FileMode) (*os.File, bool, error) {
+	f, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE|os.O_EXCL|noFollow, perm)
+	if err == nil {
+		_ = f.Chmod(perm)
+		return f, true, nil
+	}
+	if !errors.Is(err, fs.ErrExist) {
+		return nil, false, err
+	}
+
+	f, err = os.OpenFile(path, os.O_RDONLY|noFollow, 0)
+	return f, false, err
+}
+
+// Owner returns the pid of the process holding the lock at path, or 0 if unknown
+func Owner(path string) int {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return 0
+	}
+	pid, _ := strconv.Atoi(strings.TrimSpace(string(b)))
+	return pid
+}
+
+// Release releases the lock
+func (l *Lock) Release() error {
+	// The pid would be wrong for the next process, which doesn't write its own
+	if l.created {
+		_ = l.file.Truncate(0)
+	}
+	if err := unlockFile(l.file); err != nil {
+		l.file.Close()
+		return fmt.Errorf("failed to release lock: %w", err)
+	}
+	return l.file.Close()
+}
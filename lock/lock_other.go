@@ -0,0 +1,16 @@
+//go:build !linux && !darwin && !freebsd && !openbsd && !netbsd && !dragonfly && !windows
+
+package lock
+
+import "os"
+
+// lockFile doesn't lock where file locks aren't available
+func lockFile(f *os.File) error {
+	return nil
+}
+
+func unlockFile(f *os.File) error {
+	return nil
+}
+
+const noFollow = 0
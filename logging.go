@@ -0,0 +1,114 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/rs/zerolog"
+	"github.com/rs/zerolog/log"
+)
+
+// setupLogging configures the global logger
+func setupLogging(args cliArgs) error {
+	level := zerolog.InfoLevel
+	if args.Cron {
+		// Scheduled runs only report what needs attention, plus the summary
+		level = zerolog.WarnLevel
+	}
+	if args.Quiet {
+		level = zerolog.ErrorLevel
+	}
+	if args.Debug {
+		level = zerolog.DebugLevel
+	}
+	if args.LogLevel != "" {
+		var err error
+		if level, err = zerolog.ParseLevel(args.LogLevel); err != nil || level == zerolog.NoLevel {
+			return fmt.Errorf("invalid --log-level %q: expected trace, debug, info, warn or error", args.LogLevel)
+		}
+	}
+
+	colorAllowed = !args.NoColor && os.Getenv("NO_COLOR") == "" && !args.Cron
+
+	var out io.Writer
+	switch args.LogFormat {
+	case "", "console":
+		out = consoleWriter(os.Stderr)
+	case "json":
+		out = os.Stderr
+	default:
+		return fmt.Errorf("invalid --log-format %q: expected console or json", args.LogFormat)
+	}
+
+	if args.Syslog {
+		w, err := newSyslogWriter()
+		if err != nil {
+			return err
+		}
+		out = zerolog.MultiLevelWriter(out, w)
+	}
+
+	logOutput = out
+	log.Logger = log.Output(out).Level(level)
+	zerolog.DefaultContextLogger = &log.Logger
+	return nil
+}
+
+// logOutput is the writer of the global logger
+var logOutput io.Writer = os.Stderr
+
+type logWriterKey struct{}
+
+// withLogWriter records that the logger of ctx was replaced with one writing to w
+func withLogWriter(ctx context.Context, w io.Writer) context.Context {
+	return context.WithValue(ctx, logWriterKey{}, w)
+}
+
+// logWriterFrom returns the writer of the logger of ctx
+func logWriterFrom(ctx context.Context) io.Writer {
+	if w, ok := ctx.Value(logWriterKey{}).(io.Writer); ok {
+		return w
+	}
+	return logOutput
+}
+
+type jobLogKey struct{}
+
+// createJobLog creates the log file of a job in dir and returns a context
+// logging to it as well, including debug messages. Encoder output is
+// written to the same file, see jobLogFrom.
+func createJobLog(ctx context.Context, dir, videoPath string) (context.Context, *os.File, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return ctx, nil, fmt.Errorf("failed to create log directory: %w", err)
+	}
+
+	stem := strings.TrimSuffix(filepath.Base(videoPath), filepath.Ext(videoPath))
+	file, err := os.Create(filepath.Join(dir, fmt.Sprintf("%s.%s.log", stem, time.Now().Format("20060102-150405"))))
+	if err != nil {
+		return ctx, nil, fmt.Errorf("failed to create job log: %w", err)
+	}
+	w := zerolog.SyncWriter(file)
+
+	// The console keeps its level while the file gets everything
+	logger := log.Ctx(ctx)
+	console := &zerolog.FilteredLevelWriter{
+		Writer: zerolog.LevelWriterAdapter{Writer: logWriterFrom(ctx)},
+		Level:  logger.GetLevel(),
+	}
+	jobLogger := logger.Output(zerolog.MultiLevelWriter(console, w)).Level(zerolog.DebugLevel)
+
+	ctx = jobLogger.WithContext(ctx)
+	ctx = context.WithValue(ctx, jobLogKey{}, w)
+	return ctx, file, nil
+}
+
+// jobLogFrom returns the job log of ctx, or nil when jobs aren't logged to files
+func jobLogFrom(ctx context.Context) io.Writer {
+	w, _ := ctx.Value(jobLogKey{}).(io.Writer)
+	return w
+}
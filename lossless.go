@@ -0,0 +1,116 @@
+package main
+
+import (
+	"cmp"
+	"context"
+	"fmt"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/rs/zerolog/log"
+
+	"encz/ffmpeg"
+	"encz/handbrake"
+)
+
+// losslessRatio is the share of the raw video size lossless encoders
+// typically keep, live action rarely compresses better than 2:1 without loss
+const losslessRatio = 0.5
+
+// visuallyLosslessQuality returns the quality of the video encoder of engine
+// at which encodes can't be told apart from their source in playback
+func visuallyLosslessQuality(engine, encoder string) float64 {
+	if engine == "ffmpeg" {
+		encoder = cmp.Or(encoder, ffmpeg.DefaultVideoEncoder)
+	} else {
+		encoder = cmp.Or(encoder, handbrake.DefaultVideoEncoder)
+	}
+	switch {
+	case strings.Contains(encoder, "videotoolbox"), strings.HasPrefix(encoder, "vt_"):
+		return 80
+	case strings.Contains(encoder, "av1"):
+		return 20
+	case strings.Contains(encoder, "264"):
+		return 16
+	}
+	return 17
+}
+
+// validateLossless checks that the video encoder can encode losslessly and
+// that nothing resizes the video
+func (c *cliArgs) validateLossless() error {
+	if c.Lossless && c.VisuallyLossless {
+		return fmt.Errorf("--lossless and --visually-lossless are exclusive")
+	}
+	if !c.Lossless {
+		return nil
+	}
+
+	supported := handbrake.SupportsLossless(c.VideoEncoder)
+	if c.Encoder == "ffmpeg" {
+		supported = ffmpeg.SupportsLossless(c.VideoEncoder)
+	}
+	if !supported {
+		return fmt.Errorf("--lossless requires libx265, libx264, ffv1 or NVENC with ffmpeg, or x265 or x264 with HandBrake")
+	}
+	if c.Width > 0 || c.Height > 0 || len(c.Renditions) > 0 {
+		return fmt.Errorf("--lossless keeps every pixel, it cannot be combined with --width, --height or --renditions")
+	}
+	return nil
+}
+
+// codecLabel returns the codec named in output names, x265 for every encoder
+// but the FFV1 of lossless archives
+func (c *cliArgs) codecLabel() string {
+	if c.Encoder == "ffmpeg" && c.VideoEncoder == "ffv1" {
+		return "ffv1"
+	}
+	return "x265"
+}
+
+// qualityTag returns the tag added to the names of outputs of the lossless modes
+func (c *cliArgs) qualityTag() string {
+	switch {
+	case c.Lossless:
+		return "lossless"
+	case c.VisuallyLossless:
+		return "visually lossless"
+	}
+	return ""
+}
+
+// losslessSavePath returns savePath with the extension of the container
+// FFV1 is stored in, which MP4 can't carry
+func losslessSavePath(args cliArgs, savePath string) string {
+	if args.codecLabel() != "ffv1" {
+		return savePath
+	}
+	return strings.TrimSuffix(savePath, filepath.Ext(savePath)) + ".mkv"
+}
+
+// warnLosslessSize logs the size lossless outputs are expected to reach,
+// which is often several times the size of a lossy source
+func warnLosslessSize(ctx context.Context, args cliArgs, probe ffmpeg.ProbeResult, sourceSize int64, encodeDuration time.Duration) {
+	if !args.Lossless {
+		return
+	}
+	duration := encodeDuration
+	if duration == 0 {
+		duration = probe.Duration - args.FromTime
+	}
+
+	// 4:2:0 frames take 12 bits per pixel, 15 at 10 bits
+	bitsPerPixel := 12.0
+	if args.Is10Bit {
+		bitsPerPixel = 15
+	}
+	raw := float64(probe.Width*probe.Height) * bitsPerPixel / 8 * probe.FPS * duration.Seconds()
+	expected := int64(raw * losslessRatio)
+
+	event := log.Ctx(ctx).Info()
+	if sourceSize > 0 && expected > 2*sourceSize {
+		event = log.Ctx(ctx).Warn().Str("source_size", formatBytes(sourceSize))
+	}
+	event.Str("expected_size", formatBytes(expected)).Msg("lossless output is expected to be large")
+}
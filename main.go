@@ -7,73 +7,540 @@ import (
 	"flag"
 	"fmt"
 	"os"
-	"os/signal"
 	"path/filepath"
-	"regexp"
+	"slices"
 	"strings"
-	"syscall"
 	"time"
+	"unicode"
 
 	"github.com/rs/zerolog"
 	"github.com/rs/zerolog/log"
 
+	"encz/config"
 	"encz/ffmpeg"
+	"encz/fileattr"
 	"encz/handbrake"
+	"encz/history"
+	"encz/notify"
+	"encz/proc"
+	"encz/progress"
+	"encz/ytdlp"
 )
 
 type cliArgs struct {
 	VideoPath string
 	OutputDir string
-	Encoder   string
-	Quality   float64
-	Denoise   bool
-	Is10Bit   bool
-	FromTime  time.Duration
-	ToTime    time.Duration
-	Duration  time.Duration
-	Width     int
-	Height    int
-	Debug     bool
-	ExtraArgs []string
-	Version   bool
+	// Output replaces the generated output path, - for stdout
+	Output string
+	// PipeFormat is the container of outputs written to stdout
+	PipeFormat string
+	// InputDuration is the length of sources read from stdin, for the progress
+	InputDuration time.Duration
+	Encoder       string
+	Quality       float64
+	Denoise       bool
+	Is10Bit       bool
+	FromTime      time.Duration
+	ToTime        time.Duration
+	Duration      time.Duration
+	Width         int
+	Height        int
+	Debug         bool
+	ExtraArgs     []string
+	Version       bool
+
+	HandbrakeLog       string
+	HandbrakeVerbosity int
+
+	Force       bool
+	HistoryPath string
+
+	AudioCopy bool
+	// AudioCodec is aac, opus, ac3 or auto to pick it for the output container
+	AudioCodec string
+	// AudioBitrate overrides the bitrate in kbps of each audio track, 0 for
+	// the codec's default for the channels of the track
+	AudioBitrate int
+	// AudioDelay shifts the audio tracks of outputs
+	AudioDelay audioDelay
+	// AudioGain changes the volume of encoded audio in dB
+	AudioGain float64
+	// AudioPassthrough are the rules passing audio codecs through, or
+	// transcoding them, by output container
+	AudioPassthrough []passthroughRule
+
+	VideoEncoder  string
+	Chunked       bool
+	ChunkDuration time.Duration
+	ChunkWorkers  int
+	RemoteWorkers []string
+	Devices       []string
+
+	// FallbackEncoders are tried in order when VideoEncoder fails to start
+	FallbackEncoders []fallbackEncoder
+
+	// Streams selects the streams of the source kept in outputs
+	Streams streamSelection
+	// TrackFlags are the tracks flagged default or forced in outputs
+	TrackFlags trackFlags
+	// AudioLangs and SubtitleLangs are the preferred languages of the tracks
+	// kept when --map doesn't select them
+	AudioLangs    []string
+	SubtitleLangs []string
+
+	// Options placed at the right position of the ffmpeg command line
+	FFInputArgs  []string
+	FFOutputArgs []string
+	VideoFilters []string
+
+	BitrateGuard string
+
+	// Upload is the sftp:// folder outputs are uploaded to
+	Upload       string
+	UploadDelete bool
+
+	OnCompleteExec string
+	Webhooks       []notify.Webhook
+	PreHook        string
+	PostHook       string
+
+	Cron   bool
+	Quiet  bool
+	Syslog bool
+	// NoColor disables the styles of the console output, like $NO_COLOR
+	NoColor bool
+	// ProgressInterval is the time between progress lines when stdout isn't a terminal
+	ProgressInterval time.Duration
+
+	Replace bool
+
+	AccurateSeek bool
+
+	Renditions []rendition
+
+	Poster     time.Duration
+	Thumbnails int
+	Sprites    bool
+
+	Nice    bool
+	Threads int
+
+	Schedule       string
+	ScheduleAction string
+	RequireAC      bool
+	Retries        int
+	Timeout        time.Duration
+	Lock           string
+	LockFile       string
+	// QuietPeriod is how long sources must go unmodified before they're encoded
+	QuietPeriod time.Duration
+	// HWDecode decodes on the GPU of the encoder
+	HWDecode bool
+	// GPU is the device of NVENC, VAAPI and QSV encoders, or auto, see validateGPU
+	GPU string
+	// Usage samples the resource usage of the encoder, see usageMonitor
+	Usage bool
+	// Detelecine is on, off or auto to detect telecined sources
+	Detelecine string
+	// Grain is keep, synthesize, remove or empty for the encoder default
+	Grain string
+	// Tune adjusts the encoding to a type of content, see contentTunes
+	Tune string
+	// ResolutionQuality is the default quality by resolution class, see resolutionClasses
+	ResolutionQuality map[string]float64
+	// QualityGiven reports whether --quality was given on the command line, which
+	// overrides ResolutionQuality
+	QualityGiven bool
+	// SmartQuality adjusts the quality to the bits per pixel of the source,
+	// worse below SmartLowBPP and better above SmartHighBPP, by SmartStep
+	SmartQuality bool
+	SmartLowBPP  float64
+	SmartHighBPP float64
+	SmartStep    float64
+	// smartOffset is the quality offset SmartQuality picked for the source
+	smartOffset float64
+	// Stabilize smooths camera shake in a two-pass ffmpeg encode
+	Stabilize bool
+	// Title is the DVD or Blu-ray title to encode, 0 for the main feature
+	Title       int
+	MainFeature bool
+	ListTitles  bool
+	// Watermark is an image overlaid on the video, such as a logo
+	Watermark        string
+	WatermarkPos     string
+	WatermarkOpacity float64
+	// StripMetadata drops the source metadata and chapters
+	StripMetadata bool
+	// StripPrivateMetadata drops location and device tags
+	StripPrivateMetadata bool
+	// TitleTemplate is the title tag of outputs, with placeholders like {stem}
+	TitleTemplate string
+	// NoTitle leaves the title of the source as it is
+	NoTitle bool
+	// NameTemplate is the name of outputs, with placeholders like {stem}
+	NameTemplate string
+	// PreserveTimes copies the modification and creation dates of the source
+	PreserveTimes bool
+	// PreserveXattrs copies the extended attributes of the source, including Finder tags
+	PreserveXattrs bool
+	// X265Params and EncoderOptions are options of the video encoder, merged
+	// with those encz sets
+	X265Params     []string
+	EncoderOptions []string
+	// Lossless encodes every pixel of the source exactly, VisuallyLossless at
+	// a quality that can't be told apart from it
+	Lossless         bool
+	VisuallyLossless bool
+	// Precheck decodes segments of the source to skip badly corrupted ones
+	Precheck bool
+	// Estimate encodes samples to predict the output size before encoding
+	Estimate bool
+	Yes      bool
+
+	LogDir    string
+	LogFormat string
+	LogLevel  string
+
+	FFmpegPath    string
+	FFprobePath   string
+	HandbrakePath string
+	YTDLPPath     string
+
+	// YTDLP fetches URLs of web pages with yt-dlp rather than passing them to ffmpeg
+	YTDLP bool
+
+	ConfigPath string
+	// Preset names the config presets applied over the config's flag values
+	Preset string
+	// ConfigFile holds the sections of the config file
+	ConfigFile config.File
 }
 
-// parseArgs parses command line arguments
-func parseArgs() cliArgs {
-	var config cliArgs
+// splitWords splits s into arguments like a POSIX shell, so options like
+// -metadata title="A Title" keep their spaces
+func splitWords(s string) ([]string, error) {
+	var words []string
+	var word strings.Builder
+	inWord := false
+	var quote rune
+	escaped := false
+	for _, r := range s {
+		switch {
+		case escaped:
+			// Inside double quotes, backslashes only escape the characters special there
+			if quote == '"' && !strings.ContainsRune("\"\\$`", r) {
+				word.WriteRune('\\')
+			}
+			word.WriteRune(r)
+			escaped = false
+		case r == '\\' && quote != '\'':
+			escaped, inWord = true, true
+		case quote != 0 && r == quote:
+			quote = 0
+		case quote != 0:
+			word.WriteRune(r)
+		case r == '\'' || r == '"':
+			quote, inWord = r, true
+		case unicode.IsSpace(r):
+			if inWord {
+				words = append(words, word.String())
+				word.Reset()
+				inWord = false
+			}
+		default:
+			word.WriteRune(r)
+			inWord = true
+		}
+	}
+	if quote != 0 || escaped {
+		return nil, fmt.Errorf("unterminated quote or escape in %q", s)
+	}
+	if inWord {
+		words = append(words, word.String())
+	}
+	return words, nil
+}
+
+// parseArgs parses command line arguments using fs. Subcommands register
+// their own flags on fs before calling it.
+func parseArgs(fs *flag.FlagSet, arguments []string) cliArgs {
+	config, err := readArgs(fs, arguments, nil)
+	if err != nil {
+		fmt.Fprintln(fs.Output(), err)
+		os.Exit(2)
+	}
+
+	setBinaryPaths(config)
+	proc.SetLowPriority(config.Nice)
+	progress.SetPlainInterval(config.ProgressInterval)
+	return config
+}
+
+// readArgs is parseArgs without exiting on errors or configuring the process,
+// for encz serve applying job presets. It loads the config file of arguments,
+// unless file is given.
+func readArgs(fs *flag.FlagSet, arguments []string, file *config.File) (cliArgs, error) {
+	config := cliArgs{TrackFlags: unsetTrackFlags}
 
-	flag.BoolVar(&config.Version, "version", false, "show version information")
-	flag.StringVar(&config.Encoder, "encoder", "handbrake", "encoder engine (handbrake or ffmpeg)")
-	flag.Float64Var(&config.Quality, "quality", 35, "x265 quality factor")
-	flag.StringVar(&config.OutputDir, "output-dir", "", "directory to save encoded files")
-	flag.BoolVar(&config.Denoise, "denoise", false, "enable denoise filter (HandBrake only)")
-	flag.BoolVar(&config.Is10Bit, "10bit", true, "encode using 10-bit profile")
+	fs.BoolVar(&config.Version, "version", false, "show version information")
+	fs.StringVar(&config.Encoder, "encoder", "handbrake", "encoder engine (handbrake or ffmpeg)")
+	fs.Float64Var(&config.Quality, "quality", defaultQuality, "constant quality of the video encoder (higher is better for VideoToolbox, lower for others)")
+	fs.Func("resolution-quality", "default quality by output resolution when --quality isn't given, e.g. 4k=40,1080p=35,sd=30 (4k, 1440p, 1080p, 720p or sd)", func(s string) error {
+		return parseResolutionQuality(s, &config.ResolutionQuality)
+	})
+	fs.BoolVar(&config.SmartQuality, "smart-quality", false, "adjust the quality to the source, spending fewer bits on heavily compressed sources and more on detailed ones")
+	fs.Float64Var(&config.SmartLowBPP, "smart-low-bpp", 0.05, "bits per pixel, H.264 equivalent, below which --smart-quality lowers the quality")
+	fs.Float64Var(&config.SmartHighBPP, "smart-high-bpp", 0.25, "bits per pixel, H.264 equivalent, above which --smart-quality raises the quality")
+	fs.Float64Var(&config.SmartStep, "smart-step", 2, "quality change of --smart-quality on the x265 scale, doubled for the most compressed sources")
+	fs.StringVar(&config.OutputDir, "output-dir", "", "directory to save encoded files")
+	input := fs.String("i", "", "input file, - for stdin, instead of the first argument")
+	fs.StringVar(&config.Output, "o", "", "output file instead of a name generated in --output-dir, - for stdout")
+	fs.StringVar(&config.PipeFormat, "pipe-format", "matroska", "container of outputs written to stdout (matroska or nut)")
+	fs.DurationVar(&config.InputDuration, "input-duration", 0, "length of a source read from stdin, which can't be probed, to show the progress of")
+	fs.StringVar(&config.VideoEncoder, "video-encoder", "", "video encoder (e.g. hevc_videotoolbox or libx265 for ffmpeg, vt_h265 or x265 for HandBrake)")
+	listVar(fs, "fallback-encoders", "encoders tried in order when the video encoder fails to start, e.g. x265:q22 or libx265:q24 (quality defaults to --quality)", func() { config.FallbackEncoders = nil }, func(s string) error {
+		encoders, err := parseFallbackEncoders(s)
+		config.FallbackEncoders = append(config.FallbackEncoders, encoders...)
+		return err
+	})
+	fs.BoolVar(&config.Chunked, "chunked", false, "split the file into chunks and encode them in parallel (ffmpeg software encoders only)")
+	fs.DurationVar(&config.ChunkDuration, "chunk-duration", 2*time.Minute, "target length of each chunk in chunked mode")
+	fs.IntVar(&config.ChunkWorkers, "chunk-workers", 0, "number of chunks encoded in parallel (default: based on CPU count)")
+	listVar(fs, "remote-workers", "comma-separated ssh://[user@]host[:port][?slots=N] hosts that encode chunks alongside this machine", func() { config.RemoteWorkers = nil }, func(s string) error {
+		config.RemoteWorkers = append(config.RemoteWorkers, strings.Split(s, ",")...)
+		return nil
+	})
+	listVar(fs, "devices", "hardware encoder encoding the chunks in chunked mode, with its weight, i.e. concurrent sessions (e.g. hevc_nvenc=2)", func() { config.Devices = nil }, func(s string) error {
+		config.Devices = append(config.Devices, strings.Split(s, ",")...)
+		return nil
+	})
+	listVar(fs, "map", "streams kept in outputs, counted from 0 within their kind: v:N, a:0,2, a:all, s:none or t:all for attachments (repeatable)", func() { config.Streams = streamSelection{} }, func(s string) error {
+		return parseStreamMap(s, &config.Streams)
+	})
+	fs.IntVar(&config.TrackFlags.DefaultAudio, "default-audio", -1, "source audio track flagged default in outputs, counted from 0 like --map")
+	fs.Func("default-subtitle", "source subtitle track flagged default in outputs, or none to clear the flag of every subtitle", func(s string) error {
+		return parseDefaultSubtitle(s, &config.TrackFlags)
+	})
+	fs.IntVar(&config.TrackFlags.ForcedSubtitle, "forced-subtitle", -1, "source subtitle track flagged forced in outputs, shown even with subtitles off")
+	listVar(fs, "audio-langs", "preferred audio languages kept in outputs when --map doesn't select audio, e.g. eng,tr (repeatable)", func() { config.AudioLangs = nil }, func(s string) error {
+		return parseLanguages(s, &config.AudioLangs)
+	})
+	listVar(fs, "subtitle-langs", "preferred subtitle languages kept in outputs when --map doesn't select subtitles, e.g. eng (repeatable)", func() { config.SubtitleLangs = nil }, func(s string) error {
+		return parseLanguages(s, &config.SubtitleLangs)
+	})
+	listVar(fs, "ff-in", "extra ffmpeg input options placed before -i, e.g. '-hwaccel videotoolbox' (repeatable)", func() { config.FFInputArgs = nil }, func(s string) error {
+		words, err := splitWords(s)
+		config.FFInputArgs = append(config.FFInputArgs, words...)
+		return err
+	})
+	listVar(fs, "ff-out", "extra ffmpeg output options placed before the output file, e.g. '-movflags +faststart' (repeatable)", func() { config.FFOutputArgs = nil }, func(s string) error {
+		words, err := splitWords(s)
+		config.FFOutputArgs = append(config.FFOutputArgs, words...)
+		return err
+	})
+	listVar(fs, "vf-extra", "ffmpeg filter appended to the video filter chain after scaling, e.g. 'hqdn3d' (repeatable)", func() { config.VideoFilters = nil }, func(s string) error {
+		config.VideoFilters = append(config.VideoFilters, s)
+		return nil
+	})
+	listVar(fs, "renditions", "encode several outputs at once, e.g. 1080p:q28,720p:q30,480p:q32 (quality defaults to --quality)", func() { config.Renditions = nil }, func(s string) error {
+		renditions, err := parseRenditions(s)
+		config.Renditions = append(config.Renditions, renditions...)
+		return err
+	})
+	fs.Func("poster", "write a JPEG still of the output at this time next to it, e.g. 00:05:00 or 5m", func(s string) error {
+		var err error
+		config.Poster, err = parseTimestamp(s)
+		return err
+	})
+	fs.IntVar(&config.Thumbnails, "thumbnails", 0, "write this many evenly spaced JPEG stills of the output next to it")
+	fs.BoolVar(&config.Sprites, "sprites", false, "also tile the thumbnails into a sprite sheet with a WebVTT index for video players")
+	fs.BoolVar(&config.Denoise, "denoise", false, "enable denoise filter (HandBrake only)")
+	fs.BoolVar(&config.Is10Bit, "10bit", true, "encode using 10-bit profile")
 	// Handle 8bit flag to override 10bit
-	eightBit := flag.Bool("8bit", false, "encode using 8-bit profile")
+	eightBit := fs.Bool("8bit", false, "encode using 8-bit profile")
 
-	flag.DurationVar(&config.FromTime, "from", 0, "start encoding from this time (e.g., 5m30s, 1h30m, 300s)")
-	flag.DurationVar(&config.ToTime, "to", 0, "end encoding at this time (e.g., 10m, 1h30m, 420s)")
-	flag.DurationVar(&config.Duration, "duration", 0, "encoding duration (e.g., 10m, 1h30m, 420s)")
+	fs.DurationVar(&config.FromTime, "from", 0, "start encoding from this time (e.g., 5m30s, 1h30m, 300s)")
+	fs.DurationVar(&config.ToTime, "to", 0, "end encoding at this time (e.g., 10m, 1h30m, 420s)")
+	fs.DurationVar(&config.Duration, "duration", 0, "encoding duration (e.g., 10m, 1h30m, 420s)")
+	fs.BoolVar(&config.AccurateSeek, "accurate-seek", false, "cut exactly at --from instead of the nearest second, slower for late start points")
 
 	// New flags for width and height
-	flag.IntVar(&config.Width, "width", 0, "set output video width")
-	flag.IntVar(&config.Height, "height", 0, "set output video height")
+	fs.IntVar(&config.Width, "width", 0, "set output video width")
+	fs.IntVar(&config.Height, "height", 0, "set output video height")
+
+	fs.StringVar(&config.HandbrakeLog, "handbrake-log", "", "write HandBrake's detailed log to this file (default: temp file kept only on failure)")
+	fs.IntVar(&config.HandbrakeVerbosity, "handbrake-verbosity", 2, "HandBrake log verbosity captured in the log file")
+
+	fs.StringVar(&config.BitrateGuard, "bitrate-guard", "warn", "action when a hardware encode's bitrate collapses for its resolution (off, warn or abort)")
+
+	fs.BoolVar(&config.AudioCopy, "audio-copy", false, "stream-copy audio and verify it is bit-identical after encoding")
+	fs.StringVar(&config.AudioCodec, "audio-codec", "auto", "audio codec: aac, opus, ac3 or auto for Opus in MKV and AAC in MP4 outputs")
+	listVar(fs, "audio-delay", "shift audio by a duration, later when positive, e.g. 250ms, or one source track with N=duration, e.g. 1=-120ms (repeatable)", func() { config.AudioDelay = audioDelay{} }, func(s string) error {
+		return parseAudioDelay(s, &config.AudioDelay)
+	})
+	fs.Func("gain", "change the volume of encoded audio, e.g. 3dB, limiting peaks so louder audio doesn't clip", func(s string) error {
+		var err error
+		config.AudioGain, err = parseGain(s)
+		return err
+	})
+	listVar(fs, "audio-passthrough", "how audio of a codec is kept by output container, e.g. truehd@mkv=copy or dts@mp4=eac3:640 (repeatable)", func() { config.AudioPassthrough = nil }, func(s string) error {
+		rule, err := parsePassthroughRule(s)
+		config.AudioPassthrough = append(config.AudioPassthrough, rule)
+		return err
+	})
+	fs.IntVar(&config.AudioBitrate, "audio-bitrate", 0, "bitrate in kbps of each audio track (default: based on the codec and channels of the track)")
+
+	fs.StringVar(&config.Upload, "upload", "", "upload outputs to sftp://[user@]host[:port]/path after encoding")
+	fs.BoolVar(&config.UploadDelete, "upload-delete", false, "delete the local copy of outputs after uploading them")
+
+	fs.StringVar(&config.OnCompleteExec, "on-complete-exec", "", "shell command run after each job with a JSON description of the result on stdin")
+	fs.StringVar(&config.PreHook, "pre-hook", "", "shell command run before each job, a non-zero exit aborts the job ({input} and ENCZ_INPUT are replaced)")
+	fs.StringVar(&config.PostHook, "post-hook", "", "shell command run after each job ({input}, {output}, {status}, {saved_bytes}... and ENCZ_* variables are replaced)")
+	listVar(fs, "webhook", "URL notified of job start, completion and failure, prefix with discord= or slack= for chat payloads (repeatable)", func() { config.Webhooks = nil }, func(s string) error {
+		config.Webhooks = append(config.Webhooks, parseWebhook(s))
+		return nil
+	})
+
+	fs.BoolVar(&config.Force, "force", false, "encode even if the source was already encoded with equal or better settings")
+	fs.StringVar(&config.HistoryPath, "history", "", "path to the encode history database (default: user config dir)")
+
+	fs.BoolVar(&config.Debug, "debug", false, "enable debug output")
+	fs.BoolVar(&config.Debug, "verbose", false, "show encoder command lines, probe details and debug logs")
+	fs.BoolVar(&config.Debug, "v", false, "shorthand for --verbose")
+	fs.BoolVar(&config.Usage, "usage", false, "show the CPU, memory and GPU encoder usage of the encoder next to the progress, and their averages after each encode")
+	fs.BoolVar(&config.Quiet, "quiet", false, "only show errors and a summary at the end, no progress")
+	fs.StringVar(&config.LogFormat, "log-format", "console", "log format: console or json")
+	fs.StringVar(&config.LogLevel, "log-level", "", "log level: debug, info, warn or error (default: info)")
+	fs.StringVar(&config.LogDir, "log-dir", "", "write a log file per job with encz's debug log and the encoder output to this directory")
+	fs.BoolVar(&config.Cron, "cron", false, "scheduled run mode: no progress or colors, warnings and errors only, and a summary at the end")
+	fs.BoolVar(&config.Syslog, "syslog", false, "also send logs to syslog")
+	fs.BoolVar(&config.NoColor, "no-color", false, "don't color the console output (default: colored on terminals unless $NO_COLOR is set)")
+	fs.DurationVar(&config.ProgressInterval, "progress-interval", 30*time.Second, "time between progress lines when the output isn't a terminal, like logs of services and CI")
+
+	fs.BoolVar(&config.Nice, "nice", false, "run encoders at low CPU and IO priority so the machine stays usable")
+	fs.IntVar(&config.Threads, "threads", 0, "limit the threads of software encoders (default: automatic)")
+	fs.StringVar(&config.Schedule, "schedule", "", "only encode during this daily window in local time, e.g. 23:00-07:00")
+	fs.StringVar(&config.ScheduleAction, "schedule-action", "pause", "what happens to a running encode when the window closes: pause or finish")
+	fs.IntVar(&config.Retries, "retries", 0, "retry failures that are likely temporary, such as busy hardware encoders, up to this many times")
+	fs.DurationVar(&config.Timeout, "timeout", 0, "fail an encode running longer than this, e.g. 4h, not counting time spent paused")
+	fs.DurationVar(&config.QuietPeriod, "quiet-period", 0, "only encode sources unmodified for this long and not open for writing, e.g. 2m, to leave downloads and recordings alone until they finish")
+	fs.StringVar(&config.Lock, "lock", "off", "keep other encz processes from encoding at the same time: off, wait (queue behind them) or fail (exit)")
+	fs.StringVar(&config.LockFile, "lock-file", defaultLockFile(), "lock file shared by the encz processes")
+	fs.BoolVar(&config.RequireAC, "require-ac", false, "only encode on AC power, pausing while on battery")
+	fs.BoolVar(&config.Replace, "replace", false, "delete the original after a successful encode")
+	fs.IntVar(&config.Title, "title", 0, "title of a DVD or Blu-ray folder to encode (HandBrake only, default: the main feature)")
+	fs.BoolVar(&config.MainFeature, "main-feature", false, "encode the main feature of a DVD or Blu-ray folder, as detected by HandBrake")
+	fs.BoolVar(&config.ListTitles, "list-titles", false, "list the titles of a DVD or Blu-ray folder and exit")
+	fs.StringVar(&config.Watermark, "watermark", "", "image overlaid on the video, such as a logo.png (ffmpeg only)")
+	fs.StringVar(&config.WatermarkPos, "watermark-pos", "bottom-right", "position of the watermark ("+strings.Join(ffmpeg.WatermarkPositions, ", ")+")")
+	fs.Float64Var(&config.WatermarkOpacity, "watermark-opacity", 0.8, "opacity of the watermark, from 0 to 1")
+	fs.BoolVar(&config.Stabilize, "stabilize", false, "smooth the camera shake of handheld footage, analysing the motion in a first pass (ffmpeg only)")
+	fs.StringVar(&config.Tune, "tune", "", "tune encoding for the content: animation, film, screencast or grain")
+	fs.StringVar(&config.Grain, "grain", "", "film grain handling: keep tunes x265 for grain, synthesize has AV1 players add it back, remove denoises")
+	fs.StringVar(&config.Detelecine, "detelecine", "auto", "restore the film frames of telecined 29.97fps sources (auto, on or off)")
+	fs.StringVar(&config.GPU, "gpu", "", "GPU of the encoder: the index of an NVIDIA GPU for NVENC, a render node like /dev/dri/renderD129 for VAAPI and QSV, or auto for the NVIDIA GPU running the fewest sessions")
+	fs.BoolVar(&config.HWDecode, "hwdecode", false, "decode on the GPU matching the encoder, falling back to software decoding when it fails")
+	fs.BoolVar(&config.StripMetadata, "strip-metadata", false, "don't copy chapters, the creation date and other tags of the source")
+	fs.BoolVar(&config.StripPrivateMetadata, "strip-private-metadata", false, "don't copy GPS coordinates, device makes, models and serials, keeping the other tags")
+	fs.StringVar(&config.TitleTemplate, "title-template", defaultTitleTemplate, "title tag of outputs, with the placeholders {stem}, {title}, {year} and {resolution}")
+	fs.BoolVar(&config.NoTitle, "no-title", false, "keep the title tag of the source instead of --title-template")
+	fs.StringVar(&config.NameTemplate, "name-template", defaultNameTemplate, "name of outputs, with the placeholders {stem}, {resolution}, {codec}, {tag}, {bitdepth} and {hdr}")
+	fs.BoolVar(&config.PreserveTimes, "preserve-times", false, "give outputs the modification and creation dates of the source")
+	fs.BoolVar(&config.PreserveXattrs, "preserve-xattrs", false, "copy the extended attributes of the source to outputs, like Finder tags and labels")
+	listVar(fs, "x265-params", "x265 options merged with those encz sets, e.g. aq-mode=3:psy-rd=2.0 (repeatable)", func() { config.X265Params = nil }, func(s string) error {
+		options, err := parseEncoderOptions("x265-params", s)
+		config.X265Params = append(config.X265Params, options...)
+		return err
+	})
+	listVar(fs, "encopts", "HandBrake video encoder options merged with those encz sets, e.g. aq-mode=3 (repeatable)", func() { config.EncoderOptions = nil }, func(s string) error {
+		options, err := parseEncoderOptions("encopts", s)
+		config.EncoderOptions = append(config.EncoderOptions, options...)
+		return err
+	})
+	fs.BoolVar(&config.Lossless, "lossless", false, "encode losslessly for archival, with libx265, libx264, ffv1 or NVENC for ffmpeg and x265 or x264 for HandBrake")
+	fs.BoolVar(&config.VisuallyLossless, "visually-lossless", false, "encode at a quality that can't be told apart from the source, overriding --quality")
+	fs.BoolVar(&config.Precheck, "precheck", false, "decode a few segments of the source first and fail badly corrupted sources instead of encoding them")
+	fs.BoolVar(&config.Estimate, "estimate", false, "encode a few samples to estimate the output size and ask before encoding")
+	fs.BoolVar(&config.Yes, "yes", false, "don't ask for confirmation after --estimate")
+
+	fs.StringVar(&config.FFmpegPath, "ffmpeg-path", os.Getenv("ENCZ_FFMPEG_PATH"), "ffmpeg executable (default: $ENCZ_FFMPEG_PATH or ffmpeg on PATH)")
+	fs.StringVar(&config.FFprobePath, "ffprobe-path", os.Getenv("ENCZ_FFPROBE_PATH"), "ffprobe executable (default: $ENCZ_FFPROBE_PATH, next to --ffmpeg-path or ffprobe on PATH)")
+	fs.StringVar(&config.HandbrakePath, "handbrake-path", os.Getenv("ENCZ_HANDBRAKE_PATH"), "HandBrakeCLI executable (default: $ENCZ_HANDBRAKE_PATH or HandBrakeCLI on PATH)")
+	fs.StringVar(&config.YTDLPPath, "yt-dlp-path", os.Getenv("ENCZ_YTDLP_PATH"), "yt-dlp executable (default: $ENCZ_YTDLP_PATH or yt-dlp on PATH)")
+	fs.BoolVar(&config.YTDLP, "yt-dlp", false, "fetch URLs that aren't media files, like video pages, with yt-dlp before encoding")
+
+	fs.StringVar(&config.ConfigPath, "config", "", "path to the config file (default: user config dir)")
+	fs.StringVar(&config.Preset, "preset", "", "comma-separated presets from the presets section of the config file, applied in order")
 
-	flag.BoolVar(&config.Debug, "debug", false, "enable debug output")
+	if file == nil {
+		loaded, err := loadConfig(fs, arguments)
+		if err != nil {
+			return config, err
+		}
+		file = &loaded
+	} else if err := applyConfig(fs, arguments, *file); err != nil {
+		return config, err
+	}
+	config.ConfigFile = *file
+
+	if _, err := file.Section("webhooks", &config.Webhooks); err != nil {
+		return config, err
+	}
+
+	resetLists(fs, arguments)
+	if err := fs.Parse(arguments); err != nil {
+		return config, err
+	}
 
-	flag.Parse()
+	// The quality of the config is the fallback of resolutions without one
+	config.QualityGiven = givenFlags(fs, arguments)["quality"]
 
 	if *eightBit {
 		config.Is10Bit = false
 	}
+	if config.VisuallyLossless {
+		config.Quality = visuallyLosslessQuality(config.Encoder, config.VideoEncoder)
+	}
+	config.applyTune()
 
-	args := flag.Args()
-	if len(args) >= 1 {
+	args := fs.Args()
+	if *input != "" {
+		config.VideoPath = *input
+		config.ExtraArgs = args
+	} else if len(args) >= 1 {
 		config.VideoPath = args[0]
 		config.ExtraArgs = args[1:]
 	}
 
-	return config
+	return config, nil
+}
+
+// unattended reports whether progress is hidden in favor of a summary at the end
+func (c *cliArgs) unattended() bool {
+	return c.Cron || c.Quiet
+}
+
+// setBinaryPaths points the encoder packages at the configured executables
+func setBinaryPaths(args cliArgs) {
+	if args.FFmpegPath != "" {
+		ffmpeg.Binary = args.FFmpegPath
+		// Prefer the ffprobe of the same build
+		sibling := filepath.Join(filepath.Dir(args.FFmpegPath), "ffprobe"+filepath.Ext(args.FFmpegPath))
+		if _, err := os.Stat(sibling); err == nil && filepath.IsAbs(args.FFmpegPath) {
+			ffmpeg.ProbeBinary = sibling
+		}
+	}
+	if args.FFprobePath != "" {
+		ffmpeg.ProbeBinary = args.FFprobePath
+	}
+	if args.HandbrakePath != "" {
+		handbrake.Binary = args.HandbrakePath
+	} else {
+		handbrake.Binary = handbrake.FindBinary()
+	}
+	if args.YTDLPPath != "" {
+		ytdlp.Binary = args.YTDLPPath
+	}
 }
 
 // Validate validates the command line arguments
@@ -86,6 +553,61 @@ func (c *cliArgs) Validate() error {
 		return fmt.Errorf("video path is required")
 	}
 
+	if err := c.validateOutput(); err != nil {
+		return err
+	}
+	if err := c.validateEncoding(); err != nil {
+		return err
+	}
+	// Fallback encoders other than x265 leave the x265 params out
+	if err := c.validateEncoderOptions(); err != nil {
+		return err
+	}
+	// Fallback encoders of other kinds run on their default device
+	if err := c.validateGPU(); err != nil {
+		return err
+	}
+	if err := c.validatePipes(); err != nil {
+		return err
+	}
+	return c.validateFallbacks()
+}
+
+// validateWatermark validates the watermark arguments, which previews use too
+func (c *cliArgs) validateWatermark() error {
+	if c.Watermark == "" {
+		return nil
+	}
+	if _, err := os.Stat(c.Watermark); err != nil {
+		return fmt.Errorf("failed to read watermark: %w", err)
+	}
+	if !ffmpeg.IsValidWatermarkPosition(c.WatermarkPos) {
+		return fmt.Errorf("invalid --watermark-pos %q: expected one of %s", c.WatermarkPos, strings.Join(ffmpeg.WatermarkPositions, ", "))
+	}
+	if c.WatermarkOpacity <= 0 || c.WatermarkOpacity > 1 {
+		return fmt.Errorf("--watermark-opacity must be above 0 and at most 1")
+	}
+	return nil
+}
+
+// watermark returns the watermark of the encode, with no Path when there's none
+func (c *cliArgs) watermark() ffmpeg.Watermark {
+	return ffmpeg.Watermark{Path: c.Watermark, Position: c.WatermarkPos, Opacity: c.WatermarkOpacity}
+}
+
+// validateOutput validates the arguments controlling what encz prints
+func (c *cliArgs) validateOutput() error {
+	if c.Quiet && c.Debug {
+		return fmt.Errorf("cannot combine --quiet and --verbose")
+	}
+	if c.ProgressInterval <= 0 {
+		return fmt.Errorf("--progress-interval must be positive")
+	}
+	return nil
+}
+
+// validateEncoding validates the arguments controlling how files are encoded
+func (c *cliArgs) validateEncoding() error {
 	// Check that duration and to are mutually exclusive
 	if c.Duration > 0 && c.ToTime > 0 {
 		return fmt.Errorf("cannot specify both --duration and --to flags")
@@ -96,96 +618,367 @@ func (c *cliArgs) Validate() error {
 		return fmt.Errorf("--to time must be after --from time")
 	}
 
+	if err := c.validateAudio(); err != nil {
+		return err
+	}
+	if err := c.validateLossless(); err != nil {
+		return err
+	}
+	if err := c.validateTune(); err != nil {
+		return err
+	}
+	if err := c.validateSmartQuality(); err != nil {
+		return err
+	}
+	if err := validateNameTemplate(c.NameTemplate); err != nil {
+		return err
+	}
+
+	switch c.BitrateGuard {
+	case "off", "warn", "abort":
+	default:
+		return fmt.Errorf("invalid --bitrate-guard %q: expected off, warn or abort", c.BitrateGuard)
+	}
+
+	if c.Thumbnails < 0 {
+		return fmt.Errorf("--thumbnails must not be negative")
+	}
+	if c.Sprites && c.Thumbnails == 0 {
+		return fmt.Errorf("--sprites requires --thumbnails")
+	}
+
+	if len(c.Renditions) > 0 {
+		switch {
+		case c.Chunked:
+			return fmt.Errorf("--renditions cannot be combined with --chunked")
+		case c.Replace:
+			return fmt.Errorf("--renditions cannot be combined with --replace")
+		case c.Width > 0 || c.Height > 0:
+			return fmt.Errorf("--renditions cannot be combined with --width or --height, each rendition sets its own height")
+		}
+	}
+
+	if c.Chunked {
+		if c.AccurateSeek {
+			return fmt.Errorf("--accurate-seek cannot be combined with --chunked, chunks are cut at keyframes")
+		}
+		if c.Encoder != "ffmpeg" {
+			return fmt.Errorf("--chunked requires --encoder ffmpeg")
+		}
+		if !ffmpeg.IsSoftwareEncoder(c.VideoEncoder) && len(c.Devices) == 0 {
+			return fmt.Errorf("--chunked requires a software --video-encoder such as libx265, or --devices")
+		}
+		if err := validateDevices(c.Devices, c.RemoteWorkers); err != nil {
+			return err
+		}
+		if c.ChunkDuration <= 0 {
+			return fmt.Errorf("--chunk-duration must be positive")
+		}
+		for _, addr := range c.RemoteWorkers {
+			if _, err := ffmpeg.ParseWorker(addr); err != nil {
+				return err
+			}
+		}
+	} else if len(c.RemoteWorkers) > 0 || len(c.Devices) > 0 {
+		return fmt.Errorf("--remote-workers and --devices require --chunked")
+	}
+
+	if c.Encoder != "ffmpeg" && (len(c.FFInputArgs) > 0 || len(c.FFOutputArgs) > 0 || len(c.VideoFilters) > 0) {
+		return fmt.Errorf("--ff-in, --ff-out and --vf-extra require --encoder ffmpeg")
+	}
+
+	for _, hook := range c.Webhooks {
+		if err := hook.Validate(); err != nil {
+			return err
+		}
+	}
+
+	if c.Schedule != "" {
+		if _, err := parseSchedule(c.Schedule); err != nil {
+			return err
+		}
+	}
+	switch c.ScheduleAction {
+	case "pause", "finish":
+	default:
+		return fmt.Errorf("invalid --schedule-action %q: expected pause or finish", c.ScheduleAction)
+	}
+
+	switch c.Grain {
+	case "", ffmpeg.GrainKeep, ffmpeg.GrainRemove:
+	case ffmpeg.GrainSynthesize:
+		if c.Encoder == "ffmpeg" && !ffmpeg.SupportsGrainSynthesis(c.VideoEncoder) ||
+			c.Encoder != "ffmpeg" && !handbrake.SupportsGrainSynthesis(c.VideoEncoder) {
+			return fmt.Errorf("--grain synthesize requires an AV1 software encoder: libsvtav1 or libaom-av1 for ffmpeg, svt_av1 for HandBrake")
+		}
+	default:
+		return fmt.Errorf("invalid --grain %q: expected keep, synthesize or remove", c.Grain)
+	}
+	if c.Grain != "" && c.Denoise {
+		return fmt.Errorf("--denoise cannot be combined with --grain")
+	}
+
+	switch c.Detelecine {
+	case "auto", "on", "off":
+	default:
+		return fmt.Errorf("invalid --detelecine %q: expected auto, on or off", c.Detelecine)
+	}
+
+	switch c.Lock {
+	case "off", "wait", "fail":
+	default:
+		return fmt.Errorf("invalid --lock %q: expected off, wait or fail", c.Lock)
+	}
+
+	if c.Timeout < 0 {
+		return fmt.Errorf("--timeout must not be negative")
+	}
+
+	if c.QuietPeriod < 0 {
+		return fmt.Errorf("--quiet-period must not be negative")
+	}
+
+	if c.Retries < 0 {
+		return fmt.Errorf("--retries must not be negative")
+	}
+
+	if c.Threads < 0 {
+		return fmt.Errorf("--threads must not be negative")
+	}
+
+	if c.Replace && (c.FromTime > 0 || c.ToTime > 0 || c.Duration > 0) {
+		return fmt.Errorf("--replace cannot be combined with --from, --to or --duration")
+	}
+
+	if c.Upload != "" {
+		if _, err := parseUploadTarget(c.Upload); err != nil {
+			return err
+		}
+	} else if c.UploadDelete {
+		return fmt.Errorf("--upload-delete requires --upload")
+	}
+
+	if isURL(c.VideoPath) {
+		if err := c.validateURLInput(); err != nil {
+			return err
+		}
+	}
+
+	if c.Title < 0 {
+		return fmt.Errorf("--title must not be negative")
+	}
+	if c.Title > 0 && c.MainFeature {
+		return fmt.Errorf("--title cannot be combined with --main-feature")
+	}
+	if (c.Title > 0 || c.MainFeature || c.ListTitles) && c.Encoder != "handbrake" {
+		return fmt.Errorf("--title, --main-feature and --list-titles require --encoder handbrake")
+	}
+
+	if err := c.validateWatermark(); err != nil {
+		return err
+	}
+	if c.Watermark != "" && c.Encoder != "ffmpeg" {
+		return fmt.Errorf("--watermark requires --encoder ffmpeg")
+	}
+
+	if c.Stabilize && (c.Encoder != "ffmpeg" || c.Chunked) {
+		return fmt.Errorf("--stabilize requires --encoder ffmpeg and cannot be combined with --chunked")
+	}
+
+	if err := c.validateStreams(); err != nil {
+		return err
+	}
+	if err := c.validateTrackFlags(nil); err != nil {
+		return err
+	}
+
+	if c.HWDecode && c.Chunked {
+		return fmt.Errorf("--hwdecode cannot be combined with --chunked")
+	}
+
+	if c.Estimate && len(c.Renditions) > 0 {
+		return fmt.Errorf("--estimate cannot be combined with --renditions")
+	}
+
+	if c.Estimate && !c.Yes && c.unattended() {
+		return fmt.Errorf("--estimate asks for confirmation, add --yes for --cron and --quiet runs")
+	}
+
 	return nil
 }
 
-// generateFilename generates a new filename based on video properties
-func generateFilename(filePath string, sourceWidth, sourceHeight, requestedWidth, requestedHeight int) string {
-	// Use provided dimensions if available, otherwise use original dimensions
-	finalWidth := sourceWidth
-	finalHeight := sourceHeight
-
-	if requestedWidth > 0 || requestedHeight > 0 {
-		if requestedWidth > 0 && requestedHeight > 0 {
-			// Both specified - use exact dimensions
-			finalWidth = requestedWidth
-			finalHeight = requestedHeight
-		} else if requestedWidth > 0 {
-			// Only width specified - calculate height maintaining aspect ratio
-			aspectRatio := float64(sourceHeight) / float64(sourceWidth)
-			finalWidth = requestedWidth
-			finalHeight = int(float64(requestedWidth) * aspectRatio)
-		} else {
-			// Only height specified - calculate width maintaining aspect ratio
-			aspectRatio := float64(sourceWidth) / float64(sourceHeight)
-			finalHeight = requestedHeight
-			finalWidth = int(float64(requestedHeight) * aspectRatio)
-		}
-	}
-
-	maxLength := max(finalWidth, finalHeight)
-
-	var resolution string
+// outputDimensions returns the dimensions of the encoded video. Requested
+// dimensions are used if available, otherwise the source dimensions.
+func outputDimensions(sourceWidth, sourceHeight, requestedWidth, requestedHeight int) (int, int) {
 	switch {
-	case maxLength >= 3000:
-		resolution = "4K"
-	case maxLength >= 1900 && maxLength <= 2000:
-		resolution = "1080p"
-	case maxLength >= 1200 && maxLength <= 1400:
-		resolution = "720p"
+	case requestedWidth > 0 && requestedHeight > 0:
+		// Both specified - use exact dimensions
+		return requestedWidth, requestedHeight
+	case requestedWidth > 0:
+		// Only width specified - calculate height maintaining aspect ratio
+		aspectRatio := float64(sourceHeight) / float64(sourceWidth)
+		return requestedWidth, int(float64(requestedWidth) * aspectRatio)
+	case requestedHeight > 0:
+		// Only height specified - calculate width maintaining aspect ratio
+		aspectRatio := float64(sourceWidth) / float64(sourceHeight)
+		return int(float64(requestedHeight) * aspectRatio), requestedHeight
+	default:
+		return sourceWidth, sourceHeight
 	}
+}
 
-	baseName := strings.TrimSuffix(filepath.Base(filePath), filepath.Ext(filePath))
+// generateFilename generates a new filename based on video properties
+// from a --name-template, with the resolution of the output filled in
+func generateFilename(template, filePath string, sourceWidth, sourceHeight, requestedWidth, requestedHeight int, labels nameLabels) string {
+	finalWidth, finalHeight := outputDimensions(sourceWidth, sourceHeight, requestedWidth, requestedHeight)
+	labels.Resolution = resolutionLabel(finalWidth, finalHeight)
 
-	// Remove existing resolution tags
-	re := regexp.MustCompile(`\[\d+[pk]\]`)
-	newStem := strings.TrimSpace(re.ReplaceAllString(baseName, ""))
+	baseName := strings.TrimSuffix(filepath.Base(filePath), filepath.Ext(filePath))
 
-	if resolution != "" {
-		newStem = fmt.Sprintf("%s [%s, x265]", newStem, resolution)
-	} else {
-		newStem = fmt.Sprintf("%s [x265]", newStem)
-	}
+	// Remove existing tags, like those of a previous encode
+	stem := stripTags(baseName)
 
-	ext := filepath.Ext(filePath)
+	return formatFilename(template, stem, labels, filepath.Ext(filePath))
+}
 
-	return newStem + ext
+// encodeResult describes the outcome of encoding a single file
+type encodeResult struct {
+	OutputPath string
+	// Skipped is set when the file did not need encoding
+	Skipped bool
+	// InputSize is the size of the source, which may be gone with --replace
+	InputSize int64
+	// OutputSize is the size of the output, which may be gone with --upload-delete
+	OutputSize int64
+	// FPS is the average frame rate of the encode, 0 when nothing was encoded
+	FPS float64
+	// Event describes the finished job, set by runJob
+	Event notify.Event
 }
 
-func run(ctx context.Context, args cliArgs) error {
+// run encodes a single video file
+func run(ctx context.Context, args cliArgs) (encodeResult, error) {
 	log.Ctx(ctx).Debug().
 		Interface("args", args).
 		Msg("starting encoding")
 
-	absPath, err := filepath.Abs(args.VideoPath)
-	if err != nil {
-		return fmt.Errorf("failed to get absolute path: %w", err)
+	if args.pipes() {
+		return runPipe(ctx, args)
 	}
-	args.VideoPath = absPath
 
-	log.Ctx(ctx).Debug().
-		Str("resolved_path", args.VideoPath).Msg("resolved input path")
+	// yt-dlp downloads pages to a temporary file, encoded like a local one
+	fetched := args.fetchesWithYTDLP()
+	if fetched {
+		path, cleanup, err := fetchSource(ctx, args)
+		if err != nil {
+			return encodeResult{}, err
+		}
+		defer cleanup()
+		args.VideoPath = path
+	}
+
+	// URLs are read by ffmpeg, there is no local file to check
+	remote := isURL(args.VideoPath)
 
-	if _, err := os.Stat(args.VideoPath); os.IsNotExist(err) {
-		return fmt.Errorf("no such file: %s", args.VideoPath)
+	var sourceInfo os.FileInfo
+	var disc discInput
+	var isDisc bool
+	var err error
+	if !remote {
+		absPath, err := filepath.Abs(args.VideoPath)
+		if err != nil {
+			return encodeResult{}, fmt.Errorf("failed to get absolute path: %w", err)
+		}
+		args.VideoPath = absPath
+
+		log.Ctx(ctx).Debug().
+			Str("resolved_path", args.VideoPath).Msg("resolved input path")
+
+		sourceInfo, err = os.Stat(args.VideoPath)
+		if os.IsNotExist(err) {
+			return encodeResult{}, fmt.Errorf("no such file: %s", args.VideoPath)
+		}
+		if err != nil {
+			return encodeResult{}, fmt.Errorf("failed to stat video: %w", err)
+		}
+
+		disc, isDisc, err = openDisc(ctx, args)
+		if err != nil {
+			return encodeResult{}, err
+		}
+
+		if args.QuietPeriod > 0 && !isDisc {
+			if err := waitSettled(ctx, args.VideoPath, args.QuietPeriod); err != nil {
+				return encodeResult{}, err
+			}
+			// The file may have grown while waiting
+			if sourceInfo, err = os.Stat(args.VideoPath); err != nil {
+				return encodeResult{}, fmt.Errorf("failed to stat video: %w", err)
+			}
+		}
 	}
 
-	probe, err := ffmpeg.Probe(ctx, args.VideoPath)
-	if err != nil {
-		return fmt.Errorf("failed to probe video: %w", err)
+	var probe ffmpeg.ProbeResult
+	namingPath := args.VideoPath
+	// Telecine is detected on a file of the source, discs split theirs in several
+	detectInput, detectAt := args.VideoPath, time.Duration(0)
+	if isDisc {
+		probe = disc.probe()
+		args.VideoPath = disc.Root
+		args.Title = disc.Title.Index
+		namingPath = disc.namingPath()
+
+		size, largest := disc.files()
+		sourceInfo = discInfo{FileInfo: sourceInfo, size: size}
+		detectInput = largest
+		if err := args.validateTrackFlags(&probe); err != nil {
+			return encodeResult{}, err
+		}
+	} else {
+		probe, err = ffmpeg.Probe(ctx, args.VideoPath)
+		if err != nil {
+			return encodeResult{}, fmt.Errorf("failed to probe video: %w", err)
+		}
+		log.Ctx(ctx).Debug().
+			Interface("probe", probe).
+			Msg("scanned media")
+		detectAt = probe.Duration / 2
+
+		if err := args.applyLanguages(ctx, probe); err != nil {
+			return encodeResult{}, err
+		}
 	}
-	log.Ctx(ctx).Debug().
-		Interface("probe", probe).
-		Msg("scanned media")
 
+	if remote {
+		namingPath = inputName(args.VideoPath)
+		sourceInfo = urlInfo{name: namingPath, size: probe.SizeBytes}
+	}
+	// Outputs of URLs are saved to the working directory unless told otherwise
+	if (remote || fetched) && args.OutputDir == "" {
+		args.OutputDir, err = os.Getwd()
+		if err != nil {
+			return encodeResult{}, fmt.Errorf("failed to get working directory: %w", err)
+		}
+	}
 	args.OutputDir = cmp.Or(args.OutputDir, filepath.Dir(args.VideoPath))
 
 	if err := os.MkdirAll(args.OutputDir, 0755); err != nil {
-		return fmt.Errorf("failed to create output directory: %w", err)
+		return encodeResult{}, fmt.Errorf("failed to create output directory: %w", err)
 	}
 
-	outputFilename := generateFilename(args.VideoPath, probe.Width, probe.Height, args.Width, args.Height)
-	savePath := filepath.Join(args.OutputDir, outputFilename)
+	args.applySmartQuality(ctx, probe)
+	displayWidth, displayHeight := probe.DisplaySize()
+	args.applyResolutionQuality(ctx, displayWidth, displayHeight)
+	outputFilename := generateFilename(args.NameTemplate, namingPath, displayWidth, displayHeight, args.Width, args.Height, args.nameLabels(probe))
+	savePath := losslessSavePath(args, filepath.Join(args.OutputDir, outputFilename))
+	if args.Output != "" {
+		if savePath, err = filepath.Abs(args.Output); err != nil {
+			return encodeResult{}, fmt.Errorf("failed to get absolute path: %w", err)
+		}
+		if err := os.MkdirAll(filepath.Dir(savePath), 0755); err != nil {
+			return encodeResult{}, fmt.Errorf("failed to create output directory: %w", err)
+		}
+	}
 
 	// Prevent overwriting the input file
 	if args.VideoPath == savePath {
@@ -197,6 +990,10 @@ func run(ctx context.Context, args cliArgs) error {
 		Str("output_path", savePath).
 		Msg("save path for the encoded video")
 
+	if !isDisc {
+		resolveAttachments(ctx, &args, probe, savePath)
+	}
+
 	encodeDuration := args.Duration
 	if args.ToTime > 0 {
 		encodeDuration = args.ToTime - args.FromTime
@@ -205,71 +1002,650 @@ func run(ctx context.Context, args cliArgs) error {
 			Msg("duration of the encoded video")
 	}
 
+	settings := encodeSettings(args, encodeDuration)
+
+	historyPath := args.HistoryPath
+	if historyPath == "" {
+		historyPath, err = history.DefaultPath()
+		if err != nil {
+			return encodeResult{}, err
+		}
+	}
+
+	db, err := history.Open(historyPath)
+	if err != nil {
+		return encodeResult{}, err
+	}
+
+	var hash string
+	switch {
+	case isDisc:
+		hash, err = disc.hash()
+	case remote:
+		hash = hashURL(args.VideoPath, probe.SizeBytes)
+	default:
+		hash, err = history.HashFile(args.VideoPath)
+	}
+	if err != nil {
+		return encodeResult{}, fmt.Errorf("failed to hash source: %w", err)
+	}
+
+	if detectInput != "" {
+		args.Detelecine = resolveDetelecine(ctx, args, probe.FPS, detectInput, detectAt)
+	}
+
+	args.GPU = resolveGPU(ctx, args)
+
+	if len(args.Renditions) > 0 {
+		return runRenditions(ctx, args, probe, sourceInfo, db, hash, encodeDuration)
+	}
+
+	// Outputs carry their settings, which survives moving them out of reach of the history
+	if prev, ok := history.FindTag(probe.Tags); ok && prev.Covers(settings) && !args.Force {
+		log.Ctx(ctx).Info().
+			Interface("settings", prev).
+			Msg("already an encz output with equal or better settings, skipping (use --force to re-encode)")
+		return encodeResult{OutputPath: args.VideoPath, Skipped: true, InputSize: sourceInfo.Size()}, nil
+	}
+
+	if rec, ok := db.FindCovering(hash, settings); ok && !args.Force {
+		log.Ctx(ctx).Info().
+			Str("previous_output", rec.OutputPath).
+			Time("encoded_at", rec.EncodedAt).
+			Msg("already encoded with equal or better settings, skipping (use --force to re-encode)")
+		return encodeResult{OutputPath: rec.OutputPath, Skipped: true, InputSize: sourceInfo.Size()}, nil
+	}
+
+	// FFmpeg can't read the streams of a disc to decode them
+	if args.Precheck && !isDisc {
+		if err := precheckSource(ctx, args, probe, encodeDuration); err != nil {
+			return encodeResult{}, err
+		}
+	}
+
+	warnLosslessSize(ctx, args, probe, sourceInfo.Size(), encodeDuration)
+
+	if args.Estimate {
+		proceed, err := confirmEstimate(ctx, args, probe, sourceInfo.Size(), encodeDuration)
+		if err != nil {
+			return encodeResult{}, err
+		}
+		if !proceed {
+			log.Ctx(ctx).Info().Msg("not encoding after the size estimate")
+			return encodeResult{Skipped: true, InputSize: sourceInfo.Size()}, nil
+		}
+	}
+
+	encodeStart, pausedBefore := time.Now(), proc.PausedTime()
+	args, err = encodeWithFallback(ctx, args, probe, savePath, encodeDuration)
+	if err != nil {
+		return encodeResult{}, encoderError{err}
+	}
+	// Paused time isn't spent encoding
+	encodeElapsed := time.Since(encodeStart) - (proc.PausedTime() - pausedBefore)
+	// The history records the encoder that produced the output
+	settings = encodeSettings(args, encodeDuration)
+
+	// FFmpeg can't read the streams of a disc to compare them
+	if args.AudioCopy && !isDisc {
+		if err := verifyAudioCopy(ctx, args, probe, savePath, encodeDuration, false); err != nil {
+			return encodeResult{}, err
+		}
+	}
+
+	width, height := outputDimensions(displayWidth, displayHeight, args.Width, args.Height)
+	writeStills(ctx, args, savePath, width, height, cmp.Or(encodeDuration, probe.Duration-args.FromTime))
+	if !remote {
+		preserveAttributes(ctx, args, savePath)
+	}
+
+	result := encodeResult{OutputPath: savePath, InputSize: sourceInfo.Size()}
+	if encodeElapsed > 0 {
+		frames := cmp.Or(encodeDuration, probe.Duration-args.FromTime).Seconds() * probe.FPS
+		result.FPS = frames / encodeElapsed.Seconds()
+	}
+	if info, err := os.Stat(savePath); err == nil {
+		result.OutputSize = info.Size()
+	}
+	if err := uploadOutput(ctx, args, savePath); err != nil {
+		return encodeResult{}, err
+	}
+	result.OutputPath = outputLocation(args, savePath)
+
+	// Recorded once uploaded, so a failed upload is tried again by the next run
+	err = db.Add(history.Record{
+		Hash:       hash,
+		SourcePath: args.VideoPath,
+		OutputPath: result.OutputPath,
+		Settings:   settings,
+		EncodedAt:  time.Now(),
+	})
+	if err != nil {
+		return encodeResult{}, err
+	}
+
+	if args.Replace {
+		if err := os.Remove(args.VideoPath); err != nil {
+			return encodeResult{}, fmt.Errorf("failed to delete original: %w", err)
+		}
+		log.Ctx(ctx).Info().Str("file", args.VideoPath).Msg("deleted original")
+	}
+
+	return result, nil
+}
+
+// encodeSettings returns the history settings of an encode
+func encodeSettings(args cliArgs, encodeDuration time.Duration) history.Settings {
+	return history.Settings{
+		Encoder:      args.Encoder,
+		VideoEncoder: args.VideoEncoder,
+		Quality:      args.Quality,
+		Is10Bit:      args.Is10Bit,
+		Width:        args.Width,
+		Height:       args.Height,
+		FromTime:     args.FromTime,
+		Duration:     encodeDuration,
+		Lossless:     args.Lossless,
+	}
+}
+
+// verifyAudioCopy checks that stream-copied audio in the output is bit-identical to the source
+func verifyAudioCopy(ctx context.Context, args cliArgs, probe ffmpeg.ProbeResult, savePath string, encodeDuration time.Duration, renditions bool) error {
+	if args.FromTime > 0 || encodeDuration > 0 {
+		log.Ctx(ctx).Debug().Msg("skipping audio verification for trimmed encode")
+		return nil
+	}
+
+	sourceHashes, err := ffmpeg.AudioStreamHashes(ctx, args.VideoPath)
+	if err != nil {
+		return err
+	}
+	outputHashes, err := ffmpeg.AudioStreamHashes(ctx, savePath)
+	if err != nil {
+		return err
+	}
+
+	// Only the tracks kept in the output are compared
+	var kept []string
+	for _, i := range keptAudioTracks(args, probe, renditions) {
+		if i < len(sourceHashes) {
+			kept = append(kept, sourceHashes[i])
+		}
+	}
+	if len(outputHashes) != len(kept) {
+		return fmt.Errorf("audio passthrough verification failed: %s has %d audio tracks, expected %d", savePath, len(outputHashes), len(kept))
+	}
+	if !slices.Equal(kept, outputHashes) {
+		return fmt.Errorf("audio passthrough verification failed: output audio differs from source in %s", savePath)
+	}
+
+	log.Ctx(ctx).Debug().
+		Int("streams", len(outputHashes)).
+		Msg("verified audio passthrough")
+	return nil
+}
+
+// encode runs the selected encoder engine
+func encode(ctx context.Context, args cliArgs, probe ffmpeg.ProbeResult, savePath string, encodeDuration time.Duration) error {
+	ctx, cancel := context.WithCancelCause(ctx)
+	defer cancel(nil)
+
+	// The guard only makes sense for hardware encoders, software encoders
+	// don't suffer from bitrate collapse
+	guardMode := args.BitrateGuard
+	if args.Encoder == "ffmpeg" && ffmpeg.IsSoftwareEncoder(args.VideoEncoder) ||
+		args.Encoder != "ffmpeg" && !handbrake.IsHardwareEncoder(args.VideoEncoder) {
+		guardMode = "off"
+	}
+
+	displayWidth, displayHeight := probe.DisplaySize()
+	width, height := outputDimensions(displayWidth, displayHeight, args.Width, args.Height)
+	higherIsBetter := handbrake.QualityHigherIsBetter(args.VideoEncoder)
 	if args.Encoder == "ffmpeg" {
-		params := ffmpeg.EncodeParams{
-			InputPath:  args.VideoPath,
-			OutputPath: savePath,
-			Quality:    args.Quality,
-			Is10Bit:    args.Is10Bit,
-			FromTime:   args.FromTime,
-			Duration:   encodeDuration,
-			Width:      args.Width,
-			Height:     args.Height,
-			ExtraArgs:  args.ExtraArgs,
-		}
-
-		return ffmpeg.Encode(ctx, params, func(p ffmpeg.EncodeProgress) {
-			fmt.Printf("\r%s", p.String())
+		higherIsBetter = ffmpeg.QualityHigherIsBetter(args.VideoEncoder)
+	}
+	guard := newBitrateGuard(guardMode, width, height, args.Quality, higherIsBetter, cancel)
+
+	if args.Timeout > 0 {
+		go cancelAfter(ctx, args.Timeout, cancel)
+	}
+
+	bars := progressViewFrom(ctx)
+	defer bars.Finish()
+
+	meta := metadataOptions(args, probe, encodeSettings(args, encodeDuration))
+	run := func(args cliArgs) error {
+		if args.Encoder == "ffmpeg" {
+			return encodeFFmpeg(ctx, args, probe, savePath, encodeDuration, meta, guard, bars)
+		}
+		mediaDuration := cmp.Or(encodeDuration, probe.Duration-args.FromTime)
+		return encodeHandbrake(ctx, args, probe, savePath, encodeDuration, mediaDuration, meta, guard, bars)
+	}
+
+	err := run(args)
+	// Hardware decoders reject some profiles and break on damaged streams.
+	// Streams from stdin can't be read again.
+	if err != nil && args.HWDecode && ctx.Err() == nil && args.VideoPath != pipePath {
+		log.Ctx(ctx).Warn().Err(err).Msg("hardware decoding failed, retrying with software decoding")
+		args.HWDecode = false
+		err = run(args)
+	}
+
+	cause := context.Cause(ctx)
+	if errors.Is(cause, errTimedOut) {
+		return timeoutError(ctx, args.Timeout, savePath)
+	}
+	if errors.Is(cause, errBitrateCollapsed) {
+		return cause
+	}
+	// Stopped by the user, or the file was skipped
+	if err != nil && ctx.Err() != nil {
+		removePartialOutputs(ctx, savePath)
+	}
+	return err
+}
+
+// encodeFFmpeg encodes using the ffmpeg engine
+func encodeFFmpeg(ctx context.Context, args cliArgs, probe ffmpeg.ProbeResult, savePath string, encodeDuration time.Duration, meta ffmpeg.MetadataOptions, guard *bitrateGuard, bars progressView) error {
+	params := ffmpeg.EncodeParams{
+		InputPath:  args.VideoPath,
+		OutputPath: savePath,
+		Quality:    args.Quality,
+		Is10Bit:    args.Is10Bit,
+		FromTime:   args.FromTime,
+		Duration:   encodeDuration,
+		Width:      args.Width,
+		Height:     args.Height,
+		ExtraArgs:  args.ExtraArgs,
+		AudioCopy:  args.AudioCopy,
+
+		VideoEncoder: args.VideoEncoder,
+		LogOutput:    jobLogFrom(ctx),
+		Threads:      args.Threads,
+		AccurateSeek: args.AccurateSeek,
+		InputArgs:    args.FFInputArgs,
+		OutputArgs:   args.FFOutputArgs,
+		VideoFilters: args.VideoFilters,
+		Metadata:     meta,
+		SampleAR:     probe.SampleAR,
+		HWDecode:     args.HWDecode,
+		GPU:          args.GPU,
+		Detelecine:   args.Detelecine == "on",
+		Grain:        args.Grain,
+		Stabilize:    args.Stabilize,
+		Watermark:    args.watermark(),
+		VideoTrack:   args.Streams.VideoTrack,
+		Audio:        ffmpeg.Tracks(args.Streams.Audio),
+		Subtitles:    ffmpeg.Tracks(args.Streams.Subtitles),
+		Attachments:  args.Streams.Attachments,
+		Lossless:     args.Lossless,
+		X265Params:   args.X265Params,
+		Tune:         args.encoderTune(),
+	}
+	if args.VideoPath == pipePath {
+		params.InputPath, params.Stdin, params.InputDuration = "pipe:0", os.Stdin, args.InputDuration
+	}
+	if savePath == pipePath {
+		params.OutputPath, params.Stdout = "pipe:1", os.Stdout
+		params.OutputArgs = append([]string{"-f", args.PipeFormat}, params.OutputArgs...)
+	}
+	if !args.AudioCopy {
+		var err error
+		params.AudioEncoder, params.AudioTracks, err = ffmpegAudio(ctx, args, probe, savePath, false)
+		if err != nil {
+			return err
+		}
+	}
+
+	if pixFmt := ffmpeg.PixelFormat(args.VideoEncoder, args.Is10Bit); pixFmt != "" && pixFmt != probe.PixFmt {
+		log.Ctx(ctx).Debug().
+			Str("source", probe.PixFmt).
+			Str("encoder", pixFmt).
+			Msg("converting pixel format")
+	}
+
+	label := filepath.Base(inputName(args.VideoPath))
+	var eta progress.ETA
+	usage := startUsageMonitor(ctx, args)
+	defer usage.stop(ctx)
+	onProgress := func(p ffmpeg.EncodeProgress) {
+		bars.Update(progress.Status{
+			Label:       label,
+			Phase:       p.Phase,
+			Percent:     p.Percent,
+			FPS:         p.FPSAvg,
+			ETA:         eta.Update(p.Percent, p.ETA),
+			EncodedMB:   p.EncodedMB(),
+			EstimatedMB: p.EstimatedMB(),
+			Usage:       usage.latest(),
 		})
-	} else {
-		params := handbrake.EncodeParams{
-			InputPath:  args.VideoPath,
-			OutputPath: savePath,
-			Quality:    args.Quality,
-			Is10Bit:    args.Is10Bit,
-			FromTime:   args.FromTime,
-			Duration:   encodeDuration,
-			Denoise:    args.Denoise,
-			Width:      args.Width,
-			Height:     args.Height,
-			ExtraArgs:  args.ExtraArgs,
-		}
-
-		return handbrake.Encode(ctx, params, func(p handbrake.EncodeProgress) {
-			fmt.Printf("\r%s", p.String())
+		guard.check(ctx, p.OutTime, p.CurrentSize)
+	}
+
+	if args.Chunked {
+		chunks := ffmpeg.ChunkParams{
+			ChunkDuration: args.ChunkDuration,
+			OnChunkProgress: func(p ffmpeg.ChunkProgress) {
+				chunkLabel := fmt.Sprintf("  chunk %d/%d (%s)", p.Index+1, p.Count, p.Worker)
+				if p.Done {
+					bars.Remove(chunkLabel)
+					return
+				}
+				// Chunks are cut at the first keyframe after the target duration
+				bars.Update(progress.Status{
+					Label:   chunkLabel,
+					Percent: min(99, float64(p.OutTime)/float64(args.ChunkDuration)*100),
+					FPS:     p.FPS,
+				})
+			},
+		}
+
+		// Joining the chunks maps the audio, it keeps the track FFmpeg picks otherwise
+		if params.Audio.IsDefault() && len(probe.AudioChannels) > 0 {
+			params.Audio.Indices = []int{bestAudio(probe)}
+		}
+
+		// Devices replace the local software encoder slots
+		if len(args.Devices) == 0 {
+			chunks.Workers = append(chunks.Workers, ffmpeg.Worker{
+				Slots: cmp.Or(args.ChunkWorkers, ffmpeg.DefaultChunkWorkers()),
+			})
+		}
+		for _, spec := range args.Devices {
+			worker, err := ffmpeg.ParseDevice(spec)
+			if err != nil {
+				return err
+			}
+			chunks.Workers = append(chunks.Workers, worker)
+		}
+		for _, addr := range args.RemoteWorkers {
+			worker, err := ffmpeg.ParseWorker(addr)
+			if err != nil {
+				return err
+			}
+			chunks.Workers = append(chunks.Workers, worker)
+		}
+		return ffmpeg.EncodeChunked(ctx, params, chunks, onProgress)
+	}
+
+	return ffmpeg.Encode(ctx, params, onProgress)
+}
+
+// validateDevices checks the --devices of a chunked encode. Chunks are joined
+// without re-encoding, which only works when they all come from one encoder:
+// the output carries the parameter sets of the first chunk, and encoders rate
+// the same quality differently.
+func validateDevices(devices, remoteWorkers []string) error {
+	var encoder string
+	for _, spec := range devices {
+		device, err := ffmpeg.ParseDevice(spec)
+		if err != nil {
+			return err
+		}
+		if encoder != "" && device.VideoEncoder != encoder {
+			return fmt.Errorf("--devices must all use the same encoder, chunks of %s and %s can't be joined", encoder, device.VideoEncoder)
+		}
+		encoder = device.VideoEncoder
+	}
+	if encoder != "" && len(remoteWorkers) > 0 {
+		return fmt.Errorf("--devices cannot be combined with --remote-workers, which encode with --video-encoder rather than %s", encoder)
+	}
+	return nil
+}
+
+// encodeHandbrake encodes using the HandBrake engine. mediaDuration is the
+// length of the encoded segment, used to judge the realized bitrate.
+func encodeHandbrake(ctx context.Context, args cliArgs, probe ffmpeg.ProbeResult, savePath string, encodeDuration, mediaDuration time.Duration, meta ffmpeg.MetadataOptions, guard *bitrateGuard, bars progressView) error {
+	params := handbrake.EncodeParams{
+		InputPath:  args.VideoPath,
+		OutputPath: savePath,
+		Quality:    args.Quality,
+		Is10Bit:    args.Is10Bit,
+		FromTime:   args.FromTime,
+		Duration:   handbrakeDuration(args.FromTime, encodeDuration, mediaDuration),
+		Denoise:    args.Denoise,
+		Width:      args.Width,
+		Height:     args.Height,
+		ExtraArgs:  args.ExtraArgs,
+		AudioCopy:  args.AudioCopy,
+		Verbosity:  args.HandbrakeVerbosity,
+		Threads:    args.Threads,
+
+		VideoEncoder: args.VideoEncoder,
+		AccurateSeek: args.AccurateSeek,
+		FPS:          probe.FPS,
+
+		StripMetadata: args.StripMetadata,
+		SampleAR:      probe.SampleAR,
+		HWDecode:      args.HWDecode,
+		Detelecine:    args.Detelecine == "on",
+		GPU:           args.GPU,
+		Grain:         args.Grain,
+		Title:         args.Title,
+		Audio:         handbrake.Tracks(args.Streams.Audio),
+		Subtitles:     handbrake.Tracks(args.Streams.Subtitles),
+		Lossless:      args.Lossless,
+	}
+	params.EncoderOptions = args.handbrakeOptions()
+	params.Tune = args.encoderTune()
+
+	var delays []time.Duration
+	if !args.AudioCopy {
+		params.AudioCodec = audioCodec(args, savePath, true)
+		params.AudioTracks, delays = handbrakeAudio(args, probe, params.AudioCodec)
+		params.AudioGain = args.AudioGain
+	}
+
+	// FFmpeg can't read the metadata of a disc, the encode's is kept
+	metadataSource := args.VideoPath
+	if _, ok := handbrake.DiscRoot(args.VideoPath); ok {
+		metadataSource = ""
+	}
+
+	var eta progress.ETA
+	usage := startUsageMonitor(ctx, args)
+	defer usage.stop(ctx)
+	onProgress := func(p handbrake.EncodeProgress) {
+		bars.Update(progress.Status{
+			Label:       filepath.Base(args.VideoPath),
+			Phase:       p.Phase,
+			Percent:     p.Percent,
+			FPS:         p.FPSAvg,
+			ETA:         eta.Update(p.Percent, p.ETA),
+			EncodedMB:   p.EncodedMB(),
+			EstimatedMB: p.EstimatedMB(),
+			Usage:       usage.latest(),
 		})
+		encoded := time.Duration(float64(mediaDuration) * p.Percent / 100)
+		guard.check(ctx, encoded, p.CurrentSize)
 	}
+
+	// The job log already keeps HandBrake's log
+	if jobLog := jobLogFrom(ctx); jobLog != nil && args.HandbrakeLog == "" {
+		params.LogOutput = jobLog
+		if err := handbrake.Encode(ctx, params, onProgress); err != nil {
+			return err
+		}
+		return ffmpeg.ApplyMetadata(ctx, metadataSource, savePath, meta, delays)
+	}
+
+	logFile, err := createHandbrakeLog(args.HandbrakeLog)
+	if err != nil {
+		return fmt.Errorf("failed to create handbrake log: %w", err)
+	}
+	params.LogOutput = logFile
+
+	err = handbrake.Encode(ctx, params, onProgress)
+	logFile.Close()
+	if err != nil {
+		log.Ctx(ctx).Error().
+			Str("log_path", logFile.Name()).
+			Msg("handbrake log saved for diagnostics")
+		return err
+	}
+
+	// Temporary logs are only worth keeping for failed encodes
+	if args.HandbrakeLog == "" {
+		_ = os.Remove(logFile.Name())
+	}
+
+	// HandBrake only copies a few common tags and never the creation date
+	return ffmpeg.ApplyMetadata(ctx, metadataSource, savePath, meta, delays)
 }
 
-func main() {
-	args := parseArgs()
+// preserveAttributes copies the dates and extended attributes of the source to an
+// output. Failures are logged rather than failing the encode.
+func preserveAttributes(ctx context.Context, args cliArgs, savePath string) {
+	if args.PreserveXattrs {
+		if err := fileattr.CopyXattrs(args.VideoPath, savePath); err != nil {
+			log.Ctx(ctx).Warn().Err(err).Msg("failed to copy extended attributes")
+		}
+	}
+	// Last, since writing attributes can change the modification time
+	if args.PreserveTimes {
+		if err := fileattr.CopyTimes(args.VideoPath, savePath); err != nil {
+			log.Ctx(ctx).Warn().Err(err).Msg("failed to copy file times")
+		}
+	}
+}
+
+// metadataOptions returns the metadata copied from the source to outputs, along
+// with the settings tag recognizing them as encz outputs in later runs
+func metadataOptions(args cliArgs, probe ffmpeg.ProbeResult, settings history.Settings) ffmpeg.MetadataOptions {
+	meta := ffmpeg.MetadataOptions{
+		Strip: args.StripMetadata,
+		Set:   []string{history.TagKey + "=" + settings.Tag(version)},
+	}
+	if !args.NoTitle {
+		displayWidth, displayHeight := probe.DisplaySize()
+		width, height := outputDimensions(displayWidth, displayHeight, args.Width, args.Height)
+		meta.Title = formatTitle(args.TitleTemplate, inputName(args.VideoPath), probe, width, height)
+	}
+	if args.StripPrivateMetadata {
+		meta.Remove = ffmpeg.PrivateTags(probe.Tags)
+	}
+	meta.Dispositions = dispositions(args, probe)
+	return meta
+}
+
+// handbrakeDuration returns the --stop-at duration. Without one HandBrake
+// measures progress against the whole source even when starting later, so the
+// rest of the source is given explicitly. A second is added since probed
+// durations are truncated, HandBrake stops at the end of the source anyway.
+func handbrakeDuration(from, encodeDuration, mediaDuration time.Duration) time.Duration {
+	if encodeDuration > 0 || from == 0 {
+		return encodeDuration
+	}
+	return mediaDuration + time.Second
+}
+
+// createHandbrakeLog opens the file receiving HandBrake's detailed log.
+// Without an explicit path a temporary file is used instead.
+func createHandbrakeLog(path string) (*os.File, error) {
+	if path != "" {
+		return os.Create(path)
+	}
+	return os.CreateTemp("", "encz-handbrake-*.log")
+}
 
-	level := zerolog.InfoLevel
-	if args.Debug {
-		level = zerolog.DebugLevel
+// exitOnError logs err and exits with its exit code
+func exitOnError(ctx context.Context, err error) {
+	if err == nil {
+		return
 	}
+	code := exitCode(ctx, err)
+	if code == exitCancelled {
+		log.Ctx(ctx).Info().Msg("encoding cancelled by user")
+		os.Exit(code)
+	}
+	log.Ctx(ctx).WithLevel(zerolog.FatalLevel).Err(err).Msg("encoding failed")
+	os.Exit(code)
+}
 
-	log.Logger = log.Output(zerolog.ConsoleWriter{Out: os.Stderr, TimeFormat: time.DateTime}).Level(level)
-	zerolog.DefaultContextLogger = &log.Logger
+func main() {
+	if len(os.Args) > 1 {
+		switch os.Args[1] {
+		case "library":
+			libraryMain(os.Args[2:])
+			return
+		case "init":
+			initMain(os.Args[2:])
+			return
+		case "arr":
+			arrMain(os.Args[2:])
+			return
+		case "doctor":
+			doctorMain(os.Args[2:])
+			return
+		case "version":
+			versionMain(os.Args[2:])
+			return
+		case "preview":
+			previewMain(os.Args[2:])
+			return
+		case "compare":
+			compareMain(os.Args[2:])
+			return
+		case "crf-test":
+			crfTestMain(os.Args[2:])
+			return
+		case "bench":
+			benchMain(os.Args[2:])
+			return
+		case "scan":
+			scanMain(os.Args[2:])
+			return
+		case "control":
+			controlMain(os.Args[2:])
+			return
+		case "serve":
+			serveMain(os.Args[2:])
+			return
+		}
+	}
 
-	ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	args := parseArgs(flag.CommandLine, os.Args[1:])
+	if err := setupLogging(args); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+
+	ctx, cancel := interruptContext()
 	defer cancel()
+	watchPauseSignals(ctx)
+	watchStatusSignal(ctx)
+
+	// Outputs written to stdout leave it to the video
+	summaryOut := os.Stdout
+	if args.Output == pipePath {
+		summaryOut = os.Stderr
+		ctx = withProgressView(ctx, progress.New(os.Stderr))
+	}
+	if args.unattended() {
+		ctx = withProgressView(ctx, discardView{})
+	}
 
 	if err := args.Validate(); err != nil {
-		log.Ctx(ctx).Fatal().Err(err).Send()
-		return
+		exitInvalid(ctx, err)
 	}
 
 	if args.Version {
-		fmt.Println(version)
+		printVersion(os.Stdout)
 		os.Exit(0)
 	}
 
-	if err := run(ctx, args); err != nil {
-		if errors.Is(err, context.Canceled) {
-			log.Ctx(ctx).Info().Msg("encoding cancelled by user")
-			os.Exit(1)
-		}
-		log.Ctx(ctx).Fatal().Err(err).Msg("encoding failed")
+	checkPreflight(ctx, args)
+
+	if args.ListTitles {
+		exitOnError(ctx, listTitles(ctx, os.Stdout, args.VideoPath))
+		return
+	}
+
+	defer acquireLock(ctx, args)()
+
+	result, err := runJob(ctx, args)
+	if args.unattended() || useColor(summaryOut) {
+		printJobSummary(summaryOut, result.Event, useColor(summaryOut))
 	}
+	exitOnError(ctx, err)
 }
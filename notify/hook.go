@@ -0,0 +1,81 @@
+package notify
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"runtime"
+	"strconv"
+	"strings"
+
+	"encz/proc"
+)
+
+// Status returns the outcome of the job: started, encoded, skipped or failed
+func (e Event) Status() string {
+	switch {
+	case e.Type == EventStart:
+		return "started"
+	case e.Type == EventFailure:
+		return "failed"
+	case e.Skipped:
+		return "skipped"
+	default:
+		return "encoded"
+	}
+}
+
+// Hook runs command through the system shell. Placeholders such as {input}
+// are replaced with shell-quoted values, which are also available as ENCZ_*
+// environment variables.
+func Hook(ctx context.Context, command string, event Event) error {
+	vars := hookVars(event)
+
+	pairs := make([]string, 0, 2*len(vars))
+	env := os.Environ()
+	for _, v := range vars {
+		pairs = append(pairs, "{"+v.name+"}", shellQuote(v.value))
+		env = append(env, "ENCZ_"+strings.ToUpper(v.name)+"="+v.value)
+	}
+
+	cmd := shellCommand(ctx, strings.NewReplacer(pairs...).Replace(command))
+	cmd.Env = env
+	cmd.Stdout = os.Stderr
+	cmd.Stderr = os.Stderr
+
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("hook %q failed: %w", command, err)
+	}
+	return nil
+}
+
+type hookVar struct {
+	name  string
+	value string
+}
+
+// hookVars returns the values exposed to hook commands
+func hookVars(e Event) []hookVar {
+	return []hookVar{
+		{"input", e.InputPath},
+		{"output", e.OutputPath},
+		{"status", e.Status()},
+		{"encoder", e.Encoder},
+		{"video_encoder", e.VideoEncoder},
+		{"quality", strconv.FormatFloat(e.Quality, 'f', -1, 64)},
+		{"input_size", strconv.FormatInt(e.InputSize, 10)},
+		{"output_size", strconv.FormatInt(e.OutputSize, 10)},
+		{"saved_bytes", strconv.FormatInt(e.SavedBytes, 10)},
+		{"saved_percent", strconv.FormatFloat(e.SavedPercent, 'f', -1, 64)},
+		{"elapsed", strconv.FormatFloat(e.ElapsedSeconds, 'f', 1, 64)},
+		{"error", e.Error},
+	}
+}
+
+// shellQuote quotes s as a single argument for the system shell
+func shellQuote(s string) string {
+	if runtime.GOOS == "windows" {
+		return `"` + strings.ReplaceAll(s, `"`, `""`) + `"`
+	}
+	return proc.ShellQuote(s)
+}
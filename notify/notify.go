@@ -0,0 +1,70 @@
+package notify
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"runtime"
+	"time"
+)
+
+// EventType identifies a point in the lifecycle of an encode job
+type EventType string
+
+const (
+	EventStart    EventType = "start"
+	EventComplete EventType = "complete"
+	EventFailure  EventType = "failure"
+)
+
+// Event describes an encode job at a point in its lifecycle
+type Event struct {
+	Type         EventType `json:"event"`
+	Time         time.Time `json:"time"`
+	InputPath    string    `json:"input_path"`
+	OutputPath   string    `json:"output_path,omitempty"`
+	Encoder      string    `json:"encoder"`
+	VideoEncoder string    `json:"video_encoder,omitempty"`
+	Quality      float64   `json:"quality"`
+	Is10Bit      bool      `json:"is_10bit"`
+	Skipped      bool      `json:"skipped,omitempty"`
+	InputSize    int64     `json:"input_size,omitempty"`
+	OutputSize   int64     `json:"output_size,omitempty"`
+	SavedBytes   int64     `json:"saved_bytes,omitempty"`
+	SavedPercent float64   `json:"saved_percent,omitempty"`
+	// ElapsedSeconds is the wall time spent on the job
+	ElapsedSeconds float64 `json:"elapsed_seconds,omitempty"`
+	Error          string  `json:"error,omitempty"`
+	// LogPath is the job's log file when logging to a directory
+	LogPath string `json:"log_path,omitempty"`
+}
+
+// Exec runs command through the system shell with the JSON encoded event on
+// stdin, for integration with macOS Shortcuts, Hazel and similar tools
+func Exec(ctx context.Context, command string, event Event) error {
+	payload, err := json.Marshal(event)
+	if err != nil {
+		return fmt.Errorf("failed to encode event: %w", err)
+	}
+
+	cmd := shellCommand(ctx, command)
+	cmd.Stdin = bytes.NewReader(payload)
+	cmd.Stdout = os.Stderr
+	cmd.Stderr = os.Stderr
+
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("command %q failed: %w", command, err)
+	}
+	return nil
+}
+
+// shellCommand returns a command running command through the system shell
+func shellCommand(ctx context.Context, command string) *exec.Cmd {
+	if runtime.GOOS == "windows" {
+		return exec.CommandContext(ctx, "cmd", "/C", command)
+	}
+	return exec.CommandContext(ctx, "sh", "-c", command)
+}
@@ -0,0 +1,114 @@
+package notify
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"path/filepath"
+	"slices"
+	"time"
+)
+
+// Webhook payload formats
+const (
+	FormatJSON    = "json"
+	FormatDiscord = "discord"
+	FormatSlack   = "slack"
+)
+
+// webhookTimeout bounds a single webhook delivery
+const webhookTimeout = 10 * time.Second
+
+// Webhook is an HTTP endpoint notified of job events
+type Webhook struct {
+	URL string `yaml:"url"`
+	// Format is the payload format: json (the event itself), discord or slack
+	Format string `yaml:"format"`
+	// Events limits the notified events, all events when empty
+	Events []EventType `yaml:"events"`
+}
+
+// Validate checks the webhook configuration
+func (w Webhook) Validate() error {
+	if w.URL == "" {
+		return fmt.Errorf("webhook url is required")
+	}
+	switch w.Format {
+	case "", FormatJSON, FormatDiscord, FormatSlack:
+	default:
+		return fmt.Errorf("invalid webhook format %q: expected json, discord or slack", w.Format)
+	}
+	for _, event := range w.Events {
+		switch event {
+		case EventStart, EventComplete, EventFailure:
+		default:
+			return fmt.Errorf("invalid webhook event %q: expected start, complete or failure", event)
+		}
+	}
+	return nil
+}
+
+// Wants reports whether the webhook is notified of events of type t
+func (w Webhook) Wants(t EventType) bool {
+	return len(w.Events) == 0 || slices.Contains(w.Events, t)
+}
+
+// Send posts event to the webhook
+func (w Webhook) Send(ctx context.Context, event Event) error {
+	var payload any = event
+	switch w.Format {
+	case FormatDiscord:
+		payload = map[string]string{"content": event.Summary()}
+	case FormatSlack:
+		payload = map[string]string{"text": event.Summary()}
+	}
+
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return fmt.Errorf("failed to encode event: %w", err)
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, webhookTimeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, w.URL, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("failed to create webhook request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to send webhook: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("webhook returned %s", resp.Status)
+	}
+	return nil
+}
+
+// Summary returns a one-line human readable description of the event
+func (e Event) Summary() string {
+	name := filepath.Base(e.InputPath)
+	settings := fmt.Sprintf("%s, quality %g", e.Encoder, e.Quality)
+	if e.VideoEncoder != "" {
+		settings = fmt.Sprintf("%s/%s, quality %g", e.Encoder, e.VideoEncoder, e.Quality)
+	}
+	elapsed := time.Duration(e.ElapsedSeconds * float64(time.Second)).Round(time.Second)
+
+	switch {
+	case e.Type == EventStart:
+		return fmt.Sprintf("Encoding %s (%s)", name, settings)
+	case e.Type == EventFailure:
+		return fmt.Sprintf("Failed to encode %s after %s: %s", name, elapsed, e.Error)
+	case e.Skipped:
+		return fmt.Sprintf("Skipped %s, already encoded", name)
+	default:
+		return fmt.Sprintf("Encoded %s in %s (%s), saved %.1f%% (%.1f MB)",
+			name, elapsed, settings, e.SavedPercent, float64(e.SavedBytes)/(1<<20))
+	}
+}
@@ -0,0 +1,70 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// passthroughRule sets how the audio tracks of a codec are kept in outputs
+type passthroughRule struct {
+	// Codec is the codec of the source track as ffprobe names it, e.g. truehd
+	Codec string
+	// Container is the output container the rule applies to, mkv or mp4, or
+	// empty for both
+	Container string
+	// Copy passes the track through, otherwise it's transcoded to Target at
+	// Bitrate kbps, 0 for the default of its channels
+	Copy    bool
+	Target  string
+	Bitrate int
+}
+
+// parsePassthroughRule parses CODEC[@CONTAINER]=ACTION, where ACTION is copy
+// or a codec with an optional bitrate, e.g. truehd@mkv=copy or dts@mp4=eac3:640
+func parsePassthroughRule(s string) (passthroughRule, error) {
+	match, action, ok := strings.Cut(s, "=")
+	if !ok {
+		return passthroughRule{}, fmt.Errorf("invalid audio passthrough %q: expected CODEC[@CONTAINER]=copy|CODEC[:KBPS]", s)
+	}
+
+	var rule passthroughRule
+	rule.Codec, rule.Container, _ = strings.Cut(strings.ToLower(match), "@")
+	switch rule.Container {
+	case "", "mkv", "mp4":
+	default:
+		return passthroughRule{}, fmt.Errorf("invalid audio passthrough %q: container must be mkv or mp4", s)
+	}
+	if rule.Codec == "" {
+		return passthroughRule{}, fmt.Errorf("invalid audio passthrough %q: missing source codec", s)
+	}
+
+	if action == "copy" {
+		rule.Copy = true
+		return rule, nil
+	}
+	target, bitrate, hasBitrate := strings.Cut(action, ":")
+	if _, ok := audioBitrates[target]; !ok {
+		return passthroughRule{}, fmt.Errorf("invalid audio passthrough %q: expected copy, aac, opus, ac3 or eac3", s)
+	}
+	rule.Target = target
+	if hasBitrate {
+		kbps, err := strconv.Atoi(bitrate)
+		if err != nil || kbps <= 0 {
+			return passthroughRule{}, fmt.Errorf("invalid audio passthrough %q: bitrate must be a positive number of kbps", s)
+		}
+		rule.Bitrate = kbps
+	}
+	return rule, nil
+}
+
+// passthroughRule returns the first rule for source tracks of codec in
+// outputs of container
+func (c *cliArgs) passthroughRule(codec, container string) (passthroughRule, bool) {
+	for _, rule := range c.AudioPassthrough {
+		if rule.Codec == codec && (rule.Container == "" || rule.Container == container) {
+			return rule, true
+		}
+	}
+	return passthroughRule{}, false
+}
@@ -0,0 +1,66 @@
+package main
+
+import (
+	"context"
+	"time"
+
+	"github.com/rs/zerolog/log"
+
+	"encz/proc"
+)
+
+// setPaused pauses or resumes the running encoder processes
+func setPaused(ctx context.Context, pause bool) {
+	if pause {
+		if err := proc.Pause(); err != nil {
+			log.Ctx(ctx).Warn().Err(err).Msg("failed to pause encoding")
+			return
+		}
+		log.Ctx(ctx).Info().Msg("encoding paused")
+		return
+	}
+
+	if err := proc.Resume(); err != nil {
+		log.Ctx(ctx).Warn().Err(err).Msg("failed to resume encoding")
+		return
+	}
+	log.Ctx(ctx).Info().Msg("encoding resumed")
+}
+
+// togglePause pauses running encoders, or resumes them when already paused
+func togglePause(ctx context.Context) {
+	setPaused(ctx, !proc.Paused())
+}
+
+// pauseCheckInterval is how often a running encode checks the conditions it is paused for
+const pauseCheckInterval = 30 * time.Second
+
+// pauseWhile pauses the running encoders while closed returns true, until ctx is done.
+// Encoders paused by the user or another condition are left alone.
+func pauseWhile(ctx context.Context, reason string, closed func() bool) {
+	ticker := time.NewTicker(pauseCheckInterval)
+	defer ticker.Stop()
+
+	pausedHere := false
+	for {
+		select {
+		case <-ctx.Done():
+			if pausedHere {
+				setPaused(ctx, false)
+			}
+			return
+		case <-ticker.C:
+		}
+
+		isClosed := closed()
+		switch {
+		case isClosed && !pausedHere && !proc.Paused():
+			log.Ctx(ctx).Info().Str("reason", reason).Msg("pausing encoding")
+			setPaused(ctx, true)
+			pausedHere = true
+		case !isClosed && pausedHere:
+			setPaused(ctx, false)
+			pausedHere = false
+		}
+	}
+}
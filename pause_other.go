@@ -0,0 +1,8 @@
+//go:build !unix
+
+package main
+
+import "context"
+
+// watchPauseSignals is a no-op where job control signals don't exist
+func watchPauseSignals(context.Context) {}
@@ -0,0 +1,33 @@
+//go:build unix
+
+package main
+
+import (
+	"context"
+	"os"
+	"os/signal"
+	"syscall"
+)
+
+// watchPauseSignals pauses encoding on SIGTSTP (Ctrl-Z) and resumes it on
+// SIGCONT or a second SIGTSTP, keeping encz itself running
+func watchPauseSignals(ctx context.Context) {
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGTSTP, syscall.SIGCONT)
+
+	go func() {
+		defer signal.Stop(signals)
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case sig := <-signals:
+				if sig == syscall.SIGCONT {
+					setPaused(ctx, false)
+				} else {
+					togglePause(ctx)
+				}
+			}
+		}
+	}()
+}
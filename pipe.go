@@ -0,0 +1,144 @@
+package main
+
+import (
+	"cmp"
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"time"
+
+	"github.com/rs/zerolog/log"
+
+	"encz/ffmpeg"
+	"encz/proc"
+)
+
+// pipePath stands for stdin as the input and stdout as the output
+const pipePath = "-"
+
+// pipeFormats are the containers streamed to stdout, both written without seeking back
+var pipeFormats = []string{"matroska", "nut"}
+
+// pipes reports whether the input is read from stdin or the output written to stdout
+func (c *cliArgs) pipes() bool {
+	return c.VideoPath == pipePath || c.Output == pipePath
+}
+
+// validatePipes checks that c can read from stdin or write to stdout. Only
+// FFmpeg reads and writes pipes, and what needs a file on either side is out.
+func (c *cliArgs) validatePipes() error {
+	if c.Output != "" && len(c.Renditions) > 0 {
+		return fmt.Errorf("-o names a single output, it can't be combined with --renditions")
+	}
+	if !c.pipes() {
+		return nil
+	}
+
+	if c.VideoPath == pipePath && c.Output == "" {
+		return fmt.Errorf("reading from stdin requires -o, a file or - for stdout")
+	}
+	if !slices.Contains(pipeFormats, c.PipeFormat) {
+		return fmt.Errorf("invalid --pipe-format %q: expected matroska or nut", c.PipeFormat)
+	}
+	if c.Encoder != "ffmpeg" {
+		return fmt.Errorf("pipes require --encoder ffmpeg, HandBrake only reads and writes files")
+	}
+	if len(c.FallbackEncoders) > 0 || c.Chunked || c.Estimate || c.Upload != "" {
+		return fmt.Errorf("--fallback-encoders, --chunked, --estimate and --upload are not available with pipes")
+	}
+	if c.Replace || c.PreserveTimes || c.PreserveXattrs || c.Poster > 0 || c.Thumbnails > 0 {
+		return fmt.Errorf("--replace, --preserve-times, --preserve-xattrs, --poster and --thumbnails are not available with pipes")
+	}
+
+	// A stream is read once
+	if c.VideoPath == pipePath && (c.Retries > 0 || c.Stabilize || c.QuietPeriod > 0 || c.Precheck) {
+		return fmt.Errorf("--retries, --stabilize, --quiet-period and --precheck are not available for stdin inputs")
+	}
+	if c.InputDuration < 0 {
+		return fmt.Errorf("--input-duration must not be negative")
+	}
+	return nil
+}
+
+// validateBatch checks that c can encode several files, which are named after their sources
+func (c *cliArgs) validateBatch() error {
+	if c.Output != "" {
+		return fmt.Errorf("-o names the output of a single file, batches name theirs after the sources")
+	}
+	return nil
+}
+
+// runPipe encodes from stdin or to stdout. There is no file to hash on the
+// piped side, so the history is neither checked nor updated.
+func runPipe(ctx context.Context, args cliArgs) (encodeResult, error) {
+	var result encodeResult
+	var probe ffmpeg.ProbeResult
+	if args.VideoPath == pipePath {
+		// Probing would consume the stream, --input-duration stands in for it
+		probe.Duration = args.InputDuration
+		// Nor is there a name to title the output after
+		args.NoTitle = true
+		if args.Detelecine == "auto" {
+			args.Detelecine = "off"
+		}
+	} else {
+		absPath, err := filepath.Abs(args.VideoPath)
+		if err != nil {
+			return encodeResult{}, fmt.Errorf("failed to get absolute path: %w", err)
+		}
+		args.VideoPath = absPath
+
+		info, err := os.Stat(args.VideoPath)
+		if err != nil {
+			return encodeResult{}, fmt.Errorf("failed to stat video: %w", err)
+		}
+		result.InputSize = info.Size()
+
+		probe, err = ffmpeg.Probe(ctx, args.VideoPath)
+		if err != nil {
+			return encodeResult{}, fmt.Errorf("failed to probe video: %w", err)
+		}
+		if err := args.applyLanguages(ctx, probe); err != nil {
+			return encodeResult{}, err
+		}
+		args.applySmartQuality(ctx, probe)
+		displayWidth, displayHeight := probe.DisplaySize()
+		args.applyResolutionQuality(ctx, displayWidth, displayHeight)
+		args.Detelecine = resolveDetelecine(ctx, args, probe.FPS, args.VideoPath, probe.Duration/2)
+	}
+
+	savePath := args.Output
+	if savePath != pipePath {
+		var err error
+		if savePath, err = filepath.Abs(savePath); err != nil {
+			return encodeResult{}, fmt.Errorf("failed to get absolute path: %w", err)
+		}
+		if err := os.MkdirAll(filepath.Dir(savePath), 0755); err != nil {
+			return encodeResult{}, fmt.Errorf("failed to create output directory: %w", err)
+		}
+	}
+	log.Ctx(ctx).Debug().Str("input", args.VideoPath).Str("output", savePath).Msg("encoding through pipes")
+
+	encodeDuration := args.Duration
+	if args.ToTime > 0 {
+		encodeDuration = args.ToTime - args.FromTime
+	}
+	args.GPU = resolveGPU(ctx, args)
+
+	start, pausedBefore := time.Now(), proc.PausedTime()
+	if err := encode(ctx, args, probe, savePath, encodeDuration); err != nil {
+		return encodeResult{}, encoderError{err}
+	}
+	elapsed := time.Since(start) - (proc.PausedTime() - pausedBefore)
+
+	result.OutputPath = savePath
+	if info, err := os.Stat(savePath); err == nil && savePath != pipePath {
+		result.OutputSize = info.Size()
+	}
+	if duration := cmp.Or(encodeDuration, probe.Duration-args.FromTime); duration > 0 && probe.FPS > 0 && elapsed > 0 {
+		result.FPS = duration.Seconds() * probe.FPS / elapsed.Seconds()
+	}
+	return result, nil
+}
@@ -0,0 +1,38 @@
+package power
+
+import (
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+const raplDir = "/sys/class/powercap"
+
+// energy sums the RAPL package counters. They are usually only readable by root.
+func energy() (float64, bool) {
+	zones, err := filepath.Glob(filepath.Join(raplDir, "intel-rapl:[0-9]*"))
+	if err != nil {
+		return 0, false
+	}
+
+	var total float64
+	found := false
+	for _, zone := range zones {
+		// Subzones like intel-rapl:0:0 are already counted in their package
+		if strings.Count(filepath.Base(zone), ":") != 1 {
+			continue
+		}
+		data, err := os.ReadFile(filepath.Join(zone, "energy_uj"))
+		if err != nil {
+			return 0, false
+		}
+		uj, err := strconv.ParseFloat(strings.TrimSpace(string(data)), 64)
+		if err != nil {
+			return 0, false
+		}
+		total += uj / 1e6
+		found = true
+	}
+	return total, found
+}
@@ -0,0 +1,8 @@
+//go:build !linux
+
+package power
+
+// energy isn't available without root elsewhere, powermetrics on macOS needs sudo
+func energy() (float64, bool) {
+	return 0, false
+}
@@ -0,0 +1,15 @@
+// Package power reports the power source of the machine and its energy use
+package power
+
+// OnBattery reports whether the machine is running on battery.
+// Machines without a battery are always on AC power.
+func OnBattery() (bool, error) {
+	return onBattery()
+}
+
+// Energy returns a counter of the energy used by the CPU packages in joules,
+// for measuring power draw between two readings. ok is false where the
+// counter isn't available or readable.
+func Energy() (joules float64, ok bool) {
+	return energy()
+}
@@ -0,0 +1,16 @@
+package power
+
+import (
+	"fmt"
+	"os/exec"
+	"strings"
+)
+
+// onBattery parses the power source reported by pmset
+func onBattery() (bool, error) {
+	out, err := exec.Command("pmset", "-g", "batt").Output()
+	if err != nil {
+		return false, fmt.Errorf("failed to run pmset: %w", err)
+	}
+	return strings.Contains(string(out), "'Battery Power'"), nil
+}
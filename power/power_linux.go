@@ -0,0 +1,48 @@
+package power
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+const powerSupplyDir = "/sys/class/power_supply"
+
+// onBattery checks the mains adapters, falling back to the battery status
+func onBattery() (bool, error) {
+	supplies, err := os.ReadDir(powerSupplyDir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return false, nil
+		}
+		return false, fmt.Errorf("failed to read power supplies: %w", err)
+	}
+
+	hasMains, discharging := false, false
+	for _, supply := range supplies {
+		dir := filepath.Join(powerSupplyDir, supply.Name())
+		switch readValue(dir, "type") {
+		case "Mains", "USB":
+			if readValue(dir, "online") == "1" {
+				return false, nil
+			}
+			hasMains = true
+		case "Battery":
+			if readValue(dir, "status") == "Discharging" {
+				discharging = true
+			}
+		}
+	}
+
+	return hasMains || discharging, nil
+}
+
+// readValue reads a sysfs attribute, returning an empty string if it can't be read
+func readValue(dir, name string) string {
+	b, err := os.ReadFile(filepath.Join(dir, name))
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(string(b))
+}
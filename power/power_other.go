@@ -0,0 +1,8 @@
+//go:build !linux && !darwin && !windows
+
+package power
+
+// onBattery assumes AC power where the power source can't be detected
+func onBattery() (bool, error) {
+	return false, nil
+}
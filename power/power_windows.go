@@ -0,0 +1,30 @@
+package power
+
+import (
+	"fmt"
+	"unsafe"
+
+	"golang.org/x/sys/windows"
+)
+
+var procGetSystemPowerStatus = windows.NewLazySystemDLL("kernel32.dll").NewProc("GetSystemPowerStatus")
+
+// systemPowerStatus mirrors SYSTEM_POWER_STATUS
+type systemPowerStatus struct {
+	ACLineStatus        byte
+	BatteryFlag         byte
+	BatteryLifePercent  byte
+	SystemStatusFlag    byte
+	BatteryLifeTime     uint32
+	BatteryFullLifeTime uint32
+}
+
+// onBattery asks Windows for the AC line status
+func onBattery() (bool, error) {
+	var status systemPowerStatus
+	if r, _, err := procGetSystemPowerStatus.Call(uintptr(unsafe.Pointer(&status))); r == 0 {
+		return false, fmt.Errorf("failed to get power status: %w", err)
+	}
+	// 0 is offline, 1 online and 255 unknown
+	return status.ACLineStatus == 0, nil
+}
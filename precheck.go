@@ -0,0 +1,54 @@
+package main
+
+import (
+	"cmp"
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/rs/zerolog/log"
+
+	"encz/ffmpeg"
+)
+
+// Segments decoded by --precheck, spread evenly across the encoded range
+const (
+	precheckSamples      = 5
+	precheckSampleLength = 5 * time.Second
+	// precheckMaxErrors is the number of decode errors in the segments beyond
+	// which a source is too damaged to be worth encoding
+	precheckMaxErrors = 10
+)
+
+// precheckSource decodes a few segments of the source and fails when they have
+// more decode errors than precheckMaxErrors, before hours go into a glitchy encode
+func precheckSource(ctx context.Context, args cliArgs, probe ffmpeg.ProbeResult, encodeDuration time.Duration) error {
+	mediaDuration := cmp.Or(encodeDuration, probe.Duration-args.FromTime)
+	samples := max(1, min(precheckSamples, int(mediaDuration/(2*precheckSampleLength))))
+	log.Ctx(ctx).Info().Int("segments", samples).Msg("checking the source for decode errors")
+
+	var errs []string
+	for i := range samples {
+		at := args.FromTime + mediaDuration*time.Duration(2*i+1)/time.Duration(2*samples) - precheckSampleLength/2
+		at = max(args.FromTime, at)
+
+		sampleErrs, err := ffmpeg.DecodeErrors(ctx, args.VideoPath, at, min(precheckSampleLength, mediaDuration))
+		if err != nil {
+			return err
+		}
+		errs = append(errs, sampleErrs...)
+	}
+
+	switch {
+	case len(errs) > precheckMaxErrors:
+		return fmt.Errorf("source is badly corrupted: %d decode errors in %d segments, first: %s", len(errs), samples, errs[0])
+	case len(errs) > 0:
+		log.Ctx(ctx).Warn().
+			Int("errors", len(errs)).
+			Str("first", errs[0]).
+			Msg("source has decode errors, the encode may show glitches")
+	default:
+		log.Ctx(ctx).Debug().Msg("no decode errors in the source")
+	}
+	return nil
+}
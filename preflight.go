@@ -0,0 +1,118 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os/exec"
+	"runtime"
+
+	"github.com/rs/zerolog/log"
+
+	"encz/ffmpeg"
+	"encz/handbrake"
+	"encz/ytdlp"
+)
+
+// checkPreflight exits with a list of the missing tools when preflight fails
+func checkPreflight(ctx context.Context, args cliArgs) {
+	errs := preflight(args)
+	if len(errs) == 0 {
+		return
+	}
+	for _, err := range errs {
+		log.Ctx(ctx).Error().Msg(err.Error())
+	}
+	log.Ctx(ctx).Fatal().Msg("required tools are missing, run encz doctor for details")
+}
+
+// preflight checks that the external tools needed by args are installed,
+// reporting how to install missing ones instead of a raw exec error
+func preflight(args cliArgs) []error {
+	var errs []error
+
+	if err := checkTool("ffprobe", ffmpeg.ProbeBinary, "--ffprobe-path", ffmpegInstallHint()); err != nil {
+		errs = append(errs, err)
+	}
+
+	// HandBrake encodes need ffmpeg too, it writes their metadata and extracts stills
+	if err := checkTool("ffmpeg", ffmpeg.Binary, "--ffmpeg-path", ffmpegInstallHint()); err != nil {
+		errs = append(errs, err)
+	}
+
+	if usesHandbrake(args) {
+		if err := checkTool("HandBrakeCLI", handbrake.Binary, "--handbrake-path", handbrakeInstallHint()+" or use --encoder ffmpeg"); err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	if args.Upload != "" {
+		if err := checkTool("sftp", sftpBinary, "", "install the OpenSSH client"); err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	if args.fetchesWithYTDLP() {
+		if err := checkTool("yt-dlp", ytdlp.Binary, "--yt-dlp-path", ytdlpInstallHint()); err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	return errs
+}
+
+// usesHandbrake reports whether args encode with HandBrake, if only as a fallback
+func usesHandbrake(args cliArgs) bool {
+	if args.Encoder == "handbrake" {
+		return true
+	}
+	for _, f := range args.FallbackEncoders {
+		if f.Engine() == "handbrake" {
+			return true
+		}
+	}
+	return false
+}
+
+// checkTool returns an actionable error when binary can't be found
+func checkTool(name, binary, flagName, hint string) error {
+	if _, err := exec.LookPath(binary); err == nil {
+		return nil
+	}
+	if binary != name {
+		return fmt.Errorf("%s not found at %s; check %s", name, binary, flagName)
+	}
+	return fmt.Errorf("%s not found; %s", name, hint)
+}
+
+func ffmpegInstallHint() string {
+	switch runtime.GOOS {
+	case "darwin":
+		return "install with brew install ffmpeg"
+	case "windows":
+		return "install with winget install ffmpeg"
+	default:
+		return "install the ffmpeg package (e.g. apt install ffmpeg)"
+	}
+}
+
+func handbrakeInstallHint() string {
+	switch runtime.GOOS {
+	case "darwin":
+		return "install with brew install handbrake"
+	case "windows":
+		return "download it from https://handbrake.fr/downloads2.php"
+	default:
+		return "install the handbrake-cli package (e.g. apt install handbrake-cli)"
+	}
+}
+
+func ytdlpInstallHint() string {
+	switch runtime.GOOS {
+	case "darwin":
+		return "install with brew install yt-dlp"
+	case "windows":
+		return "install with winget install yt-dlp"
+	default:
+		return "install with pipx install yt-dlp"
+	}
+}
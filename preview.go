@@ -0,0 +1,126 @@
+package main
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/rs/zerolog/log"
+
+	"encz/ffmpeg"
+)
+
+// previewArgs represents the arguments of the preview command
+type previewArgs struct {
+	cliArgs
+	At         time.Duration
+	Length     time.Duration
+	FPS        int
+	Format     string
+	OutputPath string
+}
+
+// previewMain implements `encz preview [flags] <file>`
+func previewMain(arguments []string) {
+	fs := flag.NewFlagSet("preview", flag.ExitOnError)
+	var at time.Duration
+	fs.Func("at", "start of the clip, e.g. 10m or 00:10:00 (default: a third into the video)", func(s string) error {
+		var err error
+		at, err = parseTimestamp(s)
+		return err
+	})
+	length := fs.Duration("length", 5*time.Second, "length of the clip")
+	fps := fs.Int("fps", 12, "frame rate of the clip")
+	gif := fs.Bool("gif", false, "write a GIF (default)")
+	webp := fs.Bool("webp", false, "write an animated WebP, smaller than a GIF with more colors")
+	output := fs.String("output", "", "path of the clip (default: <file>-preview.gif next to the file, or in --output-dir)")
+
+	args := previewArgs{cliArgs: parseArgs(fs, arguments)}
+	args.At = at
+	args.Length = *length
+	args.FPS = *fps
+	args.OutputPath = *output
+	args.Format = ffmpeg.PreviewGIF
+	if *webp {
+		args.Format = ffmpeg.PreviewWebP
+	}
+
+	if err := setupLogging(args.cliArgs); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+
+	ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer cancel()
+
+	switch {
+	case args.VideoPath == "":
+		exitInvalid(ctx, errors.New("usage: encz preview [flags] <file>"))
+	case *gif && *webp:
+		exitInvalid(ctx, errors.New("--gif and --webp cannot be combined"))
+	case args.Length <= 0 || args.FPS <= 0:
+		exitInvalid(ctx, errors.New("--length and --fps must be positive"))
+	}
+	if err := args.validateWatermark(); err != nil {
+		exitInvalid(ctx, err)
+	}
+
+	path, err := runPreview(ctx, args)
+	exitOnError(ctx, err)
+	fmt.Println(path)
+}
+
+// runPreview writes the preview clip and returns its path
+func runPreview(ctx context.Context, args previewArgs) (string, error) {
+	probe, err := ffmpeg.Probe(ctx, args.VideoPath)
+	if err != nil {
+		return "", fmt.Errorf("failed to probe video: %w", err)
+	}
+
+	at := args.At
+	if at == 0 {
+		at = probe.Duration / 3
+	}
+	if at >= probe.Duration {
+		return "", fmt.Errorf("--at %s is past the end of the video (%s)", at, probe.Duration)
+	}
+
+	outputPath := args.OutputPath
+	if outputPath == "" {
+		// Previews of URLs land in the working directory
+		source := inputName(args.VideoPath)
+		ext := filepath.Ext(source)
+		name := strings.TrimSuffix(filepath.Base(source), ext) + "-preview." + args.Format
+		outputPath = filepath.Join(cmp.Or(args.OutputDir, filepath.Dir(source)), name)
+	}
+
+	log.Ctx(ctx).Info().
+		Str("at", at.String()).
+		Str("length", args.Length.String()).
+		Str("output", outputPath).
+		Msg("creating preview")
+
+	err = ffmpeg.Preview(ctx, ffmpeg.PreviewParams{
+		InputPath:  args.VideoPath,
+		OutputPath: outputPath,
+		At:         at,
+		Length:     args.Length,
+		// Previews are for sharing and hover cards, they don't need the source resolution
+		Width:     cmp.Or(args.Width, 480),
+		FPS:       args.FPS,
+		Format:    args.Format,
+		Watermark: args.watermark(),
+	})
+	if err != nil {
+		return "", err
+	}
+	return outputPath, nil
+}
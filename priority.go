@@ -0,0 +1,134 @@
+package main
+
+import (
+	"context"
+	"slices"
+
+	"github.com/rs/zerolog/log"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"encz/api"
+)
+
+// jobPriority checks a priority given by a client, unspecified being normal
+func jobPriority(p api.Priority) (api.Priority, error) {
+	switch p {
+	case api.Priority_PRIORITY_UNSPECIFIED:
+		return api.Priority_PRIORITY_NORMAL, nil
+	case api.Priority_PRIORITY_LOW, api.Priority_PRIORITY_NORMAL, api.Priority_PRIORITY_HIGH:
+		return p, nil
+	}
+	return 0, status.Errorf(codes.InvalidArgument, "unknown priority %d, expected low, normal or high", p)
+}
+
+func (s *jobServer) SetPriority(ctx context.Context, req *api.SetPriorityRequest) (*api.Job, error) {
+	caller, err := s.caller(ctx)
+	if err != nil {
+		return nil, err
+	}
+	priority, err := jobPriority(req.Priority)
+	if err != nil {
+		return nil, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	job, err := s.findQueued(req.Id, caller)
+	if err != nil {
+		return nil, err
+	}
+	if job.state.Priority == priority {
+		return s.reply(job), nil
+	}
+	s.dequeue(job)
+	s.changeLocked(job, func(state *api.Job) {
+		state.Priority = priority
+	})
+	s.enqueue(job)
+
+	log.Ctx(ctx).Info().Str("job", req.Id).Str("by", caller.Name).Stringer("priority", priority).Msg("job priority changed")
+	return s.reply(job), nil
+}
+
+func (s *jobServer) Move(ctx context.Context, req *api.MoveRequest) (*api.Job, error) {
+	caller, err := s.caller(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	job, err := s.findQueued(req.Id, caller)
+	if err != nil {
+		return nil, err
+	}
+	if req.Before == "" {
+		s.dequeue(job)
+		s.enqueue(job)
+		log.Ctx(ctx).Info().Str("job", req.Id).Str("by", caller.Name).Msg("job moved to the back of its priority")
+		return s.reply(job), nil
+	}
+
+	// Others don't find the jobs of someone else, only admins move in front of them
+	before, err := s.findQueued(req.Before, caller)
+	if err != nil {
+		return nil, err
+	}
+	if before == job {
+		return s.reply(job), nil
+	}
+	s.dequeue(job)
+	s.changeLocked(job, func(state *api.Job) {
+		state.Priority = before.state.Priority
+	})
+	s.queue = slices.Insert(s.queue, slices.Index(s.queue, before), job)
+	s.renumber()
+
+	log.Ctx(ctx).Info().Str("job", req.Id).Str("by", caller.Name).Str("before", req.Before).Msg("job moved")
+	return s.reply(job), nil
+}
+
+// findQueued is find for the jobs still in the queue
+func (s *jobServer) findQueued(id string, c caller) (*serverJob, error) {
+	job, err := s.find(id, c)
+	if err != nil {
+		return nil, err
+	}
+	if job.state.State != api.Job_STATE_QUEUED {
+		return nil, status.Errorf(codes.FailedPrecondition, "job %s is not queued", id)
+	}
+	return job, nil
+}
+
+// enqueue adds job to the queue behind the jobs of its priority, the mutex must be held
+func (s *jobServer) enqueue(job *serverJob) {
+	i := len(s.queue)
+	for i > 0 && s.queue[i-1].state.Priority < job.state.Priority {
+		i--
+	}
+	s.queue = slices.Insert(s.queue, i, job)
+	s.renumber()
+}
+
+// dequeue removes job from the queue, the mutex must be held. Its watchers
+// learn about it with the change taking it out.
+func (s *jobServer) dequeue(job *serverJob) {
+	s.queue = slices.DeleteFunc(s.queue, func(j *serverJob) bool { return j == job })
+	job.state.Position = 0
+	s.renumber()
+}
+
+// renumber updates the positions of the queued jobs, waking up the watchers
+// of those that moved
+func (s *jobServer) renumber() {
+	for i, job := range s.queue {
+		if position := int32(i + 1); job.state.Position != position {
+			s.changeLocked(job, func(state *api.Job) {
+				state.Position = position
+			})
+		}
+	}
+}
@@ -0,0 +1,8 @@
+//go:build !unix && !windows
+
+package proc
+
+import "os/exec"
+
+// Detach is a no-op where processes have no groups
+func Detach(*exec.Cmd) {}
@@ -0,0 +1,14 @@
+//go:build unix
+
+package proc
+
+import (
+	"os/exec"
+	"syscall"
+)
+
+// Detach starts cmd in a process group of its own, so Ctrl-C in the terminal
+// only reaches encz, which decides when to stop it
+func Detach(cmd *exec.Cmd) {
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+}
@@ -0,0 +1,12 @@
+package proc
+
+import (
+	"os/exec"
+	"syscall"
+)
+
+// Detach starts cmd in a process group of its own, so Ctrl-C in the console
+// only reaches encz, which decides when to stop it
+func Detach(cmd *exec.Cmd) {
+	cmd.SysProcAttr = &syscall.SysProcAttr{CreationFlags: syscall.CREATE_NEW_PROCESS_GROUP}
+}
@@ -0,0 +1,8 @@
+//go:build !windows
+
+package proc
+
+// longPaths returns args as they are, only Windows limits the path length of programs
+func longPaths(args []string) []string {
+	return args
+}
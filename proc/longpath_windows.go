@@ -0,0 +1,28 @@
+package proc
+
+import (
+	"path/filepath"
+	"strings"
+)
+
+// maxPath is the path length Windows programs are limited to unless they opt in to long paths
+const maxPath = 260
+
+// longPaths rewrites long absolute paths among args to the extended-length
+// \\?\ form, which ffmpeg and HandBrakeCLI can open past MAX_PATH
+func longPaths(args []string) []string {
+	fixed := make([]string, len(args))
+	for i, arg := range args {
+		fixed[i] = arg
+		if len(arg) < maxPath || !filepath.IsAbs(arg) || strings.HasPrefix(arg, `\\?\`) {
+			continue
+		}
+		arg = filepath.Clean(arg)
+		if strings.HasPrefix(arg, `\\`) {
+			fixed[i] = `\\?\UNC\` + arg[2:]
+		} else {
+			fixed[i] = `\\?\` + arg
+		}
+	}
+	return fixed
+}
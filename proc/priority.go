@@ -0,0 +1,35 @@
+package proc
+
+import (
+	"context"
+	"os/exec"
+)
+
+// niceness is the CPU priority adjustment of low priority commands
+const niceness = 10
+
+var lowPriority bool
+
+// SetLowPriority makes commands created by Command run at low CPU and IO
+// priority, so background encodes don't make the desktop unusable
+func SetLowPriority(low bool) {
+	mu.Lock()
+	defer mu.Unlock()
+	lowPriority = low
+}
+
+// Command returns a command running an encoder, at low priority when enabled.
+// It is detached from the terminal's Ctrl-C, and stopped when ctx is done.
+func Command(ctx context.Context, name string, args ...string) *exec.Cmd {
+	mu.Lock()
+	low := lowPriority
+	mu.Unlock()
+
+	args = longPaths(args)
+	if low {
+		name, args = lowPriorityCommand(name, args)
+	}
+	cmd := exec.CommandContext(ctx, name, args...)
+	Detach(cmd)
+	return cmd
+}
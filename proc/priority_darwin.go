@@ -0,0 +1,14 @@
+package proc
+
+import "os"
+
+// lowPriorityCommand wraps a command with taskpolicy, which lowers both CPU
+// and IO priority with the background policy
+func lowPriorityCommand(name string, args []string) (string, []string) {
+	return "taskpolicy", append([]string{"-b", name}, args...)
+}
+
+// lowerPriority is done by lowPriorityCommand on macOS
+func lowerPriority(*os.Process) error {
+	return nil
+}
@@ -0,0 +1,21 @@
+package proc
+
+import (
+	"os"
+	"os/exec"
+	"strconv"
+)
+
+// lowPriorityCommand wraps a command with nice, and ionice for the idle IO class when available
+func lowPriorityCommand(name string, args []string) (string, []string) {
+	wrapped := []string{"-n", strconv.Itoa(niceness)}
+	if _, err := exec.LookPath("ionice"); err == nil {
+		wrapped = append(wrapped, "ionice", "-c", "3")
+	}
+	return "nice", append(append(wrapped, name), args...)
+}
+
+// lowerPriority is done by lowPriorityCommand on Linux
+func lowerPriority(*os.Process) error {
+	return nil
+}
@@ -0,0 +1,18 @@
+//go:build !linux && !darwin && !windows
+
+package proc
+
+import (
+	"os"
+	"strconv"
+)
+
+// lowPriorityCommand wraps a command with nice
+func lowPriorityCommand(name string, args []string) (string, []string) {
+	return "nice", append([]string{"-n", strconv.Itoa(niceness), name}, args...)
+}
+
+// lowerPriority is done by lowPriorityCommand
+func lowerPriority(*os.Process) error {
+	return nil
+}
@@ -0,0 +1,27 @@
+package proc
+
+import (
+	"fmt"
+	"os"
+
+	"golang.org/x/sys/windows"
+)
+
+// lowPriorityCommand leaves the command as is, the priority class is set once it started
+func lowPriorityCommand(name string, args []string) (string, []string) {
+	return name, args
+}
+
+// lowerPriority moves a started process to the below normal priority class
+func lowerPriority(p *os.Process) error {
+	handle, err := windows.OpenProcess(windows.PROCESS_SET_INFORMATION, false, uint32(p.Pid))
+	if err != nil {
+		return fmt.Errorf("failed to open process %d: %w", p.Pid, err)
+	}
+	defer windows.CloseHandle(handle)
+
+	if err := windows.SetPriorityClass(handle, windows.BELOW_NORMAL_PRIORITY_CLASS); err != nil {
+		return fmt.Errorf("failed to lower priority of process %d: %w", p.Pid, err)
+	}
+	return nil
+}
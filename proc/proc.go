@@ -0,0 +1,96 @@
+// Package proc runs and keeps track of the encoder processes so they can be
+// paused and resumed together, and run at low priority
+package proc
+
+import (
+	"errors"
+	"os/exec"
+	"sync"
+	"time"
+)
+
+var (
+	mu      sync.Mutex
+	running = map[*exec.Cmd]struct{}{}
+	paused  bool
+
+	// pausedAt is when the current pause started, pausedTotal sums the earlier ones
+	pausedAt    time.Time
+	pausedTotal time.Duration
+)
+
+// Track registers a started command and returns a function unregistering it.
+// Commands started while paused are stopped right away.
+func Track(cmd *exec.Cmd) func() {
+	mu.Lock()
+	defer mu.Unlock()
+
+	running[cmd] = struct{}{}
+	if paused {
+		_ = stop(cmd.Process)
+	}
+	if lowPriority {
+		// Best effort, the encode works the same at normal priority
+		_ = lowerPriority(cmd.Process)
+	}
+
+	return func() {
+		mu.Lock()
+		defer mu.Unlock()
+		delete(running, cmd)
+	}
+}
+
+// Pause stops all tracked processes
+func Pause() error {
+	mu.Lock()
+	defer mu.Unlock()
+
+	if paused {
+		return nil
+	}
+	paused = true
+	pausedAt = time.Now()
+
+	var errs []error
+	for cmd := range running {
+		errs = append(errs, stop(cmd.Process))
+	}
+	return errors.Join(errs...)
+}
+
+// Resume continues all tracked processes
+func Resume() error {
+	mu.Lock()
+	defer mu.Unlock()
+
+	if !paused {
+		return nil
+	}
+	paused = false
+	pausedTotal += time.Since(pausedAt)
+
+	var errs []error
+	for cmd := range running {
+		errs = append(errs, cont(cmd.Process))
+	}
+	return errors.Join(errs...)
+}
+
+// Paused reports whether the processes are paused
+func Paused() bool {
+	mu.Lock()
+	defer mu.Unlock()
+	return paused
+}
+
+// PausedTime returns how long the processes have been paused in total, including the current pause
+func PausedTime() time.Duration {
+	mu.Lock()
+	defer mu.Unlock()
+
+	if paused {
+		return pausedTotal + time.Since(pausedAt)
+	}
+	return pausedTotal
+}
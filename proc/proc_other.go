@@ -0,0 +1,21 @@
+//go:build !unix
+
+package proc
+
+import (
+	"errors"
+	"os"
+)
+
+// Supported reports whether processes can be paused on this platform
+const Supported = false
+
+var errUnsupported = errors.New("pausing is not supported on this platform")
+
+func stop(*os.Process) error {
+	return errUnsupported
+}
+
+func cont(*os.Process) error {
+	return errUnsupported
+}
@@ -0,0 +1,26 @@
+//go:build unix
+
+package proc
+
+import (
+	"fmt"
+	"os"
+	"syscall"
+)
+
+// Supported reports whether processes can be paused on this platform
+const Supported = true
+
+func stop(p *os.Process) error {
+	if err := p.Signal(syscall.SIGSTOP); err != nil {
+		return fmt.Errorf("failed to pause process %d: %w", p.Pid, err)
+	}
+	return nil
+}
+
+func cont(p *os.Process) error {
+	if err := p.Signal(syscall.SIGCONT); err != nil {
+		return fmt.Errorf("failed to resume process %d: %w", p.Pid, err)
+	}
+	return nil
+}
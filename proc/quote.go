@@ -0,0 +1,8 @@
+package proc
+
+import "strings"
+
+// ShellQuote quotes s as a single argument for a POSIX shell
+func ShellQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
@@ -0,0 +1,48 @@
+package proc
+
+import (
+	"bytes"
+	"strings"
+)
+
+// Tail is a writer keeping the last lines written to it, so a failed
+// command can report its error message without keeping the whole log
+type Tail struct {
+	lines   int
+	partial []byte
+	buf     []string
+}
+
+// NewTail returns a Tail keeping the last n lines
+func NewTail(n int) *Tail {
+	return &Tail{lines: n}
+}
+
+func (t *Tail) Write(p []byte) (int, error) {
+	data := append(t.partial, p...)
+	for {
+		// Progress output is separated with carriage returns
+		i := bytes.IndexAny(data, "\r\n")
+		if i < 0 {
+			break
+		}
+		if line := strings.TrimSpace(string(data[:i])); line != "" {
+			t.buf = append(t.buf, line)
+			if len(t.buf) > t.lines {
+				t.buf = t.buf[1:]
+			}
+		}
+		data = data[i+1:]
+	}
+	t.partial = append(t.partial[:0], data...)
+	return len(p), nil
+}
+
+// String returns the kept lines joined with "; "
+func (t *Tail) String() string {
+	lines := t.buf
+	if line := strings.TrimSpace(string(t.partial)); line != "" {
+		lines = append(lines[:len(lines):len(lines)], line)
+	}
+	return strings.Join(lines, "; ")
+}
@@ -0,0 +1,55 @@
+package proc
+
+import "time"
+
+// Usage is the resource usage of the tracked processes
+type Usage struct {
+	// CPUPercent is the CPU time used per wall time, above 100 when using several cores
+	CPUPercent float64
+	// RSS is the resident memory in bytes, 0 when unknown
+	RSS int64
+}
+
+// Sampler measures the CPU usage of the tracked processes between samples
+type Sampler struct {
+	cpu map[int]time.Duration
+	at  time.Time
+}
+
+// Sample returns the usage of the tracked processes since the last sample.
+// The first sample only starts the measurement and reports false, as do
+// platforms without a way to measure it.
+func (s *Sampler) Sample() (Usage, bool) {
+	mu.Lock()
+	pids := make([]int, 0, len(running))
+	for cmd := range running {
+		if cmd.Process != nil {
+			pids = append(pids, cmd.Process.Pid)
+		}
+	}
+	mu.Unlock()
+
+	now := time.Now()
+	cpu := make(map[int]time.Duration, len(pids))
+	var usage Usage
+	var used time.Duration
+	for _, pid := range pids {
+		cpuTime, rss, err := processUsage(pid)
+		if err != nil {
+			continue
+		}
+		cpu[pid] = cpuTime
+		usage.RSS += rss
+		// Processes started since the last sample count from their start
+		used += cpuTime - s.cpu[pid]
+	}
+
+	first := s.cpu == nil
+	elapsed := now.Sub(s.at)
+	s.cpu, s.at = cpu, now
+	if first || len(cpu) == 0 || elapsed <= 0 {
+		return usage, false
+	}
+	usage.CPUPercent = max(0, float64(used)/float64(elapsed)*100)
+	return usage, true
+}
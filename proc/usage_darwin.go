@@ -0,0 +1,41 @@
+package proc
+
+import (
+	"errors"
+	"os/exec"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// processUsage returns the CPU time used by a process and its resident memory
+func processUsage(pid int) (time.Duration, int64, error) {
+	out, err := exec.Command("ps", "-o", "time=,rss=", "-p", strconv.Itoa(pid)).Output()
+	if err != nil {
+		return 0, 0, err
+	}
+	fields := strings.Fields(string(out))
+	if len(fields) != 2 {
+		return 0, 0, errors.New("unexpected ps output")
+	}
+
+	cpu, err := parseCPUTime(fields[0])
+	if err != nil {
+		return 0, 0, err
+	}
+	rss, _ := strconv.ParseInt(fields[1], 10, 64)
+	return cpu, rss * 1024, nil
+}
+
+// parseCPUTime parses a CPU time of ps like 1:02.50 or 1:02:03.50
+func parseCPUTime(s string) (time.Duration, error) {
+	var total float64
+	for _, part := range strings.Split(s, ":") {
+		value, err := strconv.ParseFloat(part, 64)
+		if err != nil {
+			return 0, errors.New("unexpected ps time " + s)
+		}
+		total = total*60 + value
+	}
+	return time.Duration(total * float64(time.Second)), nil
+}
@@ -0,0 +1,37 @@
+package proc
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// clockTicks is the unit of the CPU times in /proc, which is USER_HZ on
+// every architecture Linux runs encoders on
+const clockTicks = 100
+
+// processUsage returns the CPU time used by a process and its resident memory
+func processUsage(pid int) (time.Duration, int64, error) {
+	data, err := os.ReadFile(fmt.Sprintf("/proc/%d/stat", pid))
+	if err != nil {
+		return 0, 0, err
+	}
+	// The command name may hold spaces, the fields follow its closing parenthesis
+	end := strings.LastIndexByte(string(data), ')')
+	if end < 0 {
+		return 0, 0, errors.New("unexpected /proc stat format")
+	}
+	fields := strings.Fields(string(data[end+1:]))
+	if len(fields) < 22 {
+		return 0, 0, errors.New("unexpected /proc stat format")
+	}
+
+	utime, _ := strconv.ParseInt(fields[11], 10, 64)
+	stime, _ := strconv.ParseInt(fields[12], 10, 64)
+	pages, _ := strconv.ParseInt(fields[21], 10, 64)
+	cpu := time.Duration(utime+stime) * time.Second / clockTicks
+	return cpu, pages * int64(os.Getpagesize()), nil
+}
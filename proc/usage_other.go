@@ -0,0 +1,13 @@
+//go:build !linux && !darwin && !windows
+
+package proc
+
+import (
+	"errors"
+	"time"
+)
+
+// processUsage is not supported on this platform
+func processUsage(int) (time.Duration, int64, error) {
+	return 0, 0, errors.New("resource usage is not supported on this platform")
+}
@@ -0,0 +1,47 @@
+package progress
+
+import (
+	"math"
+	"time"
+)
+
+// etaTimeConstant is how quickly a smoothed ETA follows the reported one.
+// Encoders report a new ETA every few seconds, which swings wildly early on.
+const etaTimeConstant = 30 * time.Second
+
+// ETA smooths the remaining time reported by an encoder with an exponential
+// moving average, counting down between reports. The zero value is ready to use.
+type ETA struct {
+	value time.Duration
+	at    time.Time
+}
+
+// Update records a reported remaining time and returns the smoothed one.
+// Reports without an ETA keep counting down the previous estimate until
+// the percentage reaches 100.
+func (e *ETA) Update(percent float64, reported time.Duration) time.Duration {
+	if percent >= 100 {
+		*e = ETA{}
+		return 0
+	}
+
+	now := time.Now()
+	if e.at.IsZero() {
+		if reported <= 0 {
+			return 0
+		}
+		e.value, e.at = reported, now
+		return reported.Truncate(time.Second)
+	}
+
+	elapsed := now.Sub(e.at)
+	predicted := max(0, e.value-elapsed)
+	if reported > 0 {
+		// Weigh reports by the time since the last one, so frequent reports don't dominate
+		weight := 1 - math.Exp(-float64(elapsed)/float64(etaTimeConstant))
+		predicted = time.Duration(weight*float64(reported) + (1-weight)*float64(predicted))
+	}
+
+	e.value, e.at = predicted, now
+	return predicted.Truncate(time.Second)
+}
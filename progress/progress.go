@@ -0,0 +1,275 @@
+package progress
+
+import (
+	"cmp"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/mattn/go-isatty"
+)
+
+// defaultWidth and defaultHeight are used when the terminal size is unknown
+const (
+	defaultWidth  = 80
+	defaultHeight = 24
+)
+
+// defaultPlainInterval is the time between the lines of a bar when not writing
+// to a terminal, unless set with SetPlainInterval
+const defaultPlainInterval = 30 * time.Second
+
+var plainInterval atomic.Int64
+
+// SetPlainInterval sets the time between the lines of a bar when not writing to
+// a terminal, for renderers created afterwards
+func SetPlainInterval(interval time.Duration) {
+	if interval > 0 {
+		plainInterval.Store(int64(interval))
+	}
+}
+
+// Status represents the state of a single progress bar
+type Status struct {
+	// Label identifies the bar, usually the file name
+	Label       string
+	Percent     float64
+	FPS         float64
+	ETA         time.Duration
+	EncodedMB   float64
+	EstimatedMB float64
+	// Phase describes what the encoder is doing, e.g. scanning or muxing.
+	// Rates are only shown while encoding, other phases show the phase instead.
+	Phase string
+	// Usage is the resource usage of the encoder, shown after the rates when set
+	Usage *Usage
+}
+
+// Usage is the resource usage shown next to an encoding bar
+type Usage struct {
+	// CPU is the CPU time used per wall time in percent, above 100 with several cores
+	CPU      float64
+	MemoryMB float64
+	// GPU is how busy the encoder of the GPU is in percent, -1 when unknown
+	GPU float64
+}
+
+// Renderer draws one or more progress bars. On a terminal the bars are
+// redrawn in place; otherwise timestamped lines are written periodically so
+// logs stay readable.
+type Renderer struct {
+	mu       sync.Mutex
+	out      *os.File
+	tty      bool
+	interval time.Duration
+	bars     []Status
+	lines    int
+	// lastPlain is the last plain line written per label
+	lastPlain map[string]plainLine
+}
+
+// plainLine is a status written as a line, and when
+type plainLine struct {
+	status Status
+	at     time.Time
+}
+
+// New returns a renderer writing to out
+func New(out *os.File) *Renderer {
+	return &Renderer{
+		out:       out,
+		tty:       isatty.IsTerminal(out.Fd()) || isatty.IsCygwinTerminal(out.Fd()),
+		interval:  cmp.Or(time.Duration(plainInterval.Load()), defaultPlainInterval),
+		lastPlain: map[string]plainLine{},
+	}
+}
+
+// Update sets the status of the bar with the same label, adding it if needed
+func (r *Renderer) Update(s Status) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	found := false
+	for i := range r.bars {
+		if r.bars[i].Label == s.Label {
+			r.bars[i] = s
+			found = true
+			break
+		}
+	}
+	if !found {
+		r.bars = append(r.bars, s)
+	}
+
+	if r.tty {
+		r.redraw()
+	} else {
+		r.writePlain(s)
+	}
+}
+
+// Remove deletes the bar with the given label
+func (r *Renderer) Remove(label string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for i := range r.bars {
+		if r.bars[i].Label == label {
+			r.bars = append(r.bars[:i], r.bars[i+1:]...)
+			break
+		}
+	}
+	delete(r.lastPlain, label)
+
+	if r.tty {
+		r.redraw()
+	}
+}
+
+// Finish leaves the last drawn bars on screen and resets the renderer
+func (r *Renderer) Finish() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.bars = nil
+	r.lines = 0
+	r.lastPlain = map[string]plainLine{}
+}
+
+// redraw draws all bars in place of the previously drawn ones
+func (r *Renderer) redraw() {
+	var b strings.Builder
+	if r.lines > 0 {
+		fmt.Fprintf(&b, "\x1b[%dA", r.lines)
+	}
+
+	width, _ := TerminalSize(r.out)
+	for _, s := range r.bars {
+		b.WriteString("\r\x1b[2K")
+		b.WriteString(Render(s, width))
+		b.WriteString("\n")
+	}
+
+	// Clear lines left over from removed bars
+	for range r.lines - len(r.bars) {
+		b.WriteString("\r\x1b[2K\n")
+	}
+	if extra := r.lines - len(r.bars); extra > 0 {
+		fmt.Fprintf(&b, "\x1b[%dA", extra)
+	}
+
+	r.lines = len(r.bars)
+	fmt.Fprint(r.out, b.String())
+}
+
+// writePlain writes a timestamped status line when a bar starts, changes
+// phase or finishes, and otherwise once per interval
+func (r *Renderer) writePlain(s Status) {
+	now := time.Now()
+	last, seen := r.lastPlain[s.Label]
+	finished := s.Percent >= 100 && last.status.Percent < 100
+	if seen && s.Phase == last.status.Phase && !finished && now.Sub(last.at) < r.interval {
+		return
+	}
+	r.lastPlain[s.Label] = plainLine{status: s, at: now}
+
+	fmt.Fprintf(r.out, "%s %s: %s\n", now.Format(time.DateTime), s.Label, stats(s))
+}
+
+// Render formats a bar to fit within width columns
+func Render(s Status, width int) string {
+	info := stats(s)
+
+	// Reserve room for the label, brackets and spacing
+	labelWidth := min(len([]rune(s.Label)), max(10, width/3))
+	barWidth := width - labelWidth - len(info) - 5
+	if barWidth < 10 {
+		// Too narrow for a bar, show the numbers only
+		return Truncate(s.Label, max(0, width-len(info)-1)) + " " + info
+	}
+
+	filled := int(float64(barWidth) * min(100, max(0, s.Percent)) / 100)
+	bar := strings.Repeat("█", filled) + strings.Repeat("░", barWidth-filled)
+
+	return fmt.Sprintf("%s [%s] %s", Truncate(s.Label, labelWidth), bar, info)
+}
+
+// stats formats the numbers shown next to a bar
+func stats(s Status) string {
+	switch {
+	case s.Phase == "" || s.Phase == "encoding":
+	case strings.HasPrefix(s.Phase, "pass "):
+		return fmt.Sprintf("%s %s", s.Phase, rates(s))
+	default:
+		return fmt.Sprintf("%5.1f%% %s", s.Percent, s.Phase)
+	}
+	return rates(s)
+}
+
+// rates formats the percentage, speed, size and ETA of an encoding bar
+func rates(s Status) string {
+	text := fmt.Sprintf("%5.1f%% %5.1ffps", s.Percent, s.FPS)
+	if s.EstimatedMB > 0 {
+		text += fmt.Sprintf(" %.0f/%.0fMB", s.EncodedMB, s.EstimatedMB)
+	}
+	if s.ETA > 0 {
+		text += " ETA " + s.ETA.String()
+	}
+	if s.Usage != nil {
+		text += " " + s.Usage.String()
+	}
+	return text
+}
+
+// String formats the usage like "CPU 740% 1.2GB GPU 45%"
+func (u Usage) String() string {
+	text := fmt.Sprintf("CPU %.0f%%", u.CPU)
+	switch {
+	case u.MemoryMB >= 1024:
+		text += fmt.Sprintf(" %.1fGB", u.MemoryMB/1024)
+	case u.MemoryMB > 0:
+		text += fmt.Sprintf(" %.0fMB", u.MemoryMB)
+	}
+	if u.GPU >= 0 {
+		text += fmt.Sprintf(" GPU %.0f%%", u.GPU)
+	}
+	return text
+}
+
+// Truncate shortens s to at most n runes, marking the cut with an ellipsis,
+// and pads shorter strings to exactly n runes
+func Truncate(s string, n int) string {
+	runes := []rune(s)
+	if len(runes) <= n {
+		return s + strings.Repeat(" ", n-len(runes))
+	}
+	if n <= 1 {
+		return string(runes[:n])
+	}
+	return string(runes[:n-1]) + "…"
+}
+
+// TerminalSize returns the column and row count of the terminal f, falling
+// back to $COLUMNS and $LINES and finally to 80x24
+func TerminalSize(f *os.File) (int, int) {
+	cols, rows := terminalSize(f)
+	if cols <= 0 {
+		cols = envInt("COLUMNS", defaultWidth)
+	}
+	if rows <= 0 {
+		rows = envInt("LINES", defaultHeight)
+	}
+	return cols, rows
+}
+
+// envInt returns the positive integer value of an environment variable, or fallback
+func envInt(key string, fallback int) int {
+	if n, err := strconv.Atoi(os.Getenv(key)); err == nil && n > 0 {
+		return n
+	}
+	return fallback
+}
@@ -0,0 +1,10 @@
+//go:build !unix && !windows
+
+package progress
+
+import "os"
+
+// terminalSize returns zeros as the terminal size can't be queried on this platform
+func terminalSize(f *os.File) (int, int) {
+	return 0, 0
+}
@@ -0,0 +1,101 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"sync"
+)
+
+// errSkipped is the cancellation cause when the user skips the current file
+var errSkipped = errors.New("skipped by user")
+
+// jobQueue is the list of files waiting to be processed in a batch run
+type jobQueue struct {
+	mu    sync.Mutex
+	items []string
+}
+
+// Push appends an item to the end of the queue
+func (q *jobQueue) Push(item string) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.items = append(q.items, item)
+}
+
+// Pop removes and returns the first item
+func (q *jobQueue) Pop() (string, bool) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if len(q.items) == 0 {
+		return "", false
+	}
+	item := q.items[0]
+	q.items = q.items[1:]
+	return item, true
+}
+
+// Len returns the number of waiting items
+func (q *jobQueue) Len() int {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return len(q.items)
+}
+
+// Items returns a copy of the waiting items in processing order
+func (q *jobQueue) Items() []string {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return append([]string(nil), q.items...)
+}
+
+// Move moves the item at index i by delta positions
+func (q *jobQueue) Move(i, delta int) bool {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	j := i + delta
+	if i < 0 || i >= len(q.items) || j < 0 || j >= len(q.items) {
+		return false
+	}
+	item := q.items[i]
+	q.items = append(q.items[:i], q.items[i+1:]...)
+	q.items = append(q.items[:j], append([]string{item}, q.items[j:]...)...)
+	return true
+}
+
+// batchControl lets the user interfere with the file currently being processed
+type batchControl struct {
+	mu            sync.Mutex
+	cancelCurrent context.CancelCauseFunc
+}
+
+// begin returns the context for processing the next file
+func (b *batchControl) begin(ctx context.Context) context.Context {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	ctx, b.cancelCurrent = context.WithCancelCause(ctx)
+	return ctx
+}
+
+// end releases the context of the current file
+func (b *batchControl) end() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.cancelCurrent != nil {
+		b.cancelCurrent(nil)
+		b.cancelCurrent = nil
+	}
+}
+
+// skip cancels the current file
+func (b *batchControl) skip() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.cancelCurrent != nil {
+		b.cancelCurrent(errSkipped)
+	}
+}
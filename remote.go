@@ -0,0 +1,142 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io/fs"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/rs/zerolog/log"
+
+	"encz/ytdlp"
+)
+
+// urlSchemes are the protocols handed to ffmpeg as is rather than read as local paths
+var urlSchemes = []string{"http", "https", "ftp", "sftp", "rtmp", "rtmps", "rtsp", "srt"}
+
+// remoteContainers are the extensions of URLs kept for their outputs, anything
+// else, like HLS playlists and MPEG-TS streams, is saved as MP4
+var remoteContainers = []string{".mp4", ".m4v", ".mkv", ".mov", ".webm"}
+
+// mediaExtensions are the extensions of URLs of media ffmpeg reads directly,
+// yt-dlp is only needed for the others, like the pages of video sites
+var mediaExtensions = append([]string{".m3u8", ".mpd", ".ts", ".m2ts", ".avi", ".flv", ".mpg", ".wmv"}, remoteContainers...)
+
+// isURL reports whether input is a URL read by ffmpeg rather than a local file
+func isURL(input string) bool {
+	if !strings.Contains(input, "://") {
+		return false
+	}
+	u, err := url.Parse(input)
+	return err == nil && slices.Contains(urlSchemes, strings.ToLower(u.Scheme))
+}
+
+// fetchesWithYTDLP reports whether the input is downloaded with yt-dlp before
+// encoding: an http(s) URL with --yt-dlp that doesn't point to a media file
+func (c *cliArgs) fetchesWithYTDLP() bool {
+	if !c.YTDLP || !isURL(c.VideoPath) {
+		return false
+	}
+	u, _ := url.Parse(c.VideoPath)
+	switch strings.ToLower(u.Scheme) {
+	case "http", "https":
+		return !slices.Contains(mediaExtensions, strings.ToLower(path.Ext(u.Path)))
+	}
+	return false
+}
+
+// fetchSource downloads the input with yt-dlp to a temporary folder, removed
+// by the returned function
+func fetchSource(ctx context.Context, args cliArgs) (string, func(), error) {
+	dir, err := os.MkdirTemp("", "encz-ytdlp-*")
+	if err != nil {
+		return "", nil, fmt.Errorf("failed to create download directory: %w", err)
+	}
+	cleanup := func() { _ = os.RemoveAll(dir) }
+
+	log.Ctx(ctx).Info().Str("url", args.VideoPath).Msg("fetching source with yt-dlp")
+	path, err := ytdlp.Fetch(ctx, args.VideoPath, dir, jobLogFrom(ctx))
+	if err != nil {
+		cleanup()
+		return "", nil, err
+	}
+	log.Ctx(ctx).Debug().Str("path", path).Msg("fetched source")
+	return path, cleanup, nil
+}
+
+// inputName returns the path outputs and logs are named after, which is input
+// itself for local files, or the last element of the URL path for remote ones,
+// e.g. "movie.mp4" for https://example.com/videos/movie.mp4?token=abc, and
+// stdin for a source read from it
+func inputName(input string) string {
+	if input == pipePath {
+		return "stdin"
+	}
+	if !isURL(input) {
+		return input
+	}
+	u, _ := url.Parse(input)
+	name := path.Base(u.Path)
+	if name == "/" || name == "." {
+		name = u.Hostname()
+	}
+	// Unescaped paths may hold separators of the local system
+	name = strings.NewReplacer("\\", "_", ":", "_").Replace(name)
+
+	if ext := path.Ext(name); !slices.Contains(remoteContainers, strings.ToLower(ext)) {
+		name = strings.TrimSuffix(name, ext) + ".mp4"
+	}
+	return name
+}
+
+// hashURL identifies a remote source in the history. Its content can't be
+// hashed without downloading it, so the URL and the size the server reports
+// stand in for it.
+func hashURL(input string, size int64) string {
+	h := sha256.New()
+	fmt.Fprintf(h, "url:%s:size=%d", input, size)
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// urlInfo is the file info of a remote source, sized as reported by ffprobe
+type urlInfo struct {
+	name string
+	size int64
+}
+
+func (i urlInfo) Name() string       { return filepath.Base(i.name) }
+func (i urlInfo) Size() int64        { return i.size }
+func (i urlInfo) Mode() fs.FileMode  { return 0 }
+func (i urlInfo) ModTime() time.Time { return time.Time{} }
+func (i urlInfo) IsDir() bool        { return false }
+func (i urlInfo) Sys() any           { return nil }
+
+// validateURLInput checks that c can encode a URL: there is no local original
+// to delete or copy attributes from, and only ffmpeg reads URLs
+func (c *cliArgs) validateURLInput() error {
+	if c.Replace || c.PreserveTimes || c.PreserveXattrs {
+		return fmt.Errorf("--replace, --preserve-times and --preserve-xattrs are not available for URL inputs")
+	}
+	// Fetched sources are local files any engine reads
+	if c.fetchesWithYTDLP() {
+		return nil
+	}
+
+	if c.Encoder != "ffmpeg" {
+		return fmt.Errorf("URL inputs require --encoder ffmpeg, HandBrake only reads local files")
+	}
+	for _, f := range c.FallbackEncoders {
+		if f.Engine() != "ffmpeg" {
+			return fmt.Errorf("URL inputs require ffmpeg fallback encoders, %s is a HandBrake encoder", f)
+		}
+	}
+	return nil
+}
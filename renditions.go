@@ -0,0 +1,262 @@
+package main
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/rs/zerolog/log"
+
+	"encz/ffmpeg"
+	"encz/history"
+	"encz/progress"
+)
+
+// rendition is one output of --renditions
+type rendition struct {
+	Height int
+	// Quality is the quality of the rendition, 0 for --quality
+	Quality float64
+}
+
+func (r rendition) String() string {
+	return fmt.Sprintf("%dp", r.Height)
+}
+
+var renditionRe = regexp.MustCompile(`^(\d+)p(?::q(\d+(?:\.\d+)?))?$`)
+
+// parseRenditions parses a list of renditions such as 1080p:q28,720p:q30,480p
+func parseRenditions(s string) ([]rendition, error) {
+	var renditions []rendition
+	for _, spec := range strings.Split(s, ",") {
+		m := renditionRe.FindStringSubmatch(strings.TrimSpace(spec))
+		if m == nil {
+			return nil, fmt.Errorf("invalid rendition %q: expected <height>p[:q<quality>], e.g. 720p:q30", spec)
+		}
+		height, _ := strconv.Atoi(m[1])
+		quality, _ := strconv.ParseFloat(cmp.Or(m[2], "0"), 64)
+		if height <= 0 {
+			return nil, fmt.Errorf("invalid rendition %q: height must be positive", spec)
+		}
+		renditions = append(renditions, rendition{Height: height, Quality: quality})
+	}
+	return renditions, nil
+}
+
+// renditionJob is a rendition that needs encoding
+type renditionJob struct {
+	rendition rendition
+	args      cliArgs
+	savePath  string
+	settings  history.Settings
+}
+
+// renditionFilename returns the output name of a rendition, e.g. "movie [720p, x265].mp4"
+func renditionFilename(template, videoPath string, r rendition, labels nameLabels) string {
+	ext := filepath.Ext(videoPath)
+	stem := strings.TrimSuffix(filepath.Base(videoPath), ext)
+	labels.Resolution, labels.Codec = r.String(), "x265"
+	return formatFilename(template, stripTags(stem), labels, ext)
+}
+
+// runRenditions encodes the renditions of the source that aren't in the history yet.
+// FFmpeg encodes all of them in a single run, HandBrake one after the other.
+func runRenditions(ctx context.Context, args cliArgs, probe ffmpeg.ProbeResult, sourceInfo os.FileInfo, db *history.DB, hash string, encodeDuration time.Duration) (encodeResult, error) {
+	displayWidth, displayHeight := probe.DisplaySize()
+	shortEdge := min(displayWidth, displayHeight)
+
+	var jobs []renditionJob
+	for _, r := range args.Renditions {
+		// Heights are of the short edge, so 1080p of a vertical video is 1080 wide
+		if r.Height > shortEdge {
+			log.Ctx(ctx).Info().Stringer("rendition", r).Int("source_height", shortEdge).Msg("source is smaller than the rendition, skipping")
+			continue
+		}
+
+		job := renditionJob{rendition: r, args: args}
+		if probe.IsVertical() {
+			job.args.Width = r.Height
+		} else {
+			job.args.Height = r.Height
+		}
+		job.args.Quality = cmp.Or(r.Quality, args.Quality)
+		if r.Quality == 0 {
+			displayWidth, displayHeight := probe.DisplaySize()
+			job.args.applyResolutionQuality(ctx, displayWidth, displayHeight)
+		}
+		job.savePath = filepath.Join(args.OutputDir, renditionFilename(args.NameTemplate, inputName(args.VideoPath), r, job.args.nameLabels(probe)))
+		job.settings = encodeSettings(job.args, encodeDuration)
+
+		if rec, ok := db.FindCovering(hash, job.settings); ok && !args.Force {
+			log.Ctx(ctx).Info().
+				Stringer("rendition", r).
+				Str("previous_output", rec.OutputPath).
+				Msg("rendition already encoded with equal or better settings, skipping")
+			continue
+		}
+		jobs = append(jobs, job)
+	}
+
+	if len(jobs) == 0 {
+		return encodeResult{Skipped: true, InputSize: sourceInfo.Size()}, nil
+	}
+
+	if args.Precheck {
+		if err := precheckSource(ctx, args, probe, encodeDuration); err != nil {
+			return encodeResult{}, err
+		}
+	}
+
+	var err error
+	if args.Encoder == "ffmpeg" {
+		err = encodeRenditionsFFmpeg(ctx, args, probe, jobs, encodeDuration)
+	} else {
+		for _, job := range jobs {
+			if err = encode(ctx, job.args, probe, job.savePath, encodeDuration); err != nil {
+				break
+			}
+		}
+	}
+	if err != nil {
+		return encodeResult{}, encoderError{err}
+	}
+
+	for _, job := range jobs {
+		if args.AudioCopy {
+			if err := verifyAudioCopy(ctx, job.args, probe, job.savePath, encodeDuration, true); err != nil {
+				return encodeResult{}, err
+			}
+		}
+
+		preserveAttributes(ctx, args, job.savePath)
+		log.Ctx(ctx).Info().Stringer("rendition", job.rendition).Str("output", job.savePath).Msg("encoded rendition")
+	}
+
+	// Stills are only needed once, the first rendition is usually the best
+	width, height := outputDimensions(displayWidth, displayHeight, jobs[0].args.Width, jobs[0].args.Height)
+	writeStills(ctx, args, jobs[0].savePath, width, height, cmp.Or(encodeDuration, probe.Duration-args.FromTime))
+
+	result := encodeResult{OutputPath: jobs[0].savePath, InputSize: sourceInfo.Size()}
+	if info, err := os.Stat(jobs[0].savePath); err == nil {
+		result.OutputSize = info.Size()
+	}
+	// Recorded once uploaded, so a failed upload is tried again by the next run
+	for _, job := range jobs {
+		if err := uploadOutput(ctx, args, job.savePath); err != nil {
+			return encodeResult{}, err
+		}
+		err := db.Add(history.Record{
+			Hash:       hash,
+			SourcePath: args.VideoPath,
+			OutputPath: outputLocation(args, job.savePath),
+			Settings:   job.settings,
+			EncodedAt:  time.Now(),
+		})
+		if err != nil {
+			return encodeResult{}, err
+		}
+	}
+	result.OutputPath = outputLocation(args, jobs[0].savePath)
+	return result, nil
+}
+
+// encodeRenditionsFFmpeg encodes the renditions in a single FFmpeg run, decoding the source once
+func encodeRenditionsFFmpeg(ctx context.Context, args cliArgs, probe ffmpeg.ProbeResult, jobs []renditionJob, encodeDuration time.Duration) error {
+	ctx, cancel := context.WithCancelCause(ctx)
+	defer cancel(nil)
+
+	if args.Timeout > 0 {
+		go cancelAfter(ctx, args.Timeout, cancel)
+	}
+
+	bars := progressViewFrom(ctx)
+	defer bars.Finish()
+
+	params := ffmpeg.EncodeParams{
+		InputPath: args.VideoPath,
+		Is10Bit:   args.Is10Bit,
+		FromTime:  args.FromTime,
+		Duration:  encodeDuration,
+		ExtraArgs: args.ExtraArgs,
+		AudioCopy: args.AudioCopy,
+
+		VideoEncoder: args.VideoEncoder,
+		LogOutput:    jobLogFrom(ctx),
+		Threads:      args.Threads,
+		AccurateSeek: args.AccurateSeek,
+		InputArgs:    args.FFInputArgs,
+		OutputArgs:   args.FFOutputArgs,
+		VideoFilters: args.VideoFilters,
+		SampleAR:     probe.SampleAR,
+		HWDecode:     args.HWDecode,
+		GPU:          args.GPU,
+		Detelecine:   args.Detelecine == "on",
+		Grain:        args.Grain,
+		Stabilize:    args.Stabilize,
+		Watermark:    args.watermark(),
+		VideoTrack:   args.Streams.VideoTrack,
+		Audio:        ffmpeg.Tracks(args.Streams.Audio),
+		Subtitles:    ffmpeg.Tracks(args.Streams.Subtitles),
+		Attachments:  args.Streams.Attachments,
+		X265Params:   args.X265Params,
+		Tune:         args.encoderTune(),
+	}
+	if !args.AudioCopy {
+		var err error
+		params.AudioEncoder, params.AudioTracks, err = ffmpegAudio(ctx, args, probe, jobs[0].savePath, true)
+		if err != nil {
+			return err
+		}
+	}
+
+	renditions := make([]ffmpeg.Rendition, len(jobs))
+	outputs := make([]string, len(jobs))
+	for i, job := range jobs {
+		renditions[i] = ffmpeg.Rendition{
+			Width:      job.args.Width,
+			Height:     job.args.Height,
+			Quality:    job.args.Quality,
+			OutputPath: job.savePath,
+			Metadata:   metadataOptions(job.args, probe, job.settings),
+		}
+		outputs[i] = job.savePath
+	}
+
+	label := filepath.Base(inputName(args.VideoPath))
+	var eta progress.ETA
+	usage := startUsageMonitor(ctx, args)
+	defer usage.stop(ctx)
+	onProgress := func(p ffmpeg.EncodeProgress) {
+		bars.Update(progress.Status{
+			Label:     label,
+			Phase:     p.Phase,
+			Percent:   p.Percent,
+			FPS:       p.FPSAvg,
+			ETA:       eta.Update(p.Percent, p.ETA),
+			EncodedMB: p.EncodedMB(),
+			Usage:     usage.latest(),
+		})
+	}
+	err := ffmpeg.EncodeRenditions(ctx, params, renditions, onProgress)
+	if err != nil && params.HWDecode && ctx.Err() == nil {
+		log.Ctx(ctx).Warn().Err(err).Msg("hardware decoding failed, retrying with software decoding")
+		params.HWDecode = false
+		eta = progress.ETA{}
+		err = ffmpeg.EncodeRenditions(ctx, params, renditions, onProgress)
+	}
+
+	if errors.Is(context.Cause(ctx), errTimedOut) {
+		return timeoutError(ctx, args.Timeout, outputs...)
+	}
+	if err != nil && ctx.Err() != nil {
+		removePartialOutputs(ctx, outputs...)
+	}
+	return err
+}
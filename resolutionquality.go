@@ -0,0 +1,81 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/rs/zerolog/log"
+)
+
+// resolutionClasses are the resolutions --resolution-quality sets a quality
+// for, from the largest
+var resolutionClasses = []string{"4k", "1440p", "1080p", "720p", "sd"}
+
+// resolutionClass returns the resolution class of a video. Either edge may
+// match, so cropped 1920x800 scope films are 1080p.
+func resolutionClass(width, height int) string {
+	long, short := max(width, height), min(width, height)
+	switch {
+	case long >= 3000 || short >= 2000:
+		return "4k"
+	case long >= 2400 || short >= 1300:
+		return "1440p"
+	case long >= 1800 || short >= 1000:
+		return "1080p"
+	case long >= 1200 || short >= 700:
+		return "720p"
+	}
+	return "sd"
+}
+
+// parseResolutionQuality parses a --resolution-quality list like
+// 4k=40,1080p=35,sd=30 into qualities
+func parseResolutionQuality(s string, qualities *map[string]float64) error {
+	for _, spec := range strings.Split(s, ",") {
+		class, value, ok := strings.Cut(strings.TrimSpace(spec), "=")
+		class = strings.ToLower(strings.TrimSpace(class))
+		if !ok || !slices.Contains(resolutionClasses, class) {
+			return fmt.Errorf("invalid resolution quality %q: expected <resolution>=<quality> with a resolution of %s", spec, strings.Join(resolutionClasses, ", "))
+		}
+		quality, err := strconv.ParseFloat(strings.TrimSpace(value), 64)
+		if err != nil || quality <= 0 {
+			return fmt.Errorf("invalid resolution quality %q: quality must be a positive number", spec)
+		}
+		if *qualities == nil {
+			*qualities = map[string]float64{}
+		}
+		(*qualities)[class] = quality
+	}
+	return nil
+}
+
+// resolutionQuality returns the --resolution-quality of an output of the
+// given size, on top of which --tune and --smart-quality apply
+func (c *cliArgs) resolutionQuality(width, height int) (float64, bool) {
+	if c.QualityGiven || c.Lossless || c.VisuallyLossless {
+		return 0, false
+	}
+	quality, ok := c.ResolutionQuality[resolutionClass(width, height)]
+	if !ok {
+		return 0, false
+	}
+	return quality + c.tuneQualityOffset() + c.smartOffset, true
+}
+
+// applyResolutionQuality sets the quality for the output size of a source
+// shown at the given size, when --quality isn't given
+func (c *cliArgs) applyResolutionQuality(ctx context.Context, displayWidth, displayHeight int) {
+	width, height := outputDimensions(displayWidth, displayHeight, c.Width, c.Height)
+	quality, ok := c.resolutionQuality(width, height)
+	if !ok {
+		return
+	}
+	c.Quality = quality
+	log.Ctx(ctx).Debug().
+		Str("resolution", resolutionClass(width, height)).
+		Float64("quality", quality).
+		Msg("quality set for the output resolution")
+}
@@ -0,0 +1,112 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/rs/zerolog/log"
+)
+
+const (
+	retryDelay    = 30 * time.Second
+	maxRetryDelay = 10 * time.Minute
+)
+
+// transientErrors are messages of failures that are likely to go away when retried
+var transientErrors = []string{
+	// Hardware encoders running out of sessions, usually because another app uses them
+	"OpenEncodeSessionEx failed",
+	"cannot create compression session",
+	"Error initializing an internal MFX session",
+	// Network shares and flaky disks
+	"input/output error",
+	"resource temporarily unavailable",
+	"stale file handle",
+}
+
+// networkErrors are messages of network failures, retried by the steps using
+// the network rather than by encoding the file again
+var networkErrors = []string{
+	"connection reset",
+	"connection timed out",
+}
+
+// isTransient reports whether err is likely to go away when retried
+func isTransient(err error) bool {
+	if errors.Is(err, context.Canceled) || errors.Is(err, errBitrateCollapsed) {
+		return false
+	}
+	if errors.Is(err, syscall.EIO) || errors.Is(err, syscall.EAGAIN) {
+		return true
+	}
+
+	return mentions(err, transientErrors)
+}
+
+// mentions reports whether the message of err contains one of msgs, ignoring case
+func mentions(err error, msgs []string) bool {
+	msg := strings.ToLower(err.Error())
+	for _, s := range msgs {
+		if strings.Contains(msg, strings.ToLower(s)) {
+			return true
+		}
+	}
+	return false
+}
+
+// backoff returns how long to wait before the given retry, starting from 0
+func backoff(retry int) time.Duration {
+	return min(retryDelay<<retry, maxRetryDelay)
+}
+
+// runWithRetries runs the job, retrying transient failures up to args.Retries times
+func runWithRetries(ctx context.Context, args cliArgs) (encodeResult, error) {
+	for retry := 0; ; retry++ {
+		result, err := run(ctx, args)
+		if err == nil || retry >= args.Retries || !isTransient(err) {
+			return result, err
+		}
+
+		delay := backoff(retry)
+		log.Ctx(ctx).Warn().
+			Err(err).
+			Int("retry", retry+1).
+			Int("retries", args.Retries).
+			Dur("delay", delay).
+			Msg("encoding failed with a transient error, retrying")
+
+		select {
+		case <-ctx.Done():
+			return result, err
+		case <-time.After(delay):
+		}
+	}
+}
+
+// retryNetwork runs a step using the network, retrying network failures up
+// to args.Retries times
+func retryNetwork(ctx context.Context, args cliArgs, step string, run func() error) error {
+	for retry := 0; ; retry++ {
+		err := run()
+		if err == nil || retry >= args.Retries || !mentions(err, networkErrors) {
+			return err
+		}
+
+		delay := backoff(retry)
+		log.Ctx(ctx).Warn().
+			Err(err).
+			Int("retry", retry+1).
+			Int("retries", args.Retries).
+			Dur("delay", delay).
+			Msgf("%s failed with a network error, retrying", step)
+
+		select {
+		case <-ctx.Done():
+			return err
+		case <-time.After(delay):
+		}
+	}
+}
@@ -0,0 +1,367 @@
+package main
+
+import (
+	"cmp"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"sync"
+	"syscall"
+	"text/tabwriter"
+
+	"github.com/rs/zerolog/log"
+
+	"encz/ffmpeg"
+	"encz/library"
+)
+
+// scanProbeWorkers is the number of files probed at once. Probing mostly
+// waits on the disk, networked libraries especially.
+const scanProbeWorkers = 4
+
+// hevcTargetBPP is the bits per pixel of each frame typical of x265 outputs
+// at the default quality, which caps the estimated output bitrate
+const hevcTargetBPP = 0.06
+
+// scanCandidate is a library file worth re-encoding, with its estimated savings
+type scanCandidate struct {
+	Path          string  `json:"path"`
+	Codec         string  `json:"codec"`
+	Width         int     `json:"width"`
+	Height        int     `json:"height"`
+	BitrateKbps   int64   `json:"bitrate_kbps"`
+	Size          int64   `json:"size"`
+	EstimatedSize int64   `json:"estimated_size"`
+	SavedPercent  float64 `json:"estimated_saved_percent"`
+
+	probe ffmpeg.ProbeResult
+}
+
+// savedBytes returns the estimated savings of re-encoding the file
+func (c scanCandidate) savedBytes() int64 {
+	return c.Size - c.EstimatedSize
+}
+
+// scanMain implements `encz scan [flags] <root>`, listing the files of a
+// library worth re-encoding without touching them
+func scanMain(arguments []string) {
+	fs := flag.NewFlagSet("scan", flag.ExitOnError)
+	format := fs.String("format", "table", "output format: table, csv or json")
+	minSavings := fs.Float64("min-savings", 20, "only list files with at least this estimated percentage saved")
+	estimateFiles := fs.Int("estimate-files", 2, "files of each resolution class encoded by --estimate")
+	var filter library.Filter
+	listVar(fs, "include", "only scan files matching this glob, e.g. '*.mkv' (repeatable)", func() { filter.Include = nil }, func(s string) error {
+		filter.Include = append(filter.Include, s)
+		return nil
+	})
+	listVar(fs, "exclude", "skip files and directories matching this glob, e.g. '*sample*' (repeatable)", func() { filter.Exclude = nil }, func(s string) error {
+		filter.Exclude = append(filter.Exclude, s)
+		return nil
+	})
+
+	args := parseArgs(fs, arguments)
+	if err := setupLogging(args); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+
+	ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer cancel()
+
+	if args.VideoPath == "" {
+		exitInvalid(ctx, errors.New("library root is required"))
+	}
+	switch *format {
+	case "table", "csv", "json":
+	default:
+		exitInvalid(ctx, fmt.Errorf("invalid --format %q, expected table, csv or json", *format))
+	}
+	if err := filter.Validate(); err != nil {
+		exitInvalid(ctx, err)
+	}
+	if args.Estimate {
+		// Scanning never asks before encoding, the samples are all it encodes
+		args.Yes = true
+		if err := args.Validate(); err != nil {
+			exitInvalid(ctx, err)
+		}
+		if *estimateFiles < 1 {
+			exitInvalid(ctx, errors.New("--estimate-files must be at least 1"))
+		}
+		checkPreflight(ctx, args)
+	}
+
+	root, err := filepath.Abs(args.VideoPath)
+	if err != nil {
+		exitInvalid(ctx, fmt.Errorf("failed to get absolute path: %w", err))
+	}
+	args.VideoPath = root
+
+	candidates, err := scanLibrary(ctx, root, filter, *minSavings)
+	exitOnError(ctx, err)
+	exitOnError(ctx, writeScanReport(os.Stdout, *format, candidates))
+	if !args.Estimate {
+		return
+	}
+
+	projections, err := projectSavings(ctx, args, candidates, *estimateFiles)
+	exitOnError(ctx, err)
+	// The projection is for people, CSV and JSON on stdout stay parseable
+	w := os.Stdout
+	if *format != "table" {
+		w = os.Stderr
+	} else {
+		fmt.Fprintln(w)
+	}
+	exitOnError(ctx, printProjections(w, projections))
+}
+
+// scanLibrary probes the video files under root and returns those estimated to
+// save at least minSavings percent, the largest savings first
+func scanLibrary(ctx context.Context, root string, filter library.Filter, minSavings float64) ([]scanCandidate, error) {
+	files, err := library.Walk(root, filter)
+	if err != nil {
+		return nil, err
+	}
+	log.Ctx(ctx).Info().Str("root", root).Int("files", len(files)).Msg("scanning library")
+
+	paths := make(chan string)
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	var candidates []scanCandidate
+	for range min(scanProbeWorkers, len(files)) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for rel := range paths {
+				candidate, ok := scanFile(ctx, root, rel)
+				if !ok || candidate.SavedPercent < minSavings {
+					continue
+				}
+				mu.Lock()
+				candidates = append(candidates, candidate)
+				mu.Unlock()
+			}
+		}()
+	}
+	for _, rel := range files {
+		if ctx.Err() != nil {
+			break
+		}
+		paths <- rel
+	}
+	close(paths)
+	wg.Wait()
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	slices.SortFunc(candidates, func(a, b scanCandidate) int {
+		return cmp.Or(cmp.Compare(b.savedBytes(), a.savedBytes()), cmp.Compare(a.Path, b.Path))
+	})
+	return candidates, nil
+}
+
+// scanFile probes a library file and estimates what re-encoding it saves. It
+// reports false for files that fail to probe or that library runs skip.
+func scanFile(ctx context.Context, root, rel string) (scanCandidate, bool) {
+	path := filepath.Join(root, rel)
+	probe, err := ffmpeg.Probe(ctx, path)
+	if err != nil {
+		log.Ctx(ctx).Warn().Err(err).Str("file", path).Msg("failed to probe library file")
+		return scanCandidate{}, false
+	}
+	if reason := librarySkipReason(probe); reason != "" {
+		log.Ctx(ctx).Debug().Str("file", path).Str("reason", reason).Msg("not a candidate")
+		return scanCandidate{}, false
+	}
+
+	size := probe.SizeBytes
+	if info, err := os.Stat(path); err == nil {
+		size = info.Size()
+	}
+	candidate := scanCandidate{
+		probe:       probe,
+		Path:        rel,
+		Codec:       probe.Codec,
+		Width:       probe.Width,
+		Height:      probe.Height,
+		BitrateKbps: probe.Bitrate / 1000,
+		Size:        size,
+	}
+
+	bitrate := estimatedBitrate(probe)
+	if bitrate == 0 || probe.Bitrate == 0 || size == 0 {
+		return scanCandidate{}, false
+	}
+	candidate.EstimatedSize = int64(float64(size) * min(1, bitrate/float64(probe.Bitrate)))
+	candidate.SavedPercent = float64(candidate.savedBytes()*1000/size) / 10
+	return candidate, true
+}
+
+// estimatedBitrate returns the rough bitrate of an HEVC encode of the source:
+// its bitrate scaled by how much more efficient HEVC is than its codec, capped
+// at what x265 typically needs for its size. 0 when the source bitrate is unknown.
+func estimatedBitrate(probe ffmpeg.ProbeResult) float64 {
+	if probe.Bitrate <= 0 {
+		return 0
+	}
+	efficiency := cmp.Or(codecEfficiency[probe.Codec], 1)
+	bitrate := float64(probe.Bitrate) * codecEfficiency["hevc"] / efficiency
+	if target := hevcTargetBPP * float64(probe.Width*probe.Height) * probe.FPS; target > 0 {
+		bitrate = min(bitrate, target)
+	}
+	return bitrate
+}
+
+// writeScanReport writes the candidates in format, a table ending with their totals
+func writeScanReport(w io.Writer, format string, candidates []scanCandidate) error {
+	switch format {
+	case "json":
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		if candidates == nil {
+			candidates = []scanCandidate{}
+		}
+		return enc.Encode(candidates)
+	case "csv":
+		cw := csv.NewWriter(w)
+		_ = cw.Write([]string{"path", "codec", "width", "height", "bitrate_kbps", "size", "estimated_size", "estimated_saved_percent"})
+		for _, c := range candidates {
+			_ = cw.Write([]string{
+				c.Path, c.Codec, strconv.Itoa(c.Width), strconv.Itoa(c.Height),
+				strconv.FormatInt(c.BitrateKbps, 10), strconv.FormatInt(c.Size, 10),
+				strconv.FormatInt(c.EstimatedSize, 10), strconv.FormatFloat(c.SavedPercent, 'f', -1, 64),
+			})
+		}
+		cw.Flush()
+		return cw.Error()
+	}
+
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "FILE\tCODEC\tRESOLUTION\tBITRATE\tSIZE\tESTIMATED\tSAVED\t")
+	var size, estimated int64
+	for _, c := range candidates {
+		fmt.Fprintf(tw, "%s\t%s\t%dx%d\t%dkb/s\t%s\t%s\t%.1f%%\t\n",
+			c.Path, c.Codec, c.Width, c.Height, c.BitrateKbps,
+			formatBytes(c.Size), formatBytes(c.EstimatedSize), c.SavedPercent)
+		size += c.Size
+		estimated += c.EstimatedSize
+	}
+	saved := 0.0
+	if size > 0 {
+		saved = float64((size-estimated)*1000/size) / 10
+	}
+	fmt.Fprintf(tw, "total\t%d files\t\t\t%s\t%s\t%.1f%%\t\n", len(candidates), formatBytes(size), formatBytes(estimated), saved)
+	return tw.Flush()
+}
+
+// classProjection is the expected outcome of encoding the candidates of a
+// resolution class, extrapolated from encoding samples of a few of them
+type classProjection struct {
+	Class   string
+	Files   int
+	Sampled int
+	Size    int64
+	// Projected is the expected total size of the outputs
+	Projected int64
+}
+
+// projectSavings estimates the outputs of a few candidates of each resolution
+// class with the encoder settings of args, the way --estimate does for a single
+// file, and extrapolates their ratio to the other candidates of the class.
+// Classes where every estimate fails fall back to the bitrate estimates.
+func projectSavings(ctx context.Context, args cliArgs, candidates []scanCandidate, perClass int) ([]classProjection, error) {
+	classes := map[string][]scanCandidate{}
+	for _, c := range candidates {
+		class := resolutionClass(c.probe.DisplaySize())
+		classes[class] = append(classes[class], c)
+	}
+
+	var projections []classProjection
+	for _, class := range resolutionClasses {
+		files := classes[class]
+		if len(files) == 0 {
+			continue
+		}
+		projection := classProjection{Class: class, Files: len(files)}
+
+		var sampledSize, sampledEstimate int64
+		samples := min(perClass, len(files))
+		for i := range samples {
+			// Spread over the class, which is sorted by savings
+			c := files[i*len(files)/samples]
+			estimate, err := estimateCandidate(ctx, args, c)
+			if err != nil {
+				if ctx.Err() != nil {
+					return nil, ctx.Err()
+				}
+				log.Ctx(ctx).Warn().Err(err).Str("file", c.Path).Msg("failed to estimate the output size")
+				continue
+			}
+			log.Ctx(ctx).Info().
+				Str("file", c.Path).
+				Str("size", formatBytes(c.Size)).
+				Str("estimated_size", formatBytes(estimate)).
+				Msg("estimated output size")
+			projection.Sampled++
+			sampledSize += c.Size
+			sampledEstimate += estimate
+		}
+
+		for _, c := range files {
+			projection.Size += c.Size
+			projection.Projected += c.EstimatedSize
+		}
+		if sampledSize > 0 {
+			projection.Projected = int64(float64(projection.Size) * float64(sampledEstimate) / float64(sampledSize))
+		}
+		projections = append(projections, projection)
+	}
+	return projections, nil
+}
+
+// estimateCandidate estimates the output size of a candidate under the library
+// root args.VideoPath with the settings run would encode it with
+func estimateCandidate(ctx context.Context, args cliArgs, c scanCandidate) (int64, error) {
+	args.VideoPath = filepath.Join(args.VideoPath, c.Path)
+	if err := args.applyLanguages(ctx, c.probe); err != nil {
+		return 0, err
+	}
+	args.applySmartQuality(ctx, c.probe)
+	displayWidth, displayHeight := c.probe.DisplaySize()
+	args.applyResolutionQuality(ctx, displayWidth, displayHeight)
+	args.GPU = resolveGPU(ctx, args)
+	return estimateSize(ctx, args, c.probe, 0)
+}
+
+// printProjections prints the projected savings of each resolution class and their total
+func printProjections(w io.Writer, projections []classProjection) error {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "CLASS\tFILES\tSAMPLED\tSIZE\tPROJECTED\tSAVED\t")
+	var total classProjection
+	for _, p := range projections {
+		fmt.Fprintf(tw, "%s\t%d\t%d\t%s\t%s\t%s\t\n",
+			p.Class, p.Files, p.Sampled, formatBytes(p.Size), formatBytes(p.Projected), formatBytes(p.Size-p.Projected))
+		total.Files += p.Files
+		total.Sampled += p.Sampled
+		total.Size += p.Size
+		total.Projected += p.Projected
+	}
+	saved := 0.0
+	if total.Size > 0 {
+		saved = float64((total.Size-total.Projected)*1000/total.Size) / 10
+	}
+	fmt.Fprintf(tw, "total\t%d\t%d\t%s\t%s\t%s (%.1f%%)\t\n",
+		total.Files, total.Sampled, formatBytes(total.Size), formatBytes(total.Projected), formatBytes(total.Size-total.Projected), saved)
+	return tw.Flush()
+}
@@ -0,0 +1,98 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/rs/zerolog/log"
+)
+
+// schedule is a daily time window in local time, which may wrap around midnight
+type schedule struct {
+	start time.Duration
+	end   time.Duration
+}
+
+// parseSchedule parses a window like 23:00-07:00
+func parseSchedule(s string) (*schedule, error) {
+	from, to, ok := strings.Cut(s, "-")
+	if !ok {
+		return nil, fmt.Errorf("invalid --schedule %q: expected HH:MM-HH:MM", s)
+	}
+
+	start, err := parseClock(from)
+	if err != nil {
+		return nil, fmt.Errorf("invalid --schedule %q: %w", s, err)
+	}
+	end, err := parseClock(to)
+	if err != nil {
+		return nil, fmt.Errorf("invalid --schedule %q: %w", s, err)
+	}
+	if start == end {
+		return nil, fmt.Errorf("invalid --schedule %q: window is empty", s)
+	}
+
+	return &schedule{start: start, end: end}, nil
+}
+
+// parseClock parses HH:MM into the time since midnight
+func parseClock(s string) (time.Duration, error) {
+	t, err := time.Parse("15:04", strings.TrimSpace(s))
+	if err != nil {
+		return 0, fmt.Errorf("invalid time %q", s)
+	}
+	return time.Duration(t.Hour())*time.Hour + time.Duration(t.Minute())*time.Minute, nil
+}
+
+// sinceMidnight returns the local time of day of t
+func sinceMidnight(t time.Time) time.Duration {
+	h, m, s := t.Clock()
+	return time.Duration(h)*time.Hour + time.Duration(m)*time.Minute + time.Duration(s)*time.Second
+}
+
+// open reports whether t is inside the window
+func (s *schedule) open(t time.Time) bool {
+	now := sinceMidnight(t)
+	if s.start < s.end {
+		return now >= s.start && now < s.end
+	}
+	return now >= s.start || now < s.end
+}
+
+// nextOpen returns when the window opens next after t
+func (s *schedule) nextOpen(t time.Time) time.Time {
+	midnight := time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, t.Location())
+	next := midnight.Add(s.start)
+	if !next.After(t) {
+		next = next.AddDate(0, 0, 1)
+	}
+	return next
+}
+
+// wait blocks until the window is open
+func (s *schedule) wait(ctx context.Context) error {
+	now := time.Now()
+	if s.open(now) {
+		return nil
+	}
+
+	next := s.nextOpen(now)
+	log.Ctx(ctx).Info().Time("starts_at", next).Msg("outside the schedule window, waiting")
+
+	timer := time.NewTimer(time.Until(next))
+	defer timer.Stop()
+
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
+
+// closed reports whether the window is closed now
+func (s *schedule) closed() bool {
+	return !s.open(time.Now())
+}
@@ -0,0 +1,569 @@
+package main
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog/log"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/timestamppb"
+
+	"encz/api"
+	"encz/progress"
+)
+
+// defaultServeAddress is where the job API listens, reachable from this machine only
+const defaultServeAddress = "localhost:50051"
+
+// serveArgs represents the arguments of the serve command
+type serveArgs struct {
+	cliArgs
+	// Listen is the address of the gRPC job API
+	Listen string
+	// HealthListen is the address of the HTTP health checks, off when empty
+	HealthListen string
+	// DrainTimeout bounds how long SIGTERM waits for the running job, 0 waits for it
+	DrainTimeout time.Duration
+	// MediaDir is the folder relative paths of the submitted jobs are in
+	MediaDir string
+	// PathMaps translate the paths of the clients to paths of the server, as from=to
+	PathMaps []string
+	// APIKeys authenticate the callers, who name themselves when there are none
+	APIKeys []apiKey
+	// Admins are the callers seeing and cancelling the jobs of everyone
+	Admins []string
+}
+
+// serveFlags registers the flags of the serve command besides the encoding ones
+func serveFlags(fs *flag.FlagSet, args *serveArgs) {
+	fs.StringVar(&args.Listen, "listen", defaultServeAddress, "address of the gRPC job API, e.g. :50051 for every interface")
+	fs.StringVar(&args.HealthListen, "health-listen", "", "address of the /healthz and /readyz HTTP endpoints, e.g. :8080 (default: off)")
+	fs.DurationVar(&args.DrainTimeout, "drain-timeout", 0, "on SIGTERM, cancel the running job if it hasn't finished after this long (default: wait for it)")
+	fs.StringVar(&args.MediaDir, "media-dir", "", "folder relative paths of submitted jobs and their output folders are in, like a volume mounted in a container")
+	listVar(fs, "path-map", "translate paths of the clients to paths of the server, as from=to (repeatable or comma-separated)", func() { args.PathMaps = nil }, func(s string) error {
+		for _, m := range splitList(s) {
+			if !strings.Contains(m, "=") {
+				return fmt.Errorf("expected from=to, got %q", m)
+			}
+			args.PathMaps = append(args.PathMaps, m)
+		}
+		return nil
+	})
+	listVar(fs, "api-keys", "require API keys, as comma-separated name:key pairs naming the submitters (default: callers name themselves)", func() { args.APIKeys = nil }, func(s string) error {
+		return parseAPIKeys(s, &args.APIKeys)
+	})
+	listVar(fs, "admins", "comma-separated submitters seeing and cancelling the jobs of everyone", func() { args.Admins = nil }, func(s string) error {
+		args.Admins = append(args.Admins, splitList(s)...)
+		return nil
+	})
+}
+
+// serveMain implements `encz serve [flags]`, running the encodes submitted
+// over the gRPC job API one at a time
+func serveMain(arguments []string) {
+	fs := flag.NewFlagSet("serve", flag.ExitOnError)
+	var args serveArgs
+	serveFlags(fs, &args)
+	args.cliArgs = parseArgs(fs, arguments)
+
+	if err := setupLogging(args.cliArgs); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+
+	ctx, cancel := drainContext(args.DrainTimeout)
+	defer cancel()
+	watchPauseSignals(ctx)
+	watchStatusSignal(ctx)
+
+	// Files come from the clients rather than the command line
+	if args.VideoPath != "" {
+		exitInvalid(ctx, errors.New("encz serve encodes the files submitted over the job API, it takes no file"))
+	}
+	if err := cmp.Or(args.validateOutput(), args.validateEncoding(), args.validateBatch(), args.validateMediaDir(), args.validateAdmins()); err != nil {
+		exitInvalid(ctx, err)
+	}
+
+	checkPreflight(ctx, args.cliArgs)
+	defer acquireLock(ctx, args.cliArgs)()
+
+	listener, err := net.Listen("tcp", args.Listen)
+	if err != nil {
+		exitOnError(ctx, fmt.Errorf("failed to listen for the job API: %w", err))
+	}
+
+	server := newJobServer(ctx, args, arguments)
+	// The running job removes its partial outputs before the server exits
+	runnerDone := make(chan struct{})
+	go func() {
+		defer close(runnerDone)
+		server.run(ctx)
+		cancel()
+	}()
+
+	grpcServer := grpc.NewServer()
+	api.RegisterEncoderServer(grpcServer, server)
+	go func() {
+		<-ctx.Done()
+		grpcServer.GracefulStop()
+	}()
+
+	if args.HealthListen != "" {
+		health, err := startHealthServer(ctx, args.HealthListen)
+		if err != nil {
+			exitOnError(ctx, err)
+		}
+		defer health.Close()
+	}
+
+	log.Ctx(ctx).Info().Str("address", listener.Addr().String()).Msg("serving the job API")
+	if err := grpcServer.Serve(listener); err != nil {
+		exitOnError(ctx, fmt.Errorf("failed to serve the job API: %w", err))
+	}
+	<-runnerDone
+}
+
+// jobServer queues the jobs submitted over the job API and runs them in turn
+type jobServer struct {
+	api.UnimplementedEncoderServer
+
+	args serveArgs
+	// arguments is the command line of the server, which job presets are applied to
+	arguments []string
+	// submitted wakes up the runner when a job is queued
+	submitted chan struct{}
+	// stopped is closed when the server stops, ending the watches
+	stopped <-chan struct{}
+
+	mu   sync.Mutex
+	jobs []*serverJob
+	// queue holds the queued jobs in the order they run
+	queue  []*serverJob
+	nextID int
+}
+
+// serverJob is a job of the server. Its state is guarded by the server's mutex.
+type serverJob struct {
+	args  cliArgs
+	state *api.Job
+	// changed is closed and replaced whenever the state changes
+	changed chan struct{}
+	// cancel stops the job while it runs
+	cancel context.CancelFunc
+}
+
+func newJobServer(ctx context.Context, args serveArgs, arguments []string) *jobServer {
+	return &jobServer{
+		args:      args,
+		arguments: arguments,
+		submitted: make(chan struct{}, 1),
+		stopped:   ctx.Done(),
+		nextID:    1,
+	}
+}
+
+// finished reports whether a job in state won't change anymore
+func finished(state api.Job_State) bool {
+	switch state {
+	case api.Job_STATE_ENCODED, api.Job_STATE_SKIPPED, api.Job_STATE_FAILED, api.Job_STATE_CANCELLED:
+		return true
+	}
+	return false
+}
+
+func (s *jobServer) Submit(ctx context.Context, req *api.SubmitRequest) (*api.Job, error) {
+	if stopping() {
+		return nil, status.Error(codes.Unavailable, "the server is stopping")
+	}
+	caller, err := s.caller(ctx)
+	if err != nil {
+		return nil, err
+	}
+	priority, err := jobPriority(req.Priority)
+	if err != nil {
+		return nil, err
+	}
+	args, err := s.jobArgs(req)
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+
+	s.mu.Lock()
+	job := &serverJob{
+		args: args,
+		state: &api.Job{
+			Id:          strconv.Itoa(s.nextID),
+			Path:        args.VideoPath,
+			State:       api.Job_STATE_QUEUED,
+			SubmittedAt: timestamppb.Now(),
+			Submitter:   caller.Name,
+			Priority:    priority,
+		},
+		changed: make(chan struct{}),
+	}
+	s.nextID++
+	s.jobs = append(s.jobs, job)
+	s.enqueue(job)
+	reply := s.reply(job)
+	s.mu.Unlock()
+
+	select {
+	case s.submitted <- struct{}{}:
+	default:
+	}
+	log.Ctx(ctx).Info().Str("job", reply.Id).Str("submitter", caller.Name).Str("file", args.VideoPath).Msg("job submitted")
+	return reply, nil
+}
+
+// jobArgs returns the arguments encoding the file of req: the server's, with
+// the presets and overrides of req
+func (s *jobServer) jobArgs(req *api.SubmitRequest) (cliArgs, error) {
+	path, err := s.localPath(req.Path)
+	if err != nil {
+		return cliArgs{}, err
+	}
+	if _, err := os.Stat(path); err != nil {
+		return cliArgs{}, fmt.Errorf("no such file: %s", req.Path)
+	}
+	outputDir, err := s.localPath(req.OutputDir)
+	if err != nil {
+		return cliArgs{}, err
+	}
+
+	args := s.args.cliArgs
+	if req.Preset != "" {
+		// The config loaded at startup, a client mustn't stop the server with a broken one
+		fs := flag.NewFlagSet("serve", flag.ContinueOnError)
+		fs.SetOutput(io.Discard)
+		serveFlags(fs, &serveArgs{})
+		if args, err = readArgs(fs, append([]string{"-preset", req.Preset}, s.arguments...), &s.args.ConfigFile); err != nil {
+			return cliArgs{}, err
+		}
+	}
+
+	args.VideoPath = path
+	args.OutputDir = cmp.Or(outputDir, args.OutputDir)
+	if req.Quality != nil {
+		args.Quality, args.QualityGiven = req.GetQuality(), true
+	}
+	args.Force = args.Force || req.Force
+	if err := args.Validate(); err != nil {
+		return cliArgs{}, err
+	}
+	return args, nil
+}
+
+func (s *jobServer) GetJob(ctx context.Context, req *api.JobRequest) (*api.Job, error) {
+	caller, err := s.caller(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	job, err := s.find(req.Id, caller)
+	if err != nil {
+		return nil, err
+	}
+	return s.reply(job), nil
+}
+
+func (s *jobServer) ListJobs(ctx context.Context, req *api.ListJobsRequest) (*api.ListJobsResponse, error) {
+	caller, err := s.caller(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if req.All && !caller.Admin {
+		return nil, status.Errorf(codes.PermissionDenied, "%s is not an admin, only admins list the jobs of everyone", caller.Name)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	reply := &api.ListJobsResponse{}
+	for _, job := range s.jobs {
+		// Admins see their own jobs too unless they ask for all of them
+		if req.All || job.state.Submitter == caller.Name {
+			reply.Jobs = append(reply.Jobs, s.reply(job))
+		}
+	}
+	return reply, nil
+}
+
+func (s *jobServer) Watch(req *api.JobRequest, stream grpc.ServerStreamingServer[api.Job]) error {
+	caller, err := s.caller(stream.Context())
+	if err != nil {
+		return err
+	}
+
+	for {
+		s.mu.Lock()
+		job, err := s.find(req.Id, caller)
+		if err != nil {
+			s.mu.Unlock()
+			return err
+		}
+		state, changed := s.reply(job), job.changed
+		s.mu.Unlock()
+
+		if err := stream.Send(state); err != nil {
+			return err
+		}
+		if finished(state.State) {
+			return nil
+		}
+
+		select {
+		case <-changed:
+		case <-stream.Context().Done():
+			return stream.Context().Err()
+		case <-s.stopped:
+			// The last job finishes right before the server stops
+			select {
+			case <-changed:
+				continue
+			default:
+			}
+			return status.Error(codes.Unavailable, "the server is stopping")
+		}
+	}
+}
+
+func (s *jobServer) Cancel(ctx context.Context, req *api.JobRequest) (*api.Job, error) {
+	caller, err := s.caller(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	job, err := s.find(req.Id, caller)
+	if err != nil {
+		return nil, err
+	}
+	switch {
+	case finished(job.state.State):
+		return nil, status.Errorf(codes.FailedPrecondition, "job %s is already finished", req.Id)
+	case job.state.State == api.Job_STATE_QUEUED:
+		s.dequeue(job)
+		s.changeLocked(job, func(state *api.Job) {
+			state.State = api.Job_STATE_CANCELLED
+			state.FinishedAt = timestamppb.Now()
+		})
+	default:
+		// The runner records the job as cancelled once the encode stopped
+		job.cancel()
+	}
+	log.Ctx(ctx).Info().Str("job", req.Id).Str("by", caller.Name).Msg("job cancelled")
+	return s.reply(job), nil
+}
+
+// reply returns a copy of the state of job to send, with the paths of the
+// client. The mutex must be held.
+func (s *jobServer) reply(job *serverJob) *api.Job {
+	state := proto.Clone(job.state).(*api.Job)
+	state.Path = s.clientPath(state.Path)
+	state.OutputPath = s.clientPath(state.OutputPath)
+	return state
+}
+
+// localPath translates a path given by a client to a path of the server
+func (s *jobServer) localPath(path string) (string, error) {
+	if path == "" {
+		return "", nil
+	}
+	path = mapPath(path, s.args.PathMaps)
+	if s.args.MediaDir == "" {
+		if !filepath.IsAbs(path) {
+			return "", fmt.Errorf("path must be absolute without --media-dir, got %q", path)
+		}
+		return filepath.Clean(path), nil
+	}
+
+	// Clients only reach the media folder, absolute paths included
+	if !filepath.IsAbs(path) {
+		path = filepath.Join(s.args.MediaDir, path)
+	}
+	path = filepath.Clean(path)
+	if _, ok := relativeTo(s.args.MediaDir, path); !ok {
+		return "", fmt.Errorf("%s is outside of the media folder", path)
+	}
+	// Nor through the symlinks in it
+	if resolved, err := filepath.EvalSymlinks(path); err == nil {
+		root, err := filepath.EvalSymlinks(s.args.MediaDir)
+		if err != nil {
+			return "", fmt.Errorf("failed to resolve the media folder: %w", err)
+		}
+		if _, ok := relativeTo(root, resolved); !ok {
+			return "", fmt.Errorf("%s is outside of the media folder", path)
+		}
+	}
+	return path, nil
+}
+
+// clientPath translates a path of the server back to the path a client knows
+func (s *jobServer) clientPath(path string) string {
+	if path == "" {
+		return ""
+	}
+	for _, m := range s.args.PathMaps {
+		from, to, _ := strings.Cut(m, "=")
+		if rest, ok := strings.CutPrefix(path, to); ok {
+			return from + rest
+		}
+	}
+	if s.args.MediaDir != "" {
+		if rel, ok := relativeTo(s.args.MediaDir, path); ok {
+			return rel
+		}
+	}
+	return path
+}
+
+// find returns the job with the given ID if c owns it, the mutex must be
+// held. The jobs of others are not found, rather than forbidden, so their
+// IDs aren't given away.
+func (s *jobServer) find(id string, c caller) (*serverJob, error) {
+	for _, job := range s.jobs {
+		if job.state.Id == id && c.owns(job.state.Submitter) {
+			return job, nil
+		}
+	}
+	return nil, status.Errorf(codes.NotFound, "no job %s", id)
+}
+
+// change updates the state of job, waking up its watchers
+func (s *jobServer) change(job *serverJob, update func(state *api.Job)) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.changeLocked(job, update)
+}
+
+// changeLocked is change with the mutex held
+func (s *jobServer) changeLocked(job *serverJob, update func(state *api.Job)) {
+	update(job.state)
+	close(job.changed)
+	job.changed = make(chan struct{})
+}
+
+// run runs the queued jobs in turn until ctx is cancelled or the user asked
+// to stop after the current job
+func (s *jobServer) run(ctx context.Context) {
+	for ctx.Err() == nil {
+		if stopping() {
+			log.Ctx(ctx).Warn().Msg("stopping before the next job, as asked")
+			return
+		}
+		job, jobCtx, ok := s.next(ctx)
+		if !ok {
+			select {
+			case <-ctx.Done():
+			case <-s.submitted:
+			case <-stopRequests:
+			}
+			continue
+		}
+		s.runJob(ctx, jobCtx, job)
+	}
+}
+
+// next marks the first queued job as running and returns it, with the context
+// cancelling it
+func (s *jobServer) next(ctx context.Context) (*serverJob, context.Context, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if len(s.queue) == 0 {
+		return nil, nil, false
+	}
+	job := s.queue[0]
+	s.dequeue(job)
+
+	var jobCtx context.Context
+	jobCtx, job.cancel = context.WithCancel(ctx)
+	s.changeLocked(job, func(state *api.Job) {
+		state.State = api.Job_STATE_RUNNING
+		state.StartedAt = timestamppb.Now()
+	})
+	return job, jobCtx, true
+}
+
+// runJob encodes the file of a running job and records its outcome
+func (s *jobServer) runJob(ctx, jobCtx context.Context, job *serverJob) {
+	defer job.cancel()
+	jobCtx = withProgressView(jobCtx, jobView{server: s, job: job})
+	log.Ctx(ctx).Info().Str("job", job.state.Id).Str("submitter", job.state.Submitter).Str("file", job.args.VideoPath).Msg("starting job")
+
+	result, err := runJob(jobCtx, job.args)
+
+	s.change(job, func(state *api.Job) {
+		state.FinishedAt = timestamppb.Now()
+		state.Phase, state.EtaSeconds = "", 0
+		state.OutputPath = result.OutputPath
+		state.InputSize, state.OutputSize = result.InputSize, result.OutputSize
+		switch {
+		case err != nil && (errors.Is(err, context.Canceled) || jobCtx.Err() != nil):
+			state.State = api.Job_STATE_CANCELLED
+		case err != nil:
+			state.State, state.Error = api.Job_STATE_FAILED, err.Error()
+		case result.Skipped:
+			state.State = api.Job_STATE_SKIPPED
+		default:
+			state.State, state.Percent = api.Job_STATE_ENCODED, 100
+		}
+	})
+
+	event := log.Ctx(ctx).Info()
+	if err != nil && jobCtx.Err() == nil {
+		event = log.Ctx(ctx).Error().Err(err)
+	}
+	event.Str("job", job.state.Id).Str("file", job.args.VideoPath).Msg("job finished")
+}
+
+// jobView records the progress of a job in its state
+type jobView struct {
+	server *jobServer
+	job    *serverJob
+}
+
+func (v jobView) Update(s progress.Status) {
+	v.server.change(v.job, func(state *api.Job) {
+		state.Phase = s.Phase
+		state.Percent = s.Percent
+		state.Fps = s.FPS
+		state.EtaSeconds = int64(s.ETA.Round(time.Second).Seconds())
+	})
+}
+
+func (jobView) Remove(string) {}
+func (jobView) Finish()       {}
+
+// validateMediaDir checks that --media-dir is an existing folder
+func (c *serveArgs) validateMediaDir() error {
+	if c.MediaDir == "" {
+		return nil
+	}
+	if !filepath.IsAbs(c.MediaDir) {
+		return fmt.Errorf("--media-dir must be absolute, got %q", c.MediaDir)
+	}
+	if info, err := os.Stat(c.MediaDir); err != nil || !info.IsDir() {
+		return fmt.Errorf("--media-dir %s is not a folder", c.MediaDir)
+	}
+	return nil
+}
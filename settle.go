@@ -0,0 +1,54 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/rs/zerolog/log"
+)
+
+// settleInterval is how often a source still being written is checked again
+const settleInterval = 10 * time.Second
+
+// unsettledReason returns why the file at path may still be being written, or
+// an empty string when it's been left alone for quietPeriod or quietPeriod is 0
+func unsettledReason(path string, quietPeriod time.Duration) (string, error) {
+	if quietPeriod <= 0 {
+		return "", nil
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		return "", fmt.Errorf("failed to stat video: %w", err)
+	}
+	// Torrent clients preallocate files, their size doesn't change while downloading
+	if age := time.Since(info.ModTime()); age < quietPeriod {
+		return fmt.Sprintf("modified %s ago", age.Round(time.Second)), nil
+	}
+	if openForWriting(path) {
+		return "open for writing by another process", nil
+	}
+	return "", nil
+}
+
+// waitSettled blocks until the file at path is no longer being written
+func waitSettled(ctx context.Context, path string, quietPeriod time.Duration) error {
+	logged := false
+	for {
+		reason, err := unsettledReason(path, quietPeriod)
+		if err != nil || reason == "" {
+			return err
+		}
+		if !logged {
+			log.Ctx(ctx).Info().Str("file", path).Str("reason", reason).Msg("source is still being written, waiting")
+			logged = true
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(settleInterval):
+		}
+	}
+}
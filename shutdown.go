@@ -0,0 +1,76 @@
+package main
+
+import (
+	"context"
+	"os"
+	"os/signal"
+	"sync/atomic"
+	"syscall"
+	"time"
+
+	"github.com/rs/zerolog/log"
+)
+
+// stopRequested is set by the first Ctrl-C
+var stopRequested atomic.Bool
+
+// stopRequests is closed by the first Ctrl-C, waking up the runs waiting for work
+var stopRequests = make(chan struct{})
+
+// stopping reports whether the user asked to stop after the current file.
+// Batches check it before taking the next one.
+func stopping() bool {
+	return stopRequested.Load()
+}
+
+// interruptContext returns a context cancelled on the second Ctrl-C, which
+// stops the running encoders and removes their partial outputs. The first one
+// lets the current file finish, see stopping. SIGTERM cancels right away,
+// service managers don't wait for a file to finish.
+func interruptContext() (context.Context, context.CancelFunc) {
+	return signalContext(false, 0)
+}
+
+// drainContext is interruptContext for encz serve in a container, where SIGTERM
+// drains the server: like the first Ctrl-C, it lets the running job finish.
+// The job is cancelled after timeout when it's positive, before the container
+// runtime kills the server.
+func drainContext(timeout time.Duration) (context.Context, context.CancelFunc) {
+	return signalContext(true, timeout)
+}
+
+// signalContext implements interruptContext and drainContext
+func signalContext(drainOnTerm bool, timeout time.Duration) (context.Context, context.CancelFunc) {
+	ctx, cancel := context.WithCancel(context.Background())
+
+	signals := make(chan os.Signal, 2)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		defer signal.Stop(signals)
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case sig := <-signals:
+				if (sig == os.Interrupt || drainOnTerm) && !stopRequested.Swap(true) {
+					close(stopRequests)
+					if sig == os.Interrupt {
+						log.Ctx(ctx).Warn().Msg("finishing the current file, then stopping; press Ctrl-C again to stop now")
+					} else {
+						log.Ctx(ctx).Warn().Msg("draining: finishing the current file, then stopping")
+					}
+					if timeout > 0 {
+						time.AfterFunc(timeout, func() {
+							log.Ctx(ctx).Warn().Dur("timeout", timeout).Msg("drain timed out, cancelling the current file")
+							cancel()
+						})
+					}
+					continue
+				}
+				cancel()
+				return
+			}
+		}
+	}()
+	return ctx, cancel
+}
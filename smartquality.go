@@ -0,0 +1,95 @@
+package main
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/rs/zerolog/log"
+
+	"encz/ffmpeg"
+)
+
+// codecEfficiency is the bitrate of codecs relative to H.264 for the same
+// picture, which makes the bits per pixel of sources of different codecs comparable
+var codecEfficiency = map[string]float64{
+	"mpeg2video": 2,
+	"mpeg4":      1.5,
+	"vc1":        1.2,
+	"h264":       1,
+	"vp9":        0.65,
+	"hevc":       0.6,
+	"av1":        0.5,
+}
+
+// validateSmartQuality checks the thresholds of --smart-quality
+func (c *cliArgs) validateSmartQuality() error {
+	if !c.SmartQuality {
+		return nil
+	}
+	if c.SmartLowBPP <= 0 || c.SmartHighBPP <= c.SmartLowBPP {
+		return fmt.Errorf("invalid --smart-low-bpp %g and --smart-high-bpp %g: expected 0 < low < high", c.SmartLowBPP, c.SmartHighBPP)
+	}
+	if c.SmartStep < 0 {
+		return fmt.Errorf("invalid --smart-step %g: must not be negative", c.SmartStep)
+	}
+	return nil
+}
+
+// sourceBPP returns the bits per pixel of each frame of the source, as if it
+// was H.264. It's 0 when the probe lacks the bitrate, as for discs.
+func sourceBPP(probe ffmpeg.ProbeResult) float64 {
+	pixels := float64(probe.Width*probe.Height) * probe.FPS
+	if probe.Bitrate <= 0 || pixels <= 0 {
+		return 0
+	}
+	// The bitrate of the container includes the audio, which matters little
+	// next to the video of all but the most starved sources
+	efficiency, ok := codecEfficiency[probe.Codec]
+	if !ok {
+		efficiency = 1
+	}
+	return float64(probe.Bitrate) / pixels / efficiency
+}
+
+// smartQualityOffset returns the quality offset on the x265 scale for a
+// source: a worse quality for heavily compressed sources, whose artifacts
+// aren't worth preserving, and a better one for sources with detail to keep
+func (c *cliArgs) smartQualityOffset(bpp float64) float64 {
+	switch {
+	case bpp <= 0:
+		return 0
+	case bpp < c.SmartLowBPP/2:
+		return 2 * c.SmartStep
+	case bpp < c.SmartLowBPP:
+		return c.SmartStep
+	case bpp > c.SmartHighBPP:
+		return -c.SmartStep
+	}
+	return 0
+}
+
+// applySmartQuality adjusts the quality to the compression of the source with
+// --smart-quality. The lossless modes keep their quality.
+func (c *cliArgs) applySmartQuality(ctx context.Context, probe ffmpeg.ProbeResult) {
+	if !c.SmartQuality || c.Lossless || c.VisuallyLossless {
+		return
+	}
+	bpp := sourceBPP(probe)
+	if bpp == 0 {
+		log.Ctx(ctx).Warn().Msg("source bitrate unknown, --smart-quality keeps the quality")
+		return
+	}
+
+	c.smartOffset = c.scaleQualityOffset(c.smartQualityOffset(bpp))
+	event := log.Ctx(ctx).Debug()
+	if c.smartOffset != 0 {
+		event = log.Ctx(ctx).Info()
+	}
+	event.
+		Str("codec", probe.Codec).
+		Int64("bitrate_kbps", probe.Bitrate/1000).
+		Float64("bpp", bpp).
+		Float64("quality", c.Quality+c.smartOffset).
+		Msg("quality adjusted to the compression of the source")
+	c.Quality += c.smartOffset
+}
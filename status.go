@@ -0,0 +1,107 @@
+package main
+
+import (
+	"context"
+	"math"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog"
+	"github.com/rs/zerolog/log"
+
+	"encz/proc"
+	"encz/progress"
+)
+
+// statusBoard holds the latest progress of the running encodes, reported on
+// request even when no progress is shown
+type statusBoard struct {
+	mu       sync.Mutex
+	statuses []progress.Status
+}
+
+// jobStatuses is the progress of the encodes of this process
+var jobStatuses = &statusBoard{}
+
+func (b *statusBoard) update(s progress.Status) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for i := range b.statuses {
+		if b.statuses[i].Label == s.Label {
+			b.statuses[i] = s
+			return
+		}
+	}
+	b.statuses = append(b.statuses, s)
+}
+
+func (b *statusBoard) remove(label string) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.statuses = slices.DeleteFunc(b.statuses, func(s progress.Status) bool {
+		return s.Label == label
+	})
+}
+
+func (b *statusBoard) clear() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.statuses = nil
+}
+
+// snapshot returns a copy of the statuses
+func (b *statusBoard) snapshot() []progress.Status {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return slices.Clone(b.statuses)
+}
+
+// trackedView records the statuses shown by a view on jobStatuses
+type trackedView struct {
+	progressView
+}
+
+func (v trackedView) Update(s progress.Status) {
+	jobStatuses.update(s)
+	v.progressView.Update(s)
+}
+
+func (v trackedView) Remove(label string) {
+	jobStatuses.remove(label)
+	v.progressView.Remove(label)
+}
+
+func (v trackedView) Finish() {
+	jobStatuses.clear()
+	v.progressView.Finish()
+}
+
+// logJobStatus logs the progress of the running encodes as regular log lines,
+// readable where the progress line isn't, like a log file of a detached run.
+// They were asked for, so they are logged at any log level.
+func logJobStatus(ctx context.Context) {
+	logger := log.Ctx(ctx).Level(zerolog.InfoLevel)
+	statuses := jobStatuses.snapshot()
+	if len(statuses) == 0 {
+		logger.Info().Msg("no encode running")
+		return
+	}
+
+	for _, s := range statuses {
+		event := logger.Info().
+			Str("job", s.Label).
+			Float64("percent", math.Round(s.Percent*10)/10).
+			Float64("fps", math.Round(s.FPS*10)/10)
+		if s.ETA > 0 {
+			event = event.Str("eta", s.ETA.Round(time.Second).String())
+		}
+		if s.Phase != "" {
+			event = event.Str("phase", s.Phase)
+		}
+		if proc.Paused() {
+			event = event.Bool("paused", true)
+		}
+		event.Msg("encoding status")
+	}
+}
@@ -0,0 +1,8 @@
+//go:build !unix
+
+package main
+
+import "context"
+
+// watchStatusSignal is a no-op where SIGUSR1 doesn't exist
+func watchStatusSignal(context.Context) {}
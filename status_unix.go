@@ -0,0 +1,29 @@
+//go:build unix
+
+package main
+
+import (
+	"context"
+	"os"
+	"os/signal"
+	"syscall"
+)
+
+// watchStatusSignal logs the progress of the running encodes on SIGUSR1,
+// e.g. `pkill -USR1 encz`
+func watchStatusSignal(ctx context.Context) {
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGUSR1)
+
+	go func() {
+		defer signal.Stop(signals)
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-signals:
+				logJobStatus(ctx)
+			}
+		}
+	}()
+}
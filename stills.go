@@ -0,0 +1,120 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/rs/zerolog/log"
+
+	"encz/ffmpeg"
+)
+
+// Sprite sheets use small thumbnails in rows of spriteColumns
+const (
+	spriteWidth   = 160
+	spriteColumns = 10
+)
+
+// parseTimestamp parses a time given as HH:MM:SS, MM:SS or a Go duration like 5m
+func parseTimestamp(s string) (time.Duration, error) {
+	if d, err := time.ParseDuration(s); err == nil {
+		return d, nil
+	}
+
+	parts := strings.Split(s, ":")
+	if len(parts) < 2 || len(parts) > 3 {
+		return 0, fmt.Errorf("invalid time %q: expected HH:MM:SS or a duration like 5m", s)
+	}
+	var d time.Duration
+	for _, part := range parts {
+		var n float64
+		if _, err := fmt.Sscanf(part, "%g", &n); err != nil || n < 0 {
+			return 0, fmt.Errorf("invalid time %q: expected HH:MM:SS or a duration like 5m", s)
+		}
+		d = d*60 + time.Duration(n*float64(time.Second))
+	}
+	return d, nil
+}
+
+// writeStills writes the poster, thumbnails and sprite sheet of an encoded file next to it.
+// Stills are extras, so failures are logged rather than failing the encode.
+func writeStills(ctx context.Context, args cliArgs, savePath string, width, height int, duration time.Duration) {
+	if args.Poster == 0 && args.Thumbnails == 0 {
+		return
+	}
+	stem := strings.TrimSuffix(savePath, filepath.Ext(savePath))
+
+	if args.Poster > 0 {
+		path := stem + "-poster.jpg"
+		if args.Poster >= duration {
+			log.Ctx(ctx).Warn().Str("poster", args.Poster.String()).Msg("poster time is past the end of the video, skipping")
+		} else if err := ffmpeg.ExtractFrame(ctx, savePath, args.Poster, path); err != nil {
+			log.Ctx(ctx).Warn().Err(err).Msg("failed to write poster")
+		} else {
+			log.Ctx(ctx).Info().Str("poster", path).Msg("wrote poster")
+		}
+	}
+
+	if args.Thumbnails == 0 {
+		return
+	}
+
+	// Evenly spaced, leaving out the very start and end which are often black
+	thumbnails := make([]string, 0, args.Thumbnails)
+	for i := range args.Thumbnails {
+		at := duration * time.Duration(i+1) / time.Duration(args.Thumbnails+1)
+		path := fmt.Sprintf("%s-thumb-%02d.jpg", stem, i+1)
+		if err := ffmpeg.ExtractFrame(ctx, savePath, at, path); err != nil {
+			log.Ctx(ctx).Warn().Err(err).Msg("failed to write thumbnail")
+			return
+		}
+		thumbnails = append(thumbnails, path)
+	}
+	log.Ctx(ctx).Info().Int("thumbnails", len(thumbnails)).Msg("wrote thumbnails")
+
+	if !args.Sprites {
+		return
+	}
+
+	spritePath := stem + "-sprites.jpg"
+	if err := ffmpeg.SpriteSheet(ctx, thumbnails, spriteWidth, spriteColumns, spritePath); err != nil {
+		log.Ctx(ctx).Warn().Err(err).Msg("failed to write sprite sheet")
+		return
+	}
+
+	// Same rounding as FFmpeg's scale=W:-2
+	tileHeight := int(math.Round(float64(spriteWidth)*float64(height)/float64(width)/2)) * 2
+	// The cues hold relative URLs
+	vtt := spriteVTT(url.PathEscape(filepath.Base(spritePath)), len(thumbnails), duration, spriteWidth, tileHeight)
+	vttPath := stem + "-sprites.vtt"
+	if err := os.WriteFile(vttPath, []byte(vtt), 0644); err != nil {
+		log.Ctx(ctx).Warn().Err(err).Msg("failed to write sprite sheet WebVTT")
+		return
+	}
+	log.Ctx(ctx).Info().Str("sprites", spritePath).Str("vtt", vttPath).Msg("wrote sprite sheet")
+}
+
+// spriteVTT returns the WebVTT file mapping each part of the video to its tile in the sprite sheet
+func spriteVTT(sprite string, count int, duration time.Duration, width, height int) string {
+	var b strings.Builder
+	b.WriteString("WEBVTT\n")
+	for i := range count {
+		start := duration * time.Duration(i) / time.Duration(count)
+		end := duration * time.Duration(i+1) / time.Duration(count)
+		x, y := i%spriteColumns*width, i/spriteColumns*height
+		fmt.Fprintf(&b, "\n%s --> %s\n%s#xywh=%d,%d,%d,%d\n", vttTime(start), vttTime(end), sprite, x, y, width, height)
+	}
+	return b.String()
+}
+
+// vttTime formats d as HH:MM:SS.mmm
+func vttTime(d time.Duration) string {
+	ms := d.Milliseconds()
+	return fmt.Sprintf("%02d:%02d:%02d.%03d", ms/3600000, ms/60000%60, ms/1000%60, ms%1000)
+}
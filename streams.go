@@ -0,0 +1,138 @@
+package main
+
+import (
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// trackSelection selects the audio or subtitle tracks kept in outputs, the
+// same way as ffmpeg.Tracks and handbrake.Tracks
+type trackSelection struct {
+	All     bool
+	None    bool
+	Indices []int
+}
+
+func (t trackSelection) isDefault() bool {
+	return !t.All && !t.None && len(t.Indices) == 0
+}
+
+// streamSelection picks the streams of the source kept in outputs
+type streamSelection struct {
+	VideoTrack  int
+	Audio       trackSelection
+	Subtitles   trackSelection
+	Attachments bool
+	// DropAttachments keeps the fonts of styled subtitles out of outputs
+	DropAttachments bool
+}
+
+// isSet reports whether any stream was selected with --map
+func (s streamSelection) isSet() bool {
+	return s.VideoTrack > 0 || !s.Audio.isDefault() || !s.Subtitles.isDefault() || s.Attachments
+}
+
+// parseStreamMap adds a --map value to s: v:N for the video track, a: or s:
+// with all, none or comma-separated track numbers for audio and subtitles, and
+// t:all or t:none for attachments. Tracks are counted from 0 within their kind.
+func parseStreamMap(value string, s *streamSelection) error {
+	kind, spec, ok := strings.Cut(value, ":")
+	if !ok {
+		return fmt.Errorf("invalid --map %q: expected v:N, a:LIST, s:LIST or t:all|none", value)
+	}
+
+	switch kind {
+	case "v":
+		track, err := strconv.Atoi(spec)
+		if err != nil || track < 0 {
+			return fmt.Errorf("invalid --map %q: expected a video track number", value)
+		}
+		s.VideoTrack = track
+	case "a", "s":
+		tracks, err := parseTracks(spec)
+		if err != nil {
+			return fmt.Errorf("invalid --map %q: %w", value, err)
+		}
+		if kind == "a" {
+			s.Audio = tracks
+		} else {
+			s.Subtitles = tracks
+		}
+	case "t":
+		switch spec {
+		case "all":
+			s.Attachments, s.DropAttachments = true, false
+		case "none":
+			s.Attachments, s.DropAttachments = false, true
+		default:
+			return fmt.Errorf("invalid --map %q: attachments are kept with t:all or dropped with t:none", value)
+		}
+	default:
+		return fmt.Errorf("invalid --map %q: unknown stream kind %q, expected v, a, s or t", value, kind)
+	}
+	return nil
+}
+
+// parseTracks parses all, none or a comma-separated list of track numbers
+func parseTracks(spec string) (trackSelection, error) {
+	switch spec {
+	case "all":
+		return trackSelection{All: true}, nil
+	case "none":
+		return trackSelection{None: true}, nil
+	}
+
+	var tracks trackSelection
+	for _, field := range strings.Split(spec, ",") {
+		track, err := strconv.Atoi(strings.TrimSpace(field))
+		if err != nil || track < 0 {
+			return trackSelection{}, fmt.Errorf("expected all, none or track numbers like 0,2")
+		}
+		if !slices.Contains(tracks.Indices, track) {
+			tracks.Indices = append(tracks.Indices, track)
+		}
+	}
+	return tracks, nil
+}
+
+// validateStreams checks that the selected streams can be kept by the engines
+func (c *cliArgs) validateStreams() error {
+	if !c.Streams.isSet() {
+		return nil
+	}
+	if c.Chunked {
+		return fmt.Errorf("--map cannot be combined with --chunked")
+	}
+	// HandBrake always encodes the first video track and has no attachments
+	if c.Streams.VideoTrack > 0 || c.Streams.Attachments {
+		if usesHandbrake(*c) {
+			return fmt.Errorf("--map v:N and t:all require --encoder ffmpeg and ffmpeg fallback encoders")
+		}
+	}
+	return nil
+}
+
+// keptAudio returns the items, one per audio track of the source, that the
+// selection keeps in the output. The first track is kept unless tracks are
+// selected, like HandBrake and FFmpeg once other streams are selected;
+// keptAudioTracks has FFmpeg's own default.
+func keptAudio[T any](s streamSelection, items []T) []T {
+	switch {
+	case s.Audio.None:
+		return nil
+	case s.Audio.All:
+		return items
+	case len(s.Audio.Indices) > 0:
+		// Outputs have the tracks in the order they were listed
+		var kept []T
+		for _, i := range s.Audio.Indices {
+			if i < len(items) {
+				kept = append(kept, items[i])
+			}
+		}
+		return kept
+	}
+	return items[:min(1, len(items))]
+}
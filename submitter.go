@@ -0,0 +1,101 @@
+package main
+
+import (
+	"context"
+	"crypto/subtle"
+	"fmt"
+	"slices"
+	"strings"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// anonymousSubmitter submits the jobs of the callers naming no user
+const anonymousSubmitter = "anonymous"
+
+// userHeader names the submitter when the server has no API keys
+const userHeader = "x-encz-user"
+
+// apiKey is an --api-keys entry, identifying its holder
+type apiKey struct {
+	Name string
+	Key  string
+}
+
+// parseAPIKeys parses comma-separated name:key pairs
+func parseAPIKeys(s string, keys *[]apiKey) error {
+	for _, pair := range splitList(s) {
+		name, key, ok := strings.Cut(pair, ":")
+		if !ok || name == "" || key == "" {
+			return fmt.Errorf("expected name:key, got %q", pair)
+		}
+		for _, k := range *keys {
+			if k.Name == name || k.Key == key {
+				return fmt.Errorf("API key %s is given twice or shares its key", name)
+			}
+		}
+		*keys = append(*keys, apiKey{Name: name, Key: key})
+	}
+	return nil
+}
+
+// caller is who makes a call to the job API
+type caller struct {
+	Name  string
+	Admin bool
+}
+
+// owns reports whether c may see and cancel the jobs of submitter
+func (c caller) owns(submitter string) bool {
+	return c.Admin || c.Name == submitter
+}
+
+// caller identifies the caller of ctx, by its API key when the server has
+// keys, otherwise by the user it names
+func (s *jobServer) caller(ctx context.Context) (caller, error) {
+	md, _ := metadata.FromIncomingContext(ctx)
+	first := func(key string) string {
+		if values := md.Get(key); len(values) > 0 {
+			return values[0]
+		}
+		return ""
+	}
+
+	name := first(userHeader)
+	if len(s.args.APIKeys) > 0 {
+		token, ok := strings.CutPrefix(first("authorization"), "Bearer ")
+		if !ok || token == "" {
+			return caller{}, status.Error(codes.Unauthenticated, "missing API key, expected authorization: Bearer <key>")
+		}
+		name = ""
+		// Every key is compared so the time taken doesn't tell which one is close
+		for _, k := range s.args.APIKeys {
+			if subtle.ConstantTimeCompare([]byte(token), []byte(k.Key)) == 1 {
+				name = k.Name
+			}
+		}
+		if name == "" {
+			return caller{}, status.Error(codes.Unauthenticated, "invalid API key")
+		}
+	}
+	if name == "" {
+		name = anonymousSubmitter
+	}
+	return caller{Name: name, Admin: slices.Contains(s.args.Admins, name)}, nil
+}
+
+// validateAdmins checks that the admins hold API keys. Without keys, anyone
+// could claim to be an admin.
+func (c *serveArgs) validateAdmins() error {
+	if len(c.Admins) > 0 && len(c.APIKeys) == 0 {
+		return fmt.Errorf("--admins requires --api-keys, otherwise any caller can name itself an admin")
+	}
+	for _, admin := range c.Admins {
+		if !slices.ContainsFunc(c.APIKeys, func(k apiKey) bool { return k.Name == admin }) {
+			return fmt.Errorf("admin %s has no API key in --api-keys", admin)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,111 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"encz/notify"
+)
+
+// summaryRow is a line of an end-of-run block, with the style of its value
+type summaryRow struct {
+	label string
+	value string
+	style string
+}
+
+// printJobSummary writes the end-of-run block for a single file, boxed and
+// colored when styled
+func printJobSummary(w io.Writer, event notify.Event, styled bool) {
+	status := summaryRow{label: "status", value: event.Status()}
+	switch status.value {
+	case "encoded":
+		status.style = ansiGreen
+	case "failed":
+		status.style = ansiRed
+	case "skipped":
+		status.style = ansiYellow
+	}
+	rows := []summaryRow{status, {label: "input", value: event.InputPath}}
+	if event.OutputPath != "" {
+		rows = append(rows, summaryRow{label: "output", value: event.OutputPath})
+	}
+	if event.OutputSize > 0 {
+		rows = append(rows, summaryRow{
+			label: "size",
+			value: fmt.Sprintf("%s -> %s (%.1f%% saved)", formatBytes(event.InputSize), formatBytes(event.OutputSize), event.SavedPercent),
+			style: savingsStyle(event.InputSize - event.OutputSize),
+		})
+	}
+	rows = append(rows, summaryRow{label: "elapsed", value: time.Duration(event.ElapsedSeconds * float64(time.Second)).Round(time.Second).String()})
+	if event.Error != "" {
+		rows = append(rows, summaryRow{label: "error", value: event.Error, style: ansiRed})
+	}
+	writeSummary(w, "encz summary", rows, styled)
+}
+
+// printLibrarySummary writes the end-of-run block for a batch of files, boxed
+// and colored when styled
+func printLibrarySummary(w io.Writer, s librarySummary, styled bool) {
+	rows := []summaryRow{
+		{label: "root", value: s.Root},
+		{label: "encoded", value: fmt.Sprint(s.Encoded)},
+		{label: "skipped", value: fmt.Sprint(s.Skipped)},
+		{label: "failed", value: fmt.Sprint(s.Failed)},
+		{label: "unchanged", value: fmt.Sprint(s.Unchanged)},
+		{label: "saved", value: formatBytes(s.SavedBytes), style: savingsStyle(s.SavedBytes)},
+	}
+	if s.Failed > 0 {
+		rows[3].style = ansiRed
+	}
+	if s.TotalSavedBytes > 0 {
+		rows = append(rows, summaryRow{label: "saved total", value: formatBytes(s.TotalSavedBytes), style: ansiGreen})
+	}
+	rows = append(rows, summaryRow{label: "elapsed", value: s.Elapsed.Round(time.Second).String()})
+	writeSummary(w, "encz library summary", rows, styled)
+}
+
+// savingsStyle colors space saved green and space lost red
+func savingsStyle(saved int64) string {
+	switch {
+	case saved > 0:
+		return ansiGreen
+	case saved < 0:
+		return ansiRed
+	}
+	return ""
+}
+
+// writeSummary writes an end-of-run block with its values aligned. Unstyled,
+// for logs and mails, it's plain text; styled, it's drawn in a box.
+func writeSummary(w io.Writer, title string, rows []summaryRow, styled bool) {
+	labelWidth := 0
+	for _, row := range rows {
+		labelWidth = max(labelWidth, len(row.label)+1)
+	}
+	line := func(row summaryRow) string {
+		return fmt.Sprintf("%-*s %s", labelWidth, row.label+":", row.value)
+	}
+
+	if !styled {
+		fmt.Fprintln(w, title)
+		for _, row := range rows {
+			fmt.Fprintf(w, "  %s\n", line(row))
+		}
+		return
+	}
+
+	width := utf8.RuneCountInString(title) + 2
+	for _, row := range rows {
+		width = max(width, utf8.RuneCountInString(line(row)))
+	}
+	fmt.Fprintf(w, "╭─ %s %s╮\n", paint(ansiBold, title), strings.Repeat("─", width-utf8.RuneCountInString(title)-1))
+	for _, row := range rows {
+		padding := strings.Repeat(" ", width-utf8.RuneCountInString(line(row)))
+		fmt.Fprintf(w, "│ %-*s %s%s │\n", labelWidth, row.label+":", paint(row.style, row.value), padding)
+	}
+	fmt.Fprintf(w, "╰%s╯\n", strings.Repeat("─", width+2))
+}
@@ -0,0 +1,14 @@
+//go:build windows || plan9
+
+package main
+
+import (
+	"errors"
+
+	"github.com/rs/zerolog"
+)
+
+// newSyslogWriter is not available on this platform
+func newSyslogWriter() (zerolog.LevelWriter, error) {
+	return nil, errors.New("syslog is not supported on this platform")
+}
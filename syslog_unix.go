@@ -0,0 +1,19 @@
+//go:build !windows && !plan9
+
+package main
+
+import (
+	"fmt"
+	"log/syslog"
+
+	"github.com/rs/zerolog"
+)
+
+// newSyslogWriter returns a log writer sending to the local syslog daemon
+func newSyslogWriter() (zerolog.LevelWriter, error) {
+	w, err := syslog.New(syslog.LOG_INFO|syslog.LOG_USER, "encz")
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to syslog: %w", err)
+	}
+	return zerolog.SyslogLevelWriter(w), nil
+}
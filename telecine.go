@@ -0,0 +1,34 @@
+package main
+
+import (
+	"context"
+	"time"
+
+	"github.com/rs/zerolog/log"
+
+	"encz/ffmpeg"
+)
+
+// resolveDetelecine turns --detelecine auto into on or off for a source of fps,
+// analysing the frames of input from at. Only 29.97fps sources are analysed,
+// film is telecined to that rate.
+func resolveDetelecine(ctx context.Context, args cliArgs, fps float64, input string, at time.Duration) string {
+	if args.Detelecine != "auto" {
+		return args.Detelecine
+	}
+	if !ffmpeg.IsTelecineRate(fps) {
+		return "off"
+	}
+
+	telecined, err := ffmpeg.DetectTelecine(ctx, input, at)
+	if err != nil {
+		log.Ctx(ctx).Warn().Err(err).Msg("failed to detect telecine, encoding as is")
+		return "off"
+	}
+	if !telecined {
+		return "off"
+	}
+
+	log.Ctx(ctx).Info().Msg("source is telecined, restoring the 23.976fps film frames")
+	return "on"
+}
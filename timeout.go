@@ -0,0 +1,63 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/rs/zerolog/log"
+
+	"encz/proc"
+)
+
+// errTimedOut is the cancellation cause when an encode exceeds --timeout
+var errTimedOut = errors.New("encode timed out")
+
+// timeoutCheckInterval is how often a running encode is checked against --timeout
+const timeoutCheckInterval = time.Second
+
+// cancelAfter cancels an encode with errTimedOut once it ran for longer than timeout.
+// Time spent paused doesn't count, so a schedule window can't make a job time out.
+func cancelAfter(ctx context.Context, timeout time.Duration, cancel context.CancelCauseFunc) {
+	start := time.Now()
+	pausedBefore := proc.PausedTime()
+
+	ticker := time.NewTicker(timeoutCheckInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		running := time.Since(start) - (proc.PausedTime() - pausedBefore)
+		if running > timeout {
+			cancel(errTimedOut)
+			return
+		}
+	}
+}
+
+// timeoutError removes the partial outputs of an encode stopped by --timeout and returns its error
+func timeoutError(ctx context.Context, timeout time.Duration, outputs ...string) error {
+	removePartialOutputs(ctx, outputs...)
+	return fmt.Errorf("%w after %s", errTimedOut, timeout)
+}
+
+// removePartialOutputs removes the outputs of an encode that was stopped.
+// Partial outputs are useless, and would be mistaken for finished encodes.
+func removePartialOutputs(ctx context.Context, outputs ...string) {
+	for _, path := range outputs {
+		// Nothing is left behind on stdout
+		if path == pipePath {
+			continue
+		}
+		if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+			log.Ctx(ctx).Warn().Err(err).Str("file", path).Msg("failed to remove partial output")
+		}
+	}
+}
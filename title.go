@@ -0,0 +1,59 @@
+package main
+
+import (
+	"cmp"
+	"fmt"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"encz/ffmpeg"
+)
+
+// defaultTitleTemplate is the title outputs always had, the name of the source
+const defaultTitleTemplate = "{stem}"
+
+var (
+	yearRegex       = regexp.MustCompile(`\b(19\d{2}|20\d{2})\b`)
+	emptyGroupRegex = regexp.MustCompile(`\(\s*\)|\[\s*\]`)
+	spacesRegex     = regexp.MustCompile(`\s{2,}`)
+)
+
+// formatTitle fills the placeholders of a --title-template for an output of the given size
+func formatTitle(template, videoPath string, probe ffmpeg.ProbeResult, width, height int) string {
+	stem := strings.TrimSuffix(filepath.Base(videoPath), filepath.Ext(videoPath))
+
+	// Movie files are usually named with the year, phone recordings have a creation date
+	year := yearRegex.FindString(stem)
+	if year == "" {
+		if created := probe.Tags["creation_time"]; len(created) >= 4 {
+			year = created[:4]
+		}
+	}
+
+	title := strings.NewReplacer(
+		"{stem}", stem,
+		"{title}", cmp.Or(probe.Tags["title"], stem),
+		"{year}", year,
+		"{resolution}", cmp.Or(resolutionLabel(width, height), fmt.Sprintf("%dp", min(width, height))),
+	).Replace(template)
+
+	// Drop what's left of placeholders without a value, like "Movie ()"
+	title = emptyGroupRegex.ReplaceAllString(title, "")
+	return strings.TrimSpace(spacesRegex.ReplaceAllString(title, " "))
+}
+
+// resolutionLabel returns the name of a common resolution, or an empty string.
+// Either edge may match, so 1440x1080 and vertical 1080x1350 are 1080p too.
+func resolutionLabel(width, height int) string {
+	long, short := max(width, height), min(width, height)
+	switch {
+	case long >= 3000 || short >= 2000:
+		return "4K"
+	case long >= 1900 && long <= 2000 || short >= 1000 && short <= 1100:
+		return "1080p"
+	case long >= 1200 && long <= 1400 || short >= 700 && short <= 740:
+		return "720p"
+	}
+	return ""
+}
@@ -0,0 +1,13 @@
+//go:build !(linux || darwin || freebsd || netbsd || openbsd || dragonfly)
+
+package tui
+
+import (
+	"errors"
+	"os"
+)
+
+// makeRaw is not supported on this platform
+func makeRaw(f *os.File) (func(), error) {
+	return nil, errors.New("interactive mode is not supported on this platform")
+}
@@ -0,0 +1,323 @@
+package tui
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"encz/progress"
+)
+
+// maxLogLines is the number of log lines kept for the log pane
+const maxLogLines = 1000
+
+// refreshInterval is how often the screen is redrawn
+const refreshInterval = 250 * time.Millisecond
+
+// Action is a command entered by the user
+type Action int
+
+const (
+	// ActionSkip cancels the current file and moves on to the next one
+	ActionSkip Action = iota
+	// ActionQuit cancels the current file and stops the batch
+	ActionQuit
+	// ActionPause pauses the current file, or resumes it when paused
+	ActionPause
+)
+
+// Queue is the list of pending files shown and reordered by the TUI
+type Queue interface {
+	// Items returns the pending files in processing order
+	Items() []string
+	// Move moves the item at index i by delta positions and reports whether it moved
+	Move(i, delta int) bool
+}
+
+// App is a full-screen interactive view of a batch run showing the queue,
+// live progress and logs
+type App struct {
+	mu       sync.Mutex
+	in       *os.File
+	out      *os.File
+	title    string
+	queue    Queue
+	current  string
+	summary  string
+	paused   bool
+	bars     []progress.Status
+	logs     []string
+	selected int
+	actions  chan Action
+	restore  func()
+	done     chan struct{}
+}
+
+// New returns an App for the given queue
+func New(title string, queue Queue) *App {
+	return &App{
+		in:      os.Stdin,
+		out:     os.Stdout,
+		title:   title,
+		queue:   queue,
+		actions: make(chan Action, 1),
+		done:    make(chan struct{}),
+	}
+}
+
+// Actions returns the channel receiving user commands
+func (a *App) Actions() <-chan Action {
+	return a.actions
+}
+
+// Start switches the terminal to the full-screen view
+func (a *App) Start() error {
+	restore, err := makeRaw(a.in)
+	if err != nil {
+		return fmt.Errorf("failed to enter interactive mode: %w", err)
+	}
+	a.restore = restore
+
+	// Switch to the alternate screen and hide the cursor
+	fmt.Fprint(a.out, "\x1b[?1049h\x1b[?25l")
+
+	go a.readInput()
+	go a.renderLoop()
+
+	return nil
+}
+
+// Stop restores the terminal and prints the captured logs so they aren't lost
+// with the alternate screen
+func (a *App) Stop() {
+	close(a.done)
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	fmt.Fprint(a.out, "\x1b[?25h\x1b[?1049l")
+	if a.restore != nil {
+		a.restore()
+	}
+
+	for _, line := range a.logs {
+		fmt.Fprintln(a.out, line)
+	}
+}
+
+// Write implements io.Writer, appending to the log pane
+func (a *App) Write(p []byte) (int, error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	for line := range strings.Lines(string(p)) {
+		a.logs = append(a.logs, strings.TrimRight(line, "\r\n"))
+	}
+	if extra := len(a.logs) - maxLogLines; extra > 0 {
+		a.logs = a.logs[extra:]
+	}
+
+	return len(p), nil
+}
+
+// SetCurrent sets the name of the file being processed
+func (a *App) SetCurrent(name string) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.current = name
+}
+
+// SetSummary sets the line describing the overall batch state
+func (a *App) SetSummary(summary string) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.summary = summary
+}
+
+// SetPaused marks the batch as paused
+func (a *App) SetPaused(paused bool) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.paused = paused
+}
+
+// Update sets the status of the progress bar with the same label
+func (a *App) Update(s progress.Status) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	for i := range a.bars {
+		if a.bars[i].Label == s.Label {
+			a.bars[i] = s
+			return
+		}
+	}
+	a.bars = append(a.bars, s)
+}
+
+// Remove deletes the progress bar with the given label
+func (a *App) Remove(label string) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	for i := range a.bars {
+		if a.bars[i].Label == label {
+			a.bars = append(a.bars[:i], a.bars[i+1:]...)
+			return
+		}
+	}
+}
+
+// Finish removes all progress bars
+func (a *App) Finish() {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.bars = nil
+}
+
+// send delivers an action without blocking the input loop
+func (a *App) send(action Action) {
+	select {
+	case a.actions <- action:
+	default:
+	}
+}
+
+// readInput handles key presses
+func (a *App) readInput() {
+	r := bufio.NewReader(a.in)
+	for {
+		b, err := r.ReadByte()
+		if err != nil {
+			return
+		}
+
+		select {
+		case <-a.done:
+			return
+		default:
+		}
+
+		key := string(b)
+		if b == 0x1b {
+			// Arrow keys arrive as ESC [ A/B
+			if next, _ := r.ReadByte(); next == '[' {
+				arrow, _ := r.ReadByte()
+				key = "\x1b[" + string(arrow)
+			}
+		}
+
+		a.handleKey(key)
+	}
+}
+
+func (a *App) handleKey(key string) {
+	switch key {
+	case "s":
+		a.send(ActionSkip)
+	case "q":
+		a.send(ActionQuit)
+	case "p":
+		a.send(ActionPause)
+	case "k", "\x1b[A":
+		a.moveSelection(-1)
+	case "j", "\x1b[B":
+		a.moveSelection(1)
+	case "K", "u":
+		a.moveItem(-1)
+	case "J", "d":
+		a.moveItem(1)
+	}
+}
+
+func (a *App) moveSelection(delta int) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	n := len(a.queue.Items())
+	a.selected = max(0, min(n-1, a.selected+delta))
+}
+
+func (a *App) moveItem(delta int) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if a.queue.Move(a.selected, delta) {
+		a.selected += delta
+	}
+}
+
+func (a *App) renderLoop() {
+	ticker := time.NewTicker(refreshInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-a.done:
+			return
+		case <-ticker.C:
+			a.render()
+		}
+	}
+}
+
+// render redraws the whole screen
+func (a *App) render() {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	width, height := progress.TerminalSize(a.out)
+
+	var lines []string
+	lines = append(lines, "\x1b[1m"+a.title+"\x1b[0m", a.summary, "")
+
+	if a.current != "" && a.paused {
+		lines = append(lines, "Now: "+a.current+" (paused)")
+	} else if a.current != "" {
+		lines = append(lines, "Now: "+a.current)
+	} else {
+		lines = append(lines, "Now: idle")
+	}
+	for _, bar := range a.bars {
+		lines = append(lines, progress.Render(bar, width))
+	}
+
+	help := "s skip · p pause · q quit · ↑/↓ select · K/J move up/down"
+
+	// Split the remaining rows between the queue and the log pane
+	free := max(0, height-len(lines)-5)
+	items := a.queue.Items()
+	a.selected = max(0, min(len(items)-1, a.selected))
+
+	queueRows := min(len(items), free/2)
+	lines = append(lines, "", fmt.Sprintf("Queue (%d):", len(items)))
+
+	// Keep the selection visible when the queue doesn't fit
+	offset := max(0, a.selected-queueRows+1)
+	for i := offset; i < offset+queueRows && i < len(items); i++ {
+		marker := "  "
+		if i == a.selected {
+			marker = "> "
+		}
+		lines = append(lines, marker+items[i])
+	}
+
+	logRows := max(0, free-queueRows)
+	lines = append(lines, "", "Log:")
+	start := max(0, len(a.logs)-logRows)
+	lines = append(lines, a.logs[start:]...)
+
+	var b strings.Builder
+	b.WriteString("\x1b[H")
+	for _, line := range lines {
+		b.WriteString(progress.Truncate(line, width))
+		b.WriteString("\x1b[K\r\n")
+	}
+	b.WriteString("\x1b[J")
+	fmt.Fprintf(&b, "\x1b[%d;1H\x1b[7m%s\x1b[0m", height, progress.Truncate(help, width))
+
+	fmt.Fprint(a.out, b.String())
+}
@@ -0,0 +1,105 @@
+package main
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+
+	"encz/ffmpeg"
+)
+
+// contentTune is the settings suiting a type of content
+type contentTune struct {
+	// X264 and X265 are the tunes of those encoders, empty for none
+	X264, X265 string
+	// QualityOffset shifts --quality on the x265 scale, negative for better quality
+	QualityOffset float64
+	// Denoise removes the noise encoders would spend bits on, unless --grain is given
+	Denoise bool
+	// Grain is the --grain default
+	Grain string
+}
+
+// contentTunes are the settings of --tune. Flat animation compresses well and
+// suffers from noise, grain needs bits to survive, and screen text blurs first.
+var contentTunes = map[string]contentTune{
+	"animation":  {X264: "animation", X265: "animation", QualityOffset: 2, Denoise: true},
+	"film":       {X264: "film"},
+	"screencast": {X264: "stillimage", QualityOffset: -2},
+	"grain":      {X264: "grain", X265: "grain", QualityOffset: -2, Grain: ffmpeg.GrainKeep},
+}
+
+// validateTune checks --tune and that its grain handling agrees with --grain
+func (c *cliArgs) validateTune() error {
+	if c.Tune == "" {
+		return nil
+	}
+	tune, ok := contentTunes[c.Tune]
+	if !ok {
+		names := make([]string, 0, len(contentTunes))
+		for name := range contentTunes {
+			names = append(names, name)
+		}
+		slices.Sort(names)
+		return fmt.Errorf("invalid --tune %q: expected %s", c.Tune, strings.Join(names, ", "))
+	}
+	if tune.Grain != "" && c.Grain != tune.Grain {
+		return fmt.Errorf("--tune %s keeps the grain, it cannot be combined with --grain %s", c.Tune, c.Grain)
+	}
+	return nil
+}
+
+// applyTune applies the quality offset and denoising of --tune. The lossless
+// modes keep their quality.
+func (c *cliArgs) applyTune() {
+	tune, ok := contentTunes[c.Tune]
+	if !ok {
+		return
+	}
+
+	if !c.Lossless && !c.VisuallyLossless {
+		c.Quality += c.tuneQualityOffset()
+	}
+
+	if c.Grain == "" {
+		c.Grain = tune.Grain
+	}
+	if tune.Denoise && c.Grain == "" {
+		// HandBrake has a light denoiser, ffmpeg denoises as it removes grain
+		if c.Encoder == "ffmpeg" {
+			c.Grain = ffmpeg.GrainRemove
+		} else {
+			c.Denoise = true
+		}
+	}
+}
+
+// tuneQualityOffset returns the --quality offset of --tune on the scale of the encoder
+func (c *cliArgs) tuneQualityOffset() float64 {
+	return c.scaleQualityOffset(contentTunes[c.Tune].QualityOffset)
+}
+
+// scaleQualityOffset converts a quality offset on the x265 scale to the scale of the encoder
+func (c *cliArgs) scaleQualityOffset(offset float64) float64 {
+	// VideoToolbox's 1-100 scale is steeper and the other way around
+	if qualityHigherIsBetter(c.Encoder, c.VideoEncoder) {
+		return offset * -3
+	}
+	return offset
+}
+
+// encoderTune returns the tune of the video encoder for --tune, x264 and x265
+// have their own. Kept grain already tunes x265.
+func (c *cliArgs) encoderTune() string {
+	tune := contentTunes[c.Tune]
+	encoder := videoEncoderName(*c)
+	switch {
+	case encoder == "libx264" || strings.HasPrefix(encoder, "x264"):
+		return tune.X264
+	case c.Grain == ffmpeg.GrainKeep:
+		return ""
+	case encoder == "libx265" || strings.HasPrefix(encoder, "x265"):
+		return tune.X265
+	}
+	return ""
+}
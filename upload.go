@@ -0,0 +1,131 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/rs/zerolog/log"
+
+	"encz/proc"
+)
+
+// sftpBinary is the OpenSSH sftp client uploading outputs
+var sftpBinary = "sftp"
+
+// uploadTarget is the remote folder outputs are uploaded to
+type uploadTarget struct {
+	User string
+	Host string
+	Port string
+	// Dir is the remote folder, relative to the home folder when it doesn't start with a slash
+	Dir string
+}
+
+// parseUploadTarget parses an --upload destination like sftp://user@host:22/srv/media,
+// where /~/ starts a path in the home folder
+func parseUploadTarget(s string) (uploadTarget, error) {
+	u, err := url.Parse(s)
+	if err != nil {
+		return uploadTarget{}, fmt.Errorf("invalid upload destination %q: %w", s, err)
+	}
+	if u.Scheme != "sftp" || u.Hostname() == "" {
+		return uploadTarget{}, fmt.Errorf("invalid upload destination %q: expected sftp://[user@]host[:port]/path", s)
+	}
+
+	target := uploadTarget{Host: u.Hostname(), Port: u.Port(), Dir: u.Path}
+	if u.User != nil {
+		target.User = u.User.Username()
+	}
+	if target.Dir == "/~" || strings.HasPrefix(target.Dir, "/~/") {
+		target.Dir = strings.TrimPrefix(strings.TrimPrefix(target.Dir, "/~"), "/")
+	}
+	return target, nil
+}
+
+// location returns the URL of file once uploaded
+func (t uploadTarget) location(file string) string {
+	dir := t.Dir
+	if !path.IsAbs(dir) {
+		dir = path.Join("/~", dir)
+	}
+	host := t.Host
+	if t.User != "" {
+		host = t.User + "@" + host
+	}
+	if t.Port != "" {
+		host += ":" + t.Port
+	}
+	// Unescaped, it's read by people rather than parsed
+	return "sftp://" + host + path.Join(dir, file)
+}
+
+// upload copies the local file into the remote folder, keeping its times
+func (t uploadTarget) upload(ctx context.Context, file string) error {
+	args := []string{"-b", "-", "-o", "BatchMode=yes"}
+	if t.Port != "" {
+		args = append(args, "-P", t.Port)
+	}
+	if t.User != "" {
+		args = append(args, t.User+"@"+t.Host)
+	} else {
+		args = append(args, t.Host)
+	}
+
+	remote := path.Join(t.Dir, filepath.Base(file))
+	cmd := exec.CommandContext(ctx, sftpBinary, args...)
+	cmd.Stdin = strings.NewReader(fmt.Sprintf("put -p %s %s\n", sftpQuote(file), sftpQuote(remote)))
+	tail := proc.NewTail(3)
+	cmd.Stdout = tail
+	cmd.Stderr = tail
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("failed to upload %s: %w: %s", file, err, tail.String())
+	}
+	return nil
+}
+
+// sftpQuote quotes s for an sftp batch file
+func sftpQuote(s string) string {
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(s) + `"`
+}
+
+// outputLocation returns where an output is kept after the job, which is the
+// upload destination when the local copy is deleted
+func outputLocation(args cliArgs, savePath string) string {
+	if args.Upload == "" || !args.UploadDelete {
+		return savePath
+	}
+	target, _ := parseUploadTarget(args.Upload)
+	return target.location(filepath.Base(savePath))
+}
+
+// uploadOutput uploads an output to the --upload destination, deleting the
+// local copy with --upload-delete
+func uploadOutput(ctx context.Context, args cliArgs, savePath string) error {
+	if args.Upload == "" {
+		return nil
+	}
+	target, err := parseUploadTarget(args.Upload)
+	if err != nil {
+		return err
+	}
+
+	log.Ctx(ctx).Info().Str("file", savePath).Str("destination", args.Upload).Msg("uploading output")
+	if err := retryNetwork(ctx, args, "upload", func() error { return target.upload(ctx, savePath) }); err != nil {
+		return err
+	}
+	if !args.UploadDelete {
+		return nil
+	}
+
+	if err := os.Remove(savePath); err != nil {
+		return fmt.Errorf("failed to delete uploaded output: %w", err)
+	}
+	log.Ctx(ctx).Info().Str("file", savePath).Msg("deleted local copy of the upload")
+	return nil
+}
@@ -0,0 +1,141 @@
+package main
+
+import (
+	"cmp"
+	"context"
+	"math"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog/log"
+
+	"encz/ffmpeg"
+	"encz/proc"
+	"encz/progress"
+)
+
+// usageInterval is how often --usage samples the encoder. nvidia-smi takes a
+// moment to answer, so it isn't run for every progress update.
+const usageInterval = 2 * time.Second
+
+// usageMonitor samples the resource usage of the encoder processes while they run
+type usageMonitor struct {
+	mu     sync.Mutex
+	last   *progress.Usage
+	cancel context.CancelFunc
+	done   chan struct{}
+
+	// samples, cpu and gpu sum the samples for the averages, gpuSamples
+	// counts the samples with a GPU utilization
+	samples    int
+	cpu        float64
+	gpu        float64
+	gpuSamples int
+	peakMB     float64
+}
+
+// startUsageMonitor starts sampling the usage of the encoder with --usage,
+// returning nil otherwise. The GPU is sampled for NVENC encoders.
+func startUsageMonitor(ctx context.Context, args cliArgs) *usageMonitor {
+	if !args.Usage {
+		return nil
+	}
+	gpu := ""
+	if args.isNVENC() {
+		// NVENC encodes on the first GPU unless told otherwise
+		gpu = cmp.Or(args.GPU, "0")
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	m := &usageMonitor{cancel: cancel, done: make(chan struct{})}
+	go m.run(ctx, gpu)
+	return m
+}
+
+// run samples the usage until ctx is done
+func (m *usageMonitor) run(ctx context.Context, gpu string) {
+	defer close(m.done)
+	var sampler proc.Sampler
+	ticker := time.NewTicker(usageInterval)
+	defer ticker.Stop()
+
+	for {
+		if usage, ok := sampler.Sample(); ok {
+			m.record(progress.Usage{
+				CPU:      usage.CPUPercent,
+				MemoryMB: float64(usage.RSS) / 1024 / 1024,
+				GPU:      encoderUtilization(ctx, gpu),
+			})
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// encoderUtilization returns how busy the encoder of the NVIDIA GPU is, or -1
+func encoderUtilization(ctx context.Context, device string) float64 {
+	if device == "" {
+		return -1
+	}
+	gpus, err := ffmpeg.NvidiaGPUs(ctx)
+	if err != nil {
+		return -1
+	}
+	for _, gpu := range gpus {
+		if gpu.Device == device {
+			return float64(gpu.EncoderUtilization)
+		}
+	}
+	return -1
+}
+
+// record keeps a sample as the latest and in the averages
+func (m *usageMonitor) record(usage progress.Usage) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.last = &usage
+	m.samples++
+	m.cpu += usage.CPU
+	m.peakMB = max(m.peakMB, usage.MemoryMB)
+	if usage.GPU >= 0 {
+		m.gpu += usage.GPU
+		m.gpuSamples++
+	}
+}
+
+// latest returns the last sample, nil before the first one or without --usage
+func (m *usageMonitor) latest() *progress.Usage {
+	if m == nil {
+		return nil
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.last
+}
+
+// stop stops sampling and logs the average usage of the encode
+func (m *usageMonitor) stop(ctx context.Context) {
+	if m == nil {
+		return
+	}
+	m.cancel()
+	<-m.done
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.samples == 0 {
+		return
+	}
+	event := log.Ctx(ctx).Info().
+		Float64("avg_cpu_percent", math.Round(m.cpu/float64(m.samples))).
+		Float64("peak_memory_mb", math.Round(m.peakMB))
+	if m.gpuSamples > 0 {
+		event = event.Float64("avg_gpu_encoder_percent", math.Round(m.gpu/float64(m.gpuSamples)))
+	}
+	event.Msg("encoder resource usage")
+}
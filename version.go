@@ -1,10 +1,82 @@
 package main
 
-import "fmt"
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"runtime"
+	"runtime/debug"
+	"time"
+
+	"encz/ffmpeg"
+	"encz/handbrake"
+)
 
 var gitTag string = "dev"
 var gitCommit string = "unknown"
+var buildDate string = "unknown"
 
 var version string = func() string {
 	return fmt.Sprintf("%s-%s", gitTag, gitCommit)
 }()
+
+// toolVersionTimeout bounds asking the external tools for their versions
+const toolVersionTimeout = 5 * time.Second
+
+func init() {
+	// Builds without ldflags still know their commit from the VCS stamp
+	info, ok := debug.ReadBuildInfo()
+	if !ok {
+		return
+	}
+	for _, setting := range info.Settings {
+		switch setting.Key {
+		case "vcs.revision":
+			if gitCommit == "unknown" && len(setting.Value) >= 7 {
+				gitCommit = setting.Value[:7]
+				version = fmt.Sprintf("%s-%s", gitTag, gitCommit)
+			}
+		case "vcs.time":
+			if buildDate == "unknown" {
+				buildDate = setting.Value
+			}
+		}
+	}
+}
+
+// versionMain implements `encz version`
+func versionMain(arguments []string) {
+	fs := flag.NewFlagSet("version", flag.ExitOnError)
+	parseArgs(fs, arguments)
+	printVersion(os.Stdout)
+}
+
+// printVersion writes the build info and the versions of the external tools
+func printVersion(w io.Writer) {
+	ctx, cancel := context.WithTimeout(context.Background(), toolVersionTimeout)
+	defer cancel()
+
+	fmt.Fprintf(w, "encz %s\n", version)
+	fmt.Fprintf(w, "  tag:        %s\n", gitTag)
+	fmt.Fprintf(w, "  commit:     %s\n", gitCommit)
+	fmt.Fprintf(w, "  built:      %s\n", buildDate)
+	fmt.Fprintf(w, "  go:         %s %s/%s\n", runtime.Version(), runtime.GOOS, runtime.GOARCH)
+
+	tools := []struct {
+		name    string
+		version func(context.Context) (string, error)
+	}{
+		{"ffmpeg", ffmpeg.Version},
+		{"ffprobe", ffmpeg.ProbeVersion},
+		{"handbrake", handbrake.Version},
+	}
+	for _, tool := range tools {
+		v, err := tool.version(ctx)
+		if err != nil {
+			v = "not found"
+		}
+		fmt.Fprintf(w, "  %-11s %s\n", tool.name+":", v)
+	}
+}
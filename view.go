@@ -0,0 +1,38 @@
+package main
+
+import (
+	"context"
+	"os"
+
+	"encz/progress"
+)
+
+// progressView displays the progress of encodes
+type progressView interface {
+	Update(s progress.Status)
+	Remove(label string)
+	Finish()
+}
+
+type progressViewKey struct{}
+
+// withProgressView returns a context whose encodes report progress to view
+func withProgressView(ctx context.Context, view progressView) context.Context {
+	return context.WithValue(ctx, progressViewKey{}, view)
+}
+
+// progressViewFrom returns the progress view of ctx, defaulting to progress
+// bars on stdout. Its statuses are also kept for SIGUSR1.
+func progressViewFrom(ctx context.Context) progressView {
+	if view, ok := ctx.Value(progressViewKey{}).(progressView); ok {
+		return trackedView{view}
+	}
+	return trackedView{progress.New(os.Stdout)}
+}
+
+// discardView hides progress, for unattended runs
+type discardView struct{}
+
+func (discardView) Update(progress.Status) {}
+func (discardView) Remove(string)          {}
+func (discardView) Finish()                {}
@@ -0,0 +1,73 @@
+// Package ytdlp fetches videos from sites ffmpeg can't read directly
+package ytdlp
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"github.com/rs/zerolog/log"
+
+	"encz/proc"
+)
+
+// Binary is the yt-dlp executable
+var Binary = "yt-dlp"
+
+// format selects the best video and audio streams, or the best single file
+// when the site doesn't serve them separately
+const format = "bv*+ba/b"
+
+// Fetch downloads the best source of url into dir and returns its path. The
+// file is named after the title of the video, sanitized by yt-dlp for the system.
+func Fetch(ctx context.Context, url, dir string, logOutput io.Writer) (string, error) {
+	args := []string{
+		"--no-playlist",
+		"--no-progress",
+		"--no-simulate",
+		"--format", format,
+		"--merge-output-format", "mkv",
+		"--output", filepath.Join(dir, "%(title)s.%(ext)s"),
+		"--print", "after_move:filepath",
+		url,
+	}
+	log.Ctx(ctx).Debug().Strs("args", args).Msg("starting yt-dlp")
+
+	cmd := exec.CommandContext(ctx, Binary, args...)
+	var stdout bytes.Buffer
+	tail := proc.NewTail(3)
+	cmd.Stdout = &stdout
+	cmd.Stderr = tail
+	if logOutput != nil {
+		cmd.Stderr = io.MultiWriter(tail, logOutput)
+	}
+
+	if err := cmd.Start(); err != nil {
+		return "", fmt.Errorf("failed to start yt-dlp: %w", err)
+	}
+	defer proc.Track(cmd)()
+
+	if err := cmd.Wait(); err != nil {
+		return "", fmt.Errorf("failed to fetch %s: %w: %s", url, err, tail.String())
+	}
+
+	lines := strings.Split(strings.TrimSpace(stdout.String()), "\n")
+	path := strings.TrimSpace(lines[len(lines)-1])
+	if path == "" {
+		return "", fmt.Errorf("yt-dlp did not report the downloaded file of %s", url)
+	}
+	return path, nil
+}
+
+// Version returns the version of yt-dlp
+func Version(ctx context.Context) (string, error) {
+	output, err := exec.CommandContext(ctx, Binary, "--version").Output()
+	if err != nil {
+		return "", fmt.Errorf("failed to get yt-dlp version: %w", err)
+	}
+	return "yt-dlp " + strings.TrimSpace(string(output)), nil
+}